@@ -1,9 +1,16 @@
 package ast
 
-import "github.com/perigrin/simian/token"
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/perigrin/simian/token"
+)
 
 type Node interface {
 	TokenLiteral() string
+	String() string
 }
 
 type Statement interface {
@@ -28,15 +35,131 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) String() string {
+	var out bytes.Buffer
+	writeStatements(&out, p.Statements, "\n")
+	return out.String()
+}
+
+// writeStatements writes statements separated by sep, with a semicolon
+// after each one that does not end in a block.
+func writeStatements(out *bytes.Buffer, statements []Statement, sep string) {
+	for i, s := range statements {
+		if i > 0 {
+			if !endsWithBlock(statements[i-1]) {
+				out.WriteString(";")
+			}
+			out.WriteString(sep)
+		}
+		out.WriteString(s.String())
+	}
+}
+
+func endsWithBlock(s Statement) bool {
+	switch s := s.(type) {
+	case *BlockStatement, *PhaseBlock:
+		return true
+	case *PackageStatement:
+		return s.Body != nil
+	case *SubStatement:
+		return s.Body != nil
+	case *MethodStatement:
+		return s.Body != nil
+	case *ClassStatement:
+		return s.Body != nil
+	case *IfStatement, *WhileStatement, *ForStatement, *ForeachStatement:
+		return true
+	case *LabeledStatement:
+		return endsWithBlock(s.Statement)
+	}
+	return false
+}
+
+// isWord reports whether op is a named operator such as not or defined,
+// which needs a space before its operand.
+func isWord(op string) bool {
+	return op != "" && (op[0] == '_' || 'a' <= op[0] && op[0] <= 'z' || 'A' <= op[0] && op[0] <= 'Z')
+}
+
+// stringOf returns the String of n, or nothing for a nil operand that
+// error recovery left in a partial tree.
+func stringOf(n Node) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
+
+// joinExpressions writes the String of each expression separated by
+// commas, keeping the fat comma after a bareword perl quotes, as in
+// (a => 1), which a plain comma would turn into a call of a.
+func joinExpressions(out *bytes.Buffer, list []Expression) {
+	for i, e := range list {
+		if i > 0 {
+			if s, ok := list[i-1].(*StringLiteral); ok && s.Token.Type != token.STRING {
+				out.WriteString(" => ")
+			} else {
+				out.WriteString(", ")
+			}
+		}
+		out.WriteString(stringOf(e))
+	}
+}
+
+// writeSubscript writes index between open and close. The list of a
+// slice is written without its parentheses, which the brackets replace.
+func writeSubscript(out *bytes.Buffer, open, close string, index Expression) {
+	out.WriteString(open)
+	if list, ok := index.(*ListLiteral); ok && list.Token.Type != token.LPAREN {
+		joinExpressions(out, list.Elements)
+	} else {
+		out.WriteString(stringOf(index))
+	}
+	out.WriteString(close)
+}
+
+// writeAttributes writes each attribute preceded by a space.
+func writeAttributes(out *bytes.Buffer, attributes []*Attribute) {
+	for _, a := range attributes {
+		out.WriteString(" ")
+		out.WriteString(a.String())
+	}
+}
+
+// writeVersion writes a space and the version, if there is one.
+func writeVersion(out *bytes.Buffer, v *VersionLiteral) {
+	if v != nil {
+		out.WriteString(" ")
+		out.WriteString(v.String())
+	}
+}
+
+// MyStatement declares a single variable with my, our or state. Lists
+// and declarations inside expressions are Declarations.
 type MyStatement struct {
-	Token token.Token // "LET"
-	Name  *Identifier
+	Token token.Token // "my", "our" or "state"
+	Type  *TypeName   // nil when there is no annotation
+	Name  *Variable
 	Value Expression
 }
 
 func (ls *MyStatement) statementNode()       {}
 func (ls *MyStatement) TokenLiteral() string { return string(ls.Token.Literal) }
 
+func (ls *MyStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ls.TokenLiteral() + " ")
+	writeType(&out, ls.Type)
+	out.WriteString(ls.Name.String())
+	if ls.Value != nil {
+		out.WriteString(" = ")
+		out.WriteString(ls.Value.String())
+	}
+	return out.String()
+}
+
+// Identifier is a bareword: the name of a sub, method, package or class,
+// or a builtin such as print. Variables are Variable nodes.
 type Identifier struct {
 	Token token.Token // "IDENT"
 	Value string
@@ -45,36 +168,999 @@ type Identifier struct {
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return string(i.Token.Literal) }
 
+func (i *Identifier) String() string {
+	return i.Value
+}
+
+// Sigil says what kind of value a variable names.
+type Sigil int
+
+const (
+	ScalarSigil    Sigil = iota // $
+	ArraySigil                  // @
+	HashSigil                   // %
+	CodeSigil                   // &
+	GlobSigil                   // *
+	LastIndexSigil              // $#, the last index of an array
+)
+
+var sigils = [...]string{
+	ScalarSigil:    "$",
+	ArraySigil:     "@",
+	HashSigil:      "%",
+	CodeSigil:      "&",
+	GlobSigil:      "*",
+	LastIndexSigil: "$#",
+}
+
+func (s Sigil) String() string {
+	if s < 0 || int(s) >= len(sigils) {
+		return "Sigil(" + strconv.Itoa(int(s)) + ")"
+	}
+	return sigils[s]
+}
+
+// LookupSigil returns the sigil spelt lit: "$", "@", "%", "&", "*" or
+// "$#".
+func LookupSigil(lit string) (Sigil, bool) {
+	for s, spelling := range sigils {
+		if lit == spelling {
+			return Sigil(s), true
+		}
+	}
+	return 0, false
+}
+
+// Variable is a variable such as $x, @list, %Foo::opts, &code, *STDOUT
+// or $#list. Name is written without the sigil. It is empty for a lone
+// sigil, as in a signature placeholder. The short dereference forms
+// such as @$ref are a Dereference, not a Variable.
+type Variable struct {
+	Token token.Token
+	Sigil Sigil
+	Name  string
+}
+
+func (v *Variable) expressionNode()      {}
+func (v *Variable) TokenLiteral() string { return string(v.Token.Literal) }
+
+func (v *Variable) String() string {
+	return v.Sigil.String() + v.Name
+}
+
+// IntegerLiteral is a whole number that fits in an int64. Octal
+// literals such as 0755 are converted; larger numbers are
+// NumberLiterals, as in perl.
 type IntegerLiteral struct {
 	Token token.Token
-	Value string
+	Value int64
 }
 
 func (i *IntegerLiteral) expressionNode()      {}
 func (i *IntegerLiteral) TokenLiteral() string { return string(i.Token.Literal) }
 
-type TokenNode struct {
+func (i *IntegerLiteral) String() string {
+	return i.TokenLiteral()
+}
+
+// NumberLiteral is a number with a fractional part, or a whole number
+// too large for an IntegerLiteral.
+type NumberLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (n *NumberLiteral) expressionNode()      {}
+func (n *NumberLiteral) TokenLiteral() string { return string(n.Token.Literal) }
+
+func (n *NumberLiteral) String() string {
+	return n.TokenLiteral()
+}
+
+// BooleanLiteral is true or false.
+type BooleanLiteral struct {
+	Token token.Token
+	Value bool
+}
+
+func (b *BooleanLiteral) expressionNode()      {}
+func (b *BooleanLiteral) TokenLiteral() string { return string(b.Token.Literal) }
+
+func (b *BooleanLiteral) String() string {
+	return strconv.FormatBool(b.Value)
+}
+
+// Undef is the undefined value, a bare undef. undef with an operand
+// is a call, like the other named unary operators.
+type Undef struct {
+	Token token.Token // "undef"
+}
+
+func (u *Undef) expressionNode()      {}
+func (u *Undef) TokenLiteral() string { return string(u.Token.Literal) }
+
+func (u *Undef) String() string {
+	return "undef"
+}
+
+// StringLiteral is a single or double quoted string, or its q() / qq()
+// equivalent. Value holds the contents with the delimiters removed and
+// escapes decoded, unless the string interpolates.
+// Barewords perl treats as strings, such as hash keys in {key} and
+// before =>, are StringLiterals too, with the word as Token.
+type StringLiteral struct {
+	Token        token.Token
+	Value        string
+	Interpolated bool
+
+	// Parts holds the variables and elements the string interpolates,
+	// such as $name in "hello $name" or $h{key} in "$h{key}s", in order
+	Parts []Expression
+}
+
+func (s *StringLiteral) expressionNode()      {}
+func (s *StringLiteral) TokenLiteral() string { return string(s.Token.Literal) }
+
+func (s *StringLiteral) String() string {
+	return s.TokenLiteral()
+}
+
+// QuoteWords is a qw() word list.
+type QuoteWords struct {
+	Token token.Token
+	Words []string
+}
+
+func (q *QuoteWords) expressionNode()      {}
+func (q *QuoteWords) TokenLiteral() string { return string(q.Token.Literal) }
+
+func (q *QuoteWords) String() string {
+	return q.TokenLiteral()
+}
+
+// VersionLiteral is a version such as 5.036, 1.2.3 or v5.36.
+type VersionLiteral struct {
 	Token token.Token
+	Value string
 }
 
-func (t *TokenNode) expressionNode()      {}
-func (t *TokenNode) TokenLiteral() string { return string(t.Token.Literal) }
+func (v *VersionLiteral) expressionNode()      {}
+func (v *VersionLiteral) TokenLiteral() string { return string(v.Token.Literal) }
+
+func (v *VersionLiteral) String() string {
+	return v.TokenLiteral()
+}
+
+// ArrayLiteral is an anonymous array constructor, `[ ... ]`.
+type ArrayLiteral struct {
+	Token    token.Token // "["
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return string(al.Token.Literal) }
+
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+	out.WriteString("[")
+	joinExpressions(&out, al.Elements)
+	out.WriteString("]")
+	return out.String()
+}
+
+// HashLiteral is an anonymous hash constructor, `{ ... }`. Like perl, the
+// contents are kept as a flat list rather than key/value pairs, since any
+// element may itself expand to several.
+type HashLiteral struct {
+	Token    token.Token // "{"
+	Elements []Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return string(hl.Token.Literal) }
+
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+	out.WriteString("{")
+	joinExpressions(&out, hl.Elements)
+	out.WriteString("}")
+	return out.String()
+}
+
+// ListLiteral is a comma separated list, usually parenthesised: `(1, 2)`
+// or the empty list `()`.
+type ListLiteral struct {
+	Token    token.Token // "(", or the token introducing an unparenthesised list
+	Elements []Expression
+}
+
+func (ll *ListLiteral) expressionNode()      {}
+func (ll *ListLiteral) TokenLiteral() string { return string(ll.Token.Literal) }
+
+func (ll *ListLiteral) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	joinExpressions(&out, ll.Elements)
+	out.WriteString(")")
+	return out.String()
+}
 
-func TokenToAstNode(t token.Token) Node {
-	switch t.Type {
-	case token.IDENTIFIER:
-		return &Identifier{
-			Token: t,
-			Value: string(t.Literal),
+type PrefixExpression struct {
+	Token    token.Token // the prefix operator
+	Operator string
+	Right    Expression
+}
+
+func (pe *PrefixExpression) expressionNode()      {}
+func (pe *PrefixExpression) TokenLiteral() string { return string(pe.Token.Literal) }
+
+func (pe *PrefixExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(pe.Operator)
+	if isWord(pe.Operator) {
+		out.WriteString(" ")
+	}
+	out.WriteString(stringOf(pe.Right))
+	out.WriteString(")")
+	return out.String()
+}
+
+type InfixExpression struct {
+	Token    token.Token // the operator
+	Left     Expression
+	Operator string
+	Right    Expression
+}
+
+func (ie *InfixExpression) expressionNode()      {}
+func (ie *InfixExpression) TokenLiteral() string { return string(ie.Token.Literal) }
+
+func (ie *InfixExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(stringOf(ie.Left))
+	out.WriteString(" " + ie.Operator + " ")
+	out.WriteString(stringOf(ie.Right))
+	out.WriteString(")")
+	return out.String()
+}
+
+type ConditionalExpression struct {
+	Token       token.Token // "?"
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (ce *ConditionalExpression) expressionNode()      {}
+func (ce *ConditionalExpression) TokenLiteral() string { return string(ce.Token.Literal) }
+
+func (ce *ConditionalExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(stringOf(ce.Condition))
+	out.WriteString(" ? ")
+	out.WriteString(stringOf(ce.Consequence))
+	out.WriteString(" : ")
+	out.WriteString(stringOf(ce.Alternative))
+	out.WriteString(")")
+	return out.String()
+}
+
+type PostfixExpression struct {
+	Token    token.Token // "++" or "--"
+	Left     Expression
+	Operator string
+}
+
+func (pe *PostfixExpression) expressionNode()      {}
+func (pe *PostfixExpression) TokenLiteral() string { return string(pe.Token.Literal) }
+
+func (pe *PostfixExpression) String() string {
+	return "(" + stringOf(pe.Left) + pe.Operator + ")"
+}
+
+// CallExpression is a call to a named sub, `foo(...)` or `&foo(...)`, or
+// to a code reference, `$code->(...)`, in which case Arrow is set. List
+// operators such as `map BLOCK LIST` keep their leading block in Block.
+type CallExpression struct {
+	Token     token.Token // "(", "->" or the function name
+	Function  Expression
+	Block     *BlockStatement
+	Arguments []Expression
+	Arrow     bool
+}
+
+func (ce *CallExpression) expressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return string(ce.Token.Literal) }
+
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString(stringOf(ce.Function))
+	switch {
+	case ce.Arrow:
+		out.WriteString("->(")
+		joinExpressions(&out, ce.Arguments)
+		out.WriteString(")")
+	case ce.Token.Type == token.LPAREN:
+		out.WriteString("(")
+		joinExpressions(&out, ce.Arguments)
+		out.WriteString(")")
+	default:
+		// a list operator called without parentheses
+		if ce.Block != nil {
+			out.WriteString(" ")
+			out.WriteString(ce.Block.String())
 		}
-	case token.DIGIT:
-		// Assuming you have an IntegerLiteral type
-		return &IntegerLiteral{
-			Token: t,
-			Value: string(t.Literal),
+		if len(ce.Arguments) > 0 {
+			out.WriteString(" ")
+			joinExpressions(&out, ce.Arguments)
 		}
+	}
+	return out.String()
+}
+
+// MethodCall is `INVOCANT->method(...)`. The invocant is an expression or
+// a bareword class name. Method is a bareword Identifier for ordinary
+// calls and a scalar variable for indirect calls such as `$obj->$name()`.
+// Arguments is nil when the call has no parentheses. The indirect object
+// syntax `new Class(...)` gives the same node as `Class->new(...)`.
+type MethodCall struct {
+	Token     token.Token // "->", or the method of `new Class`
+	Invocant  Expression
+	Method    *Identifier
+	Arguments []Expression
+}
+
+func (mc *MethodCall) expressionNode()      {}
+func (mc *MethodCall) TokenLiteral() string { return string(mc.Token.Literal) }
+
+func (mc *MethodCall) String() string {
+	var out bytes.Buffer
+	out.WriteString(stringOf(mc.Invocant))
+	out.WriteString("->")
+	out.WriteString(mc.Method.String())
+	if mc.Arguments != nil {
+		out.WriteString("(")
+		joinExpressions(&out, mc.Arguments)
+		out.WriteString(")")
+	}
+	return out.String()
+}
+
+// Indirect reports whether the method name is taken from a variable.
+func (mc *MethodCall) Indirect() bool {
+	return strings.HasPrefix(mc.Method.Value, "$")
+}
+
+// Index is an array element `[...]` or hash element `{...}` subscript,
+// either directly on a variable (`$x[0]`) or through a reference
+// (`$x->[0]`), in which case Arrow is set. The subscript of a slice
+// with several elements, as in `@x[0, 1]`, is a ListLiteral.
+type Index struct {
+	Token token.Token // "[" or "{"
+	Left  Expression
+	Index Expression
+	Arrow bool
+}
+
+func (ix *Index) expressionNode()      {}
+func (ix *Index) TokenLiteral() string { return string(ix.Token.Literal) }
+
+func (ix *Index) String() string {
+	var out bytes.Buffer
+	out.WriteString(stringOf(ix.Left))
+	if ix.Arrow {
+		out.WriteString("->")
+	}
+	open, close := "[", "]"
+	if ix.IsHash() {
+		open, close = "{", "}"
+	}
+	writeSubscript(&out, open, close, ix.Index)
+	return out.String()
+}
+
+// IsHash reports whether this is a hash subscript.
+func (ix *Index) IsHash() bool { return ix.Token.Type == token.LBRACE }
+
+// Dereference is a sigil applied to a block: @{$ref}, %{ $self->{h} }
+// or ${"name"}, or to a scalar variable in the short forms @$ref and
+// $$ref, which are the same as @{$ref} and ${$ref}. Dereferencing a
+// string is a symbolic reference.
+type Dereference struct {
+	Token token.Token // the sigil
+	Sigil Sigil
+	Value Expression
+}
+
+func (d *Dereference) expressionNode()      {}
+func (d *Dereference) TokenLiteral() string { return string(d.Token.Literal) }
+
+func (d *Dereference) String() string {
+	return d.Sigil.String() + "{" + stringOf(d.Value) + "}"
+}
+
+// PostfixDeref is a whole-value postfix dereference: `->$*`, `->@*`,
+// `->%*`, `->&*`, `->**` or `->$#*`.
+type PostfixDeref struct {
+	Token token.Token // the deref token, e.g. "@*"
+	Left  Expression
+	Sigil Sigil // the sigil before the *, GlobSigil for ->**
+}
+
+func (pd *PostfixDeref) expressionNode()      {}
+func (pd *PostfixDeref) TokenLiteral() string { return string(pd.Token.Literal) }
+
+func (pd *PostfixDeref) String() string {
+	return stringOf(pd.Left) + "->" + pd.TokenLiteral()
+}
+
+// PostfixSlice is a postfix slice: `->@[...]`, `->@{...}`, `->%[...]`
+// or `->%{...}`. Like an Index, several elements are a ListLiteral.
+type PostfixSlice struct {
+	Token   token.Token // "@" or "%"
+	Left    Expression
+	Sigil   Sigil       // ArraySigil or HashSigil
+	Bracket token.Token // "[" or "{"
+	Index   Expression
+}
+
+func (ps *PostfixSlice) expressionNode()      {}
+func (ps *PostfixSlice) TokenLiteral() string { return string(ps.Token.Literal) }
+
+func (ps *PostfixSlice) String() string {
+	var out bytes.Buffer
+	out.WriteString(stringOf(ps.Left))
+	out.WriteString("->" + ps.Sigil.String())
+	open, close := "[", "]"
+	if ps.Bracket.Type == token.LBRACE {
+		open, close = "{", "}"
+	}
+	writeSubscript(&out, open, close, ps.Index)
+	return out.String()
+}
+
+type ExpressionStatement struct {
+	Token      token.Token // the first token of the expression
+	Expression Expression
+}
+
+func (es *ExpressionStatement) statementNode()       {}
+func (es *ExpressionStatement) TokenLiteral() string { return string(es.Token.Literal) }
+
+func (es *ExpressionStatement) String() string {
+	if es.Expression != nil {
+		return es.Expression.String()
+	}
+	return ""
+}
+
+type ReturnStatement struct {
+	Token       token.Token // "return"
+	ReturnValue Expression
+}
+
+func (rs *ReturnStatement) statementNode()       {}
+func (rs *ReturnStatement) TokenLiteral() string { return string(rs.Token.Literal) }
+
+func (rs *ReturnStatement) String() string {
+	if rs.ReturnValue != nil {
+		return rs.TokenLiteral() + " " + rs.ReturnValue.String()
+	}
+	return rs.TokenLiteral()
+}
+
+type BlockStatement struct {
+	Token      token.Token // "{"
+	Statements []Statement
+}
+
+func (bs *BlockStatement) statementNode()       {}
+func (bs *BlockStatement) TokenLiteral() string { return string(bs.Token.Literal) }
+
+func (bs *BlockStatement) String() string {
+	if len(bs.Statements) == 0 {
+		return "{}"
+	}
+	var out bytes.Buffer
+	out.WriteString("{ ")
+	writeStatements(&out, bs.Statements, " ")
+	out.WriteString(" }")
+	return out.String()
+}
+
+// Declaration is my, our or state used as an expression, as in
+// `my ($a, $b) = @_` or `while (my $line = shift @lines)`. Parens
+// records whether the variables were parenthesised, which makes an
+// assignment to them a list assignment even for one variable.
+type Declaration struct {
+	Token     token.Token // "my", "our" or "state"
+	Type      *TypeName   // nil when there is no annotation
+	Variables []*Variable
+	Parens    bool
+}
+
+func (d *Declaration) expressionNode()      {}
+func (d *Declaration) TokenLiteral() string { return string(d.Token.Literal) }
+
+func (d *Declaration) String() string {
+	var out bytes.Buffer
+	out.WriteString(d.TokenLiteral() + " ")
+	writeType(&out, d.Type)
+	if !d.Parens {
+		out.WriteString(d.Variables[0].String())
+		return out.String()
+	}
+	names := make([]string, len(d.Variables))
+	for i, v := range d.Variables {
+		names[i] = v.String()
+	}
+	out.WriteString("(" + strings.Join(names, ", ") + ")")
+	return out.String()
+}
+
+// IfStatement is an if or unless statement. Alternative is the else
+// block, or another IfStatement for an elsif.
+type IfStatement struct {
+	Token       token.Token // "if", "unless" or "elsif"
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative Statement
+}
+
+func (is *IfStatement) statementNode()       {}
+func (is *IfStatement) TokenLiteral() string { return string(is.Token.Literal) }
+
+func (is *IfStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(is.TokenLiteral() + " (" + stringOf(is.Condition) + ") ")
+	out.WriteString(is.Consequence.String())
+	switch alt := is.Alternative.(type) {
+	case *BlockStatement:
+		out.WriteString(" else " + alt.String())
+	case *IfStatement:
+		out.WriteString(" " + alt.String())
+	}
+	return out.String()
+}
+
+// WhileStatement is a while or until loop. Condition is nil for the
+// endless `while ()`.
+type WhileStatement struct {
+	Token     token.Token // "while" or "until"
+	Condition Expression
+	Body      *BlockStatement
+	Continue  *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return string(ws.Token.Literal) }
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ws.TokenLiteral() + " (")
+	if ws.Condition != nil {
+		out.WriteString(ws.Condition.String())
+	}
+	out.WriteString(") " + ws.Body.String())
+	writeContinue(&out, ws.Continue)
+	return out.String()
+}
+
+// ForStatement is the C-style `for (INIT; CONDITION; STEP) BLOCK`. Any
+// of the three expressions may be nil.
+type ForStatement struct {
+	Token     token.Token // "for" or "foreach"
+	Init      Expression
+	Condition Expression
+	Step      Expression
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return string(fs.Token.Literal) }
+
+func (fs *ForStatement) String() string {
+	parts := make([]string, 3)
+	for i, e := range []Expression{fs.Init, fs.Condition, fs.Step} {
+		if e != nil {
+			parts[i] = e.String()
+		}
+	}
+	return fs.TokenLiteral() + " (" + strings.Join(parts, "; ") + ") " + fs.Body.String()
+}
+
+// ForeachStatement is a loop over a list. Variable is the iterator: a
+// Declaration for `foreach my $x`, a Variable for `foreach $x`, or nil
+// when the loop uses $_.
+type ForeachStatement struct {
+	Token    token.Token // "for" or "foreach"
+	Variable Expression
+	List     Expression
+	Body     *BlockStatement
+	Continue *BlockStatement
+}
+
+func (fs *ForeachStatement) statementNode()       {}
+func (fs *ForeachStatement) TokenLiteral() string { return string(fs.Token.Literal) }
+
+func (fs *ForeachStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(fs.TokenLiteral() + " ")
+	if fs.Variable != nil {
+		out.WriteString(fs.Variable.String() + " ")
+	}
+	switch list := fs.List.(type) {
+	case nil:
+		out.WriteString("()")
+	case *ListLiteral:
+		out.WriteString(list.String())
 	default:
-		// For other token types, create a generic node or handle as needed
-		return &TokenNode{Token: t}
+		out.WriteString("(" + list.String() + ")")
+	}
+	out.WriteString(" " + fs.Body.String())
+	writeContinue(&out, fs.Continue)
+	return out.String()
+}
+
+// writeContinue writes a loop's continue block, if there is one.
+func writeContinue(out *bytes.Buffer, b *BlockStatement) {
+	if b != nil {
+		out.WriteString(" continue " + b.String())
+	}
+}
+
+// LabeledStatement is a statement, usually a loop, with a label such as
+// OUTER: that next, last and redo can name.
+type LabeledStatement struct {
+	Token     token.Token // the label, colon included
+	Label     string
+	Statement Statement
+}
+
+func (ls *LabeledStatement) statementNode()       {}
+func (ls *LabeledStatement) TokenLiteral() string { return string(ls.Token.Literal) }
+
+func (ls *LabeledStatement) String() string {
+	return ls.Label + ": " + stringOf(ls.Statement)
+}
+
+// LoopControlStatement is next, last or redo, which go on to the next
+// iteration of a loop, leave it or run its body again. Label names the
+// loop; it is nil for the innermost one.
+type LoopControlStatement struct {
+	Token token.Token // "next", "last" or "redo"
+	Label *Identifier
+}
+
+func (lc *LoopControlStatement) statementNode()       {}
+func (lc *LoopControlStatement) TokenLiteral() string { return string(lc.Token.Literal) }
+
+func (lc *LoopControlStatement) String() string {
+	if lc.Label != nil {
+		return lc.TokenLiteral() + " " + lc.Label.String()
+	}
+	return lc.TokenLiteral()
+}
+
+// ModifiedStatement is a simple statement with a modifier after it, as
+// in `print if $x` or `f($_) for @list`. Condition is the list a for or
+// foreach modifier loops over.
+type ModifiedStatement struct {
+	Token     token.Token // "if", "unless", "while", "until", "for" or "foreach"
+	Statement Statement
+	Condition Expression
+}
+
+func (ms *ModifiedStatement) statementNode()       {}
+func (ms *ModifiedStatement) TokenLiteral() string { return string(ms.Token.Literal) }
+
+func (ms *ModifiedStatement) String() string {
+	return stringOf(ms.Statement) + " " + ms.TokenLiteral() + " " + stringOf(ms.Condition)
+}
+
+// PackageDeclaration is `package NAME VERSION;`, which switches the
+// package for the rest of the enclosing block or file.
+type PackageDeclaration struct {
+	Token   token.Token // "package"
+	Name    *Identifier
+	Version *VersionLiteral
+}
+
+func (pd *PackageDeclaration) statementNode()       {}
+func (pd *PackageDeclaration) TokenLiteral() string { return string(pd.Token.Literal) }
+
+func (pd *PackageDeclaration) String() string {
+	var out bytes.Buffer
+	out.WriteString("package " + pd.Name.String())
+	writeVersion(&out, pd.Version)
+	return out.String()
+}
+
+// PackageStatement is `package NAME VERSION BLOCK`, scoped to its block.
+type PackageStatement struct {
+	Token   token.Token // "package"
+	Name    *Identifier
+	Version *VersionLiteral
+	Body    *BlockStatement
+}
+
+func (ps *PackageStatement) statementNode()       {}
+func (ps *PackageStatement) TokenLiteral() string { return string(ps.Token.Literal) }
+
+func (ps *PackageStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("package " + ps.Name.String())
+	writeVersion(&out, ps.Version)
+	out.WriteString(" " + ps.Body.String())
+	return out.String()
+}
+
+// UseStatement is `use MODULE VERSION LIST` or `use VERSION`. Module is
+// nil for the latter. Imports is nil when no list was given and empty for
+// an explicit `()`, which perl treats as "do not call import".
+type UseStatement struct {
+	Token   token.Token // "use"
+	Module  *Identifier
+	Version *VersionLiteral
+	Imports []Expression
+}
+
+func (us *UseStatement) statementNode()       {}
+func (us *UseStatement) TokenLiteral() string { return string(us.Token.Literal) }
+
+func (us *UseStatement) String() string {
+	return writeImport("use", us.Module, us.Version, us.Imports)
+}
+
+// writeImport renders a use or no statement.
+func writeImport(keyword string, module *Identifier, version *VersionLiteral, imports []Expression) string {
+	var out bytes.Buffer
+	out.WriteString(keyword)
+	if module != nil {
+		out.WriteString(" " + module.String())
+	}
+	writeVersion(&out, version)
+	switch {
+	case imports == nil:
+	case len(imports) == 0:
+		out.WriteString(" ()")
+	default:
+		out.WriteString(" ")
+		joinExpressions(&out, imports)
+	}
+	return out.String()
+}
+
+// NoStatement is `no MODULE VERSION LIST`, the unimport form of use.
+type NoStatement struct {
+	Token   token.Token // "no"
+	Module  *Identifier
+	Version *VersionLiteral
+	Imports []Expression
+}
+
+func (ns *NoStatement) statementNode()       {}
+func (ns *NoStatement) TokenLiteral() string { return string(ns.Token.Literal) }
+
+func (ns *NoStatement) String() string {
+	return writeImport("no", ns.Module, ns.Version, ns.Imports)
+}
+
+// RequireStatement loads a module by bareword name, checks the perl
+// version, or loads a file named by an arbitrary expression. Exactly one
+// of Module, Version and Value is set.
+type RequireStatement struct {
+	Token   token.Token // "require"
+	Module  *Identifier
+	Version *VersionLiteral
+	Value   Expression
+}
+
+func (rs *RequireStatement) statementNode()       {}
+func (rs *RequireStatement) TokenLiteral() string { return string(rs.Token.Literal) }
+
+func (rs *RequireStatement) String() string {
+	switch {
+	case rs.Module != nil:
+		return "require " + rs.Module.String()
+	case rs.Version != nil:
+		return "require " + rs.Version.String()
+	case rs.Value != nil:
+		return "require " + rs.Value.String()
+	}
+	return "require"
+}
+
+// PhaseBlock is a BEGIN, END, INIT, CHECK or UNITCHECK block, written
+// with or without a leading `sub`.
+type PhaseBlock struct {
+	Token token.Token // the phase name
+	Phase string
+	Body  *BlockStatement
+}
+
+func (pb *PhaseBlock) statementNode()       {}
+func (pb *PhaseBlock) TokenLiteral() string { return string(pb.Token.Literal) }
+
+func (pb *PhaseBlock) String() string {
+	return pb.Phase + " " + pb.Body.String()
+}
+
+// Attribute is a `:name` or `:name(args)` attribute on a sub, method,
+// class or field. Args holds the raw argument text.
+type Attribute struct {
+	Token token.Token
+	Name  string
+	Args  string
+}
+
+func (a *Attribute) TokenLiteral() string { return string(a.Token.Literal) }
+
+func (a *Attribute) String() string {
+	if a.Args != "" {
+		return ":" + a.Name + "(" + a.Args + ")"
+	}
+	return ":" + a.Name
+}
+
+type Parameter struct {
+	Type    *TypeName // nil when there is no annotation
+	Name    *Variable
+	Default Expression
+}
+
+func (p *Parameter) TokenLiteral() string { return p.Name.TokenLiteral() }
+
+func (p *Parameter) String() string {
+	var out bytes.Buffer
+	writeType(&out, p.Type)
+	out.WriteString(p.Name.String())
+	if p.Default != nil {
+		out.WriteString(" = " + p.Default.String())
+	}
+	return out.String()
+}
+
+// TypeName is a type annotation on a declaration, field or parameter,
+// such as the Int in `my Int $x` or `ArrayRef[Str]`. Perl itself only
+// allows a package name there.
+type TypeName struct {
+	Token token.Token // the name
+	Name  string
+	Args  []*TypeName
+}
+
+func (tn *TypeName) TokenLiteral() string { return string(tn.Token.Literal) }
+
+func (tn *TypeName) String() string {
+	if len(tn.Args) == 0 {
+		return tn.Name
+	}
+	args := make([]string, len(tn.Args))
+	for i, a := range tn.Args {
+		args[i] = a.String()
+	}
+	return tn.Name + "[" + strings.Join(args, ", ") + "]"
+}
+
+// writeType writes an annotation followed by a space, if there is one.
+func writeType(out *bytes.Buffer, t *TypeName) {
+	if t != nil {
+		out.WriteString(t.String() + " ")
+	}
+}
+
+type Signature struct {
+	Token      token.Token // "("
+	Parameters []*Parameter
+}
+
+func (s *Signature) TokenLiteral() string { return string(s.Token.Literal) }
+
+func (s *Signature) String() string {
+	params := make([]string, len(s.Parameters))
+	for i, p := range s.Parameters {
+		params[i] = p.String()
+	}
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+// writeSub renders a sub or method declaration.
+func writeSub(keyword string, name *Identifier, attributes []*Attribute, signature *Signature, body *BlockStatement) string {
+	var out bytes.Buffer
+	out.WriteString(keyword + " " + name.String())
+	writeAttributes(&out, attributes)
+	if signature != nil {
+		out.WriteString(" " + signature.String())
+	}
+	if body != nil {
+		out.WriteString(" " + body.String())
+	}
+	return out.String()
+}
+
+// SubStatement is a named sub. Body is nil for a forward declaration.
+type SubStatement struct {
+	Token      token.Token // "sub"
+	Name       *Identifier
+	Attributes []*Attribute
+	Signature  *Signature
+	Body       *BlockStatement
+}
+
+func (ss *SubStatement) statementNode()       {}
+func (ss *SubStatement) TokenLiteral() string { return string(ss.Token.Literal) }
+
+func (ss *SubStatement) String() string {
+	return writeSub("sub", ss.Name, ss.Attributes, ss.Signature, ss.Body)
+}
+
+type MethodStatement struct {
+	Token      token.Token // "method"
+	Name       *Identifier
+	Attributes []*Attribute
+	Signature  *Signature
+	Body       *BlockStatement
+}
+
+func (ms *MethodStatement) statementNode()       {}
+func (ms *MethodStatement) TokenLiteral() string { return string(ms.Token.Literal) }
+
+func (ms *MethodStatement) String() string {
+	return writeSub("method", ms.Name, ms.Attributes, ms.Signature, ms.Body)
+}
+
+// ClassStatement is a Corinna class, or a role, which is declared the
+// same way. Like packages, Body is nil for the `class NAME;` form which
+// applies to the rest of the file.
+type ClassStatement struct {
+	Token      token.Token // "class" or "role"
+	Name       *Identifier
+	Version    *VersionLiteral
+	Attributes []*Attribute
+	Body       *BlockStatement
+}
+
+func (cs *ClassStatement) statementNode()       {}
+func (cs *ClassStatement) TokenLiteral() string { return string(cs.Token.Literal) }
+
+// IsRole reports whether this is a role rather than a class.
+func (cs *ClassStatement) IsRole() bool { return cs.TokenLiteral() == "role" }
+
+func (cs *ClassStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(cs.TokenLiteral() + " " + cs.Name.String())
+	writeVersion(&out, cs.Version)
+	writeAttributes(&out, cs.Attributes)
+	if cs.Body != nil {
+		out.WriteString(" " + cs.Body.String())
+	}
+	return out.String()
+}
+
+type FieldStatement struct {
+	Token      token.Token // "field"
+	Type       *TypeName   // nil when there is no annotation
+	Name       *Variable
+	Attributes []*Attribute
+	Value      Expression
+}
+
+func (fs *FieldStatement) statementNode()       {}
+func (fs *FieldStatement) TokenLiteral() string { return string(fs.Token.Literal) }
+
+func (fs *FieldStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("field ")
+	writeType(&out, fs.Type)
+	out.WriteString(fs.Name.String())
+	writeAttributes(&out, fs.Attributes)
+	if fs.Value != nil {
+		out.WriteString(" = ")
+		out.WriteString(fs.Value.String())
 	}
+	return out.String()
 }
@@ -0,0 +1,112 @@
+package ast
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/perigrin/simian/token"
+)
+
+func TestString(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&MyStatement{
+				Token: token.Token{Type: token.MY, Literal: []byte("my")},
+				Name:  &Variable{Token: token.Token{Type: token.IDENTIFIER, Literal: []byte("$x")}, Sigil: ScalarSigil, Name: "x"},
+				Value: &Variable{Token: token.Token{Type: token.IDENTIFIER, Literal: []byte("$y")}, Sigil: ScalarSigil, Name: "y"},
+			},
+			&SubStatement{
+				Token: token.Token{Type: token.SUB, Literal: []byte("sub")},
+				Name:  &Identifier{Value: "f"},
+				Body: &BlockStatement{Statements: []Statement{
+					&ReturnStatement{
+						Token: token.Token{Type: token.RETURN, Literal: []byte("return")},
+						ReturnValue: &InfixExpression{
+							Left:     &Variable{Sigil: ScalarSigil, Name: "x"},
+							Operator: "+",
+							Right:    &IntegerLiteral{Token: token.Token{Type: token.DIGIT, Literal: []byte("1")}, Value: 1},
+						},
+					},
+				}},
+			},
+			&ExpressionStatement{Expression: &CallExpression{
+				Token:     token.Token{Type: token.LPAREN, Literal: []byte("(")},
+				Function:  &Identifier{Value: "f"},
+				Arguments: []Expression{},
+			}},
+		},
+	}
+
+	expected := "my $x = $y;\nsub f { return ($x + 1) }\nf()"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. expected %q, got %q", expected, program.String())
+	}
+}
+
+func TestTokenToAstNode(t *testing.T) {
+	tests := []struct {
+		tok      token.Token
+		expected string // the node's type, or "" for none
+	}{
+		{token.Token{Type: token.IDENTIFIER, Literal: []byte("$x")}, "*ast.Variable"},
+		{token.Token{Type: token.IDENTIFIER, Literal: []byte("print")}, "*ast.Identifier"},
+		{token.Token{Type: token.IDENTIFIER, Literal: []byte("undef")}, "*ast.Undef"},
+		{token.Token{Type: token.DIGIT, Literal: []byte("1")}, "*ast.IntegerLiteral"},
+		{token.Token{Type: token.NUMBER, Literal: []byte("1.5")}, "*ast.NumberLiteral"},
+		{token.Token{Type: token.STRING, Literal: []byte("'a'")}, "*ast.StringLiteral"},
+		{token.Token{Type: token.QW, Literal: []byte("qw(a b)")}, "*ast.QuoteWords"},
+		{token.Token{Type: token.VERSION, Literal: []byte("v5.36")}, "*ast.VersionLiteral"},
+		{token.Token{Type: token.TRUE, Literal: []byte("true")}, "*ast.BooleanLiteral"},
+		{token.Token{Type: token.SEMICOLON, Literal: []byte(";")}, ""},
+		{token.Token{Type: token.MY, Literal: []byte("my")}, ""},
+		{token.Token{Type: token.PLUS, Literal: []byte("+")}, ""},
+	}
+
+	for _, tt := range tests {
+		n := TokenToAstNode(tt.tok)
+		got := ""
+		if n != nil {
+			got = fmt.Sprintf("%T", n)
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.tok.Literal, tt.expected, got)
+		}
+	}
+}
+
+func TestNewNumber(t *testing.T) {
+	tests := []struct {
+		tok      token.Token
+		expected string
+		err      bool
+	}{
+		{token.Token{Type: token.DIGIT, Literal: []byte("1_000")}, "1000", false},
+		{token.Token{Type: token.DIGIT, Literal: []byte("0755")}, "493", false},
+		{token.Token{Type: token.DIGIT, Literal: []byte("0789")}, "789", true},
+		{token.Token{Type: token.DIGIT, Literal: []byte("0x1F")}, "31", false},
+		{token.Token{Type: token.DIGIT, Literal: []byte("0xdead_beef")}, "3735928559", false},
+		{token.Token{Type: token.DIGIT, Literal: []byte("0b1010")}, "10", false},
+		{token.Token{Type: token.DIGIT, Literal: []byte("0b102")}, "0", true},
+		{token.Token{Type: token.NUMBER, Literal: []byte("1e3")}, "1000", false},
+		{token.Token{Type: token.NUMBER, Literal: []byte("1.5E-2")}, "0.015", false},
+		{token.Token{Type: token.NUMBER, Literal: []byte("1_0.2_5")}, "10.25", false},
+		{token.Token{Type: token.DIGIT, Literal: []byte("0xFFFFFFFFFFFFFFFF")}, "1.8446744073709552e+19", false},
+	}
+
+	for _, tt := range tests {
+		n, err := NewNumber(tt.tok)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: expected error %t, got %v", tt.tok.Literal, tt.err, err)
+		}
+		var got string
+		switch n := n.(type) {
+		case *IntegerLiteral:
+			got = fmt.Sprint(n.Value)
+		case *NumberLiteral:
+			got = fmt.Sprint(n.Value)
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.tok.Literal, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package ast
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/perigrin/simian/diagnostics"
+)
+
+// SchemaVersion is the version of the JSON schema written by WriteJSON.
+// It changes whenever a node kind, field name or property is renamed or
+// removed, so consumers can refuse trees they don't understand; adding
+// kinds or properties doesn't change it.
+const SchemaVersion = 3
+
+// Document is the top level of the JSON written by WriteJSON.
+type Document struct {
+	Schema  string   `json:"schema"`  // always "simian-ast"
+	Version int      `json:"version"` // SchemaVersion
+	Root    *Encoded `json:"root"`
+}
+
+// Encoded is a node as WriteJSON and WriteSExpr write it.
+//
+// Kind is the name of the node's Go type, such as "InfixExpression".
+// Field names the field of the parent the node is held in, in lower
+// camel case ("left", "statements"); it is empty for the root. Span
+// is the node's byte span as reported by SpanOf, and Token its
+// TokenLiteral. Props holds the node's values that aren't nodes,
+// such as an operator or an identifier's name, and Children its child
+// nodes in source order.
+type Encoded struct {
+	Kind     string           `json:"kind"`
+	Field    string           `json:"field,omitempty"`
+	Span     diagnostics.Span `json:"span"`
+	Token    string           `json:"token,omitempty"`
+	Props    map[string]any   `json:"props,omitempty"`
+	Children []*Encoded       `json:"children,omitempty"`
+
+	hasSpan bool // whether any token was recorded for Span
+}
+
+// Encode returns the encoded form of the tree rooted at n.
+func Encode(n Node) *Encoded {
+	var stack []*Encoded
+	var root *Encoded
+
+	pre := func(c *Cursor) bool {
+		if c.Node() == nil {
+			return false
+		}
+		e := &Encoded{
+			Kind:  reflect.Indirect(reflect.ValueOf(c.Node())).Type().Name(),
+			Token: c.Node().TokenLiteral(),
+			Props: props(c.Node()),
+		}
+		if len(stack) > 0 {
+			e.Field = lowerFirst(c.Name())
+		}
+		stack = append(stack, e)
+		return true
+	}
+	post := func(c *Cursor) bool {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		span, found := OwnSpan(c.Node())
+		for _, child := range e.Children {
+			if child.hasSpan {
+				span, found = union(span, found, child.Span), true
+			}
+		}
+		e.Span, e.hasSpan = span, found
+		sortChildren(e.Children)
+
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, e)
+		} else {
+			root = e
+		}
+		return true
+	}
+	Apply(n, pre, post)
+	return root
+}
+
+// sortChildren puts children in source order, which isn't always the
+// order of the fields that hold them: the attributes of a sub come
+// before its signature in the tree but may follow it in the source. A
+// child without a span stays after the one before it.
+func sortChildren(children []*Encoded) {
+	starts := make(map[*Encoded]int, len(children))
+	start := 0
+	for _, c := range children {
+		if c.hasSpan {
+			start = c.Span.Start
+		}
+		starts[c] = start
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return starts[children[i]] < starts[children[j]]
+	})
+}
+
+// props returns the values of n that aren't child nodes, or nil.
+func props(n Node) map[string]any {
+	switch n := n.(type) {
+	case *Identifier:
+		return map[string]any{"value": n.Value}
+	case *Variable:
+		return map[string]any{"sigil": n.Sigil.String(), "name": n.Name}
+	case *BooleanLiteral:
+		return map[string]any{"value": n.Value}
+	case *IntegerLiteral:
+		return map[string]any{"value": n.Value}
+	case *NumberLiteral:
+		return map[string]any{"value": n.Value}
+	case *StringLiteral:
+		return map[string]any{"value": n.Value, "interpolated": n.Interpolated}
+	case *QuoteWords:
+		return map[string]any{"words": n.Words}
+	case *VersionLiteral:
+		return map[string]any{"value": n.Value}
+	case *PrefixExpression:
+		return map[string]any{"operator": n.Operator}
+	case *InfixExpression:
+		return map[string]any{"operator": n.Operator}
+	case *PostfixExpression:
+		return map[string]any{"operator": n.Operator}
+	case *CallExpression:
+		if n.Arrow {
+			return map[string]any{"arrow": true}
+		}
+	case *Index:
+		p := map[string]any{"hash": n.IsHash()}
+		if n.Arrow {
+			p["arrow"] = true
+		}
+		return p
+	case *Dereference:
+		return map[string]any{"sigil": n.Sigil.String()}
+	case *PostfixDeref:
+		return map[string]any{"sigil": n.Sigil.String()}
+	case *PostfixSlice:
+		return map[string]any{"sigil": n.Sigil.String(), "bracket": string(n.Bracket.Literal)}
+	case *PhaseBlock:
+		return map[string]any{"phase": n.Phase}
+	case *MyStatement:
+		return map[string]any{"keyword": n.TokenLiteral()}
+	case *Declaration:
+		if n.Parens {
+			return map[string]any{"keyword": n.TokenLiteral(), "parens": true}
+		}
+		return map[string]any{"keyword": n.TokenLiteral()}
+	case *IfStatement:
+		return map[string]any{"keyword": n.TokenLiteral()}
+	case *WhileStatement:
+		return map[string]any{"keyword": n.TokenLiteral()}
+	case *LabeledStatement:
+		return map[string]any{"label": n.Label}
+	case *LoopControlStatement:
+		return map[string]any{"keyword": n.TokenLiteral()}
+	case *ModifiedStatement:
+		return map[string]any{"keyword": n.TokenLiteral()}
+	case *TypeName:
+		return map[string]any{"name": n.Name}
+	case *Attribute:
+		if n.Args != "" {
+			return map[string]any{"name": n.Name, "args": n.Args}
+		}
+		return map[string]any{"name": n.Name}
+	}
+	return nil
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return string(unicode.ToLower(rune(s[0]))) + s[1:]
+}
+
+// WriteJSON writes the tree rooted at n to w as an indented JSON
+// Document.
+func WriteJSON(w io.Writer, n Node) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Document{Schema: "simian-ast", Version: SchemaVersion, Root: Encode(n)})
+}
+
+// WriteSExpr writes the tree rooted at n to w as an S-expression, one
+// node per line, each list holding the node's kind, its props as
+// keyword/value pairs in name order, then its children:
+//
+//	(InfixExpression :operator "+"
+//	  (Variable :name "x" :sigil "$")
+//	  (IntegerLiteral :value 1))
+//
+// Spans and tokens are left out; use WriteJSON to get them.
+func WriteSExpr(w io.Writer, n Node) error {
+	b := bufio.NewWriter(w)
+	writeSExpr(b, Encode(n), 0)
+	b.WriteString("\n")
+	return b.Flush()
+}
+
+func writeSExpr(b *bufio.Writer, e *Encoded, depth int) {
+	b.WriteString("(" + e.Kind)
+	keys := make([]string, 0, len(e.Props))
+	for k := range e.Props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(" :" + k + " " + atom(e.Props[k]))
+	}
+	for _, c := range e.Children {
+		b.WriteString("\n" + strings.Repeat("  ", depth+1))
+		writeSExpr(b, c, depth+1)
+	}
+	b.WriteString(")")
+}
+
+func atom(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		if v {
+			return "#t"
+		}
+		return "#f"
+	case []string:
+		words := make([]string, len(v))
+		for i, w := range v {
+			words[i] = strconv.Quote(w)
+		}
+		return "(" + strings.Join(words, " ") + ")"
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,99 @@
+package ast_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestGolden encodes each testdata/*.pl and compares the result with the
+// .json and .sexp files beside it. Run with -update after a deliberate
+// change to the output, and bump ast.SchemaVersion if the change isn't
+// backwards compatible.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.pl")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test files: %v", err)
+	}
+
+	formats := map[string]func(io.Writer, ast.Node) error{
+		".json": ast.WriteJSON,
+		".sexp": ast.WriteSExpr,
+	}
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program := parse(t, string(src))
+
+		for ext, write := range formats {
+			var out bytes.Buffer
+			if err := write(&out, program); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			golden := strings.TrimSuffix(name, ".pl") + ext
+			if *update {
+				if err := os.WriteFile(golden, out.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if !bytes.Equal(out.Bytes(), expected) {
+				t.Errorf("%s differs from the golden file; got:\n%s", golden, out.String())
+			}
+		}
+	}
+}
+
+func TestJSONSpans(t *testing.T) {
+	src := `my $x = $y + 1;`
+	program := parse(t, src)
+	var out bytes.Buffer
+	if err := ast.WriteJSON(&out, program); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc ast.Document
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Schema != "simian-ast" || doc.Version != ast.SchemaVersion {
+		t.Errorf("wrong header: %q version %d", doc.Schema, doc.Version)
+	}
+
+	tests := []struct {
+		node *ast.Encoded
+		kind string
+		text string
+	}{
+		{doc.Root, "Program", "my $x = $y + 1"},
+		{doc.Root.Children[0].Children[0], "Variable", "$x"},
+		{doc.Root.Children[0].Children[1], "InfixExpression", "$y + 1"},
+	}
+	for _, tt := range tests {
+		if tt.node.Kind != tt.kind {
+			t.Errorf("expected %s, got %s", tt.kind, tt.node.Kind)
+		}
+		if text := src[tt.node.Span.Start:tt.node.Span.End]; text != tt.text {
+			t.Errorf("%s: expected span over %q, got %q", tt.kind, tt.text, text)
+		}
+	}
+	if span := ast.SpanOf(program); span != doc.Root.Span {
+		t.Errorf("SpanOf gives %v, the encoding %v", span, doc.Root.Span)
+	}
+}
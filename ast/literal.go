@@ -0,0 +1,275 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/perigrin/simian/token"
+)
+
+// NewVariable returns the variable t names. t must start with a sigil.
+func NewVariable(t token.Token) *Variable {
+	lit := string(t.Literal)
+	v := &Variable{Token: t}
+	switch {
+	case strings.HasPrefix(lit, "$#"):
+		v.Sigil, v.Name = LastIndexSigil, lit[2:]
+	case lit != "":
+		v.Sigil = Sigil(strings.IndexByte("$@%&*", lit[0]))
+		v.Name = lit[1:]
+	}
+	return v
+}
+
+// NewVariableExpression returns the variable t names, or for the short
+// dereference forms such as @$ref, $$$ref and $#$ref the Dereference of
+// the scalar variable holding the reference. t must start with a sigil.
+func NewVariableExpression(t token.Token) Expression {
+	lit := string(t.Literal)
+	n := 1
+	if strings.HasPrefix(lit, "$#") {
+		n = 2
+	}
+	// $$ alone is the process id, not a dereference
+	if len(lit) <= n+1 || lit[n] != '$' {
+		return NewVariable(t)
+	}
+	sigil, _ := LookupSigil(lit[:n])
+	value := t
+	value.Literal, value.Offset = t.Literal[n:], t.Offset+n
+	t.Literal = t.Literal[:n]
+	return &Dereference{Token: t, Sigil: sigil, Value: NewVariableExpression(value)}
+}
+
+// NewNumber returns the IntegerLiteral or NumberLiteral for a DIGIT or
+// NUMBER token. Underscores between digits are ignored. A whole number
+// may be hexadecimal with 0x, binary with 0b, or octal with a leading
+// zero; if an octal number holds an 8 or a 9 NewNumber reports an error,
+// and reads it as decimal. A number with an exponent is floating point.
+func NewNumber(t token.Token) (Expression, error) {
+	lit := strings.ReplaceAll(string(t.Literal), "_", "")
+	if t.Type == token.NUMBER || strings.ContainsAny(lit, ".eE") && !isPrefixed(lit) {
+		f, _ := strconv.ParseFloat(lit, 64)
+		return &NumberLiteral{Token: t, Value: f}, nil
+	}
+
+	base := 10
+	digits := lit
+	var err error
+	switch {
+	case isPrefixed(lit):
+		base = 16
+		if lit[1] == 'b' || lit[1] == 'B' {
+			base = 2
+		}
+		digits = lit[2:]
+		if digits == "" {
+			return &IntegerLiteral{Token: t}, fmt.Errorf("no digits after %s", lit)
+		}
+	case len(lit) > 1 && lit[0] == '0':
+		base = 8
+		if i := strings.IndexAny(lit, "89"); i >= 0 {
+			base = 10
+			err = fmt.Errorf("illegal octal digit '%c'", lit[i])
+		}
+	}
+	if n, err2 := strconv.ParseInt(digits, base, 64); err2 == nil {
+		return &IntegerLiteral{Token: t, Value: n}, err
+	} else if errors.Is(err2, strconv.ErrSyntax) && base != 10 {
+		return &IntegerLiteral{Token: t}, fmt.Errorf("illegal digit in %s", lit)
+	}
+	// too large for an integer, so floating point as in perl
+	if base == 10 {
+		f, _ := strconv.ParseFloat(digits, 64)
+		return &NumberLiteral{Token: t, Value: f}, err
+	}
+	f := 0.0
+	for _, d := range strings.ToLower(digits) {
+		v := strings.IndexRune("0123456789abcdef", d)
+		f = f*float64(base) + float64(v)
+	}
+	return &NumberLiteral{Token: t, Value: f}, err
+}
+
+// isPrefixed reports whether lit is a hexadecimal or binary number.
+func isPrefixed(lit string) bool {
+	return len(lit) > 1 && lit[0] == '0' && strings.ContainsRune("xXbB", rune(lit[1]))
+}
+
+// NewStringLiteral returns the string a STRING token quotes. Escapes
+// are decoded, except in a double quoted string that interpolates,
+// whose Value is left as written for run time to process.
+func NewStringLiteral(t token.Token) *StringLiteral {
+	lit := string(t.Literal)
+	interpolated := strings.HasPrefix(lit, "\"") || strings.HasPrefix(lit, "qq")
+	lit = strings.TrimPrefix(strings.TrimPrefix(lit, "qq"), "q")
+	body := unquote(lit)
+	switch {
+	case !interpolated:
+		body = unescapeSingle(lit, body)
+	case !interpolates(body):
+		body = unescapeDouble(body)
+	}
+	return &StringLiteral{
+		Token:        t,
+		Value:        body,
+		Interpolated: interpolated,
+	}
+}
+
+// Interpolates reports whether s is a double quoted string that
+// interpolates, so its Value still holds variables and escapes.
+func (s *StringLiteral) Interpolates() bool {
+	return s.Interpolated && interpolates(unquote(strings.TrimPrefix(s.TokenLiteral(), "qq")))
+}
+
+// NewBareString returns the string a bareword stands for where perl
+// quotes it automatically.
+func NewBareString(t token.Token) *StringLiteral {
+	return &StringLiteral{Token: t, Value: string(t.Literal)}
+}
+
+// NewQuoteWords returns the word list of a QW token.
+func NewQuoteWords(t token.Token) *QuoteWords {
+	body := unquote(strings.TrimPrefix(string(t.Literal), "qw"))
+	return &QuoteWords{Token: t, Words: strings.Fields(body)}
+}
+
+// unquote strips the delimiters from a quoted literal.
+func unquote(lit string) string {
+	if len(lit) < 2 {
+		return ""
+	}
+	return lit[1 : len(lit)-1]
+}
+
+// unescapeSingle decodes a single quoted body, in which only a
+// backslash and the delimiters of the quoted literal lit are escaped.
+func unescapeSingle(lit, body string) string {
+	if !strings.Contains(body, `\`) {
+		return body
+	}
+	open, close := lit[0], lit[len(lit)-1]
+	var out strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == '\\' && i+1 < len(body) {
+			if next := body[i+1]; next == '\\' || next == open || next == close {
+				i++
+				c = next
+			}
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
+
+// interpolates reports whether a double quoted body holds a variable
+// or a case modifying escape, which only run time can expand.
+func interpolates(body string) bool {
+	for i := 0; i < len(body)-1; i++ {
+		switch c, next := body[i], body[i+1]; {
+		case c == '\\' && strings.IndexByte("ulULQEF", next) >= 0:
+			return true
+		case c == '\\':
+			i++
+		case (c == '$' || c == '@') && (token.IsLetter(next) || strings.IndexByte("_{:$", next) >= 0):
+			return true
+		case c == '$' && (token.IsDigit(next) || strings.IndexByte("&`'+!@/\\,;.0", next) >= 0):
+			return true
+		}
+	}
+	return false
+}
+
+// escapes maps the single character escapes of a double quoted string
+// to what they stand for.
+var escapes = map[byte]string{
+	'n': "\n", 't': "\t", 'r': "\r", 'f': "\f", 'b': "\b", 'a': "\a", 'e': "\x1b",
+}
+
+// unescapeDouble decodes the escapes in a double quoted body that
+// interpolates nothing.
+func unescapeDouble(body string) string {
+	if !strings.Contains(body, `\`) {
+		return body
+	}
+	var out strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c != '\\' || i+1 == len(body) {
+			out.WriteByte(c)
+			continue
+		}
+		i++
+		c = body[i]
+		switch {
+		case escapes[c] != "":
+			out.WriteString(escapes[c])
+		case c == 'x':
+			digits := ""
+			if i+1 < len(body) && body[i+1] == '{' {
+				if end := strings.IndexByte(body[i:], '}'); end > 0 {
+					digits = body[i+2 : i+end]
+					i += end
+				}
+			} else {
+				for len(digits) < 2 && i+1 < len(body) && isHexDigit(body[i+1]) {
+					i++
+					digits += string(body[i])
+				}
+			}
+			n, _ := strconv.ParseUint(strings.TrimSpace(digits), 16, 32)
+			out.WriteRune(rune(n))
+		case c >= '0' && c <= '7':
+			digits := string(c)
+			for len(digits) < 3 && i+1 < len(body) && body[i+1] >= '0' && body[i+1] <= '7' {
+				i++
+				digits += string(body[i])
+			}
+			n, _ := strconv.ParseUint(digits, 8, 32)
+			out.WriteRune(rune(n))
+		default:
+			// any other character stands for itself
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+func isHexDigit(ch byte) bool {
+	return token.IsDigit(ch) || ch >= 'a' && ch <= 'f' || ch >= 'A' && ch <= 'F'
+}
+
+// TokenToAstNode returns the node for a token that is a value on its
+// own: a variable or bareword, a number, string, word list or version,
+// true, false or undef. Operators, punctuation and keywords have no
+// value, and give nil.
+func TokenToAstNode(t token.Token) Node {
+	switch t.Type {
+	case token.IDENTIFIER:
+		switch {
+		case len(t.Literal) > 0 && token.IsSigil(t.Literal[0]):
+			return NewVariableExpression(t)
+		case string(t.Literal) == "undef":
+			return &Undef{Token: t}
+		default:
+			return &Identifier{Token: t, Value: string(t.Literal)}
+		}
+	case token.DIGIT, token.NUMBER:
+		n, _ := NewNumber(t)
+		return n
+	case token.STRING:
+		return NewStringLiteral(t)
+	case token.QW:
+		return NewQuoteWords(t)
+	case token.VERSION:
+		return &VersionLiteral{Token: t, Value: string(t.Literal)}
+	case token.TRUE, token.FALSE:
+		return &BooleanLiteral{Token: t, Value: t.Type == token.TRUE}
+	default:
+		return nil
+	}
+}
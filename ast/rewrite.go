@@ -0,0 +1,404 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// An ApplyFunc is invoked by Apply for each node n, even if n is nil,
+// before and/or after the node's children, using a Cursor describing
+// the current node and providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal.
+// See Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses a syntax tree recursively, starting with root, and
+// calling pre and post for each node as described below. Apply returns
+// the syntax tree, possibly modified.
+//
+// If pre is not nil, it is called for each node before the node's
+// children are traversed (pre-order). If pre returns false, no children
+// are traversed, and post is not called for that node.
+//
+// If post is not nil, and a prior call of pre didn't return false, post
+// is called for each node after its children are traversed (post-order).
+// If post returns false, traversal is terminated and Apply returns
+// immediately.
+//
+// Only fields that refer to AST nodes are considered children; children
+// are traversed in the same order as Walk visits them. Nodes inserted
+// with InsertBefore or InsertAfter are not traversed; a node set with
+// Replace is traversed when Replace is called from pre.
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	parent := &struct{ Node }{root}
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = parent.Node
+	}()
+	a := &application{pre: pre, post: post}
+	a.apply(parent, "Node", nil, root)
+	return
+}
+
+var abort = new(int) // singleton, to signal termination of Apply
+
+// A Cursor describes a node encountered during Apply. Information about
+// the node and its parent is available from the Node, Parent, Name, and
+// Index methods.
+//
+// If p is a variable of type and value of the current parent node
+// c.Parent(), and f is the field identifier with name c.Name(), the
+// following invariants hold:
+//
+//	p.f            == c.Node()  if c.Index() <  0
+//	p.f[c.Index()] == c.Node()  if c.Index() >= 0
+//
+// The methods Replace, Delete, InsertBefore, and InsertAfter can be
+// used to change the AST without disrupting Apply.
+type Cursor struct {
+	parent Node
+	name   string
+	iter   *iterator // valid if non-nil
+	node   Node
+}
+
+// Node returns the current Node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current Node.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent Node field that contains the
+// current Node. If the parent is a *Program and the current Node is a
+// statement, Name returns "Statements".
+func (c *Cursor) Name() string { return c.name }
+
+// Index reports the index >= 0 of the current Node in the slice of
+// Nodes that contains it, or a value < 0 if the current Node is not
+// part of a slice. The index of the current node changes if
+// InsertBefore is called while processing the current node.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// field returns the current node's parent field value.
+func (c *Cursor) field() reflect.Value {
+	return reflect.Indirect(reflect.ValueOf(c.parent)).FieldByName(c.name)
+}
+
+// Replace replaces the current Node with n. n must be assignable to the field holding the
+// current node: a statement for a statement, an *Identifier for a name,
+// and so on.
+func (c *Cursor) Replace(n Node) {
+	v := c.field()
+	if i := c.Index(); i >= 0 {
+		v = v.Index(i)
+	}
+	v.Set(value(v.Type(), n))
+	c.node = n
+}
+
+// Delete deletes the current Node from its containing slice. If the
+// current Node is not part of a slice, Delete panics.
+func (c *Cursor) Delete() {
+	i := c.Index()
+	if i < 0 {
+		panic("Delete node not contained in slice")
+	}
+	v := c.field()
+	l := v.Len()
+	reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
+	v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
+	v.SetLen(l - 1)
+	c.iter.step--
+}
+
+// InsertAfter inserts n after the current Node in its containing slice.
+// If the current Node is not part of a slice, InsertAfter panics.
+// Apply does not walk n.
+func (c *Cursor) InsertAfter(n Node) {
+	i := c.Index()
+	if i < 0 {
+		panic("InsertAfter node not contained in slice")
+	}
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+2, l), v.Slice(i+1, l))
+	v.Index(i + 1).Set(value(v.Type().Elem(), n))
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current Node in its containing
+// slice. If the current Node is not part of a slice, InsertBefore
+// panics. Apply will not walk n.
+func (c *Cursor) InsertBefore(n Node) {
+	i := c.Index()
+	if i < 0 {
+		panic("InsertBefore node not contained in slice")
+	}
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
+	v.Index(i).Set(value(v.Type().Elem(), n))
+	c.iter.index++
+}
+
+// value returns n as a value to store in a field or element of type t,
+// panicking with a readable message if it doesn't fit.
+func value(t reflect.Type, n Node) reflect.Value {
+	if n == nil {
+		return reflect.Zero(t)
+	}
+	v := reflect.ValueOf(n)
+	if !v.Type().AssignableTo(t) {
+		panic(fmt.Sprintf("cannot use %T as %s", n, t))
+	}
+	return v
+}
+
+// application carries all the shared data so we can pass it around
+// cheaply.
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	iter      iterator
+}
+
+func (a *application) apply(parent Node, name string, iter *iterator, n Node) {
+	// convert typed nil into untyped nil
+	if isNil(n) {
+		n = nil
+	}
+
+	// avoid heap-allocating a new cursor for each apply call; reuse a.cursor instead
+	saved := a.cursor
+	a.cursor.parent = parent
+	a.cursor.name = name
+	a.cursor.iter = iter
+	a.cursor.node = n
+
+	if a.pre != nil && !a.pre(&a.cursor) {
+		a.cursor = saved
+		return
+	}
+
+	// walk children in the same order as Walk; node types defined
+	// outside this package are leaves
+	switch n := a.cursor.node.(type) {
+	case nil:
+		// nothing to do
+
+	case *Program:
+		a.applyList(n, "Statements")
+
+	case *MyStatement:
+		a.apply(n, "Type", nil, n.Type)
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Value", nil, n.Value)
+
+	case *Identifier, *IntegerLiteral, *NumberLiteral, *QuoteWords,
+		*VersionLiteral, *Attribute, *Variable, *BooleanLiteral, *Undef:
+		// nothing to do
+
+	case *StringLiteral:
+		a.applyList(n, "Parts")
+
+	case *TypeName:
+		a.applyList(n, "Args")
+
+	case *ArrayLiteral:
+		a.applyList(n, "Elements")
+
+	case *HashLiteral:
+		a.applyList(n, "Elements")
+
+	case *ListLiteral:
+		a.applyList(n, "Elements")
+
+	case *PrefixExpression:
+		a.apply(n, "Right", nil, n.Right)
+
+	case *InfixExpression:
+		a.apply(n, "Left", nil, n.Left)
+		a.apply(n, "Right", nil, n.Right)
+
+	case *ConditionalExpression:
+		a.apply(n, "Condition", nil, n.Condition)
+		a.apply(n, "Consequence", nil, n.Consequence)
+		a.apply(n, "Alternative", nil, n.Alternative)
+
+	case *PostfixExpression:
+		a.apply(n, "Left", nil, n.Left)
+
+	case *CallExpression:
+		a.apply(n, "Function", nil, n.Function)
+		a.apply(n, "Block", nil, n.Block)
+		a.applyList(n, "Arguments")
+
+	case *MethodCall:
+		a.apply(n, "Invocant", nil, n.Invocant)
+		a.apply(n, "Method", nil, n.Method)
+		a.applyList(n, "Arguments")
+
+	case *Index:
+		a.apply(n, "Left", nil, n.Left)
+		a.apply(n, "Index", nil, n.Index)
+
+	case *Dereference:
+		a.apply(n, "Value", nil, n.Value)
+
+	case *PostfixDeref:
+		a.apply(n, "Left", nil, n.Left)
+
+	case *PostfixSlice:
+		a.apply(n, "Left", nil, n.Left)
+		a.apply(n, "Index", nil, n.Index)
+
+	case *ExpressionStatement:
+		a.apply(n, "Expression", nil, n.Expression)
+
+	case *ReturnStatement:
+		a.apply(n, "ReturnValue", nil, n.ReturnValue)
+
+	case *BlockStatement:
+		a.applyList(n, "Statements")
+
+	case *Declaration:
+		a.apply(n, "Type", nil, n.Type)
+		a.applyList(n, "Variables")
+
+	case *IfStatement:
+		a.apply(n, "Condition", nil, n.Condition)
+		a.apply(n, "Consequence", nil, n.Consequence)
+		a.apply(n, "Alternative", nil, n.Alternative)
+
+	case *WhileStatement:
+		a.apply(n, "Condition", nil, n.Condition)
+		a.apply(n, "Body", nil, n.Body)
+		a.apply(n, "Continue", nil, n.Continue)
+
+	case *ForStatement:
+		a.apply(n, "Init", nil, n.Init)
+		a.apply(n, "Condition", nil, n.Condition)
+		a.apply(n, "Step", nil, n.Step)
+		a.apply(n, "Body", nil, n.Body)
+
+	case *ForeachStatement:
+		a.apply(n, "Variable", nil, n.Variable)
+		a.apply(n, "List", nil, n.List)
+		a.apply(n, "Body", nil, n.Body)
+		a.apply(n, "Continue", nil, n.Continue)
+
+	case *LabeledStatement:
+		a.apply(n, "Statement", nil, n.Statement)
+
+	case *LoopControlStatement:
+		a.apply(n, "Label", nil, n.Label)
+
+	case *ModifiedStatement:
+		a.apply(n, "Statement", nil, n.Statement)
+		a.apply(n, "Condition", nil, n.Condition)
+
+	case *PackageDeclaration:
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Version", nil, n.Version)
+
+	case *PackageStatement:
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Version", nil, n.Version)
+		a.apply(n, "Body", nil, n.Body)
+
+	case *UseStatement:
+		a.apply(n, "Module", nil, n.Module)
+		a.apply(n, "Version", nil, n.Version)
+		a.applyList(n, "Imports")
+
+	case *NoStatement:
+		a.apply(n, "Module", nil, n.Module)
+		a.apply(n, "Version", nil, n.Version)
+		a.applyList(n, "Imports")
+
+	case *RequireStatement:
+		a.apply(n, "Module", nil, n.Module)
+		a.apply(n, "Version", nil, n.Version)
+		a.apply(n, "Value", nil, n.Value)
+
+	case *PhaseBlock:
+		a.apply(n, "Body", nil, n.Body)
+
+	case *Parameter:
+		a.apply(n, "Type", nil, n.Type)
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Default", nil, n.Default)
+
+	case *Signature:
+		a.applyList(n, "Parameters")
+
+	case *SubStatement:
+		a.apply(n, "Name", nil, n.Name)
+		a.applyList(n, "Attributes")
+		a.apply(n, "Signature", nil, n.Signature)
+		a.apply(n, "Body", nil, n.Body)
+
+	case *MethodStatement:
+		a.apply(n, "Name", nil, n.Name)
+		a.applyList(n, "Attributes")
+		a.apply(n, "Signature", nil, n.Signature)
+		a.apply(n, "Body", nil, n.Body)
+
+	case *ClassStatement:
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Version", nil, n.Version)
+		a.applyList(n, "Attributes")
+		a.apply(n, "Body", nil, n.Body)
+
+	case *FieldStatement:
+		a.apply(n, "Type", nil, n.Type)
+		a.apply(n, "Name", nil, n.Name)
+		a.applyList(n, "Attributes")
+		a.apply(n, "Value", nil, n.Value)
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abort)
+	}
+
+	a.cursor = saved
+}
+
+// An iterator controls iteration over a slice of nodes.
+type iterator struct {
+	index, step int
+}
+
+func (a *application) applyList(parent Node, name string) {
+	// avoid heap-allocating a new iterator for each applyList call; reuse a.iter instead
+	saved := a.iter
+	a.iter.index = 0
+	for {
+		// must reload parent.name each time, since cursor modifications might change it
+		v := reflect.Indirect(reflect.ValueOf(parent)).FieldByName(name)
+		if a.iter.index >= v.Len() {
+			break
+		}
+
+		// element x may be nil in a bad AST - be cautious
+		var x Node
+		if e := v.Index(a.iter.index); e.IsValid() && !(e.Kind() == reflect.Interface && e.IsNil()) {
+			x = e.Interface().(Node)
+		}
+
+		a.iter.step = 1
+		a.apply(parent, name, &a.iter, x)
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
@@ -0,0 +1,60 @@
+package ast
+
+import (
+	"reflect"
+
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/token"
+)
+
+var tokenType = reflect.TypeOf(token.Token{})
+
+// SpanOf returns the source n was parsed from, running from the first
+// token recorded in n or any node under it to the end of the last one.
+// The parser doesn't keep closing delimiters or terminators, so those
+// fall outside the span. A node with no recorded tokens has an empty
+// span at offset 0.
+func SpanOf(n Node) diagnostics.Span {
+	var span diagnostics.Span
+	found := false
+	Inspect(n, func(n Node) bool {
+		if n == nil {
+			return false
+		}
+		if s, ok := OwnSpan(n); ok {
+			span, found = union(span, found, s), true
+		}
+		return true
+	})
+	return span
+}
+
+// OwnSpan returns the span of the tokens n holds itself, not counting
+// its children, and whether it holds any. SpanOf(n) covers the OwnSpan
+// of n and of every node under it.
+func OwnSpan(n Node) (diagnostics.Span, bool) {
+	var span diagnostics.Span
+	found := false
+	v := reflect.Indirect(reflect.ValueOf(n))
+	if v.Kind() != reflect.Struct {
+		return span, false
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Type() != tokenType {
+			continue
+		}
+		t := v.Field(i).Interface().(token.Token)
+		if len(t.Literal) == 0 {
+			continue // synthesized by the parser
+		}
+		span, found = union(span, found, diagnostics.SpanOf(t)), true
+	}
+	return span, found
+}
+
+func union(span diagnostics.Span, found bool, s diagnostics.Span) diagnostics.Span {
+	if !found {
+		return s
+	}
+	return diagnostics.Span{Start: min(span.Start, s.Start), End: max(span.End, s.End)}
+}
@@ -0,0 +1,9 @@
+use v5.38;
+class Point 1.0 :isa(Shape) {
+    field $x :param = 0;
+    field @history;
+    method move($dx) {
+        $x += $dx;
+        push @history, $x;
+    }
+}
@@ -0,0 +1,10 @@
+my ($a, $b) = @_;
+OUTER: for my $i (1, 2) {
+    unless ($i) { 1 } elsif ($a) { 2 } else { 3 }
+}
+while (my $line = shift @lines) { $b } continue { 1 }
+for (my $j = 0; $j < 3; $j++) { }
+for (@lines) { next if $_; last unless $b; redo }
+print $a for @lines;
+until ($b) { $b++ }
+next OUTER while $b;
@@ -0,0 +1,11 @@
+package Foo::Bar 1.02;
+use strict;
+use List::Util qw(sum max);
+no warnings 'once';
+require Carp;
+BEGIN { $DEBUG = 1; }
+sub add($a, $b = 0) :prototype($$) {
+    return $a + $b;
+}
+our $VERSION = 1;
+sub counter { state $n = 0; return ++$n; }
@@ -0,0 +1,10 @@
+my $total = $price * $count + 1.5;
+my $name = $opt{name} // "anonymous";
+my @words = qw(a b c);
+my $ref = [1, 2, { key => 'value' }];
+$ref->[2]{key} = -$x ** 2;
+$i++;
+print $ok ? "yes" : "no";
+$obj->method(1, $list->@*)->@{qw(a b)};
+print "total: $total @words[0, 1] $ref->{key}\n";
+my @copy = (@$ref, $$ref[0]);
@@ -0,0 +1,299 @@
+package ast
+
+import "reflect"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: It starts by calling
+// v.Visit(node); node must not be nil. If the visitor w returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with visitor w
+// for each of the non-nil children of node, followed by a call of
+// w.Visit(nil). Children are visited in the order of the fields that
+// hold them, which is source order except that the attributes of a sub
+// or method come before its signature; node types defined outside this
+// package have none.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *MyStatement:
+		walkType(v, n.Type)
+		walkVariable(v, n.Name)
+		walkExpression(v, n.Value)
+
+	case *Identifier, *IntegerLiteral, *NumberLiteral, *QuoteWords,
+		*VersionLiteral, *Attribute, *Variable, *BooleanLiteral, *Undef:
+		// nothing to do
+
+	case *StringLiteral:
+		walkExpressions(v, n.Parts)
+
+	case *TypeName:
+		for _, a := range n.Args {
+			Walk(v, a)
+		}
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *HashLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *ListLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+
+	case *ConditionalExpression:
+		walkExpression(v, n.Condition)
+		walkExpression(v, n.Consequence)
+		walkExpression(v, n.Alternative)
+
+	case *PostfixExpression:
+		walkExpression(v, n.Left)
+
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkBlock(v, n.Block)
+		walkExpressions(v, n.Arguments)
+
+	case *MethodCall:
+		walkExpression(v, n.Invocant)
+		walkIdentifier(v, n.Method)
+		walkExpressions(v, n.Arguments)
+
+	case *Index:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+
+	case *Dereference:
+		walkExpression(v, n.Value)
+
+	case *PostfixDeref:
+		walkExpression(v, n.Left)
+
+	case *PostfixSlice:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *Declaration:
+		walkType(v, n.Type)
+		for _, variable := range n.Variables {
+			walkVariable(v, variable)
+		}
+
+	case *IfStatement:
+		walkExpression(v, n.Condition)
+		walkBlock(v, n.Consequence)
+		if !isNil(n.Alternative) {
+			Walk(v, n.Alternative)
+		}
+
+	case *WhileStatement:
+		walkExpression(v, n.Condition)
+		walkBlock(v, n.Body)
+		walkBlock(v, n.Continue)
+
+	case *ForStatement:
+		walkExpression(v, n.Init)
+		walkExpression(v, n.Condition)
+		walkExpression(v, n.Step)
+		walkBlock(v, n.Body)
+
+	case *ForeachStatement:
+		walkExpression(v, n.Variable)
+		walkExpression(v, n.List)
+		walkBlock(v, n.Body)
+		walkBlock(v, n.Continue)
+
+	case *LabeledStatement:
+		if !isNil(n.Statement) {
+			Walk(v, n.Statement)
+		}
+
+	case *LoopControlStatement:
+		walkIdentifier(v, n.Label)
+
+	case *ModifiedStatement:
+		if !isNil(n.Statement) {
+			Walk(v, n.Statement)
+		}
+		walkExpression(v, n.Condition)
+
+	case *PackageDeclaration:
+		walkIdentifier(v, n.Name)
+		walkVersion(v, n.Version)
+
+	case *PackageStatement:
+		walkIdentifier(v, n.Name)
+		walkVersion(v, n.Version)
+		walkBlock(v, n.Body)
+
+	case *UseStatement:
+		walkIdentifier(v, n.Module)
+		walkVersion(v, n.Version)
+		walkExpressions(v, n.Imports)
+
+	case *NoStatement:
+		walkIdentifier(v, n.Module)
+		walkVersion(v, n.Version)
+		walkExpressions(v, n.Imports)
+
+	case *RequireStatement:
+		walkIdentifier(v, n.Module)
+		walkVersion(v, n.Version)
+		walkExpression(v, n.Value)
+
+	case *PhaseBlock:
+		walkBlock(v, n.Body)
+
+	case *Signature:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+
+	case *Parameter:
+		walkType(v, n.Type)
+		walkVariable(v, n.Name)
+		walkExpression(v, n.Default)
+
+	case *SubStatement:
+		walkIdentifier(v, n.Name)
+		walkAttributes(v, n.Attributes)
+		if n.Signature != nil {
+			Walk(v, n.Signature)
+		}
+		walkBlock(v, n.Body)
+
+	case *MethodStatement:
+		walkIdentifier(v, n.Name)
+		walkAttributes(v, n.Attributes)
+		if n.Signature != nil {
+			Walk(v, n.Signature)
+		}
+		walkBlock(v, n.Body)
+
+	case *ClassStatement:
+		walkIdentifier(v, n.Name)
+		walkVersion(v, n.Version)
+		walkAttributes(v, n.Attributes)
+		walkBlock(v, n.Body)
+
+	case *FieldStatement:
+		walkType(v, n.Type)
+		walkVariable(v, n.Name)
+		walkAttributes(v, n.Attributes)
+		walkExpression(v, n.Value)
+	}
+
+	v.Visit(nil)
+}
+
+// The helpers below skip nil children, including typed nil pointers
+// held in interface fields.
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		if !isNil(s) {
+			Walk(v, s)
+		}
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		walkExpression(v, e)
+	}
+}
+
+func walkExpression(v Visitor, e Expression) {
+	if !isNil(e) {
+		Walk(v, e)
+	}
+}
+
+func walkIdentifier(v Visitor, i *Identifier) {
+	if i != nil {
+		Walk(v, i)
+	}
+}
+
+func walkVariable(v Visitor, variable *Variable) {
+	if variable != nil {
+		Walk(v, variable)
+	}
+}
+
+func walkVersion(v Visitor, version *VersionLiteral) {
+	if version != nil {
+		Walk(v, version)
+	}
+}
+
+func walkBlock(v Visitor, b *BlockStatement) {
+	if b != nil {
+		Walk(v, b)
+	}
+}
+
+func walkType(v Visitor, t *TypeName) {
+	if t != nil {
+		Walk(v, t)
+	}
+}
+
+func walkAttributes(v Visitor, list []*Attribute) {
+	for _, a := range list {
+		Walk(v, a)
+	}
+}
+
+// isNil reports whether n is nil or a nil pointer.
+func isNil(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
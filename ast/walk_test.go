@@ -0,0 +1,215 @@
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	return program
+}
+
+func TestInspect(t *testing.T) {
+	program := parse(t, `
+class Point :isa(Shape) {
+    field $x :param = 0;
+    method move($dx, $dy = 1) { $x += $dx; }
+}
+`)
+
+	var visited []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n != nil {
+			visited = append(visited, fmt.Sprintf("%T %s", n, n.TokenLiteral()))
+		}
+		return true
+	})
+
+	expected := []string{
+		"*ast.Program class",
+		"*ast.ClassStatement class",
+		"*ast.Identifier Point",
+		"*ast.Attribute :isa",
+		"*ast.BlockStatement {",
+		"*ast.FieldStatement field",
+		"*ast.Variable $x",
+		"*ast.Attribute :param",
+		"*ast.IntegerLiteral 0",
+		"*ast.MethodStatement method",
+		"*ast.Identifier move",
+		"*ast.Signature (",
+		"*ast.Parameter $dx",
+		"*ast.Variable $dx",
+		"*ast.Parameter $dy",
+		"*ast.Variable $dy",
+		"*ast.IntegerLiteral 1",
+		"*ast.BlockStatement {",
+		"*ast.ExpressionStatement $x",
+		"*ast.InfixExpression +=",
+		"*ast.Variable $x",
+		"*ast.Variable $dx",
+	}
+	if got, want := strings.Join(visited, "\n"), strings.Join(expected, "\n"); got != want {
+		t.Errorf("wrong traversal.\nexpected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestInspectPrune(t *testing.T) {
+	program := parse(t, `sub f { g(1); } h(2);`)
+
+	var calls []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if _, ok := n.(*ast.SubStatement); ok {
+			return false
+		}
+		if call, ok := n.(*ast.CallExpression); ok {
+			calls = append(calls, call.Function.String())
+		}
+		return true
+	})
+
+	if len(calls) != 1 || calls[0] != "h" {
+		t.Errorf("expected only the call outside the sub, got %v", calls)
+	}
+}
+
+// depth records the nesting of the nodes it visits, checking that every
+// node is followed by a Visit(nil) once its children are done.
+type depth struct {
+	level, max *int
+}
+
+func (d depth) Visit(n ast.Node) ast.Visitor {
+	if n == nil {
+		*d.level--
+		return nil
+	}
+	*d.level++
+	*d.max = max(*d.max, *d.level)
+	return d
+}
+
+func TestWalk(t *testing.T) {
+	program := parse(t, `my $x = $h->{a}[0] ? foo(1, 2) : -$y;`)
+
+	var level, deepest int
+	ast.Walk(depth{&level, &deepest}, program)
+
+	if level != 0 {
+		t.Errorf("unbalanced Visit(nil) calls: level %d after the walk", level)
+	}
+	// Program, MyStatement, ConditionalExpression, Index, Index, Identifier
+	if deepest != 6 {
+		t.Errorf("expected depth 6, got %d", deepest)
+	}
+}
+
+func TestApplyReplace(t *testing.T) {
+	program := parse(t, `my $x = $y + 1; print $y;`)
+
+	result := ast.Apply(program, func(c *ast.Cursor) bool {
+		if v, ok := c.Node().(*ast.Variable); ok && v.Name == "y" {
+			c.Replace(&ast.Variable{Token: v.Token, Sigil: v.Sigil, Name: "z"})
+		}
+		return true
+	}, nil)
+
+	expected := "my $x = ($z + 1);\nprint $z"
+	if result.String() != expected {
+		t.Errorf("expected %q, got %q", expected, result.String())
+	}
+}
+
+func TestApplyRoot(t *testing.T) {
+	program := parse(t, `1;`)
+	replacement := &ast.Program{}
+
+	result := ast.Apply(program, func(c *ast.Cursor) bool {
+		if _, ok := c.Node().(*ast.Program); ok {
+			c.Replace(replacement)
+			return false
+		}
+		return true
+	}, nil)
+
+	if result != replacement {
+		t.Errorf("expected the root to be replaced, got %v", result)
+	}
+}
+
+func TestApplyDeleteAndInsert(t *testing.T) {
+	program := parse(t, `sub f { debug(1); a(); debug(2); b(); }`)
+
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		stmt, ok := c.Node().(*ast.ExpressionStatement)
+		if !ok {
+			return true
+		}
+		switch stmt.Expression.(*ast.CallExpression).Function.String() {
+		case "debug":
+			c.Delete()
+		case "a":
+			c.InsertBefore(parse(t, `before();`).Statements[0])
+			c.InsertAfter(parse(t, `after();`).Statements[0])
+		}
+		return false
+	}, nil)
+
+	expected := "sub f { before(); a(); after(); b() }"
+	if program.String() != expected {
+		t.Errorf("expected %q, got %q", expected, program.String())
+	}
+}
+
+func TestApplyPostAbort(t *testing.T) {
+	program := parse(t, `a(); b(); c();`)
+
+	var seen []string
+	ast.Apply(program, nil, func(c *ast.Cursor) bool {
+		if stmt, ok := c.Node().(*ast.ExpressionStatement); ok {
+			seen = append(seen, stmt.String())
+			return stmt.String() != "b()"
+		}
+		return true
+	})
+
+	if strings.Join(seen, " ") != "a() b()" {
+		t.Errorf("expected traversal to stop after b(), saw %v", seen)
+	}
+}
+
+func TestApplyCursor(t *testing.T) {
+	program := parse(t, `sub f($a) {}`)
+
+	var found bool
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		if p, ok := c.Node().(*ast.Parameter); ok {
+			found = true
+			if _, ok := c.Parent().(*ast.Signature); !ok {
+				t.Errorf("expected the parameter's parent to be a signature, got %T", c.Parent())
+			}
+			if c.Name() != "Parameters" || c.Index() != 0 {
+				t.Errorf("expected Parameters[0], got %s[%d]", c.Name(), c.Index())
+			}
+			if p.Name.String() != "$a" {
+				t.Errorf("expected $a, got %s", p.Name)
+			}
+		}
+		return true
+	}, nil)
+
+	if !found {
+		t.Errorf("parameter not visited")
+	}
+}
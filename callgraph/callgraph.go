@@ -0,0 +1,362 @@
+// Package callgraph finds which subs and methods of a program call which,
+// and indexes where each sub, method and variable is defined and used,
+// for navigating a codebase.
+//
+// A call is resolved to what it runs where the source says: a sub
+// called by its name, as NAME(...), as a bareword once it is declared or
+// with &NAME; a method called on a class by name, as Class->method; and
+// a method called on an object whose class is known. An object's class
+// is known for $self, which is an instance of the package it is used
+// in, and for a variable assigned Class->new(...). Methods are looked
+// up through the class hierarchy, so a call may resolve to a method a
+// class inherits or takes from a role. Other calls, such as those of
+// builtins or on objects of unknown class, are recorded without a
+// callee.
+package callgraph
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/hierarchy"
+	"github.com/perigrin/simian/resolve"
+)
+
+// Func is a sub or method with a body.
+type Func struct {
+	Name   string // qualified, such as "main::f" or "Dog::bark"
+	Method bool
+
+	// Decl is the *ast.SubStatement or *ast.MethodStatement that
+	// defines it; the last, if it is defined more than once.
+	Decl ast.Statement
+
+	// Calls holds the calls its body makes, and Callers the calls that
+	// run it, in the order they appear.
+	Calls   []*Call
+	Callers []*Call
+}
+
+// Call is a call of a sub or method.
+type Call struct {
+	// Caller is the sub or method the call is made in, nil at the top
+	// level of the program.
+	Caller *Func
+
+	// Callee is what the call runs, nil if it isn't defined in the
+	// program.
+	Callee *Func
+
+	// Name is the qualified name of what is called, or the name as it
+	// is written if its package isn't known: "print" for a builtin,
+	// "bark" for a method called on an object of unknown class.
+	Name   string
+	Method bool
+
+	// Node is the *ast.CallExpression, *ast.MethodCall, *ast.Identifier
+	// or *ast.Variable making the call.
+	Node ast.Expression
+}
+
+// Graph is the call graph of a program.
+type Graph struct {
+	// Funcs holds the subs and methods by qualified name, and Order the
+	// same in the order they are defined.
+	Funcs map[string]*Func
+	Order []*Func
+
+	// Calls holds every call in the program in the order they appear.
+	Calls []*Call
+
+	// Index holds the definitions and uses of every name.
+	Index *Index
+}
+
+// Lookup returns the subs and methods called name: the one with that
+// qualified name, or every one with that name in any package.
+func (g *Graph) Lookup(name string) []*Func {
+	if f := g.Funcs[name]; f != nil {
+		return []*Func{f}
+	}
+	var out []*Func
+	for _, f := range g.Order {
+		if shortName(f.Name) == name {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// Build builds the call graph and index of program, whose variables info
+// resolves.
+func Build(program *ast.Program, info *resolve.Info) *Graph {
+	b := &builder{
+		graph:     &Graph{Funcs: make(map[string]*Func)},
+		info:      info,
+		hierarchy: hierarchy.Check(program),
+		decls:     make(map[ast.Statement]*Func),
+		declared:  make(map[*Func]bool),
+		classes:   make(map[*resolve.Symbol]string),
+		index:     newIndex(),
+	}
+
+	// every sub is known before any call, since a sub may be called
+	// before it is defined
+	b.collecting = true
+	ast.Apply(program, b.pre, b.post)
+	b.collecting = false
+	ast.Apply(program, b.pre, b.post)
+
+	b.variables()
+	b.graph.Index = b.index.sorted()
+	return b.graph
+}
+
+type builder struct {
+	graph     *Graph
+	info      *resolve.Info
+	hierarchy *hierarchy.Info
+
+	// whether the walk collects the subs and methods, or the calls
+	collecting bool
+
+	// the sub or method being walked, nil at the top level, and those
+	// it is nested in
+	current *Func
+	outer   []*Func
+
+	// the sub or method each declaration with a body defines
+	decls map[ast.Statement]*Func
+
+	// the subs declared so far in the walk of the calls
+	declared map[*Func]bool
+
+	// the class of each variable assigned Class->new(...)
+	classes map[*resolve.Symbol]string
+
+	index *Index
+}
+
+func (b *builder) pre(cur *ast.Cursor) bool {
+	switch n := cur.Node().(type) {
+	case nil:
+		return false
+
+	case *ast.SubStatement:
+		b.enter(n, n.Name, n.Body, false)
+	case *ast.MethodStatement:
+		b.enter(n, n.Name, n.Body, true)
+	}
+	if b.collecting {
+		return true
+	}
+
+	switch n := cur.Node().(type) {
+	case *ast.MyStatement:
+		b.assign(n.Name, n.Value)
+	case *ast.InfixExpression:
+		if n.Operator == "=" {
+			b.assign(n.Left, n.Right)
+		}
+
+	case *ast.CallExpression:
+		if name, ok := n.Function.(*ast.Identifier); ok && !n.Arrow {
+			b.function(n, name, name.Value)
+		}
+	case *ast.Identifier:
+		switch cur.Name() {
+		case "Name", "Module", "Method", "Function", "Invocant":
+			// names of things, not barewords
+		default:
+			// a bareword is a call once the sub is declared
+			if f := b.graph.Funcs[b.info.Qualify(n, n.Value)]; f != nil && !f.Method && b.declared[f] {
+				b.function(n, n, n.Value)
+			}
+		}
+	case *ast.Variable:
+		if n.Sigil == ast.CodeSigil {
+			b.function(n, n, n.Name)
+		}
+	case *ast.MethodCall:
+		b.method(n)
+	}
+	return true
+}
+
+func (b *builder) post(cur *ast.Cursor) bool {
+	switch cur.Node().(type) {
+	case *ast.SubStatement, *ast.MethodStatement:
+		b.current = b.outer[len(b.outer)-1]
+		b.outer = b.outer[:len(b.outer)-1]
+	}
+	return true
+}
+
+// enter starts walking the body of a sub or method, which the first walk
+// defines.
+func (b *builder) enter(decl ast.Statement, name *ast.Identifier, body *ast.BlockStatement, method bool) {
+	b.outer = append(b.outer, b.current)
+	b.current = b.decls[decl]
+	if !b.collecting {
+		if f := b.graph.Funcs[b.info.Qualify(decl, name.Value)]; f != nil {
+			b.declared[f] = true
+		}
+		return
+	}
+
+	qualified := b.info.Qualify(decl, name.Value)
+	b.index.define(qualified, kindOf(method), name)
+	if body == nil {
+		// a forward declaration, or a method a role requires
+		return
+	}
+	f := b.graph.Funcs[qualified]
+	if f == nil {
+		f = &Func{Name: qualified, Method: method}
+		b.graph.Funcs[qualified] = f
+		b.graph.Order = append(b.graph.Order, f)
+	}
+	f.Decl = decl
+	b.decls[decl] = f
+}
+
+// function records a call of the sub name, made by call with name
+// written at at.
+func (b *builder) function(call ast.Expression, at ast.Node, name string) {
+	qualified := b.info.Qualify(at, name)
+	if f := b.graph.Funcs[qualified]; f != nil {
+		b.record(call, at, f, qualified, false)
+		return
+	}
+	if strings.Contains(name, "::") {
+		// a sub of another package, defined outside the program
+		b.record(call, at, nil, qualified, false)
+		return
+	}
+	b.record(call, at, nil, name, false)
+}
+
+// method records a method call, resolving it if the class of the
+// invocant is known.
+func (b *builder) method(call *ast.MethodCall) {
+	name := call.Method.Value
+	if strings.HasPrefix(name, "$") {
+		// the method is chosen at run time
+		return
+	}
+	class := b.classOf(call.Invocant)
+	if class == "" {
+		b.record(call, call.Method, nil, name, true)
+		return
+	}
+	if f := b.lookupMethod(class, name); f != nil {
+		b.record(call, call.Method, f, f.Name, true)
+		return
+	}
+	b.record(call, call.Method, nil, class+"::"+name, true)
+}
+
+// lookupMethod returns the method class calls by name: for a class or
+// role, the one it defines, inherits or composes; for a package, its
+// sub.
+func (b *builder) lookupMethod(class, name string) *Func {
+	if c := b.hierarchy.Classes[class]; c != nil {
+		if m := c.Method(name); m != nil {
+			return b.decls[m]
+		}
+		return nil
+	}
+	return b.graph.Funcs[class+"::"+name]
+}
+
+// classOf returns the class of an invocant, if it is known.
+func (b *builder) classOf(inv ast.Expression) string {
+	switch inv := inv.(type) {
+	case *ast.Identifier:
+		return strings.TrimPrefix(inv.Value, "::")
+	case *ast.Variable:
+		sym := b.info.SymbolOf(inv)
+		if sym == nil {
+			return ""
+		}
+		if sym.Name == "$self" && sym.Scope != nil {
+			return sym.Scope.Package
+		}
+		return b.classes[sym]
+	}
+	return ""
+}
+
+// assign notes the class of a variable assigned a new object, as in
+// `my $dog = Dog->new(...)`.
+func (b *builder) assign(target, value ast.Expression) {
+	v, ok := target.(*ast.Variable)
+	if !ok || v.Sigil != ast.ScalarSigil {
+		return
+	}
+	sym := b.info.SymbolOf(v)
+	call, ok := value.(*ast.MethodCall)
+	if sym == nil || !ok || call.Method.Value != "new" {
+		return
+	}
+	if class, ok := call.Invocant.(*ast.Identifier); ok {
+		b.classes[sym] = b.classOf(class)
+	}
+}
+
+func (b *builder) record(node ast.Expression, at ast.Node, callee *Func, name string, method bool) {
+	c := &Call{Caller: b.current, Callee: callee, Name: name, Method: method, Node: node}
+	b.graph.Calls = append(b.graph.Calls, c)
+	if b.current != nil {
+		b.current.Calls = append(b.current.Calls, c)
+	}
+	if callee != nil {
+		callee.Callers = append(callee.Callers, c)
+	}
+	if callee != nil || strings.Contains(name, "::") {
+		b.index.use(name, kindOf(method), at)
+	}
+}
+
+// variables indexes the variables info resolves.
+func (b *builder) variables() {
+	for v, sym := range b.info.Defs {
+		if v.Sigil != ast.CodeSigil {
+			b.index.symbol(sym).Defs = append(b.index.symbol(sym).Defs, v)
+		}
+	}
+	for v, sym := range b.info.Uses {
+		if v.Sigil != ast.CodeSigil {
+			b.index.symbol(sym).Uses = append(b.index.symbol(sym).Uses, v)
+		}
+	}
+}
+
+func kindOf(method bool) Kind {
+	if method {
+		return Method
+	}
+	return Sub
+}
+
+// shortName returns name without its package, keeping any sigil:
+// "$main::x" is "$x".
+func shortName(name string) string {
+	i := strings.LastIndex(name, "::")
+	if i < 0 {
+		return name
+	}
+	if strings.IndexByte("$@%&*", name[0]) >= 0 {
+		return name[:1] + name[i+2:]
+	}
+	return name[i+2:]
+}
+
+func offset(n ast.Node) int {
+	return ast.SpanOf(n).Start
+}
+
+func sortNodes(nodes []ast.Node) {
+	sort.SliceStable(nodes, func(i, j int) bool { return offset(nodes[i]) < offset(nodes[j]) })
+}
@@ -0,0 +1,172 @@
+package callgraph_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/callgraph"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+)
+
+func build(t *testing.T, input string) *callgraph.Graph {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	return callgraph.Build(program, resolve.Resolve(program))
+}
+
+// calls describes each call as caller -> name, with a ? for a callee
+// the program doesn't define.
+func calls(g *callgraph.Graph) string {
+	var out []string
+	for _, c := range g.Calls {
+		caller := "top"
+		if c.Caller != nil {
+			caller = c.Caller.Name
+		}
+		name := c.Name
+		if c.Callee == nil {
+			name += "?"
+		}
+		out = append(out, caller+" -> "+name)
+	}
+	return strings.Join(out, ", ")
+}
+
+// offsets describes where the nodes are.
+func offsets(nodes []ast.Node) string {
+	var out []string
+	for _, n := range nodes {
+		out = append(out, fmt.Sprint(ast.SpanOf(n).Start))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sub f { g(1) } sub g { print "g" } f();`, "main::f -> main::g, main::g -> print?, top -> main::f"},
+		{`sub f { } sub g { f; &f; &f(1) }`, "main::g -> main::f, main::g -> main::f, main::g -> main::f"},
+		{`f; sub f { }`, ""},
+		{`sub f; f; sub f { }`, "top -> main::f"},
+		{`package Foo; sub f { } package main; Foo::f(); f(); Bar::g();`, "top -> Foo::f, top -> f?, top -> Bar::g?"},
+		{`sub outer { sub inner { a() } b() }`, "main::inner -> a?, main::outer -> b?"},
+		{`class A { method m { $self->n } method n { } } A->new->m;`, "A::m -> A::n, top -> m?, top -> A::new?"},
+		{`class P { method m { } } class C :isa(P) { method n { $self->m } }`, "C::n -> P::m"},
+		{`role R { method r { } } class C :does(R) { method n { $self->r; $self->x } }`, "C::n -> R::r, C::n -> C::x?"},
+		{`class C { method m { } } my $c = C->new; $c->m; $other->m; $c->$name;`, "top -> C::new?, top -> C::m, top -> m?"},
+		{`package Counter; sub new { bless {} } sub inc { my $self = shift; $self->add(1) } sub add { }`, "Counter::new -> bless?, Counter::inc -> Counter::add"},
+	}
+
+	for _, tt := range tests {
+		g := build(t, tt.input)
+		if got := calls(g); got != tt.expected {
+			t.Errorf("%s:\nexpected %s\ngot      %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	g := build(t, `
+package A; sub run { B::run() }
+package B; sub run { helper() } sub helper { }
+package main; A::run();
+`)
+	if got := len(g.Lookup("run")); got != 2 {
+		t.Errorf("expected 2 subs called run, got %d", got)
+	}
+	found := g.Lookup("B::run")
+	if len(found) != 1 {
+		t.Fatalf("expected one B::run, got %d", len(found))
+	}
+	b := found[0]
+	if len(b.Callers) != 1 || b.Callers[0].Caller != g.Funcs["A::run"] {
+		t.Errorf("expected B::run to be called by A::run, got %v", b.Callers)
+	}
+	if len(b.Calls) != 1 || b.Calls[0].Callee != g.Funcs["B::helper"] {
+		t.Errorf("expected B::run to call B::helper, got %v", b.Calls)
+	}
+	if got := g.Lookup("missing"); len(got) != 0 {
+		t.Errorf("expected nothing called missing, got %v", got)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	input := `sub f { my $x = shift; $x + $y } f(1); our $y; $y = f(2); my $x; $main::y;`
+	g := build(t, input)
+
+	tests := []struct {
+		name     string
+		expected []string // kind name defs / uses, one per entry
+	}{
+		{"f", []string{"sub main::f 4 / 33 52"}},
+		{"main::f", []string{"sub main::f 4 / 33 52"}},
+		{"$x", []string{"variable $x 11 / 23", "variable $x 61 / "}},
+		{"$y", []string{"variable $main::y 43 / 28 47 65"}},
+		{"$main::y", []string{"variable $main::y 43 / 28 47 65"}},
+		{"shift", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, e := range g.Index.Lookup(tt.name) {
+			got = append(got, fmt.Sprintf("%s %s %s / %s", e.Kind, e.Name, offsets(e.Defs), offsets(e.Uses)))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.name, strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+		}
+	}
+
+	var names []string
+	for _, e := range g.Index.Entries {
+		names = append(names, e.Name)
+	}
+	if got := strings.Join(names, " "); got != "main::f $x $main::y $x" {
+		t.Errorf("unexpected entries %s", got)
+	}
+
+	// variables interpolated into strings are uses too
+	g = build(t, `my %h; print "$h{a} @{[ f() ]}"; sub f { }`)
+	var got []string
+	for _, e := range g.Index.Entries {
+		got = append(got, fmt.Sprintf("%s %s / %s", e.Name, offsets(e.Defs), offsets(e.Uses)))
+	}
+	if expected := "%h 3 / 14\nmain::f 37 / 24"; strings.Join(got, "\n") != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, strings.Join(got, "\n"))
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := build(t, `
+class Greeter { method greet { $self->name; $self->name } method name { } }
+sub main { Greeter->new->greet; log() } sub log { }
+main();
+`)
+	var out bytes.Buffer
+	if err := g.WriteDOT(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph calls {
+	"(top level)" [shape=plaintext];
+	"Greeter::greet" [shape=box];
+	"Greeter::name" [shape=box];
+	"main::main";
+	"main::log";
+	"Greeter::greet" -> "Greeter::name" [label=2];
+	"main::main" -> "main::log";
+	"(top level)" -> "main::main";
+}
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,63 @@
+package callgraph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// top is the node the calls made at the top level of the program come
+// from.
+const top = "(top level)"
+
+// WriteDOT writes g to w as a Graphviz digraph, with a node for each sub
+// and method and an edge from each to those it calls. Methods are
+// boxes. Calls of what the program doesn't define are left out, and
+// several calls from one sub to another are drawn as one edge labelled
+// with their number.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("digraph calls {\n")
+
+	type edge struct{ from, to string }
+	var edges []edge
+	count := make(map[edge]int)
+	for _, c := range g.Calls {
+		if c.Callee == nil {
+			continue
+		}
+		e := edge{top, c.Callee.Name}
+		if c.Caller != nil {
+			e.from = c.Caller.Name
+		}
+		if count[e] == 0 {
+			edges = append(edges, e)
+		}
+		count[e]++
+	}
+
+	for _, e := range edges {
+		if e.from == top {
+			fmt.Fprintf(b, "\t%s [shape=plaintext];\n", strconv.Quote(top))
+			break
+		}
+	}
+	for _, f := range g.Order {
+		if f.Method {
+			fmt.Fprintf(b, "\t%s [shape=box];\n", strconv.Quote(f.Name))
+		} else {
+			fmt.Fprintf(b, "\t%s;\n", strconv.Quote(f.Name))
+		}
+	}
+	for _, e := range edges {
+		fmt.Fprintf(b, "\t%s -> %s", strconv.Quote(e.from), strconv.Quote(e.to))
+		if n := count[e]; n > 1 {
+			fmt.Fprintf(b, " [label=%d]", n)
+		}
+		b.WriteString(";\n")
+	}
+
+	b.WriteString("}\n")
+	return b.Flush()
+}
@@ -0,0 +1,142 @@
+package callgraph
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/resolve"
+)
+
+// Kind says what an Entry names.
+type Kind int
+
+const (
+	Sub Kind = iota
+	Method
+	Variable
+)
+
+var kinds = [...]string{"sub", "method", "variable"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kinds) {
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+	return kinds[k]
+}
+
+// Entry is what the index knows about a name: where it is defined and
+// where it is used.
+type Entry struct {
+	// Name is the qualified name of a sub, method or package variable,
+	// such as "Dog::bark" or "$main::x", or the name of a lexical
+	// variable, such as "$x".
+	Name string
+	Kind Kind
+
+	// Symbol is the variable a Variable entry is for. Two lexicals of
+	// the same name have an entry each.
+	Symbol *resolve.Symbol
+
+	// Defs holds the names in the declarations, and Uses the names
+	// everywhere else, in the order they appear. A sub called outside
+	// the program has no definition, and $self none either.
+	Defs []ast.Node
+	Uses []ast.Node
+}
+
+// Index is a cross-reference of the subs, methods and variables of a
+// program. A call whose target isn't known, such as that of a builtin,
+// isn't a use of anything.
+type Index struct {
+	// Entries holds every entry in the order the names first appear.
+	Entries []*Entry
+
+	names   map[string]*Entry
+	symbols map[*resolve.Symbol]*Entry
+	short   map[string][]*Entry
+}
+
+func newIndex() *Index {
+	return &Index{names: make(map[string]*Entry), symbols: make(map[*resolve.Symbol]*Entry)}
+}
+
+// Lookup returns the entries for name: the sub, method or package
+// variable with that qualified name, or every entry with that name in
+// any package or scope. A variable's name includes its sigil.
+func (x *Index) Lookup(name string) []*Entry {
+	if e := x.names[name]; e != nil {
+		return []*Entry{e}
+	}
+	return x.short[name]
+}
+
+func (x *Index) entry(name string, kind Kind) *Entry {
+	e := x.names[name]
+	if e == nil {
+		e = &Entry{Name: name, Kind: kind}
+		x.names[name] = e
+		x.Entries = append(x.Entries, e)
+	}
+	return e
+}
+
+func (x *Index) define(name string, kind Kind, at ast.Node) {
+	e := x.entry(name, kind)
+	e.Defs = append(e.Defs, at)
+}
+
+func (x *Index) use(name string, kind Kind, at ast.Node) {
+	e := x.entry(name, kind)
+	e.Uses = append(e.Uses, at)
+}
+
+// symbol returns the entry for a variable. Package variables are
+// indexed by their qualified name, so that an our and the uses of the
+// same variable elsewhere share it.
+func (x *Index) symbol(sym *resolve.Symbol) *Entry {
+	if e := x.symbols[sym]; e != nil {
+		return e
+	}
+	var e *Entry
+	if sym.Kind == resolve.Our || sym.Kind == resolve.Global {
+		e = x.entry(sym.QualifiedName(), Variable)
+	} else {
+		e = &Entry{Name: sym.Name, Kind: Variable}
+		x.Entries = append(x.Entries, e)
+	}
+	if e.Symbol == nil {
+		e.Symbol = sym
+	}
+	x.symbols[sym] = e
+	return e
+}
+
+// sorted puts the definitions, uses and entries of x in source order,
+// and returns it ready to look names up in.
+func (x *Index) sorted() *Index {
+	for _, e := range x.Entries {
+		sortNodes(e.Defs)
+		sortNodes(e.Uses)
+	}
+	sort.SliceStable(x.Entries, func(i, j int) bool { return first(x.Entries[i]) < first(x.Entries[j]) })
+
+	x.short = make(map[string][]*Entry)
+	for _, e := range x.Entries {
+		name := shortName(e.Name)
+		x.short[name] = append(x.short[name], e)
+	}
+	return x
+}
+
+// first returns the offset of the first definition or use of e.
+func first(e *Entry) int {
+	at := -1
+	for _, list := range [][]ast.Node{e.Defs, e.Uses} {
+		if len(list) > 0 && (at < 0 || offset(list[0]) < at) {
+			at = offset(list[0])
+		}
+	}
+	return at
+}
@@ -0,0 +1,462 @@
+// Package cfg builds the control-flow graph of each sub and method in a
+// program: its body divided into basic blocks, runs of statements that
+// execute one after another, joined by the jumps between them.
+//
+// Branches come from if, unless and elsif, loops from while, until, for
+// and foreach, and the statement modifiers do both, as in `print if $x`
+// and `f($_) for @list`. next, last and redo jump within the innermost
+// loop or the one their label names; a bare block is a loop that runs
+// once, as in perl. return jumps to the exit, while die, croak, confess
+// and exit end the path there. A loop whose condition is always true,
+// such as while (1), only ends with last.
+//
+// Check uses the graphs to warn about code no path reaches, and about
+// subs that return a value on some paths but run off the end of their
+// body on others.
+package cfg
+
+import (
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/resolve"
+	"github.com/perigrin/simian/token"
+)
+
+// Block is a basic block.
+type Block struct {
+	Index int
+
+	// Comment says what the block is, such as "entry", "if.then" or
+	// "while.head".
+	Comment string
+
+	// Nodes holds the statements in the block, then the condition or
+	// list that decides where it goes next, if any. A compound
+	// statement, such as an if, isn't a node itself: its condition
+	// ends the block it starts in.
+	Nodes []ast.Node
+
+	Succs []*Block
+	Preds []*Block
+
+	// Live reports whether a path from the entry reaches the block.
+	Live bool
+}
+
+// Graph is the control-flow graph of a sub or method.
+type Graph struct {
+	Name string // qualified, such as "main::f"
+	Decl ast.Statement
+
+	// Blocks holds the blocks in the order they were made; the first is
+	// the entry and the second the exit, which return and running off
+	// the end of the body go to.
+	Blocks []*Block
+
+	body *ast.BlockStatement
+
+	// the block each statement starts in
+	starts map[ast.Statement]*Block
+}
+
+// Entry returns the block the body starts in.
+func (g *Graph) Entry() *Block { return g.Blocks[0] }
+
+// Exit returns the block every return goes to.
+func (g *Graph) Exit() *Block { return g.Blocks[1] }
+
+// New builds the graph of the body of decl, a sub or method called name.
+func New(name string, decl ast.Statement, body *ast.BlockStatement) *Graph {
+	g := &Graph{Name: name, Decl: decl, body: body, starts: make(map[ast.Statement]*Block)}
+	b := &builder{g: g}
+	b.current = b.newBlock("entry")
+	exit := b.newBlock("exit")
+	b.statements(body.Statements)
+	b.jump(exit)
+	g.mark(g.Entry())
+	return g
+}
+
+// Build builds the graph of every sub and method with a body in program,
+// in the order they are declared.
+func Build(program *ast.Program, info *resolve.Info) []*Graph {
+	var graphs []*Graph
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SubStatement:
+			if n.Body != nil {
+				graphs = append(graphs, New(info.Qualify(n, n.Name.Value), n, n.Body))
+			}
+		case *ast.MethodStatement:
+			if n.Body != nil {
+				graphs = append(graphs, New(info.Qualify(n, n.Name.Value), n, n.Body))
+			}
+		}
+		return true
+	})
+	return graphs
+}
+
+// mark marks the blocks reachable from b live.
+func (g *Graph) mark(b *Block) {
+	if b.Live {
+		return
+	}
+	b.Live = true
+	for _, s := range b.Succs {
+		g.mark(s)
+	}
+}
+
+type builder struct {
+	g       *Graph
+	current *Block
+
+	// the loops around the statement being built, innermost last
+	loops []*loop
+
+	// the label of the statement being built, for the loop it names
+	label string
+}
+
+// loop is where next, last and redo go in a loop.
+type loop struct {
+	label            string
+	next, last, redo *Block
+}
+
+func (b *builder) newBlock(comment string) *Block {
+	block := &Block{Index: len(b.g.Blocks), Comment: comment}
+	b.g.Blocks = append(b.g.Blocks, block)
+	return block
+}
+
+func (b *builder) add(n ast.Node) {
+	addTo(b.current, n)
+}
+
+// addTo appends n to block, leaving out the parts a statement can omit,
+// such as the condition of `for (;;)`, and those missing from a tree
+// with syntax errors.
+func addTo(block *Block, n ast.Node) {
+	if n != nil {
+		block.Nodes = append(block.Nodes, n)
+	}
+}
+
+// jump goes from the current block to to.
+func (b *builder) jump(to *Block) {
+	link(b.current, to)
+}
+
+func link(from, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// stop ends the current path. What follows runs only if something jumps
+// to it, which nothing can: it is unreachable.
+func (b *builder) stop() {
+	b.current = b.newBlock("unreachable")
+}
+
+// inLoop builds the body of a loop with label, in which next, last and
+// redo go to the blocks given.
+func (b *builder) inLoop(label string, next, last, redo *Block, body func()) {
+	b.loops = append(b.loops, &loop{label, next, last, redo})
+	body()
+	b.loops = b.loops[:len(b.loops)-1]
+}
+
+func (b *builder) statements(list []ast.Statement) {
+	for _, s := range list {
+		b.statement(s)
+	}
+}
+
+func (b *builder) statement(s ast.Statement) {
+	if compiled(s) {
+		// perl handles these as it compiles, so they can't be
+		// unreachable and have no place in the flow
+		return
+	}
+	b.g.starts[s] = b.current
+	label := b.label
+	b.label = ""
+
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		b.add(s)
+		if dies(s.Expression) {
+			b.stop()
+		}
+
+	case *ast.ReturnStatement:
+		b.add(s)
+		b.jump(b.g.Exit())
+		b.stop()
+
+	case *ast.LoopControlStatement:
+		b.add(s)
+		if to := b.target(s); to != nil {
+			b.jump(to)
+		}
+		b.stop()
+
+	case *ast.BlockStatement:
+		// a bare block is a loop that runs once
+		body := b.newBlock("block")
+		done := b.newBlock("block.done")
+		b.jump(body)
+		b.current = body
+		b.inLoop(label, done, done, body, func() { b.statements(s.Statements) })
+		b.jump(done)
+		b.current = done
+
+	case *ast.LabeledStatement:
+		b.label = s.Label
+		b.statement(s.Statement)
+
+	case *ast.IfStatement:
+		b.ifStatement(s)
+	case *ast.WhileStatement:
+		b.whileStatement(s, label)
+	case *ast.ForStatement:
+		b.forStatement(s, label)
+	case *ast.ForeachStatement:
+		b.foreachStatement(s, label)
+	case *ast.ModifiedStatement:
+		b.modifiedStatement(s)
+
+	default:
+		// declarations, and packages and phase blocks, whose bodies
+		// don't run here
+		b.add(s)
+	}
+}
+
+// compiled reports whether s is a named sub or method, which has a graph
+// of its own, or a use, which perl runs at compile time.
+func compiled(s ast.Statement) bool {
+	switch s := s.(type) {
+	case *ast.SubStatement:
+		return s.Name != nil
+	case *ast.MethodStatement:
+		return s.Name != nil
+	case *ast.UseStatement:
+		return true
+	}
+	return false
+}
+
+// target returns the block a next, last or redo goes to, or nil if it
+// isn't in a loop, or not one with its label; perl then leaves the sub.
+func (b *builder) target(s *ast.LoopControlStatement) *Block {
+	for i := len(b.loops) - 1; i >= 0; i-- {
+		l := b.loops[i]
+		if s.Label != nil && s.Label.Value != l.label {
+			continue
+		}
+		switch s.TokenLiteral() {
+		case "next":
+			return l.next
+		case "last":
+			return l.last
+		default:
+			return l.redo
+		}
+	}
+	return nil
+}
+
+func (b *builder) ifStatement(s *ast.IfStatement) {
+	b.add(s.Condition)
+	cond := b.current
+	kind := s.TokenLiteral()
+
+	then := b.newBlock(kind + ".then")
+	link(cond, then)
+	b.current = then
+	b.statements(s.Consequence.Statements)
+	then = b.current
+
+	var els *Block
+	if s.Alternative != nil {
+		els = b.newBlock(kind + ".else")
+		link(cond, els)
+		b.current = els
+		if block, ok := s.Alternative.(*ast.BlockStatement); ok {
+			// not a bare block, which last would leave
+			b.g.starts[block] = els
+			b.statements(block.Statements)
+		} else {
+			b.statement(s.Alternative)
+		}
+		els = b.current
+	}
+
+	done := b.newBlock(kind + ".done")
+	link(then, done)
+	if els != nil {
+		link(els, done)
+	} else {
+		link(cond, done)
+	}
+	b.current = done
+}
+
+func (b *builder) whileStatement(s *ast.WhileStatement, label string) {
+	kind := s.TokenLiteral()
+	head := b.newBlock(kind + ".head")
+	b.jump(head)
+	addTo(head, s.Condition)
+	body := b.newBlock(kind + ".body")
+	next := head
+	var cont *Block
+	if s.Continue != nil {
+		cont = b.newBlock(kind + ".continue")
+		next = cont
+	}
+	done := b.newBlock(kind + ".done")
+
+	link(head, body)
+	if s.Condition == nil || !always(s.Condition, kind == "while") {
+		link(head, done)
+	}
+	b.current = body
+	b.inLoop(label, next, done, body, func() { b.statements(s.Body.Statements) })
+	b.jump(next)
+	if cont != nil {
+		b.current = cont
+		b.statements(s.Continue.Statements)
+		b.jump(head)
+	}
+	b.current = done
+}
+
+func (b *builder) forStatement(s *ast.ForStatement, label string) {
+	if s.Init != nil {
+		b.add(s.Init)
+	}
+	head := b.newBlock("for.head")
+	b.jump(head)
+	addTo(head, s.Condition)
+	body := b.newBlock("for.body")
+	post := b.newBlock("for.post")
+	done := b.newBlock("for.done")
+
+	link(head, body)
+	if s.Condition != nil && !always(s.Condition, true) {
+		link(head, done)
+	}
+	b.current = body
+	b.inLoop(label, post, done, body, func() { b.statements(s.Body.Statements) })
+	b.jump(post)
+	addTo(post, s.Step)
+	link(post, head)
+	b.current = done
+}
+
+func (b *builder) foreachStatement(s *ast.ForeachStatement, label string) {
+	kind := s.TokenLiteral()
+	b.add(s.List)
+	head := b.newBlock(kind + ".head")
+	b.jump(head)
+	body := b.newBlock(kind + ".body")
+	next := head
+	var cont *Block
+	if s.Continue != nil {
+		cont = b.newBlock(kind + ".continue")
+		next = cont
+	}
+	done := b.newBlock(kind + ".done")
+
+	link(head, body)
+	link(head, done)
+	b.current = body
+	b.inLoop(label, next, done, body, func() { b.statements(s.Body.Statements) })
+	b.jump(next)
+	if cont != nil {
+		b.current = cont
+		b.statements(s.Continue.Statements)
+		b.jump(head)
+	}
+	b.current = done
+}
+
+// modifiedStatement builds a statement with a modifier. Unlike a loop
+// statement, a loop modifier isn't a loop next and last can leave.
+func (b *builder) modifiedStatement(s *ast.ModifiedStatement) {
+	kind := s.TokenLiteral()
+	switch s.Token.Type {
+	case token.IF, token.UNLESS:
+		b.add(s.Condition)
+		cond := b.current
+		then := b.newBlock(kind + ".then")
+		link(cond, then)
+		b.current = then
+		b.statement(s.Statement)
+		done := b.newBlock(kind + ".done")
+		b.jump(done)
+		link(cond, done)
+		b.current = done
+
+	default:
+		loopsOver := s.Token.Type == token.FOR || s.Token.Type == token.FOREACH
+		if loopsOver {
+			b.add(s.Condition)
+		}
+		head := b.newBlock(kind + ".head")
+		b.jump(head)
+		if !loopsOver {
+			addTo(head, s.Condition)
+		}
+		body := b.newBlock(kind + ".body")
+		done := b.newBlock(kind + ".done")
+		link(head, body)
+		if loopsOver || !always(s.Condition, kind == "while") {
+			link(head, done)
+		}
+		b.current = body
+		b.statement(s.Statement)
+		b.jump(head)
+		b.current = done
+	}
+}
+
+// dies reports whether e ends the program or throws an exception.
+func dies(e ast.Expression) bool {
+	if call, ok := e.(*ast.CallExpression); ok && !call.Arrow {
+		e = call.Function
+	}
+	name, ok := e.(*ast.Identifier)
+	if !ok {
+		return false
+	}
+	switch name.Value {
+	case "die", "croak", "confess", "exit":
+		return true
+	}
+	return false
+}
+
+// always reports whether the condition e of a loop is a constant that
+// is always want: true for while, false for until.
+func always(e ast.Expression, want bool) bool {
+	var truth bool
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		truth = e.Value != 0
+	case *ast.NumberLiteral:
+		truth = e.Value != 0
+	case *ast.BooleanLiteral:
+		truth = e.Value
+	case *ast.StringLiteral:
+		if e.Interpolates() {
+			return false
+		}
+		truth = e.Value != "" && e.Value != "0"
+	default:
+		return false
+	}
+	return truth == want
+}
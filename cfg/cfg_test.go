@@ -0,0 +1,209 @@
+package cfg_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/cfg"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+)
+
+func build(t *testing.T, input string) []*cfg.Graph {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	return cfg.Build(program, resolve.Resolve(program))
+}
+
+// edges describes the live edges of g as from->to, by block comment.
+func edges(g *cfg.Graph) string {
+	var out []string
+	for _, b := range g.Blocks {
+		if !b.Live {
+			continue
+		}
+		for _, s := range b.Succs {
+			out = append(out, b.Comment+"->"+s.Comment)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func TestBlocks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sub f { a(); b() }`, "entry->exit"},
+		{`sub f { return 1; a() }`, "entry->exit"},
+		{`sub f { if ($x) { a() } else { b() } }`,
+			"entry->if.then entry->if.else if.then->if.done if.else->if.done if.done->exit"},
+		{`sub f { while ($x) { if ($y) { a() } else { last } } }`,
+			"entry->while.head while.head->while.body while.head->while.done while.body->if.then while.body->if.else " +
+				"while.done->exit if.then->if.done if.else->while.done if.done->while.head"},
+		{`sub f { unless ($x) { a() } }`, "entry->unless.then entry->unless.done unless.then->unless.done unless.done->exit"},
+		{`sub f { while ($x) { next if $y; a() } }`,
+			"entry->while.head while.head->while.body while.head->while.done while.body->if.then while.body->if.done " +
+				"while.done->exit if.then->while.head if.done->while.head"},
+		{`sub f { while (1) { last } }`, "entry->while.head while.head->while.body while.body->while.done while.done->exit"},
+		{`sub f { for (my $i = 0; $i < 3; $i++) { redo } }`,
+			"entry->for.head for.head->for.body for.head->for.done for.body->for.body for.done->exit"},
+		{`sub f { foreach my $x (@list) { a() } continue { b() } }`,
+			"entry->foreach.head foreach.head->foreach.body foreach.head->foreach.done foreach.body->foreach.continue " +
+				"foreach.continue->foreach.head foreach.done->exit"},
+		{`sub f { foreach my $x () { } }`,
+			"entry->foreach.head foreach.head->foreach.body foreach.head->foreach.done foreach.body->foreach.head foreach.done->exit"},
+		{`sub f { { last; a() } b() }`, "entry->block block->block.done block.done->exit"},
+		{`sub f { die "no" }`, ""},
+		{`sub f { a() while $x }`, "entry->while.head while.head->while.body while.head->while.done while.body->while.head while.done->exit"},
+	}
+
+	for _, tt := range tests {
+		graphs := build(t, tt.input)
+		if len(graphs) != 1 {
+			t.Fatalf("%s: expected one graph, got %d", tt.input, len(graphs))
+		}
+		if got := edges(graphs[0]); got != tt.expected {
+			t.Errorf("%s:\nexpected %s\ngot      %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	graphs := build(t, `sub f { OUTER: while ($a) { for my $x (@list) { next OUTER; last } } }`)
+	g := graphs[0]
+	var next *cfg.Block
+	for _, b := range g.Blocks {
+		if b.Comment == "for.body" {
+			next = b
+		}
+	}
+	if next == nil {
+		t.Fatal("expected a for.body block")
+	}
+	if len(next.Succs) != 1 || next.Succs[0].Comment != "while.head" {
+		t.Fatalf("expected next OUTER to go to while.head, got %v", next.Succs)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	graphs := build(t, `
+sub f { }
+package Foo; sub g { sub h { } }
+class Bar { method m { } }
+sub Baz::k { }
+sub declared;
+`)
+	var names []string
+	for _, g := range graphs {
+		names = append(names, g.Name)
+	}
+	if got := strings.Join(names, " "); got != "main::f Foo::g Foo::h Bar::m Baz::k" {
+		t.Errorf("unexpected graphs %s", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // code@offset
+	}{
+		{`sub f { return 1; a() }`, []string{"E0800@18"}},
+		{`sub f { die "no"; a(); b() }`, []string{"E0800@18"}},
+		{`sub f { while (1) { a() } b() }`, []string{"E0800@26"}},
+		{`sub f { for (@x) { last; a() } b() }`, []string{"E0800@25"}},
+		{`sub f { if ($x) { return 1 } else { return 2 } a() }`, []string{"E0800@47"}},
+		{`sub f { return 1 if $x; a() }`, nil},
+		{`sub f { return 1; sub g { 1 } }`, nil},
+		{`sub f { return 1; sub g { 1 } use POSIX; a() }`, []string{"E0800@41"}},
+		{`sub f { if ($x) { return 1 } }`, []string{"E0801@4"}},
+		{`sub f { return 1 if $x; my $y = 2 }`, []string{"E0801@4"}},
+		{`sub f { if ($x) { return 1 } else { 0 } }`, nil},
+		{`sub f { return 1 if $x; die "no" }`, nil},
+		{`sub f { for (@x) { return $_ if $_ } return }`, nil},
+		{`sub f { for (@x) { return $_ if $_ } }`, []string{"E0801@4"}},
+		{`sub f { if ($x) { return } }`, nil},
+		{`class C { method m { return 1 unless $x; } }`, []string{"E0801@17"}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New([]byte(tt.input)))
+		program := p.ParseProgram()
+		if errors := p.Errors(); len(errors) > 0 {
+			t.Fatalf("%s: parser has %d errors: %v", tt.input, len(errors), errors)
+		}
+		var got []string
+		for _, d := range cfg.Check(program, resolve.Resolve(program)) {
+			if d.Severity != diagnostics.Warning {
+				t.Errorf("%s: expected a warning, got %s", tt.input, d)
+			}
+			got = append(got, fmt.Sprintf("%s@%d", d.Code, d.Span.Start))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("%s: expected %v, got %v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	graphs := build(t, `sub f { if ($x) { return 1 } die "no"; a() }`)
+	var out bytes.Buffer
+	if err := cfg.WriteDOT(&out, graphs...); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph cfg {
+	subgraph cluster_0 {
+		label="main::f";
+		g0_0 [shape=box,label="entry\n$x"];
+		g0_1 [shape=box,label="exit"];
+		g0_2 [shape=box,label="if.then\nreturn 1"];
+		g0_4 [shape=box,label="if.done\ndie \"no\""];
+		g0_5 [shape=box,label="unreachable\na()",style=dashed];
+		g0_0 -> g0_2;
+		g0_0 -> g0_4;
+		g0_2 -> g0_1;
+		g0_5 -> g0_1;
+	}
+}
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	for _, input := range []string{
+		`sub f { my $x = 1 + ; }`,
+		`sub f { if () { 1 } }`,
+	} {
+		p := parser.New(lexer.New([]byte(input)))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Fatalf("%s: expected parse errors", input)
+		}
+		var out bytes.Buffer
+		if err := cfg.WriteDOT(&out, cfg.Build(program, resolve.Resolve(program))...); err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+	}
+}
+
+func TestWriteDOTLabels(t *testing.T) {
+	graphs := build(t, `sub f { print "\\ é"; print "ééééééééééééééééééééééééééééééééééééééééé" }`)
+	var out bytes.Buffer
+	if err := cfg.WriteDOT(&out, graphs...); err != nil {
+		t.Fatal(err)
+	}
+	expected := `label="entry\nprint \"\\\\ é\"\nprint \"éééééééééééééééééééééééééééééé..."`
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected a label with\n%s\ngot\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,142 @@
+package cfg
+
+import (
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/resolve"
+)
+
+// Check builds the graph of each sub and method in program and warns
+// about the code in them no path reaches, and about those that return a
+// value on some paths but not others.
+func Check(program *ast.Program, info *resolve.Info) []diagnostics.Diagnostic {
+	var diags []diagnostics.Diagnostic
+	for _, g := range Build(program, info) {
+		for _, s := range g.Unreachable() {
+			d := diagnostics.Errorf(diagnostics.UnreachableCode, ast.SpanOf(s), "unreachable code")
+			d.Severity = diagnostics.Warning
+			diags = append(diags, d)
+		}
+		if d, ok := g.missingReturn(); ok {
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+// Unreachable returns the statements no path from the entry reaches,
+// only the first of each run of them in a block.
+func (g *Graph) Unreachable() []ast.Statement {
+	var dead []ast.Statement
+	var visit func(list []ast.Statement)
+	visit = func(list []ast.Statement) {
+		for _, s := range list {
+			if b := g.starts[s]; b != nil && !b.Live {
+				dead = append(dead, s)
+				return
+			}
+			for _, inner := range nested(s) {
+				visit(inner)
+			}
+		}
+	}
+	visit(g.body.Statements)
+	return dead
+}
+
+// nested returns the lists of statements that make up s.
+func nested(s ast.Statement) [][]ast.Statement {
+	switch s := s.(type) {
+	case *ast.BlockStatement:
+		return [][]ast.Statement{s.Statements}
+	case *ast.IfStatement:
+		lists := [][]ast.Statement{s.Consequence.Statements}
+		if s.Alternative != nil {
+			lists = append(lists, []ast.Statement{s.Alternative})
+		}
+		return lists
+	case *ast.WhileStatement:
+		return blocks(s.Body, s.Continue)
+	case *ast.ForStatement:
+		return blocks(s.Body)
+	case *ast.ForeachStatement:
+		return blocks(s.Body, s.Continue)
+	case *ast.LabeledStatement:
+		return [][]ast.Statement{{s.Statement}}
+	case *ast.ModifiedStatement:
+		return [][]ast.Statement{{s.Statement}}
+	}
+	return nil
+}
+
+func blocks(list ...*ast.BlockStatement) [][]ast.Statement {
+	var lists [][]ast.Statement
+	for _, b := range list {
+		if b != nil {
+			lists = append(lists, b.Statements)
+		}
+	}
+	return lists
+}
+
+// missingReturn reports a sub that returns a value somewhere but can
+// also run off the end of its body without one. The value of the last
+// statement run counts, as it does in perl, so a sub ending in an
+// expression, or an if and else that both do, is fine.
+func (g *Graph) missingReturn() (diagnostics.Diagnostic, bool) {
+	var ret *ast.ReturnStatement
+	for _, b := range g.Blocks {
+		for _, n := range b.Nodes {
+			if r, ok := n.(*ast.ReturnStatement); ok && r.ReturnValue != nil && ret == nil {
+				ret = r
+			}
+		}
+	}
+	if ret == nil {
+		return diagnostics.Diagnostic{}, false
+	}
+
+	for _, b := range g.Exit().Preds {
+		if b.Live && !g.endsWithValue(b, make(map[*Block]bool)) {
+			d := diagnostics.Errorf(diagnostics.MissingReturn, nameSpan(g.Decl), "not all paths of %s return a value", g.Name)
+			d.Severity = diagnostics.Warning
+			d.Label = "can reach the end of its body without a value"
+			d.Labels = append(d.Labels, diagnostics.Label{Span: ast.SpanOf(ret), Message: "returns a value here"})
+			return d, true
+		}
+	}
+	return diagnostics.Diagnostic{}, false
+}
+
+// endsWithValue reports whether every live path into the end of b ends
+// with a return or a statement whose value the sub returns.
+func (g *Graph) endsWithValue(b *Block, seen map[*Block]bool) bool {
+	if seen[b] {
+		// a loop back to where we started; the way in decides
+		return true
+	}
+	seen[b] = true
+	if len(b.Nodes) > 0 {
+		switch b.Nodes[len(b.Nodes)-1].(type) {
+		case *ast.ReturnStatement, *ast.ExpressionStatement:
+			return true
+		}
+		return false
+	}
+	for _, p := range b.Preds {
+		if p.Live && !g.endsWithValue(p, seen) {
+			return false
+		}
+	}
+	return len(b.Preds) > 0
+}
+
+func nameSpan(decl ast.Statement) diagnostics.Span {
+	switch decl := decl.(type) {
+	case *ast.SubStatement:
+		return ast.SpanOf(decl.Name)
+	case *ast.MethodStatement:
+		return ast.SpanOf(decl.Name)
+	}
+	return ast.SpanOf(decl)
+}
@@ -0,0 +1,77 @@
+package cfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLabel is how much of a statement a block's label shows.
+const maxLabel = 40
+
+// WriteDOT writes graphs to w as one Graphviz digraph, with a cluster
+// for each sub. A block is a box labelled with what it is and the first
+// line of each of its statements, dashed if no path reaches it. The
+// empty blocks left after a return or die, which nothing jumps to, are
+// left out.
+func WriteDOT(w io.Writer, graphs ...*Graph) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("digraph cfg {\n")
+	for i, g := range graphs {
+		id := func(block *Block) string { return fmt.Sprintf("g%d_%d", i, block.Index) }
+		shown := func(block *Block) bool {
+			return block.Live || len(block.Nodes) > 0 || len(block.Preds) > 0
+		}
+
+		fmt.Fprintf(b, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(b, "\t\tlabel=%s;\n", quote(g.Name))
+		for _, block := range g.Blocks {
+			if !shown(block) {
+				continue
+			}
+			lines := []string{block.Comment}
+			for _, n := range block.Nodes {
+				lines = append(lines, summary(n.String()))
+			}
+			fmt.Fprintf(b, "\t\t%s [shape=box,label=%s", id(block), quote(strings.Join(lines, "\n")))
+			if !block.Live {
+				b.WriteString(",style=dashed")
+			}
+			b.WriteString("];\n")
+		}
+		for _, block := range g.Blocks {
+			if !shown(block) {
+				continue
+			}
+			for _, s := range block.Succs {
+				fmt.Fprintf(b, "\t\t%s -> %s;\n", id(block), id(s))
+			}
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.Flush()
+}
+
+// summary shortens the text of a statement to its first line, and to
+// maxLabel characters.
+func summary(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i] + " ..."
+	}
+	if utf8.RuneCountInString(s) > maxLabel {
+		s = string([]rune(s)[:maxLabel-3]) + "..."
+	}
+	return s
+}
+
+// escaper escapes what DOT reads specially in a quoted string, writing
+// a newline as \n, which centres the line before it.
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quote returns s as a DOT string.
+func quote(s string) string {
+	return `"` + escaper.Replace(s) + `"`
+}
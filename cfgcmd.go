@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/perigrin/simian/cfg"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+)
+
+// cfgCommand implements `simian cfg [--name=NAME] [file]`. It parses
+// file, or standard input when no file is given, and writes the
+// control-flow graph of each sub and method in it to stdout as Graphviz
+// DOT, or only of those called NAME. Parse errors go to stderr instead of
+// any graph; the exit status is 1 if there are any, and 2 for a usage
+// problem.
+func cfgCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("cfg", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	name := flags.String("name", "", "only write the graphs of the subs and methods with this name")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: simian cfg [--name=NAME] [file]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	filename, src, err := readSource(flags, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "simian cfg: %v\n", err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	diags := p.Errors()
+	if diagnostics.HasErrors(diags) {
+		diagnostics.Render(stderr, filename, src, diags...)
+		return 1
+	}
+
+	graphs := cfg.Build(program, resolve.Resolve(program))
+	if *name != "" {
+		var named []*cfg.Graph
+		for _, g := range graphs {
+			if g.Name == *name || shortName(g.Name) == *name {
+				named = append(named, g)
+			}
+		}
+		graphs = named
+	}
+	if err := cfg.WriteDOT(stdout, graphs...); err != nil {
+		fmt.Fprintf(stderr, "simian cfg: %v\n", err)
+		return 1
+	}
+
+	diagnostics.Render(stderr, filename, src, diags...)
+	return 0
+}
+
+// shortName returns name without its package.
+func shortName(name string) string {
+	for i := len(name) - 1; i > 0; i-- {
+		if name[i] == ':' && name[i-1] == ':' {
+			return name[i+1:]
+		}
+	}
+	return name
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCfgCommand(t *testing.T) {
+	tests := []struct {
+		input  string
+		status int
+		stdout string
+		stderr string
+	}{
+		{`sub f { a() }`, 0, `label="main::f"`, ""},
+		{`sub f { my $x = 1 + ; }`, 1, "", "expected expression"},
+		{`sub f { foreach my $x () { } }`, 0, `label="foreach.head"`, ""},
+		{`sub f { if () { 1 } }`, 1, "", "expected expression"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		status := cfgCommand(nil, strings.NewReader(tt.input), &stdout, &stderr)
+		if status != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.input, tt.status, status)
+		}
+		if tt.stdout == "" && stdout.Len() > 0 || !strings.Contains(stdout.String(), tt.stdout) {
+			t.Errorf("%s: unexpected output\n%s", tt.input, stdout.String())
+		}
+		if tt.stderr == "" && stderr.Len() > 0 || !strings.Contains(stderr.String(), tt.stderr) {
+			t.Errorf("%s: unexpected errors\n%s", tt.input, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/perigrin/simian/cfg"
+	"github.com/perigrin/simian/ctxcheck"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/fold"
+	"github.com/perigrin/simian/hierarchy"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+	"github.com/perigrin/simian/strict"
+	"github.com/perigrin/simian/types"
+)
+
+// checkCommand implements `simian check [--strict] [file]`. It parses
+// file, or standard input when no file is given, resolves its variables
+// and checks it against use strict, its type annotations and its class
+// hierarchy, for values used in the wrong context, for unreachable code
+// and subs that don't always return a value, and for constant
+// expressions that cannot be evaluated, writing the diagnostics to
+// stderr.
+// With --strict the whole file is checked as if it began with
+// `use strict`. The exit status is 1 if any diagnostic is an error, and
+// 2 for a usage problem.
+func checkCommand(args []string, stdin io.Reader, stderr io.Writer) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	strictAll := flags.Bool("strict", false, "check the whole file as if it began with use strict")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: simian check [--strict] [file]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	filename, src, err := readSource(flags, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "simian check: %v\n", err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	diags := p.Errors()
+
+	mode := strict.None
+	if *strictAll {
+		mode = strict.All
+	}
+	info := resolve.Resolve(program)
+	found := append(info.Diagnostics, strict.Check(program, info, mode)...)
+	found = append(found, types.Check(program, info)...)
+	found = append(found, ctxcheck.Analyze(program, info).Diagnostics...)
+	found = append(found, hierarchy.Check(program).Diagnostics...)
+	found = append(found, cfg.Check(program, info)...)
+	// last, since it rewrites the tree
+	found = append(found, fold.Fold(program, info)...)
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Span.Start < found[j].Span.Start })
+	diags = append(diags, found...)
+
+	diagnostics.Render(stderr, filename, src, diags...)
+	if diagnostics.HasErrors(diags) {
+		return 1
+	}
+	return 0
+}
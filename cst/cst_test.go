@@ -0,0 +1,231 @@
+package cst_test
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/cst"
+	"github.com/perigrin/simian/diagnostics"
+)
+
+var sources = []string{
+	"",
+	"   \n\t",
+	"# only a comment",
+	"my $x = 5;",
+	"my $x = 5 # no semicolon",
+	"use strict;\nuse warnings;\n\npackage Foo::Bar 1.2 {\n  sub new ($class, %args) { bless {%args}, $class }\n}\n",
+	"class Point :isa(Base) {\n    field $x :param = 0;\n    method x { $x }\n}\n",
+	"OUTER: for my $i (1..10) {\n  next OUTER if $i % 2; # odd\n  print \"$i\\n\";\n}\n",
+	"my %h = map { $_ => 1 } grep { defined } @list;",
+	"$obj->method(1)->{key}[0]{'x'};",
+	"if ($x) { 1 } elsif ($y) { 2 } else { 3 }\n",
+	"my $s = q{ nested { braces } };\nmy @w = qw(a b c);",
+	"sub { unclosed",
+	") ] } stray closers",
+	"my $x = \"unterminated",
+	"\x00\x01 ` binary \xff",
+	"my $x = 1;\r\n# windows\r\n",
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, src := range sources {
+		tree, _ := cst.Parse([]byte(src))
+		if tree.Text() != src {
+			t.Errorf("round trip changed %q into %q", src, tree.Text())
+		}
+		checkSpans(t, tree)
+	}
+}
+
+// TestRoundTripRepository parses every file in the repository, perl or
+// not, since the tree must hold any input.
+func TestRoundTripRepository(t *testing.T) {
+	files, _ := filepath.Glob("../*/*")
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		tree, _ := cst.Parse(src)
+		if tree.Text() != string(src) {
+			t.Errorf("round trip changed %s", name)
+		}
+	}
+}
+
+func TestRoundTripRandom(t *testing.T) {
+	alphabet := "$@%&*(){}[];:,.=>-+/\\'\"#qw \n\tmy sub if else x1_"
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		b := make([]byte, r.Intn(60))
+		for j := range b {
+			b[j] = alphabet[r.Intn(len(alphabet))]
+		}
+		tree, _ := cst.Parse(b)
+		if tree.Text() != string(b) {
+			t.Fatalf("round trip changed %q into %q", b, tree.Text())
+		}
+		checkSpans(t, tree)
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, src := range sources {
+		f.Add([]byte(src))
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		tree, _ := cst.Parse(src)
+		if tree.Text() != string(src) {
+			t.Errorf("round trip changed %q into %q", src, tree.Text())
+		}
+	})
+}
+
+// checkSpans makes sure children tile their parent's span exactly.
+func checkSpans(t *testing.T, n *cst.Node) {
+	t.Helper()
+	offset := n.Span().Start
+	for _, c := range n.Children() {
+		span := c.Span()
+		if span.Start != offset {
+			t.Errorf("%s: child starts at %d, expected %d", n.Kind(), span.Start, offset)
+		}
+		if c.Parent() != n {
+			t.Errorf("%s: child has the wrong parent", n.Kind())
+		}
+		if c, ok := c.(*cst.Node); ok {
+			checkSpans(t, c)
+		}
+		offset = span.End
+	}
+	if offset != n.Span().End {
+		t.Errorf("%s: children end at %d, expected %d", n.Kind(), offset, n.Span().End)
+	}
+}
+
+func TestStructure(t *testing.T) {
+	src := "sub f { my %h = { a => 1 }; } # done\n"
+	tree, errors := cst.Parse([]byte(src))
+	if len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	expected := `File@0..37
+  Statement@0..29
+    SUB@0..3 "sub"
+    WHITESPACE@3..4 " "
+    IDENTIFIER@4..5 "f"
+    WHITESPACE@5..6 " "
+    Block@6..29
+      LBRACE@6..7 "{"
+      WHITESPACE@7..8 " "
+      Statement@8..27
+        MY@8..10 "my"
+        WHITESPACE@10..11 " "
+        IDENTIFIER@11..13 "%h"
+        WHITESPACE@13..14 " "
+        ASSIGN (=)@14..15 "="
+        WHITESPACE@15..16 " "
+        Braces@16..26
+          LBRACE@16..17 "{"
+          WHITESPACE@17..18 " "
+          IDENTIFIER@18..19 "a"
+          WHITESPACE@19..20 " "
+          COMMA@20..22 "=>"
+          WHITESPACE@22..23 " "
+          DIGIT@23..24 "1"
+          WHITESPACE@24..25 " "
+          RBRACE@25..26 "}"
+        SEMICOLON@26..27 ";"
+      WHITESPACE@27..28 " "
+      RBRACE@28..29 "}"
+  WHITESPACE@29..30 " "
+  COMMENT@30..36 "# done"
+  WHITESPACE@36..37 "\n"
+`
+	if got := cst.Dump(tree); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"my $x = 1; my $y = 2;", []string{"my $x = 1;", "my $y = 2;"}},
+		{"if ($x) { 1 } else { 2 } print 3;", []string{"if ($x) { 1 } else { 2 }", "print 3;"}},
+		{"sub f { 1 } sub g { 2 }", []string{"sub f { 1 }", "sub g { 2 }"}},
+		{"my $f = sub { 1 }; f();", []string{"my $f = sub { 1 };", "f();"}},
+		{"do { 1 } while ($x); 2;", []string{"do { 1 } while ($x);", "2;"}},
+		{"L: while (1) { last L } 1;", []string{"L: while (1) { last L }", "1;"}},
+		{"{ local $_ = 1; } 2;", []string{"{ local $_ = 1; }", "2;"}},
+	}
+
+	for _, tt := range tests {
+		tree, _ := cst.Parse([]byte(tt.input))
+		var got []string
+		for _, n := range tree.Nodes() {
+			got = append(got, n.Text())
+		}
+		if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("%q: expected statements %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected cst.Kind
+	}{
+		{"if (1) { 2 }", cst.Block},
+		{"map { $_ } @x;", cst.Block},
+		{"my $f = sub ($x) { $x };", cst.Block},
+		{"my $h = { a => 1 };", cst.Braces},
+		{"$h->{key};", cst.Braces},
+	}
+
+	for _, tt := range tests {
+		tree, _ := cst.Parse([]byte(tt.input))
+		var kinds []cst.Kind
+		for _, c := range tree.Nodes()[0].Nodes() {
+			kinds = append(kinds, c.Kind())
+		}
+		if kinds[len(kinds)-1] != tt.expected {
+			t.Errorf("%q: expected the braces to be %s, got %v", tt.input, tt.expected, kinds)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input   string
+		code    string
+		message string
+		span    diagnostics.Span
+	}{
+		{"sub f { 1;", diagnostics.UnclosedDelimiter, "unclosed delimiter `{`", diagnostics.Span{Start: 10, End: 10}},
+		{"f(1, 2;", diagnostics.UnclosedDelimiter, "unclosed delimiter `(`", diagnostics.Span{Start: 7, End: 7}},
+		{"1; }", diagnostics.UnexpectedToken, "unexpected closing delimiter `}`", diagnostics.Span{Start: 3, End: 4}},
+	}
+
+	for _, tt := range tests {
+		tree, errors := cst.Parse([]byte(tt.input))
+		if tree.Text() != tt.input {
+			t.Errorf("round trip changed %q into %q", tt.input, tree.Text())
+		}
+		if len(errors) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		d := errors[0]
+		if d.Code != tt.code || d.Message != tt.message || d.Span != tt.span {
+			t.Errorf("%q: expected %s %q at %v, got %s %q at %v", tt.input, tt.code, tt.message, tt.span, d.Code, d.Message, d.Span)
+		}
+	}
+}
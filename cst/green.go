@@ -0,0 +1,123 @@
+// Package cst is a lossless concrete syntax tree for perl source. Every
+// byte of the input, whitespace and comments included, belongs to exactly
+// one token of the tree, so printing a parsed file gives back the source
+// it was parsed from.
+//
+// The tree comes in two layers. Green nodes are immutable and know only
+// their kind, their children and their width, so identical subtrees can
+// be shared between versions of a file. Red nodes wrap green ones with
+// a parent and an absolute offset, and are made on demand as the tree is
+// walked.
+package cst
+
+import (
+	"strings"
+
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/token"
+)
+
+// Kind is the kind of an interior node.
+type Kind string
+
+const (
+	File      Kind = "File"
+	Statement Kind = "Statement"
+	Block     Kind = "Block"    // { statements }
+	Parens    Kind = "Parens"   // ( ... )
+	Brackets  Kind = "Brackets" // [ ... ]
+	Braces    Kind = "Braces"   // { ... } that is not a block
+	Error     Kind = "Error"    // a closing delimiter with nothing to close
+)
+
+// GreenElement is a green node or token.
+type GreenElement interface {
+	Width() int
+	Text() string
+	writeTo(b *strings.Builder)
+	tokenCount() int
+	hasProblems() bool
+}
+
+// GreenToken is a token with its exact source text. Trivia, the
+// whitespace and comments between tokens, are tokens too.
+type GreenToken struct {
+	typ  token.TokenType
+	text string
+
+	// problems found lexing the token, with spans relative to its start
+	problems []diagnostics.Diagnostic
+}
+
+func NewGreenToken(typ token.TokenType, text string) *GreenToken {
+	return &GreenToken{typ: typ, text: text}
+}
+
+func (t *GreenToken) Type() token.TokenType { return t.typ }
+func (t *GreenToken) Width() int            { return len(t.text) }
+func (t *GreenToken) Text() string          { return t.text }
+
+// IsTrivia reports whether the token is whitespace or a comment.
+func (t *GreenToken) IsTrivia() bool {
+	return t.typ == token.WHITESPACE || t.typ == token.COMMENT
+}
+
+func (t *GreenToken) writeTo(b *strings.Builder) {
+	b.WriteString(t.text)
+}
+
+func (t *GreenToken) tokenCount() int   { return 1 }
+func (t *GreenToken) hasProblems() bool { return len(t.problems) > 0 }
+
+// GreenNode is an interior node. Its width is the sum of its children's.
+type GreenNode struct {
+	kind     Kind
+	width    int
+	tokens   int
+	children []GreenElement
+
+	// problems with the node itself, such as a missing closing
+	// delimiter, with spans relative to its start
+	problems []diagnostics.Diagnostic
+
+	// whether there are problems anywhere in the subtree
+	anyProblems bool
+}
+
+func NewGreenNode(kind Kind, children ...GreenElement) *GreenNode {
+	n := &GreenNode{kind: kind, children: children}
+	for _, c := range children {
+		n.width += c.Width()
+		n.tokens += c.tokenCount()
+		n.anyProblems = n.anyProblems || c.hasProblems()
+	}
+	return n
+}
+
+func (n *GreenNode) tokenCount() int   { return n.tokens }
+func (n *GreenNode) hasProblems() bool { return n.anyProblems }
+
+// withProblems attaches diagnostics to a new node, with spans relative
+// to its start.
+func (n *GreenNode) withProblems(diags ...diagnostics.Diagnostic) *GreenNode {
+	n.problems = append(n.problems, diags...)
+	n.anyProblems = n.anyProblems || len(diags) > 0
+	return n
+}
+
+func (n *GreenNode) Kind() Kind               { return n.kind }
+func (n *GreenNode) Width() int               { return n.width }
+func (n *GreenNode) Children() []GreenElement { return n.children }
+
+func (n *GreenNode) Text() string {
+	var b strings.Builder
+	b.Grow(n.width)
+	n.writeTo(&b)
+	return b.String()
+}
+
+func (n *GreenNode) writeTo(b *strings.Builder) {
+	for _, c := range n.children {
+		c.writeTo(b)
+	}
+}
@@ -0,0 +1,243 @@
+package cst
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/perigrin/simian/diagnostics"
+)
+
+// Edit replaces the text in Span with Replacement.
+type Edit struct {
+	Span        diagnostics.Span
+	Replacement string
+}
+
+// Reparse returns the tree of the source of old with edit applied. It
+// gives the same tree and diagnostics as parsing the edited source from
+// scratch, but only re-lexes the text around the edit and shares every
+// statement the edit cannot have changed with old.
+func Reparse(old *Node, edit Edit) (*Node, []diagnostics.Diagnostic) {
+	width := old.green.width
+	edit.Span.Start = min(max(edit.Span.Start, 0), width)
+	edit.Span.End = min(max(edit.Span.End, edit.Span.Start), width)
+	if root := reparseBlock(old, edit); root != nil {
+		return root, root.Diagnostics()
+	}
+
+	text := old.Text()
+	src := []byte(text[:edit.Span.Start] + edit.Replacement + text[edit.Span.End:])
+
+	r := newReuse(old.green)
+	tokens := r.relex(src, edit, len(src))
+	b := &builder{tokens: tokens, reuse: r.statement}
+	root := NewRoot(b.file())
+	return root, root.Diagnostics()
+}
+
+// reuse holds what Reparse knows about the old tree.
+type reuse struct {
+	tokens []*GreenToken
+	starts []int // offset of each old token
+
+	// statements without problems, by the index of their first token
+	statements map[int]*GreenNode
+
+	// the old tokens kept before and after the re-lexed ones, and how
+	// many tokens the re-lexed region holds
+	prefix, suffix, relexed int
+}
+
+func newReuse(root *GreenNode) *reuse {
+	r := &reuse{statements: make(map[int]*GreenNode)}
+	offset := 0
+	var walk func(g GreenElement)
+	walk = func(g GreenElement) {
+		switch g := g.(type) {
+		case *GreenToken:
+			r.tokens = append(r.tokens, g)
+			r.starts = append(r.starts, offset)
+			offset += g.Width()
+		case *GreenNode:
+			if g.kind == Statement && !g.anyProblems {
+				r.statements[len(r.tokens)] = g
+			}
+			for _, c := range g.children {
+				walk(c)
+			}
+		}
+	}
+	walk(root)
+	return r
+}
+
+// relex returns the tokens of src, the edited source, up to offset
+// limit. The lexer keeps no state between tokens, so old tokens far
+// enough before the edit are unchanged, and once lexing past the edit
+// reaches the start of an old token every token from there on is
+// unchanged too.
+func (r *reuse) relex(src []byte, edit Edit, limit int) []*GreenToken {
+	// a token's extent depends on up to two characters past its end
+	r.prefix = sort.Search(len(r.tokens), func(i int) bool {
+		return r.starts[i]+r.tokens[i].Width()+2 > edit.Span.Start
+	})
+	start := edit.Span.Start
+	if r.prefix < len(r.tokens) {
+		start = r.starts[r.prefix]
+	}
+
+	delta := len(edit.Replacement) - (edit.Span.End - edit.Span.Start)
+	editEnd := edit.Span.Start + len(edit.Replacement)
+	r.suffix = len(r.tokens)
+	stop := func(offset int) bool {
+		if offset < editEnd {
+			return false
+		}
+		i := sort.SearchInts(r.starts, offset-delta)
+		if i < len(r.starts) && r.starts[i] == offset-delta && i >= r.prefix {
+			r.suffix = i
+			return true
+		}
+		return offset >= limit
+	}
+	relexed, _ := scan(src[start:], start, stop)
+	r.relexed = len(relexed)
+
+	tokens := make([]*GreenToken, 0, r.prefix+len(relexed)+len(r.tokens)-r.suffix)
+	tokens = append(tokens, r.tokens[:r.prefix]...)
+	tokens = append(tokens, relexed...)
+	return append(tokens, r.tokens[r.suffix:]...)
+}
+
+// statement returns the old statement starting at new token pos if it
+// and the token after it, which decides where it ends, are unchanged.
+func (r *reuse) statement(pos int) *GreenNode {
+	if pos < r.prefix {
+		n := r.statements[pos]
+		if n == nil {
+			return nil
+		}
+		next := pos + n.tokens
+		for next < len(r.tokens) && r.tokens[next].IsTrivia() {
+			next++
+		}
+		if next >= r.prefix {
+			return nil
+		}
+		return n
+	}
+	if pos >= r.prefix+r.relexed {
+		return r.statements[pos-r.prefix-r.relexed+r.suffix]
+	}
+	return nil
+}
+
+// reparseBlock handles the usual case of an edit inside a block that
+// leaves the block's braces alone. Only the block is re-lexed and
+// rebuilt, and only the nodes on the path from it to the root are
+// replaced. It returns nil when the edit could change more than the
+// block.
+func reparseBlock(old *Node, edit Edit) *Node {
+	block := innermostBlock(old, edit.Span)
+	if block == nil || block.green.anyProblems {
+		return nil
+	}
+	for n := block.parent; n != nil; n = n.parent {
+		// a missing delimiter is reported past the node, which the edit moves
+		if len(n.green.problems) > 0 {
+			return nil
+		}
+	}
+
+	span := block.Span()
+	text := block.Text()
+	local := Edit{
+		Span:        diagnostics.Span{Start: edit.Span.Start - span.Start, End: edit.Span.End - span.Start},
+		Replacement: edit.Replacement,
+	}
+	edited := text[:local.Span.Start] + edit.Replacement + text[local.Span.End:]
+
+	// the last tokens of the block may look a couple of characters past it
+	var following strings.Builder
+	writeRange(&following, old.green, span.End, span.End+2)
+	r := newReuse(block.green)
+	tokens := r.relex([]byte(edited+following.String()), local, len(edited))
+	width := 0
+	for _, t := range tokens {
+		width += t.Width()
+	}
+	if width != len(edited) || len(tokens) == 0 || tokens[0].text != "{" || tokens[len(tokens)-1].text != "}" {
+		return nil
+	}
+
+	b := &builder{tokens: tokens, reuse: r.statement}
+	green := b.group(true)
+	if b.pos != len(tokens) || green.anyProblems {
+		return nil
+	}
+	return replace(block, green)
+}
+
+// innermostBlock returns the smallest block under n whose braces lie
+// strictly outside span.
+func innermostBlock(n *Node, span diagnostics.Span) *Node {
+	var found *Node
+	for {
+		var next *Node
+		offset := n.offset
+		for _, c := range n.green.children {
+			if g, ok := c.(*GreenNode); ok && offset < span.Start && span.End < offset+g.width {
+				next = &Node{green: g, parent: n, offset: offset}
+				break
+			}
+			offset += c.Width()
+		}
+		if next == nil {
+			return found
+		}
+		if next.Kind() == Block {
+			found = next
+		}
+		n = next
+	}
+}
+
+// replace returns a new root in which the green node of n is green,
+// copying the nodes above it and sharing everything else.
+func replace(n *Node, green *GreenNode) *Node {
+	for n.parent != nil {
+		parent := n.parent
+		children := make([]GreenElement, len(parent.green.children))
+		copy(children, parent.green.children)
+		offset := parent.offset
+		for i, c := range children {
+			if offset == n.offset && c == GreenElement(n.green) {
+				children[i] = green
+				break
+			}
+			offset += c.Width()
+		}
+		green = NewGreenNode(parent.green.kind, children...).withProblems(parent.green.problems...)
+		n = parent
+	}
+	return NewRoot(green)
+}
+
+// writeRange writes the text of g between offsets start and end.
+func writeRange(b *strings.Builder, g GreenElement, start, end int) {
+	switch g := g.(type) {
+	case *GreenToken:
+		b.WriteString(g.text[max(start, 0):min(end, len(g.text))])
+	case *GreenNode:
+		offset := 0
+		for _, c := range g.children {
+			if offset >= end {
+				return
+			}
+			if offset+c.Width() > start {
+				writeRange(b, c, start-offset, end-offset)
+			}
+			offset += c.Width()
+		}
+	}
+}
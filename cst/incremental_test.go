@@ -0,0 +1,193 @@
+package cst_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/cst"
+	"github.com/perigrin/simian/diagnostics"
+)
+
+const program = `use strict;
+use warnings;
+
+package Counter {
+    sub new ($class, %args) {
+        my $self = bless { count => 0, %args }, $class;
+        return $self;
+    }
+
+    sub increment ($self) {
+        $self->{count}++; # one more
+        return $self->{count};
+    }
+}
+
+OUTER: for my $i (1..10) {
+    next OUTER if $i % 2;
+    print "even: $i\n";
+}
+
+my @words = qw(alpha beta gamma);
+my %seen = map { $_ => 1 } @words;
+`
+
+// checkReparse applies edit to the source of old both ways and compares
+// the results.
+func checkReparse(t *testing.T, old *cst.Node, edit cst.Edit) *cst.Node {
+	t.Helper()
+	src := old.Text()
+	got, gotErrors := cst.Reparse(old, edit)
+
+	edited := src[:edit.Span.Start] + edit.Replacement + src[edit.Span.End:]
+	expected, expectedErrors := cst.Parse([]byte(edited))
+	if got.Text() != edited {
+		t.Fatalf("%v: expected text %q, got %q", edit, edited, got.Text())
+	}
+	if cst.Dump(got) != cst.Dump(expected) {
+		t.Fatalf("%v on %q: trees differ\nexpected\n%s\ngot\n%s", edit, src, cst.Dump(expected), cst.Dump(got))
+	}
+	if fmt.Sprint(gotErrors) != fmt.Sprint(expectedErrors) {
+		t.Fatalf("%v on %q: expected diagnostics %v, got %v", edit, src, expectedErrors, gotErrors)
+	}
+	for i := range gotErrors {
+		if gotErrors[i].Span != expectedErrors[i].Span {
+			t.Fatalf("%v on %q: expected %s at %v, got %v", edit, src, expectedErrors[i], expectedErrors[i].Span, gotErrors[i].Span)
+		}
+	}
+	return got
+}
+
+func edit(start, end int, replacement string) cst.Edit {
+	return cst.Edit{Span: diagnostics.Span{Start: start, End: end}, Replacement: replacement}
+}
+
+func TestReparse(t *testing.T) {
+	tests := []struct {
+		src  string
+		edit cst.Edit
+	}{
+		{"my $x = 1;", edit(8, 9, "42")},
+		{"my $x = 1;", edit(5, 5, "yz")},                        // extends a token
+		{"my $x = 1;", edit(10, 10, " my $y = 2;")},             // appends
+		{"my $x = 1; my $y = 2;", edit(9, 10, "")},              // merges statements
+		{"my $x = 1; my $y = 2;", edit(8, 8, "\"")},             // opens a string
+		{"my $x = \"1; my $y = 2;", edit(8, 9, "")},             // closes one
+		{"if ($x) { 1 } print 2;", edit(14, 14, "else { 3 } ")}, // continues a compound statement
+		{"sub f { 1; } sub g { 2; }", edit(6, 7, "")},           // unbalances a block
+		{"sub f { 1; } sub g { 2; }", edit(0, 25, "")},          // deletes everything
+		{"", edit(0, 0, "sub f { 1 }")},
+		{"my $x = 1; # comment\n2;", edit(14, 14, "\n")}, // splits a comment
+		{"$v = v5", edit(7, 7, ".36")},                   // lookahead past the token
+	}
+
+	for _, tt := range tests {
+		old, _ := cst.Parse([]byte(tt.src))
+		checkReparse(t, old, tt.edit)
+	}
+}
+
+func TestReparseRandom(t *testing.T) {
+	inserts := []string{"", " ", "\n", ";", "{", "}", "(", ")", "[", "]", "'", "\"", "#", "$x", "sub f ", "if (1) ", "else ", "q{", "=> 1,", "\\", "x"}
+	r := rand.New(rand.NewSource(1))
+	tree, _ := cst.Parse([]byte(program))
+	for i := 0; i < 2000; i++ {
+		// keep editing the reparsed tree, starting afresh now and then
+		if i%100 == 0 {
+			tree, _ = cst.Parse([]byte(program))
+		}
+		width := tree.Span().End
+		start := r.Intn(width + 1)
+		end := start + r.Intn(min(8, width-start)+1)
+		tree = checkReparse(t, tree, edit(start, end, inserts[r.Intn(len(inserts))]))
+	}
+}
+
+// TestReparseSharing checks that an edit inside one sub leaves the green
+// nodes and tokens of the rest of the file shared with the old tree.
+func TestReparseSharing(t *testing.T) {
+	old, _ := cst.Parse([]byte(program))
+	at := len("use strict;\nuse warnings;\n\npackage Counter {\n    sub new ($class, %args) {\n        my $self = bless { count => ")
+	tree := checkReparse(t, old, edit(at, at+1, "1"))
+
+	oldStatements := statements(old)
+	newStatements := statements(tree)
+	if len(oldStatements) != len(newStatements) {
+		t.Fatalf("expected %d statements, got %d", len(oldStatements), len(newStatements))
+	}
+	var rebuilt []string
+	for i := range oldStatements {
+		if oldStatements[i].Green() != newStatements[i].Green() {
+			rebuilt = append(rebuilt, newStatements[i].Text())
+		}
+	}
+	expected := []string{
+		"package Counter {\n    sub new ($class, %args) {\n        my $self = bless { count => 1, %args }, $class;\n        return $self;\n    }\n\n    sub increment ($self) {\n        $self->{count}++; # one more\n        return $self->{count};\n    }\n}",
+		"sub new ($class, %args) {\n        my $self = bless { count => 1, %args }, $class;\n        return $self;\n    }",
+		"my $self = bless { count => 1, %args }, $class;",
+	}
+	if fmt.Sprintf("%q", rebuilt) != fmt.Sprintf("%q", expected) {
+		t.Errorf("expected only the enclosing statements to be rebuilt, got %q", rebuilt)
+	}
+
+	oldTokens, newTokens := old.Tokens(), tree.Tokens()
+	shared := 0
+	for i := range oldTokens {
+		if oldTokens[i].Green() == newTokens[i].Green() {
+			shared++
+		}
+	}
+	if shared < len(oldTokens)-3 {
+		t.Errorf("expected all but a few tokens to be shared, %d of %d were", shared, len(oldTokens))
+	}
+}
+
+func statements(n *cst.Node) []*cst.Node {
+	var result []*cst.Node
+	for _, c := range n.Nodes() {
+		if c.Kind() == cst.Statement {
+			result = append(result, c)
+		}
+		result = append(result, statements(c)...)
+	}
+	return result
+}
+
+func largeProgram() string {
+	var src string
+	for i := 0; i < 200; i++ {
+		src += program
+	}
+	return src
+}
+
+func BenchmarkParse(b *testing.B) {
+	src := []byte(largeProgram())
+	for i := 0; i < b.N; i++ {
+		cst.Parse(src)
+	}
+}
+
+// BenchmarkReparse edits between two statements at the top level.
+func BenchmarkReparse(b *testing.B) {
+	src := largeProgram()
+	tree, _ := cst.Parse([]byte(src))
+	at := len(src) / 2
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cst.Reparse(tree, edit(at, at, " "))
+	}
+}
+
+// BenchmarkReparseBlock edits inside a sub.
+func BenchmarkReparseBlock(b *testing.B) {
+	src := largeProgram()
+	tree, _ := cst.Parse([]byte(src))
+	at := len(src)/2 + strings.Index(program, "count => 0") + len("count => ")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cst.Reparse(tree, edit(at, at+1, "1"))
+	}
+}
@@ -0,0 +1,352 @@
+package cst
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/token"
+)
+
+// Parse builds the concrete syntax tree of src. The tree always covers
+// the whole input; problems such as unbalanced delimiters are reported
+// as diagnostics alongside it.
+func Parse(src []byte) (*Node, []diagnostics.Diagnostic) {
+	b := &builder{tokens: Lex(src)}
+	root := NewRoot(b.file())
+	return root, root.Diagnostics()
+}
+
+// Lex splits src into green tokens, trivia included, so that their text
+// joined together is src.
+func Lex(src []byte) []*GreenToken {
+	tokens, _ := scan(src, 0, nil)
+	return tokens
+}
+
+// scan lexes src, which starts at offset base in the file, stopping
+// before the first token at an offset where stop returns true. It
+// reports whether it stopped early.
+func scan(src []byte, base int, stop func(offset int) bool) ([]*GreenToken, bool) {
+	var tokens []*GreenToken
+	emit := func(t *GreenToken, offset int) bool {
+		if stop != nil && stop(base+offset) {
+			return false
+		}
+		tokens = append(tokens, t)
+		return true
+	}
+
+	l := lexer.New(src)
+	offset, reported := 0, 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Offset < offset {
+			continue
+		}
+		t := NewGreenToken(tok.Type, string(tok.Literal))
+		for _, d := range l.Diagnostics()[reported:] {
+			t.problems = appendShifted(t.problems, []diagnostics.Diagnostic{d}, -tok.Offset)
+		}
+		reported = len(l.Diagnostics())
+
+		for _, trivia := range splitTrivia(src[offset:tok.Offset]) {
+			if !emit(trivia, offset) {
+				return tokens, true
+			}
+			offset += trivia.Width()
+		}
+		if !emit(t, offset) {
+			return tokens, true
+		}
+		offset += t.Width()
+	}
+	for _, trivia := range splitTrivia(src[offset:]) {
+		if !emit(trivia, offset) {
+			return tokens, true
+		}
+		offset += trivia.Width()
+	}
+	return tokens, false
+}
+
+// splitTrivia splits the text the lexer skipped between two tokens into
+// runs of whitespace and comments.
+func splitTrivia(gap []byte) []*GreenToken {
+	var tokens []*GreenToken
+	for len(gap) > 0 {
+		n := 1
+		typ := token.TokenType(token.INVALID)
+		switch {
+		case token.IsWhitespace(gap[0]):
+			typ = token.WHITESPACE
+			for n < len(gap) && token.IsWhitespace(gap[n]) {
+				n++
+			}
+		case gap[0] == '#':
+			typ = token.COMMENT
+			for n < len(gap) && gap[n] != '\n' {
+				n++
+			}
+		}
+		tokens = append(tokens, NewGreenToken(typ, string(gap[:n])))
+		gap = gap[n:]
+	}
+	return tokens
+}
+
+// builder groups tokens into statements and balanced delimiters. It
+// knows just enough perl to tell where a statement ends and whether a
+// brace opens a block, which is all a lossless tree needs.
+type builder struct {
+	tokens []*GreenToken
+	pos    int
+	offset int // of tokens[pos]
+	open   []string
+
+	// reuse returns a statement from an earlier tree that would parse
+	// the same way starting at the given token, or nil.
+	reuse func(pos int) *GreenNode
+}
+
+// peek returns the next token that is not trivia, or nil at the end.
+func (b *builder) peek() *GreenToken {
+	for _, t := range b.tokens[b.pos:] {
+		if !t.IsTrivia() {
+			return t
+		}
+	}
+	return nil
+}
+
+// trivia moves any trivia at the current position into children.
+func (b *builder) trivia(children []GreenElement) []GreenElement {
+	for b.pos < len(b.tokens) && b.tokens[b.pos].IsTrivia() {
+		children = b.bump(children)
+	}
+	return children
+}
+
+// bump moves the current token into children.
+func (b *builder) bump(children []GreenElement) []GreenElement {
+	t := b.tokens[b.pos]
+	b.pos++
+	b.offset += t.Width()
+	return append(children, t)
+}
+
+// next moves the trivia before the next token and the token itself into
+// children.
+func (b *builder) next(children []GreenElement) []GreenElement {
+	return b.bump(b.trivia(children))
+}
+
+var closers = map[string]string{"(": ")", "[": "]", "{": "}"}
+
+func isCloser(t *GreenToken) bool {
+	return t.text == ")" || t.text == "]" || t.text == "}"
+}
+
+// closes reports whether t closes one of the open delimiters.
+func (b *builder) closes(t *GreenToken) bool {
+	for _, open := range b.open {
+		if closers[open] == t.text {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *builder) file() *GreenNode {
+	children := b.statements(nil)
+	children = b.trivia(children)
+	return NewGreenNode(File, children...)
+}
+
+// statements reads statements up to a closing delimiter or the end.
+// Trivia between statements belongs to the enclosing node.
+func (b *builder) statements(children []GreenElement) []GreenElement {
+	for {
+		t := b.peek()
+		switch {
+		case t == nil:
+			return children
+		case isCloser(t) && b.closes(t):
+			return children
+		case isCloser(t):
+			children = b.trivia(children)
+			children = append(children, b.stray())
+		default:
+			children = b.trivia(children)
+			if n := b.reused(); n != nil {
+				children = append(children, n)
+				continue
+			}
+			children = append(children, b.statement())
+		}
+	}
+}
+
+// reused skips over a statement the reuse hook supplies.
+func (b *builder) reused() *GreenNode {
+	if b.reuse == nil {
+		return nil
+	}
+	n := b.reuse(b.pos)
+	if n != nil {
+		b.pos += n.tokens
+		b.offset += n.width
+	}
+	return n
+}
+
+// stray wraps a closing delimiter that closes nothing.
+func (b *builder) stray() *GreenNode {
+	t := b.tokens[b.pos]
+	d := diagnostics.Errorf(diagnostics.UnexpectedToken, diagnostics.Span{Start: 0, End: t.Width()},
+		"unexpected closing delimiter `%s`", t.text)
+	d.Label = "nothing to close"
+	return NewGreenNode(Error, b.bump(nil)...).withProblems(d)
+}
+
+// compound statements end with a block rather than a semicolon.
+var compound = map[string]bool{
+	"if": true, "unless": true, "while": true, "until": true, "for": true, "foreach": true,
+	"sub": true, "method": true, "package": true, "class": true,
+	"BEGIN": true, "END": true, "INIT": true, "CHECK": true, "UNITCHECK": true,
+	"{": true,
+}
+
+// continues are the keywords that carry a compound statement on past
+// its block.
+var continues = map[string]bool{"elsif": true, "else": true, "continue": true}
+
+// blockIntroducers are followed by a block rather than a hash.
+var blockIntroducers = map[string]bool{
+	"do": true, "eval": true, "map": true, "grep": true, "sort": true, "sub": true, "method": true,
+}
+
+// isLabel reports whether t is a loop label such as OUTER:.
+func isLabel(t *GreenToken) bool {
+	return t.typ == token.IDENTIFIER && strings.HasSuffix(t.text, ":") && !strings.HasSuffix(t.text, "::") &&
+		!strings.HasPrefix(t.text, ":")
+}
+
+// statement reads tokens up to and including a semicolon, or up to the
+// last block of a compound statement.
+func (b *builder) statement() *GreenNode {
+	var children []GreenElement
+	first := b.peek()
+	if isLabel(first) {
+		children = b.next(children)
+		if next := b.peek(); next != nil && !isCloser(next) {
+			first = next
+		}
+	}
+	c := &context{compound: compound[first.text]}
+
+	for {
+		t := b.peek()
+		if t == nil || isCloser(t) {
+			break
+		}
+		if t.text == ";" {
+			children = b.next(children)
+			break
+		}
+		var block bool
+		children, block = b.element(children, c)
+		if block && c.compound {
+			if next := b.peek(); next == nil || !continues[next.text] {
+				break
+			}
+		}
+	}
+	return NewGreenNode(Statement, children...)
+}
+
+// context is what element needs to know about the tokens before it.
+type context struct {
+	compound   bool   // braces directly in the statement are blocks
+	previous   string // the last token read
+	pendingSub bool   // a sub or method is waiting for its body
+}
+
+// element reads one token or balanced group into children, reporting
+// whether it was a block.
+func (b *builder) element(children []GreenElement, c *context) ([]GreenElement, bool) {
+	t := b.peek()
+	previous := c.previous
+	c.previous = t.text
+	if _, ok := closers[t.text]; !ok {
+		if t.text == "sub" || t.text == "method" {
+			c.pendingSub = true
+		}
+		return b.next(children), false
+	}
+
+	children = b.trivia(children)
+	block := t.text == "{" && (c.compound || c.pendingSub || blockIntroducers[previous])
+	if t.text == "{" {
+		c.pendingSub = false
+	}
+	return append(children, b.group(block)), block
+}
+
+// group reads a delimited group from its opener to its closer.
+func (b *builder) group(block bool) *GreenNode {
+	open := b.tokens[b.pos]
+	start := b.offset
+	kind := map[string]Kind{"(": Parens, "[": Brackets, "{": Braces}[open.text]
+	if block {
+		kind = Block
+	}
+	children := b.bump(nil)
+	b.open = append(b.open, open.text)
+	defer func() { b.open = b.open[:len(b.open)-1] }()
+
+	if block {
+		children = b.statements(children)
+	} else {
+		c := &context{}
+		for {
+			t := b.peek()
+			if t == nil || isCloser(t) && b.closes(t) {
+				break
+			}
+			if isCloser(t) {
+				children = b.trivia(children)
+				children = append(children, b.stray())
+				continue
+			}
+			children, _ = b.element(children, c)
+		}
+	}
+
+	close := closers[open.text]
+	if t := b.peek(); t != nil && t.text == close {
+		return NewGreenNode(kind, b.next(children)...)
+	}
+	return NewGreenNode(kind, children...).withProblems(b.unclosed(open, start, close))
+}
+
+// unclosed describes a group opened at start that runs into the next
+// token, with spans relative to start.
+func (b *builder) unclosed(open *GreenToken, start int, close string) diagnostics.Diagnostic {
+	at := b.offset
+	for _, t := range b.tokens[b.pos:] {
+		if !t.IsTrivia() {
+			break
+		}
+		at += t.Width()
+	}
+	span := diagnostics.Span{Start: at, End: at}
+	if t := b.peek(); t != nil {
+		span.End = at + t.Width()
+	}
+	d := diagnostics.Errorf(diagnostics.UnclosedDelimiter, span, "unclosed delimiter `%s`", open.text)
+	d.Label = fmt.Sprintf("expected `%s`", close)
+	d.Labels = []diagnostics.Label{{Span: diagnostics.Span{Start: start, End: start + 1}, Message: "unclosed delimiter"}}
+	d.Fix = &diagnostics.Fix{Message: fmt.Sprintf("insert `%s`", close), Span: diagnostics.Span{Start: at, End: at}, Replacement: close}
+	return appendShifted(nil, []diagnostics.Diagnostic{d}, -start)[0]
+}
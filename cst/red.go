@@ -0,0 +1,176 @@
+package cst
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/token"
+)
+
+// Element is a node or token of the red tree.
+type Element interface {
+	Parent() *Node
+	Span() diagnostics.Span
+	Text() string
+}
+
+// Node is a green node at a known place in the tree.
+type Node struct {
+	green  *GreenNode
+	parent *Node
+	offset int
+}
+
+// NewRoot returns the red tree for a green root node.
+func NewRoot(green *GreenNode) *Node {
+	return &Node{green: green}
+}
+
+func (n *Node) Kind() Kind        { return n.green.kind }
+func (n *Node) Green() *GreenNode { return n.green }
+func (n *Node) Parent() *Node     { return n.parent }
+func (n *Node) Text() string      { return n.green.Text() }
+func (n *Node) String() string    { return n.Text() }
+func (n *Node) Span() diagnostics.Span {
+	return diagnostics.Span{Start: n.offset, End: n.offset + n.green.width}
+}
+
+// Children returns the node's children, trivia included.
+func (n *Node) Children() []Element {
+	children := make([]Element, len(n.green.children))
+	offset := n.offset
+	for i, c := range n.green.children {
+		switch c := c.(type) {
+		case *GreenNode:
+			children[i] = &Node{green: c, parent: n, offset: offset}
+		case *GreenToken:
+			children[i] = &Token{green: c, parent: n, offset: offset}
+		}
+		offset += c.Width()
+	}
+	return children
+}
+
+// Nodes returns the interior nodes among n's children.
+func (n *Node) Nodes() []*Node {
+	var nodes []*Node
+	for _, c := range n.Children() {
+		if c, ok := c.(*Node); ok {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// Tokens returns every token under n in source order, trivia included.
+func (n *Node) Tokens() []*Token {
+	var tokens []*Token
+	for _, c := range n.Children() {
+		switch c := c.(type) {
+		case *Node:
+			tokens = append(tokens, c.Tokens()...)
+		case *Token:
+			tokens = append(tokens, c)
+		}
+	}
+	return tokens
+}
+
+// Diagnostics returns the problems found parsing the subtree under n, in
+// source order.
+func (n *Node) Diagnostics() []diagnostics.Diagnostic {
+	var diags []diagnostics.Diagnostic
+	var collect func(g GreenElement, offset int)
+	collect = func(g GreenElement, offset int) {
+		if !g.hasProblems() {
+			return
+		}
+		switch g := g.(type) {
+		case *GreenToken:
+			diags = appendShifted(diags, g.problems, offset)
+		case *GreenNode:
+			diags = appendShifted(diags, g.problems, offset)
+			for _, c := range g.children {
+				collect(c, offset)
+				offset += c.Width()
+			}
+		}
+	}
+	collect(n.green, n.offset)
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Span.Start < diags[j].Span.Start
+	})
+	return diags
+}
+
+// appendShifted appends diagnostics with spans relative to offset.
+func appendShifted(diags, relative []diagnostics.Diagnostic, offset int) []diagnostics.Diagnostic {
+	for _, d := range relative {
+		d.Span = shift(d.Span, offset)
+		labels := make([]diagnostics.Label, len(d.Labels))
+		for i, l := range d.Labels {
+			labels[i] = diagnostics.Label{Span: shift(l.Span, offset), Message: l.Message}
+		}
+		if d.Labels != nil {
+			d.Labels = labels
+		}
+		if d.Fix != nil {
+			fix := *d.Fix
+			fix.Span = shift(fix.Span, offset)
+			d.Fix = &fix
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+func shift(s diagnostics.Span, offset int) diagnostics.Span {
+	return diagnostics.Span{Start: s.Start + offset, End: s.End + offset}
+}
+
+// Token is a green token at a known place in the tree.
+type Token struct {
+	green  *GreenToken
+	parent *Node
+	offset int
+}
+
+func (t *Token) Type() token.TokenType { return t.green.typ }
+func (t *Token) Green() *GreenToken    { return t.green }
+func (t *Token) Parent() *Node         { return t.parent }
+func (t *Token) Text() string          { return t.green.text }
+func (t *Token) IsTrivia() bool        { return t.green.IsTrivia() }
+func (t *Token) Span() diagnostics.Span {
+	return diagnostics.Span{Start: t.offset, End: t.offset + len(t.green.text)}
+}
+
+// Print writes the source text of n to w.
+func Print(w io.Writer, n *Node) error {
+	_, err := io.WriteString(w, n.Text())
+	return err
+}
+
+// Dump returns an indented outline of the tree under n, one element per
+// line with its byte range, for debugging and tests.
+func Dump(n *Node) string {
+	var b strings.Builder
+	dump(&b, n, 0)
+	return b.String()
+}
+
+func dump(b *strings.Builder, e Element, depth int) {
+	span := e.Span()
+	indent := strings.Repeat("  ", depth)
+	switch e := e.(type) {
+	case *Node:
+		fmt.Fprintf(b, "%s%s@%d..%d\n", indent, e.Kind(), span.Start, span.End)
+		for _, c := range e.Children() {
+			dump(b, c, depth+1)
+		}
+	case *Token:
+		fmt.Fprintf(b, "%s%s@%d..%d %q\n", indent, e.Type(), span.Start, span.End, e.Text())
+	}
+}
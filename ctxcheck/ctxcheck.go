@@ -0,0 +1,608 @@
+// Package ctxcheck works out the context perl evaluates each expression
+// in: void, where its value is thrown away; scalar, where it gives one
+// value; or list, where it gives any number. What an expression does can
+// depend on it: an array in scalar context is its number of elements,
+// and a list its last element.
+//
+// The value a sub returns, from a return or its last statement, is
+// evaluated in the context the sub was called in, which wantarray tells
+// it at run time. Statically that context is Caller.
+//
+// Analyze also warns about the mistakes context makes easy: a list, or
+// a sub that returns one, where a scalar is wanted, and a value computed
+// in void context only to be thrown away.
+package ctxcheck
+
+import (
+	"fmt"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/resolve"
+	"github.com/perigrin/simian/token"
+)
+
+// Context is the context an expression is evaluated in.
+type Context int
+
+const (
+	Void   Context = iota // the value is thrown away
+	Scalar                // one value is wanted
+	List                  // any number of values are wanted
+	Caller                // a sub's value, in the context of its call
+)
+
+var contexts = [...]string{"void", "scalar", "list", "caller"}
+
+func (c Context) String() string {
+	if c < 0 || int(c) >= len(contexts) {
+		return fmt.Sprintf("Context(%d)", int(c))
+	}
+	return contexts[c]
+}
+
+// Info is what Analyze learns about a program.
+type Info struct {
+	// Contexts holds the context of every expression.
+	Contexts map[ast.Expression]Context
+
+	Diagnostics []diagnostics.Diagnostic
+}
+
+// ContextOf returns the context e is evaluated in. The name of a sub or
+// method being called is in the context of the call, and names that are
+// only declared, as by sub, are in void context.
+func (info *Info) ContextOf(e ast.Expression) Context {
+	return info.Contexts[e]
+}
+
+// Analyze works out the context of every expression in program. A
+// statement is in void context, except for the last statement of a sub,
+// which is its value. info resolves program's variables.
+func Analyze(program *ast.Program, info *resolve.Info) *Info {
+	a := &analyzer{
+		info:     info,
+		lists:    make(map[string]*sub),
+		contexts: make(map[ast.Expression]Context),
+	}
+	a.statements(program.Statements, Void)
+	a.checkCalls()
+	return &Info{Contexts: a.contexts, Diagnostics: a.diagnostics}
+}
+
+type analyzer struct {
+	info *resolve.Info
+
+	// the subs being analysed, innermost last, and those that return a
+	// list without asking wantarray, by qualified name
+	subs  []*sub
+	lists map[string]*sub
+
+	// the calls of subs in scalar context, checked once every sub is
+	// known, since a sub may be called before it is defined
+	calls []call
+
+	contexts    map[ast.Expression]Context
+	diagnostics []diagnostics.Diagnostic
+}
+
+type sub struct {
+	name      string
+	list      ast.Expression // a list the sub returns
+	wantarray bool
+}
+
+type call struct {
+	name string
+	node ast.Expression
+}
+
+// statements analyses a list of statements, the last of which is in
+// context last.
+func (a *analyzer) statements(list []ast.Statement, last Context) {
+	for i, s := range list {
+		c := Void
+		if i == len(list)-1 {
+			c = last
+		}
+		a.statement(s, c)
+	}
+}
+
+func (a *analyzer) statement(s ast.Statement, c Context) {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		a.expr(s.Expression, c)
+		switch c {
+		case Void:
+			a.useless(s.Expression)
+		case Caller:
+			a.returns(s.Expression)
+		}
+
+	case *ast.MyStatement:
+		c := of(s.Name)
+		a.expr(s.Name, c)
+		if s.Value != nil {
+			a.expr(s.Value, c)
+		}
+
+	case *ast.ReturnStatement:
+		if s.ReturnValue != nil {
+			a.expr(s.ReturnValue, Caller)
+			a.returns(s.ReturnValue)
+		}
+
+	case *ast.BlockStatement:
+		a.statements(s.Statements, c)
+
+	case *ast.IfStatement:
+		a.condition(s.Condition)
+		a.statements(s.Consequence.Statements, c)
+		if s.Alternative != nil {
+			a.statement(s.Alternative, c)
+		}
+
+	case *ast.WhileStatement:
+		if s.Condition != nil {
+			a.condition(s.Condition)
+		}
+		a.statements(s.Body.Statements, Void)
+		if s.Continue != nil {
+			a.statements(s.Continue.Statements, Void)
+		}
+
+	case *ast.ForStatement:
+		for _, e := range []ast.Expression{s.Init, s.Condition, s.Step} {
+			if e == nil {
+				continue
+			}
+			if e == s.Condition {
+				a.condition(e)
+			} else {
+				a.expr(e, Void)
+			}
+		}
+		a.statements(s.Body.Statements, Void)
+
+	case *ast.ForeachStatement:
+		if s.Variable != nil {
+			a.expr(s.Variable, Scalar)
+		}
+		a.expr(s.List, List)
+		a.statements(s.Body.Statements, Void)
+		if s.Continue != nil {
+			a.statements(s.Continue.Statements, Void)
+		}
+
+	case *ast.LabeledStatement:
+		a.statement(s.Statement, c)
+
+	case *ast.ModifiedStatement:
+		switch s.Token.Type {
+		case token.FOR, token.FOREACH:
+			a.expr(s.Condition, List)
+			a.statement(s.Statement, Void)
+		case token.WHILE, token.UNTIL:
+			a.condition(s.Condition)
+			a.statement(s.Statement, Void)
+		default:
+			a.condition(s.Condition)
+			a.statement(s.Statement, c)
+		}
+
+	case *ast.PackageStatement:
+		a.statements(s.Body.Statements, Void)
+
+	case *ast.ClassStatement:
+		if s.Body != nil {
+			a.statements(s.Body.Statements, Void)
+		}
+
+	case *ast.FieldStatement:
+		c := of(s.Name)
+		a.expr(s.Name, c)
+		if s.Value != nil {
+			a.expr(s.Value, c)
+		}
+
+	case *ast.UseStatement:
+		for _, e := range s.Imports {
+			a.expr(e, List)
+		}
+
+	case *ast.NoStatement:
+		for _, e := range s.Imports {
+			a.expr(e, List)
+		}
+
+	case *ast.RequireStatement:
+		if s.Value != nil {
+			a.expr(s.Value, Scalar)
+		}
+
+	case *ast.SubStatement:
+		if s.Body != nil {
+			a.sub(a.info.Qualify(s, s.Name.Value), s.Signature, s.Body)
+		}
+
+	case *ast.MethodStatement:
+		if s.Body != nil {
+			a.sub(a.info.Qualify(s, s.Name.Value), s.Signature, s.Body)
+		}
+
+	case *ast.PhaseBlock:
+		a.statements(s.Body.Statements, Void)
+	}
+}
+
+// sub analyses the body of a sub or method, noting whether it returns a
+// list to callers that may want a scalar.
+func (a *analyzer) sub(name string, sig *ast.Signature, body *ast.BlockStatement) {
+	if sig != nil {
+		for _, p := range sig.Parameters {
+			a.expr(p.Name, of(p.Name))
+			if p.Default != nil {
+				a.expr(p.Default, Scalar)
+			}
+		}
+	}
+
+	s := &sub{name: name}
+	a.subs = append(a.subs, s)
+	a.statements(body.Statements, Caller)
+	a.subs = a.subs[:len(a.subs)-1]
+
+	if s.list != nil && !s.wantarray {
+		a.lists[name] = s
+	} else {
+		delete(a.lists, name)
+	}
+}
+
+// returns notes that the sub being analysed returns the value of e.
+func (a *analyzer) returns(e ast.Expression) {
+	if len(a.subs) == 0 {
+		return
+	}
+	if s := a.subs[len(a.subs)-1]; s.list == nil && isList(e) {
+		s.list = e
+	}
+}
+
+// of returns the context a declared variable or assignment target
+// gives its value: list for an array or hash, and scalar otherwise.
+func of(target ast.Expression) Context {
+	if isAggregate(target) {
+		return List
+	}
+	return Scalar
+}
+
+// isAggregate reports whether assigning to e is a list assignment: e is
+// an array, hash, slice or list of variables.
+func isAggregate(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.Variable:
+		return e.Sigil == ast.ArraySigil || e.Sigil == ast.HashSigil
+	case *ast.Declaration:
+		return e.Parens || isAggregate(e.Variables[0])
+	case *ast.ListLiteral, *ast.PostfixSlice:
+		return true
+	case *ast.Index:
+		return isAggregate(e.Left) && !e.Arrow
+	case *ast.Dereference:
+		return e.Sigil == ast.ArraySigil || e.Sigil == ast.HashSigil
+	case *ast.PostfixDeref:
+		return e.Sigil == ast.ArraySigil || e.Sigil == ast.HashSigil
+	}
+	return false
+}
+
+// listBuiltins are the builtins that return a list, which in scalar
+// context is something else: a count, or for reverse, a reversed string.
+var listBuiltins = map[string]bool{
+	"grep": true, "keys": true, "map": true, "reverse": true, "sort": true,
+	"split": true, "values": true,
+}
+
+// isList reports whether e gives a list: more or less than one value,
+// or an array or hash, which may hold any number.
+func isList(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.ListLiteral:
+		return len(e.Elements) != 1 || isList(e.Elements[0])
+	case *ast.QuoteWords:
+		return len(e.Words) != 1
+	case *ast.CallExpression:
+		name, ok := e.Function.(*ast.Identifier)
+		return ok && !e.Arrow && listBuiltins[name.Value]
+	case *ast.Declaration:
+		return false
+	}
+	return isAggregate(e)
+}
+
+// expr analyses e, evaluated in context c.
+func (a *analyzer) expr(e ast.Expression, c Context) {
+	a.contexts[e] = c
+
+	switch e := e.(type) {
+	case *ast.Variable, *ast.IntegerLiteral, *ast.NumberLiteral,
+		*ast.StringLiteral, *ast.BooleanLiteral, *ast.Undef,
+		*ast.QuoteWords, *ast.VersionLiteral:
+
+	case *ast.Declaration:
+		for _, v := range e.Variables {
+			a.expr(v, c)
+		}
+
+	case *ast.ListLiteral:
+		if c == Scalar && len(e.Elements) > 1 {
+			d := diagnostics.Errorf(diagnostics.ListInScalarContext, ast.SpanOf(e),
+				"list in scalar context evaluates to its last element")
+			d.Severity = diagnostics.Warning
+			d.Label = "only the last element is used"
+			a.diagnostics = append(a.diagnostics, d)
+		}
+		for i, el := range e.Elements {
+			// the comma operator throws away all but its last operand
+			if c == Scalar && i < len(e.Elements)-1 {
+				a.expr(el, Void)
+			} else {
+				a.expr(el, c)
+			}
+		}
+
+	case *ast.ArrayLiteral:
+		a.list(e.Elements)
+	case *ast.HashLiteral:
+		a.list(e.Elements)
+
+	case *ast.PrefixExpression:
+		if e.Operator == "!" || e.Operator == "not" {
+			a.condition(e.Right)
+		} else {
+			a.expr(e.Right, Scalar)
+		}
+	case *ast.PostfixExpression:
+		a.expr(e.Left, Scalar)
+	case *ast.InfixExpression:
+		a.infix(e, c)
+
+	case *ast.ConditionalExpression:
+		a.condition(e.Condition)
+		a.expr(e.Consequence, c)
+		a.expr(e.Alternative, c)
+
+	case *ast.Identifier:
+		if e.Value == "wantarray" {
+			a.wantarray()
+		}
+		if c == Scalar {
+			a.calls = append(a.calls, call{a.info.Qualify(e, e.Value), e})
+		}
+
+	case *ast.CallExpression:
+		a.call(e, c)
+
+	case *ast.MethodCall:
+		a.contexts[e.Method] = c
+		a.expr(e.Invocant, Scalar)
+		a.list(e.Arguments)
+		if c != Scalar {
+			break
+		}
+		switch inv := e.Invocant.(type) {
+		case *ast.Identifier:
+			a.calls = append(a.calls, call{inv.Value + "::" + e.Method.Value, e})
+		case *ast.Variable:
+			if inv.Name == "self" && inv.Sigil == ast.ScalarSigil {
+				a.calls = append(a.calls, call{a.info.PackageOf(inv) + "::" + e.Method.Value, e})
+			}
+		}
+
+	case *ast.Index:
+		// an element has a scalar subscript and a slice a list of them
+		slice := isAggregate(e)
+		if e.Arrow || !isVariable(e.Left) {
+			a.expr(e.Left, Scalar)
+		} else {
+			a.expr(e.Left, of(e))
+		}
+		if slice {
+			a.expr(e.Index, List)
+		} else {
+			a.expr(e.Index, Scalar)
+		}
+
+	case *ast.Dereference:
+		a.expr(e.Value, Scalar)
+	case *ast.PostfixDeref:
+		a.expr(e.Left, Scalar)
+	case *ast.PostfixSlice:
+		a.expr(e.Left, Scalar)
+		a.expr(e.Index, List)
+
+	default:
+		// anything else is analysed as a scalar
+		ast.Inspect(e, func(n ast.Node) bool {
+			if sub, ok := n.(ast.Expression); ok && n != ast.Node(e) {
+				a.expr(sub, Scalar)
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// condition analyses e as a condition, in scalar context. Testing a
+// list a sub returns, as in if (items()), asks whether it is empty, so
+// it isn't a mistake.
+func (a *analyzer) condition(e ast.Expression) {
+	n := len(a.calls)
+	a.expr(e, Scalar)
+	calls := a.calls[:n]
+	for _, c := range a.calls[n:] {
+		if c.node != e {
+			calls = append(calls, c)
+		}
+	}
+	a.calls = calls
+}
+
+func isVariable(e ast.Expression) bool {
+	_, ok := e.(*ast.Variable)
+	return ok
+}
+
+// list analyses expressions in list context, such as the elements of an
+// anonymous array or the arguments of a call.
+func (a *analyzer) list(list []ast.Expression) {
+	for _, e := range list {
+		a.expr(e, List)
+	}
+}
+
+func (a *analyzer) infix(e *ast.InfixExpression, c Context) {
+	switch e.Operator {
+	case "=":
+		// a list assignment takes its value in list context
+		t := of(e.Left)
+		a.expr(e.Left, t)
+		a.expr(e.Right, t)
+	case "x":
+		if _, ok := e.Left.(*ast.ListLiteral); ok {
+			a.expr(e.Left, List)
+		} else {
+			a.expr(e.Left, Scalar)
+		}
+		a.expr(e.Right, Scalar)
+	case "&&", "||", "//", "and", "or":
+		// the right operand is the value of the whole
+		a.expr(e.Left, Scalar)
+		a.expr(e.Right, c)
+	default:
+		a.expr(e.Left, Scalar)
+		a.expr(e.Right, Scalar)
+	}
+}
+
+// scalarArguments are the builtins that take their arguments in scalar
+// context, such as the named unary operators.
+var scalarArguments = map[string]bool{
+	"abs": true, "atan2": true, "bless": true, "chdir": true, "chr": true,
+	"close": true, "cos": true, "defined": true, "delete": true,
+	"exists": true, "exp": true, "hex": true, "index": true, "int": true,
+	"lc": true, "lcfirst": true, "length": true, "log": true, "oct": true,
+	"ord": true, "quotemeta": true, "rand": true, "ref": true,
+	"rindex": true, "scalar": true, "sin": true, "split": true,
+	"sqrt": true, "substr": true, "uc": true, "ucfirst": true,
+}
+
+// scalarFirst are the builtins that take a scalar, then a list.
+var scalarFirst = map[string]bool{"join": true, "sprintf": true}
+
+// blocks holds the context of the last statement in the block of the
+// builtins that take one: each value of a map block is part of a list,
+// while grep and sort want one value each time. An eval block gives the
+// value of the eval.
+var blocks = map[string]Context{"map": List, "grep": Scalar, "sort": Scalar}
+
+func (a *analyzer) call(e *ast.CallExpression, c Context) {
+	name, ok := e.Function.(*ast.Identifier)
+	if !ok || e.Arrow {
+		a.expr(e.Function, Scalar)
+		a.list(e.Arguments)
+		return
+	}
+	a.contexts[name] = c
+
+	if e.Block != nil {
+		bc, ok := blocks[name.Value]
+		switch {
+		case name.Value == "eval" || name.Value == "do":
+			bc = c
+		case !ok:
+			bc = List
+		}
+		a.statements(e.Block.Statements, bc)
+	}
+	for i, arg := range e.Arguments {
+		if scalarArguments[name.Value] || scalarFirst[name.Value] && i == 0 {
+			a.expr(arg, Scalar)
+		} else {
+			a.expr(arg, List)
+		}
+	}
+
+	if name.Value == "wantarray" {
+		a.wantarray()
+	}
+	if c == Scalar && e.Block == nil {
+		a.calls = append(a.calls, call{a.info.Qualify(name, name.Value), e})
+	}
+}
+
+// wantarray notes that the sub being analysed asks the context it was
+// called in, so it may return a list only when one is wanted.
+func (a *analyzer) wantarray() {
+	if len(a.subs) > 0 {
+		a.subs[len(a.subs)-1].wantarray = true
+	}
+}
+
+// checkCalls warns about each call in scalar context of a sub that
+// returns a list.
+func (a *analyzer) checkCalls() {
+	for _, c := range a.calls {
+		s := a.lists[c.name]
+		if s == nil {
+			continue
+		}
+		d := diagnostics.Errorf(diagnostics.ListReturnInScalarContext, ast.SpanOf(c.node),
+			"%s returns a list, but is called in scalar context", s.name)
+		d.Severity = diagnostics.Warning
+		d.Label = "called in scalar context"
+		d.Labels = []diagnostics.Label{{Span: ast.SpanOf(s.list), Message: "returns a list here"}}
+		a.diagnostics = append(a.diagnostics, d)
+	}
+}
+
+// pure are the operators whose only effect is their value.
+var pure = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "%": true, "**": true,
+	".": true, "==": true, "!=": true, "<": true, ">": true, "<=": true,
+	">=": true, "<=>": true, "eq": true, "ne": true, "lt": true,
+	"gt": true, "le": true, "ge": true, "cmp": true,
+}
+
+// useless warns if e, a statement in void context, computes a value
+// only to throw it away. Like perl, it allows the constants 0 and 1,
+// which end modules.
+func (a *analyzer) useless(e ast.Expression) {
+	var what string
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		if e.Value == 0 || e.Value == 1 {
+			return
+		}
+		what = "a constant"
+	case *ast.NumberLiteral, *ast.StringLiteral, *ast.QuoteWords:
+		what = "a constant"
+	case *ast.Variable:
+		what = "a variable"
+	case *ast.InfixExpression:
+		if !pure[e.Operator] {
+			return
+		}
+		what = "the " + e.Operator + " operator"
+	default:
+		return
+	}
+	d := diagnostics.Errorf(diagnostics.UselessInVoidContext, ast.SpanOf(e),
+		"useless use of %s in void context", what)
+	d.Severity = diagnostics.Warning
+	d.Label = "this value is thrown away"
+	a.diagnostics = append(a.diagnostics, d)
+}
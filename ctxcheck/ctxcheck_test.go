@@ -0,0 +1,114 @@
+package ctxcheck_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/ctxcheck"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+)
+
+func analyze(t *testing.T, input string) (*ast.Program, *ctxcheck.Info) {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	return program, ctxcheck.Analyze(program, resolve.Resolve(program))
+}
+
+// contexts describes the context of each expression in input, by its
+// source, in the order they appear.
+func contexts(t *testing.T, input string) []string {
+	t.Helper()
+	program, info := analyze(t, input)
+	var out []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if e, ok := n.(ast.Expression); ok {
+			out = append(out, fmt.Sprintf("%s: %s", e, info.ContextOf(e)))
+		}
+		return true
+	})
+	return out
+}
+
+// found describes diagnostics as code@offset.
+func found(diags []diagnostics.Diagnostic) string {
+	var out []string
+	for _, d := range diags {
+		out = append(out, fmt.Sprintf("%s@%d", d.Code, d.Span.Start))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestContexts(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`my $n = @list;`, []string{"$n: scalar", "@list: scalar"}},
+		{`my ($first) = @list;`, []string{"(my ($first) = @list): void", "my ($first): list", "$first: list", "@list: list"}},
+		{`my @all = f(1);`, []string{"@all: list", "f(1): list", "f: list", "1: list"}},
+		{`$x = g(@b);`, []string{"($x = g(@b)): void", "$x: scalar", "g(@b): scalar", "g: scalar", "@b: list"}},
+		{`sub f { return @list }`, []string{"f: void", "@list: caller"}},
+		{`sub g { $x + 1 }`, []string{"g: void", "($x + 1): caller", "$x: scalar", "1: scalar"}},
+		{`sub h { if ($x) { 1 } else { (2, 3) } }`, []string{"h: void", "$x: scalar", "1: caller", "(2, 3): caller", "2: caller", "3: caller"}},
+		{`my $c = (1, 2);`, []string{"$c: scalar", "(1, 2): scalar", "1: void", "2: scalar"}},
+		{`open(F) or die "no";`, []string{"(open(F) or die \"no\"): void", "open(F): scalar", "open: scalar", "F: list", "die \"no\": void", "die: void", "\"no\": list"}},
+		{`my @b = map { ($_, 1) } @a;`, []string{"@b: list", "map { ($_, 1) } @a: list", "map: list", "($_, 1): list", "$_: list", "1: list", "@a: list"}},
+		{`grep { $_ } @a;`, []string{"grep { $_ } @a: void", "grep: void", "$_: scalar", "@a: list"}},
+		{`$h{k}; @h{qw(a b)}; $r->[0];`, []string{"$h{k}: void", "$h: scalar", "k: scalar", "@h{qw(a b)}: void", "@h: list", "qw(a b): list", "$r->[0]: void", "$r: scalar", "0: scalar"}},
+		{`join ",", @a; length $s;`, []string{"join \",\", @a: void", "join: void", "\",\": scalar", "@a: list", "length $s: void", "length: void", "$s: scalar"}},
+		{`for my $x (@a) { } while (@a) { }`, []string{"my $x: scalar", "$x: scalar", "@a: list", "@a: scalar"}},
+		{`my $y = $t ? @a : $b;`, []string{"$y: scalar", "($t ? @a : $b): scalar", "$t: scalar", "@a: scalar", "$b: scalar"}},
+		{`@x = (1, 2) x 3; $s = "-" x 3;`, []string{"(@x = ((1, 2) x 3)): void", "@x: list", "((1, 2) x 3): list", "(1, 2): list", "1: list", "2: list", "3: scalar", "($s = (\"-\" x 3)): void", "$s: scalar", "(\"-\" x 3): scalar", "\"-\": scalar", "3: scalar"}},
+		{`my $n = () = f();`, []string{"$n: scalar", "(() = f()): scalar", "(): list", "f(): list", "f: list"}},
+		{`class P { field @items; method m($x, @rest) { $self->n(@rest) } }`, []string{"P: void", "@items: list", "m: void", "$x: scalar", "@rest: list", "$self->n(@rest): caller", "$self: scalar", "n: caller", "@rest: list"}},
+	}
+
+	for _, tt := range tests {
+		got := contexts(t, tt.input)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.input, strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`my $l = (4, 5, 6);`, "E0500@8"},
+		{`my ($l) = (4, 5, 6); my @l = (4, 5); my $n = @l; return (1, 2);`, ""},
+		{`sub items { my @list; return @list } my $n = items(); my @a = items(); my ($f) = items();`, "E0501@45"},
+		{`my $n = pair(); sub pair { (1, 2) }`, "E0501@8"},
+		{`sub aware { return wantarray ? @x : $x[0] } my $a = aware();`, ""},
+		{`sub items { my @l; @l } if (items()) { } unless (!items()) { } my $n = () = items();`, ""},
+		{`sub rev { reverse @_ } my $s = rev("ab");`, "E0501@31"},
+		{`package Foo; sub kids { my @k; @k } package main; my $k = Foo->kids;`, "E0501@58"},
+		{`class C { method all { my @a; @a } method count { my $n = $self->all; $n } }`, "E0501@58"},
+		{`$n == 1; "abc"; $x; 1; 0; $x = 1; f();`, "E0502@0 E0502@9 E0502@16"},
+		{`sub f { $n == 1 }`, ""},
+	}
+
+	for _, tt := range tests {
+		_, info := analyze(t, tt.input)
+		if got := found(info.Diagnostics); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q (%v)", tt.input, tt.expected, got, info.Diagnostics)
+		}
+	}
+
+	_, info := analyze(t, `sub items { my @list; return @list } my $n = items();`)
+	d := info.Diagnostics[0]
+	if d.Severity != diagnostics.Warning || d.Message != "main::items returns a list, but is called in scalar context" ||
+		len(d.Labels) != 1 || d.Labels[0].Span != (diagnostics.Span{Start: 29, End: 34}) {
+		t.Errorf("unexpected diagnostic %v with labels %v", d, d.Labels)
+	}
+}
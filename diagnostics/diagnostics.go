@@ -0,0 +1,163 @@
+// Package diagnostics describes problems found in perl source, such as
+// syntax errors from the lexer and parser, and renders them against the
+// source they refer to.
+package diagnostics
+
+import (
+	"fmt"
+
+	"github.com/perigrin/simian/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Diagnostic codes. Each kind of problem has its own code so tools can
+// filter or suppress them without matching on the message.
+const (
+	// lexer
+	UnknownCharacter   = "E0001"
+	UnterminatedString = "E0002"
+
+	// parser
+	UnexpectedToken    = "E0100"
+	ExpectedExpression = "E0101"
+	UnclosedDelimiter  = "E0102"
+	InvalidNumber      = "E0103"
+
+	// grammar files
+	UndefinedSymbol   = "E0200"
+	UnreachableSymbol = "E0201"
+	AmbiguousParse    = "E0202"
+
+	// names
+	Redeclared         = "E0300"
+	Shadowed           = "E0301"
+	UndeclaredVariable = "E0302"
+	BarewordNotAllowed = "E0303"
+	SymbolicReference  = "E0304"
+	UnknownStrictTag   = "E0305"
+
+	// types
+	TypeMismatch  = "E0400"
+	InfiniteType  = "E0401"
+	ArgumentCount = "E0402"
+	UnknownType   = "E0403"
+
+	// context
+	ListInScalarContext       = "E0500"
+	ListReturnInScalarContext = "E0501"
+	UselessInVoidContext      = "E0502"
+
+	// classes
+	UnknownParent    = "E0600"
+	InheritanceCycle = "E0601"
+	WrongParentKind  = "E0602"
+	MissingMethod    = "E0603"
+	DuplicateField   = "E0604"
+	DuplicateParam   = "E0605"
+
+	// folding
+	DivisionByZero = "E0700"
+
+	// control flow
+	UnreachableCode = "E0800"
+	MissingReturn   = "E0801"
+)
+
+// Span is the half open range of byte offsets [Start, End) in the
+// source. An empty span marks a position between two characters.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// SpanOf returns the span covered by t.
+func SpanOf(t token.Token) Span {
+	return Span{Start: t.Offset, End: t.Offset + len(t.Literal)}
+}
+
+// After returns the empty span just past t, where something missing
+// after it would go.
+func After(t token.Token) Span {
+	end := t.Offset + len(t.Literal)
+	return Span{Start: end, End: end}
+}
+
+// Label attaches a message to a span of source.
+type Label struct {
+	Span    Span
+	Message string
+}
+
+// Fix is a suggested edit: replace the text in Span with Replacement.
+type Fix struct {
+	Message     string
+	Span        Span
+	Replacement string
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Message  string
+
+	// Span is the primary location of the problem and Label, if set,
+	// explains what is wrong there.
+	Span  Span
+	Label string
+
+	// Labels point at other source that helps explain the problem.
+	Labels []Label
+
+	Fix *Fix
+}
+
+func (d Diagnostic) String() string {
+	if d.Code == "" {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s[%s]: %s", d.Severity, d.Code, d.Message)
+}
+
+func (d Diagnostic) Error() string {
+	return d.String()
+}
+
+// Errorf returns an error diagnostic at span.
+func Errorf(code string, span Span, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Span:     span,
+	}
+}
+
+// HasErrors reports whether any of diags is an error.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package diagnostics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const tabWidth = 4
+
+// Position returns the 1-based line and column of offset in src.
+// Columns count characters, not bytes.
+func Position(src []byte, offset int) (line, column int) {
+	offset = clamp(src, offset)
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	line = bytes.Count(src[:offset], []byte{'\n'}) + 1
+	return line, utf8.RuneCount(src[start:offset]) + 1
+}
+
+// clamp keeps offset within src, moving a position just past a final
+// newline back onto the last line.
+func clamp(src []byte, offset int) int {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset == len(src) && offset > 0 && src[offset-1] == '\n' {
+		offset--
+	}
+	return offset
+}
+
+// Render writes each diagnostic in the style of rustc: a header, the
+// file position, then the lines of src it refers to with carets under
+// the primary span and dashes under any secondary labels.
+func Render(w io.Writer, filename string, src []byte, diags ...Diagnostic) error {
+	for i, d := range diags {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, renderOne(filename, src, d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marker is a label drawn under a source line.
+type marker struct {
+	line    int
+	start   int // display columns, 0-based
+	width   int
+	char    byte
+	message string
+}
+
+func renderOne(filename string, src []byte, d Diagnostic) string {
+	markers := []marker{newMarker(src, d.Span, '^', d.Label)}
+	for _, l := range d.Labels {
+		markers = append(markers, newMarker(src, l.Span, '-', l.Message))
+	}
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].line < markers[j].line
+	})
+
+	gutter := len(strconv.Itoa(markers[len(markers)-1].line))
+	pad := strings.Repeat(" ", gutter)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", d)
+	line, column := Position(src, d.Span.Start)
+	fmt.Fprintf(&b, "%s--> %s:%d:%d\n", pad, filename, line, column)
+	fmt.Fprintf(&b, "%s |\n", pad)
+
+	last := 0
+	for _, m := range markers {
+		if m.line != last {
+			if last != 0 && m.line > last+1 {
+				b.WriteString("...\n")
+			}
+			fmt.Fprintf(&b, "%*d | %s\n", gutter, m.line, expandTabs(sourceLine(src, m.line)))
+			last = m.line
+		}
+		underline := strings.TrimRight(strings.Repeat(" ", m.start)+strings.Repeat(string(m.char), m.width)+" "+m.message, " ")
+		fmt.Fprintf(&b, "%s | %s\n", pad, underline)
+	}
+
+	if d.Fix != nil {
+		fmt.Fprintf(&b, "%s |\n", pad)
+		fmt.Fprintf(&b, "%s = help: %s\n", pad, d.Fix.Message)
+	}
+	return b.String()
+}
+
+func newMarker(src []byte, span Span, char byte, message string) marker {
+	start := clamp(src, span.Start)
+	end := clamp(src, span.End)
+	if end < start {
+		end = start
+	}
+	lineStart := bytes.LastIndexByte(src[:start], '\n') + 1
+	if nl := bytes.IndexByte(src[start:end], '\n'); nl >= 0 {
+		// only underline the first line of a multi-line span
+		end = start + nl
+	}
+
+	line, _ := Position(src, start)
+	from := displayWidth(src[lineStart:start])
+	width := displayWidth(src[lineStart:end]) - from
+	if width < 1 {
+		width = 1
+	}
+	return marker{line: line, start: from, width: width, char: char, message: message}
+}
+
+func sourceLine(src []byte, line int) string {
+	lines := bytes.Split(src, []byte{'\n'})
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(string(lines[line-1]), "\r")
+}
+
+func displayWidth(b []byte) int {
+	width := 0
+	for _, r := range string(b) {
+		if r == '\t' {
+			width += tabWidth
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+func expandTabs(s string) string {
+	return strings.ReplaceAll(s, "\t", strings.Repeat(" ", tabWidth))
+}
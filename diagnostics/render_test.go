@@ -0,0 +1,90 @@
+package diagnostics_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/diagnostics"
+)
+
+func TestPosition(t *testing.T) {
+	src := []byte("my $x;\n\tmy $y;\n")
+
+	tests := []struct {
+		offset int
+		line   int
+		column int
+	}{
+		{0, 1, 1},
+		{3, 1, 4},
+		{7, 2, 1},
+		{9, 2, 3},
+		{len(src), 2, 8},
+	}
+
+	for _, tt := range tests {
+		line, column := diagnostics.Position(src, tt.offset)
+		if line != tt.line || column != tt.column {
+			t.Errorf("offset %d: expected %d:%d, got %d:%d", tt.offset, tt.line, tt.column, line, column)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := []byte("sub f {\n\tmy $x 5;\n}\n")
+
+	d := diagnostics.Errorf(diagnostics.UnexpectedToken, diagnostics.Span{Start: 15, End: 16},
+		"expected `=`, found `5`")
+	d.Label = "expected `=`"
+	d.Labels = []diagnostics.Label{{Span: diagnostics.Span{Start: 0, End: 3}, Message: "in this sub"}}
+	d.Fix = &diagnostics.Fix{Message: "insert `=`", Span: diagnostics.Span{Start: 14, End: 14}, Replacement: "="}
+
+	expected := strings.Join([]string{
+		"error[E0100]: expected `=`, found `5`",
+		" --> test.pl:2:8",
+		"  |",
+		"1 | sub f {",
+		"  | --- in this sub",
+		"2 |     my $x 5;",
+		"  |           ^ expected `=`",
+		"  |",
+		"  = help: insert `=`",
+		"",
+	}, "\n")
+
+	var b strings.Builder
+	if err := diagnostics.Render(&b, "test.pl", src, d); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+func TestRenderSkippedLines(t *testing.T) {
+	src := []byte("{\n1;\n2;\n3;\n")
+
+	d := diagnostics.Errorf(diagnostics.UnclosedDelimiter, diagnostics.Span{Start: len(src), End: len(src)},
+		"unclosed delimiter `{`")
+	d.Labels = []diagnostics.Label{{Span: diagnostics.Span{Start: 0, End: 1}, Message: "unclosed delimiter"}}
+
+	expected := strings.Join([]string{
+		"error[E0102]: unclosed delimiter `{`",
+		" --> test.pl:4:3",
+		"  |",
+		"1 | {",
+		"  | - unclosed delimiter",
+		"...",
+		"4 | 3;",
+		"  |   ^",
+		"",
+	}, "\n")
+
+	var b strings.Builder
+	if err := diagnostics.Render(&b, "test.pl", src, d); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
@@ -0,0 +1,223 @@
+package earley
+
+import (
+	"github.com/perigrin/simian/token"
+)
+
+// item is an Earley item: rule with the first dot symbols of its right
+// hand side recognised from token origin up to the set holding it.
+type item struct {
+	rule   *Rule
+	dot    int
+	origin int
+}
+
+func (it item) next() (string, bool) {
+	if it.dot >= len(it.rule.RHS) {
+		return "", false
+	}
+	return it.rule.RHS[it.dot], true
+}
+
+func (it item) advance() item {
+	return item{rule: it.rule, dot: it.dot + 1, origin: it.origin}
+}
+
+// set is the Earley set for one position in the input.
+type set struct {
+	items []item
+	seen  map[item]bool
+
+	// items in this set whose next symbol is the key
+	waiting map[string][]item
+
+	// Leo items memoised by symbol; a nil entry means there is none
+	leo map[string]*item
+}
+
+func newSet() *set {
+	return &set{
+		seen:    make(map[item]bool),
+		waiting: make(map[string][]item),
+		leo:     make(map[string]*item),
+	}
+}
+
+type chart struct {
+	g      *Grammar
+	tokens []token.Token
+	sets   []*set
+	start  *Rule
+
+	// the terminals each token is, when a Scanner said so; otherwise
+	// the grammar matches them
+	accepts []map[string]bool
+
+	// index of the last set reached; when the parse fails this is where
+	// the unexpected token is
+	last int
+}
+
+// recognise runs the Earley recogniser over tokens.
+func (g *Grammar) recognise(tokens []token.Token) *chart {
+	c := g.newChart()
+	c.tokens = tokens
+	c.run(func(i int) bool { return i < len(c.tokens) })
+	return c
+}
+
+// recogniseFrom runs the Earley recogniser over the tokens s returns,
+// telling it which terminals each set expects. It also returns the EOF
+// token, or the last token read when the parse stopped early.
+func (g *Grammar) recogniseFrom(s Scanner) (*chart, token.Token) {
+	c := g.newChart()
+	var eof token.Token
+	c.run(func(i int) bool {
+		tok, terminals := s.Scan(c.expected(i))
+		eof = tok
+		if tok.Type == token.EOF {
+			return false
+		}
+		accepts := make(map[string]bool)
+		for _, t := range terminals {
+			accepts[t] = true
+		}
+		c.tokens = append(c.tokens, tok)
+		c.accepts = append(c.accepts, accepts)
+		return true
+	})
+	return c, eof
+}
+
+func (g *Grammar) newChart() *chart {
+	c := &chart{
+		g:     g,
+		sets:  []*set{newSet()},
+		start: &Rule{RHS: []string{g.Start}},
+	}
+	c.add(0, item{rule: c.start})
+	return c
+}
+
+// run fills in the sets in turn, scanning token i once set i is
+// complete, for as long as next reports there is a token i.
+func (c *chart) run(next func(i int) bool) {
+	for i := 0; ; i++ {
+		c.last = i
+		s := c.sets[i]
+		for j := 0; j < len(s.items); j++ {
+			it := s.items[j]
+			sym, ok := it.next()
+			switch {
+			case !ok:
+				c.complete(i, it)
+			case !c.g.IsTerminal(sym):
+				c.predict(i, it, sym)
+			}
+		}
+		if !next(i) {
+			return
+		}
+
+		c.sets = append(c.sets, newSet())
+		for _, it := range s.items {
+			if sym, ok := it.next(); ok && c.g.IsTerminal(sym) && c.match(sym, i) {
+				c.add(i+1, it.advance())
+			}
+		}
+		if len(c.sets[i+1].items) == 0 {
+			return
+		}
+	}
+}
+
+// match reports whether token i can be the terminal sym.
+func (c *chart) match(sym string, i int) bool {
+	if c.accepts != nil {
+		return c.accepts[i][sym]
+	}
+	return c.g.match(sym, c.tokens[i])
+}
+
+func (c *chart) add(i int, it item) {
+	s := c.sets[i]
+	if s.seen[it] {
+		return
+	}
+	s.seen[it] = true
+	s.items = append(s.items, it)
+	if sym, ok := it.next(); ok {
+		s.waiting[sym] = append(s.waiting[sym], it)
+	}
+}
+
+func (c *chart) predict(i int, it item, sym string) {
+	for _, r := range c.g.RulesFor(sym) {
+		c.add(i, item{rule: r, origin: i})
+	}
+	if c.g.Nullable(sym) {
+		// Aycock and Horspool: a nullable symbol may be skipped outright
+		c.add(i, it.advance())
+	}
+}
+
+func (c *chart) complete(i int, it item) {
+	lhs := it.rule.LHS
+	if it.origin < i {
+		if top := c.leo(it.origin, lhs); top != nil {
+			c.add(i, *top)
+			return
+		}
+	}
+	for _, w := range c.sets[it.origin].waiting[lhs] {
+		c.add(i, w.advance())
+	}
+}
+
+// leo returns the topmost completed item of the deterministic chain of
+// reductions set k's items make once sym is complete, following Leo
+// (1991). A chain exists when exactly one item in the set waits for sym
+// and sym is the last symbol of its rule; completing sym then completes
+// that item, which may in turn be the only item waiting in its origin
+// set. Adding just the top of the chain keeps right recursion linear.
+func (c *chart) leo(k int, sym string) *item {
+	s := c.sets[k]
+	if top, ok := s.leo[sym]; ok {
+		return top
+	}
+	// guard against cycles through unit rules while computing
+	s.leo[sym] = nil
+
+	waiting := s.waiting[sym]
+	if len(waiting) != 1 || waiting[0].dot+1 != len(waiting[0].rule.RHS) {
+		return nil
+	}
+	w := waiting[0]
+	top := w.advance()
+	if above := c.leo(w.origin, w.rule.LHS); above != nil {
+		top = *above
+	}
+	s.leo[sym] = &top
+	return &top
+}
+
+// accepted reports whether the whole input derives the start symbol.
+func (c *chart) accepted() bool {
+	n := len(c.tokens)
+	return len(c.sets) == n+1 && c.sets[n].seen[item{rule: c.start, dot: 1}]
+}
+
+// expected returns the terminals set i could have scanned next.
+func (c *chart) expected(i int) []string {
+	var terminals []string
+	seen := make(map[string]bool)
+	for _, it := range c.sets[i].items {
+		sym, ok := it.next()
+		if !ok || !c.g.IsTerminal(sym) || seen[sym] {
+			continue
+		}
+		seen[sym] = true
+		terminals = append(terminals, sym)
+	}
+	return terminals
+}
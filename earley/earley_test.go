@@ -0,0 +1,147 @@
+package earley_test
+
+import (
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/earley"
+	"github.com/perigrin/simian/lexer"
+)
+
+func rule(lhs string, action earley.Action, rhs ...string) *earley.Rule {
+	return &earley.Rule{LHS: lhs, RHS: rhs, Action: action}
+}
+
+func infix(n *earley.Node, children []ast.Node) ast.Node {
+	return &ast.InfixExpression{
+		Token:    n.Children[1].Token,
+		Left:     children[0].(ast.Expression),
+		Operator: string(n.Children[1].Token.Literal),
+		Right:    children[2].(ast.Expression),
+	}
+}
+
+func myStatement(n *earley.Node, children []ast.Node) ast.Node {
+	return &ast.MyStatement{
+		Token: n.Children[0].Token,
+		Name:  children[1].(*ast.Variable),
+		Value: children[3].(ast.Expression),
+	}
+}
+
+// testGrammar is the small statement grammar from docs/chat-gpt.md.
+func testGrammar() *earley.Grammar {
+	return earley.NewGrammar("Program",
+		rule("Program", nil, "StatementList"),
+		rule("StatementList", nil, "Statement", "StatementList"),
+		rule("StatementList", nil),
+		rule("Statement", myStatement, "my", "IDENTIFIER", "=", "Expression", ";"),
+		rule("Statement", nil, "Expression", ";"),
+		rule("Expression", infix, "Expression", "+", "Term"),
+		rule("Expression", infix, "Expression", "-", "Term"),
+		rule("Expression", nil, "Term"),
+		rule("Term", infix, "Term", "*", "Factor"),
+		rule("Term", nil, "Factor"),
+		rule("Factor", nil, "IDENTIFIER"),
+		rule("Factor", nil, "DIGIT"),
+		rule("Factor", nil, "(", "Expression", ")"),
+	)
+}
+
+func TestParseTree(t *testing.T) {
+	tree, errors := testGrammar().Parse(lexer.New([]byte("1 + 2 * 3;")))
+	if len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	expected := `(Program (StatementList (Statement (Expression (Expression (Term (Factor DIGIT("1")))) +("+") (Term (Term (Factor DIGIT("2"))) *("*") (Factor DIGIT("3")))) ;(";")) (StatementList)))`
+	if tree.String() != expected {
+		t.Errorf("expected %s\ngot %s", expected, tree.String())
+	}
+}
+
+func TestParseProgram(t *testing.T) {
+	p := earley.NewParser(testGrammar(), lexer.New([]byte("my $x = (1 - 2) * 3;\n$x + 1;")))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("unexpected errors: %v", p.Errors())
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(program.Statements))
+	}
+
+	my, ok := program.Statements[0].(*ast.MyStatement)
+	if !ok {
+		t.Fatalf("expected *ast.MyStatement, got %T", program.Statements[0])
+	}
+	if my.Name.String() != "$x" {
+		t.Errorf("expected $x, got %s", my.Name)
+	}
+	product, ok := my.Value.(*ast.InfixExpression)
+	if !ok || product.Operator != "*" {
+		t.Fatalf("expected a product, got %+v", my.Value)
+	}
+	if difference, ok := product.Left.(*ast.InfixExpression); !ok || difference.Operator != "-" {
+		t.Errorf("expected a difference, got %+v", product.Left)
+	}
+
+	stmt, ok := program.Statements[1].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ExpressionStatement, got %T", program.Statements[1])
+	}
+	if stmt.TokenLiteral() != "$x" {
+		t.Errorf("expected statement to start at $x, got %s", stmt.TokenLiteral())
+	}
+	if sum, ok := stmt.Expression.(*ast.InfixExpression); !ok || sum.Operator != "+" {
+		t.Errorf("expected a sum, got %+v", stmt.Expression)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		start int
+	}{
+		{"my $x = ;", 8},
+		{"1 + 2", 5},
+		{"1 2;", 2},
+	}
+
+	for _, tt := range tests {
+		p := earley.NewParser(testGrammar(), lexer.New([]byte(tt.input)))
+		program := p.ParseProgram()
+
+		if len(program.Statements) != 0 {
+			t.Errorf("%q: expected no statements, got %d", tt.input, len(program.Statements))
+		}
+		if len(p.Errors()) != 1 {
+			t.Fatalf("%q: expected 1 error, got %v", tt.input, p.Errors())
+		}
+		d := p.Errors()[0]
+		if d.Code != diagnostics.UnexpectedToken || d.Span.Start != tt.start {
+			t.Errorf("%q: expected unexpected token at %d, got %s at %d", tt.input, tt.start, d, d.Span.Start)
+		}
+		if d.Label == "" {
+			t.Errorf("%q: expected a label listing what was expected", tt.input)
+		}
+	}
+}
+
+func TestNullableRules(t *testing.T) {
+	g := earley.NewGrammar("List",
+		rule("List", nil, "Opt", "Item", "Opt"),
+		rule("Opt", nil),
+		rule("Opt", nil, ","),
+		rule("Item", nil, "DIGIT"),
+	)
+
+	for _, input := range []string{"1", ", 1", "1 ,", ", 1 ,"} {
+		if tree, errors := g.Parse(lexer.New([]byte(input))); tree == nil {
+			t.Errorf("%q: expected a parse, got %v", input, errors)
+		}
+	}
+	if tree, _ := g.Parse(lexer.New([]byte(", ,"))); tree != nil {
+		t.Errorf("expected no parse, got %s", tree)
+	}
+}
@@ -0,0 +1,311 @@
+package earley
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/token"
+)
+
+// ForestNode is a node of a shared packed parse forest: every way Symbol
+// derives tokens [Start, End). A node is shared by all the derivations
+// that use it, and an ambiguous node packs each of its derivations as a
+// separate family.
+type ForestNode struct {
+	Symbol   string
+	Start    int
+	End      int
+	Token    token.Token // for terminals
+	Families []*Family
+}
+
+// Family is one derivation of a forest node: a rule and the nodes its
+// right hand side symbols derive.
+type Family struct {
+	Rule     *Rule
+	Children []*ForestNode
+}
+
+func (n *ForestNode) IsTerminal() bool {
+	return len(n.Families) == 0
+}
+
+// Ambiguous reports whether the node has more than one derivation.
+func (n *ForestNode) Ambiguous() bool {
+	return len(n.Families) > 1
+}
+
+func (f *Family) String() string {
+	parts := []string{f.Rule.LHS, "::="}
+	for _, c := range f.Children {
+		parts = append(parts, fmt.Sprintf("%s[%d,%d)", c.Symbol, c.Start, c.End))
+	}
+	return strings.Join(parts, " ")
+}
+
+type Forest struct {
+	Root   *ForestNode
+	tokens []token.Token
+}
+
+// forest builds the parse forest for the start symbol over all tokens.
+func (c *chart) forest() *Forest {
+	b := &forestBuilder{
+		c:        c,
+		nodes:    make(map[span]*ForestNode),
+		building: make(map[span]bool),
+		families: make(map[prefix][][]*ForestNode),
+	}
+	return &Forest{Root: b.node(c.g.Start, 0, len(c.tokens)), tokens: c.tokens}
+}
+
+// span identifies a derivation of a symbol over tokens [start, end).
+type span struct {
+	symbol     string
+	start, end int
+}
+
+// prefix identifies the first dot symbols of a rule over [start, end).
+type prefix struct {
+	rule       *Rule
+	dot        int
+	start, end int
+}
+
+// forestBuilder derives the forest top down from the chart. Completed
+// items are not consulted since Leo's optimisation leaves some of them
+// out; instead each rule is matched right to left against the items that
+// must exist for its prefixes.
+type forestBuilder struct {
+	c        *chart
+	nodes    map[span]*ForestNode
+	building map[span]bool
+	families map[prefix][][]*ForestNode
+}
+
+func (b *forestBuilder) node(sym string, start, end int) *ForestNode {
+	key := span{sym, start, end}
+	if n, ok := b.nodes[key]; ok {
+		return n
+	}
+
+	if b.c.g.IsTerminal(sym) {
+		var n *ForestNode
+		if end == start+1 && b.c.match(sym, start) {
+			n = &ForestNode{Symbol: sym, Start: start, End: end, Token: b.c.tokens[start]}
+		}
+		b.nodes[key] = n
+		return n
+	}
+
+	if b.building[key] {
+		// a symbol deriving itself over the same span adds no new trees
+		return nil
+	}
+	b.building[key] = true
+	defer delete(b.building, key)
+
+	n := &ForestNode{Symbol: sym, Start: start, End: end}
+	for _, r := range b.c.g.RulesFor(sym) {
+		if !b.c.sets[start].seen[item{rule: r, origin: start}] {
+			continue
+		}
+		for _, children := range b.match(r, len(r.RHS), start, end) {
+			n.Families = append(n.Families, &Family{Rule: r, Children: children})
+		}
+	}
+	if len(n.Families) == 0 {
+		n = nil
+	}
+	b.nodes[key] = n
+	return n
+}
+
+// match returns every list of nodes deriving the first dot symbols of r
+// over [start, end).
+func (b *forestBuilder) match(r *Rule, dot, start, end int) [][]*ForestNode {
+	if dot == 0 {
+		if start == end {
+			return [][]*ForestNode{nil}
+		}
+		return nil
+	}
+
+	key := prefix{r, dot, start, end}
+	if lists, ok := b.families[key]; ok {
+		return lists
+	}
+
+	var lists [][]*ForestNode
+	last := r.RHS[dot-1]
+	for k := end; k >= start; k-- {
+		if dot > 1 && !b.c.sets[k].seen[item{rule: r, dot: dot - 1, origin: start}] {
+			continue
+		}
+		if dot == 1 && k != start {
+			continue
+		}
+		child := b.node(last, k, end)
+		if child == nil {
+			continue
+		}
+		for _, list := range b.match(r, dot-1, start, k) {
+			children := make([]*ForestNode, len(list), len(list)+1)
+			copy(children, list)
+			lists = append(lists, append(children, child))
+		}
+	}
+	b.families[key] = lists
+	return lists
+}
+
+// Tree returns one parse tree from the forest, taking the first family
+// of every ambiguous node.
+func (f *Forest) Tree() *Node {
+	return f.Root.tree()
+}
+
+func (n *ForestNode) tree() *Node {
+	if n.IsTerminal() {
+		return &Node{Symbol: n.Symbol, Start: n.Start, End: n.End, Token: n.Token}
+	}
+	family := n.Families[0]
+	node := &Node{Symbol: n.Symbol, Rule: family.Rule, Start: n.Start, End: n.End}
+	for _, c := range family.Children {
+		node.Children = append(node.Children, c.tree())
+	}
+	return node
+}
+
+// Count returns the number of distinct parse trees in the forest, or
+// math.MaxInt if there are more than that.
+func (f *Forest) Count() int {
+	return f.Root.count(make(map[*ForestNode]int))
+}
+
+func (n *ForestNode) count(memo map[*ForestNode]int) int {
+	if n.IsTerminal() {
+		return 1
+	}
+	if c, ok := memo[n]; ok {
+		return c
+	}
+	total := 0
+	for _, family := range n.Families {
+		product := 1
+		for _, child := range family.Children {
+			product = saturatingMultiply(product, child.count(memo))
+		}
+		total = saturatingAdd(total, product)
+	}
+	memo[n] = total
+	return total
+}
+
+func saturatingMultiply(a, b int) int {
+	if a != 0 && b > math.MaxInt/a {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+func saturatingAdd(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// Ambiguity is a span of input that a symbol derives in more than one
+// way, with the competing derivations.
+type Ambiguity struct {
+	Symbol     string
+	Start, End int // token indices
+	Span       diagnostics.Span
+	Families   []*Family
+}
+
+// Ambiguities lists every ambiguous node in the forest, in source order
+// with outer spans before the spans nested in them.
+func (f *Forest) Ambiguities() []Ambiguity {
+	var result []Ambiguity
+	seen := make(map[*ForestNode]bool)
+	var visit func(n *ForestNode)
+	visit = func(n *ForestNode) {
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		if n.Ambiguous() {
+			result = append(result, Ambiguity{
+				Symbol:   n.Symbol,
+				Start:    n.Start,
+				End:      n.End,
+				Span:     f.span(n.Start, n.End),
+				Families: n.Families,
+			})
+		}
+		for _, family := range n.Families {
+			for _, c := range family.Children {
+				visit(c)
+			}
+		}
+	}
+	visit(f.Root)
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Start != result[j].Start {
+			return result[i].Start < result[j].Start
+		}
+		return result[i].End > result[j].End
+	})
+	return result
+}
+
+// span returns the source covered by tokens [start, end).
+func (f *Forest) span(start, end int) diagnostics.Span {
+	if start >= len(f.tokens) || start == end {
+		if start < len(f.tokens) {
+			return diagnostics.Span{Start: f.tokens[start].Offset, End: f.tokens[start].Offset}
+		}
+		if len(f.tokens) == 0 {
+			return diagnostics.Span{}
+		}
+		return diagnostics.After(f.tokens[len(f.tokens)-1])
+	}
+	last := f.tokens[end-1]
+	return diagnostics.Span{Start: f.tokens[start].Offset, End: last.Offset + len(last.Literal)}
+}
+
+// Report describes each ambiguity as a warning listing the competing
+// rules, with a label under the pieces of each derivation.
+func (f *Forest) Report() []diagnostics.Diagnostic {
+	var diags []diagnostics.Diagnostic
+	for _, a := range f.Ambiguities() {
+		d := diagnostics.Diagnostic{
+			Severity: diagnostics.Warning,
+			Code:     diagnostics.AmbiguousParse,
+			Message:  fmt.Sprintf("ambiguous %s: %d derivations", a.Symbol, len(a.Families)),
+			Span:     a.Span,
+		}
+		var rules []string
+		for i, family := range a.Families {
+			rules = append(rules, fmt.Sprintf("%d: %s", i+1, family))
+			for _, c := range family.Children {
+				if c.Start == a.Start && c.End == a.End {
+					continue
+				}
+				d.Labels = append(d.Labels, diagnostics.Label{
+					Span:    f.span(c.Start, c.End),
+					Message: fmt.Sprintf("%d: %s", i+1, c.Symbol),
+				})
+			}
+		}
+		d.Label = strings.Join(rules, "; ")
+		diags = append(diags, d)
+	}
+	return diags
+}
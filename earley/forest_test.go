@@ -0,0 +1,141 @@
+package earley_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/earley"
+	"github.com/perigrin/simian/lexer"
+)
+
+// ambiguousGrammar leaves the associativity of + unspecified.
+func ambiguousGrammar() *earley.Grammar {
+	return earley.NewGrammar("E",
+		rule("E", nil, "E", "+", "E"),
+		rule("E", nil, "DIGIT"),
+	)
+}
+
+func parseForest(t *testing.T, g *earley.Grammar, input string) *earley.Forest {
+	t.Helper()
+	forest, errors := g.ParseForest(lexer.New([]byte(input)))
+	if len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+	return forest
+}
+
+func TestForestCount(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"1", 1},
+		{"1 + 2", 1},
+		{"1 + 2 + 3", 2},
+		{"1 + 2 + 3 + 4", 5},
+		{"1 + 2 + 3 + 4 + 5", 14},
+	}
+
+	for _, tt := range tests {
+		forest := parseForest(t, ambiguousGrammar(), tt.input)
+		if got := forest.Count(); got != tt.expected {
+			t.Errorf("%q: expected %d trees, got %d", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestForestSharing(t *testing.T) {
+	forest := parseForest(t, ambiguousGrammar(), "1 + 2 + 3")
+	root := forest.Root
+	if len(root.Families) != 2 {
+		t.Fatalf("expected 2 families, got %d", len(root.Families))
+	}
+
+	// 1 + (2 + 3) and (1 + 2) + 3 both reach `1` through the same node
+	first := map[*earley.ForestNode]bool{}
+	for _, f := range root.Families {
+		for _, c := range f.Children {
+			if c.Symbol == "E" && c.Start == 0 && c.End == 1 {
+				first[c] = true
+			}
+			for _, g := range c.Families {
+				for _, gc := range g.Children {
+					if gc.Symbol == "E" && gc.Start == 0 && gc.End == 1 {
+						first[gc] = true
+					}
+				}
+			}
+		}
+	}
+	if len(first) != 1 {
+		t.Errorf("expected the node for `1` to be shared, got %d copies", len(first))
+	}
+}
+
+func TestAmbiguities(t *testing.T) {
+	forest := parseForest(t, ambiguousGrammar(), "1 + 2 + 3")
+	ambiguities := forest.Ambiguities()
+	if len(ambiguities) != 1 {
+		t.Fatalf("expected 1 ambiguity, got %d", len(ambiguities))
+	}
+
+	a := ambiguities[0]
+	if a.Symbol != "E" || a.Start != 0 || a.End != 5 {
+		t.Errorf("expected E over tokens [0, 5), got %s over [%d, %d)", a.Symbol, a.Start, a.End)
+	}
+	if a.Span != (diagnostics.Span{Start: 0, End: 9}) {
+		t.Errorf("expected span 0-9, got %v", a.Span)
+	}
+	if len(a.Families) != 2 {
+		t.Fatalf("expected 2 competing derivations, got %d", len(a.Families))
+	}
+	splits := map[string]bool{}
+	for _, f := range a.Families {
+		splits[f.String()] = true
+	}
+	for _, expected := range []string{"E ::= E[0,1) +[1,2) E[2,5)", "E ::= E[0,3) +[3,4) E[4,5)"} {
+		if !splits[expected] {
+			t.Errorf("expected a derivation %s, got %v", expected, splits)
+		}
+	}
+}
+
+func TestUnambiguous(t *testing.T) {
+	forest := parseForest(t, testGrammar(), "my $x = 1 + 2 * 3; $x - 1;")
+	if got := forest.Count(); got != 1 {
+		t.Errorf("expected 1 tree, got %d", got)
+	}
+	if a := forest.Ambiguities(); len(a) != 0 {
+		t.Errorf("expected no ambiguities, got %v", a)
+	}
+	if d := forest.Report(); len(d) != 0 {
+		t.Errorf("expected no diagnostics, got %v", d)
+	}
+}
+
+func TestAmbiguityReport(t *testing.T) {
+	src := "1 + 2 + 3"
+	forest := parseForest(t, ambiguousGrammar(), src)
+	diags := forest.Report()
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d", len(diags))
+	}
+
+	d := diags[0]
+	if d.Severity != diagnostics.Warning || d.Code != diagnostics.AmbiguousParse {
+		t.Errorf("expected an ambiguity warning, got %s", d)
+	}
+	if d.Message != "ambiguous E: 2 derivations" {
+		t.Errorf("unexpected message %q", d.Message)
+	}
+
+	var out strings.Builder
+	diagnostics.Render(&out, "test.pl", []byte(src), d)
+	for _, expected := range []string{"warning[E0202]", "E ::= E[0,1) +[1,2) E[2,5)", "1: E", "2: E"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected rendering to contain %q, got\n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Package earley implements an Earley parser for context free grammars,
+// with Leo's optimisation so right recursive rules parse in linear time.
+//
+// A Grammar is a list of rules over symbols. Symbols that are the left
+// hand side of some rule are nonterminals; every other symbol is a
+// terminal matched against a token from the lexer.
+package earley
+
+import (
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/token"
+)
+
+// Action builds the AST for a node of the parse tree from the values
+// already built for its children. Terminals are built with
+// ast.TokenToAstNode, so punctuation and keywords are nil.
+type Action func(n *Node, children []ast.Node) ast.Node
+
+// Rule is the production LHS ::= RHS. An empty RHS derives nothing.
+type Rule struct {
+	LHS    string
+	RHS    []string
+	Action Action
+}
+
+type Grammar struct {
+	Start string
+	Rules []*Rule
+
+	// Match reports whether tok can be the terminal. When nil a terminal
+	// matches tokens of the type it names, or spelled the same as it.
+	Match func(terminal string, tok token.Token) bool
+
+	byLHS    map[string][]*Rule
+	nullable map[string]bool
+}
+
+// NewGrammar returns a grammar deriving start from rules.
+func NewGrammar(start string, rules ...*Rule) *Grammar {
+	g := &Grammar{Start: start, Rules: rules}
+	g.byLHS = make(map[string][]*Rule)
+	for _, r := range rules {
+		g.byLHS[r.LHS] = append(g.byLHS[r.LHS], r)
+	}
+	g.nullable = nullable(rules)
+	return g
+}
+
+// IsTerminal reports whether no rule defines sym.
+func (g *Grammar) IsTerminal(sym string) bool {
+	_, ok := g.byLHS[sym]
+	return !ok
+}
+
+// RulesFor returns the rules defining sym.
+func (g *Grammar) RulesFor(sym string) []*Rule {
+	return g.byLHS[sym]
+}
+
+// Nullable reports whether sym can derive the empty string.
+func (g *Grammar) Nullable(sym string) bool {
+	return g.nullable[sym]
+}
+
+func (g *Grammar) match(terminal string, tok token.Token) bool {
+	if g.Match != nil {
+		return g.Match(terminal, tok)
+	}
+	return string(tok.Type) == terminal || string(tok.Literal) == terminal
+}
+
+// nullable finds the symbols deriving the empty string by iterating to
+// a fixed point.
+func nullable(rules []*Rule) map[string]bool {
+	result := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, r := range rules {
+			if result[r.LHS] || !allNullable(r.RHS, result) {
+				continue
+			}
+			result[r.LHS] = true
+			changed = true
+		}
+	}
+	return result
+}
+
+func allNullable(symbols []string, nullable map[string]bool) bool {
+	for _, sym := range symbols {
+		if !nullable[sym] {
+			return false
+		}
+	}
+	return true
+}
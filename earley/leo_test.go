@@ -0,0 +1,42 @@
+package earley
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/lexer"
+)
+
+func TestLeoRightRecursion(t *testing.T) {
+	g := NewGrammar("S",
+		&Rule{LHS: "S", RHS: []string{"a", "S"}},
+		&Rule{LHS: "S", RHS: []string{"a"}},
+	)
+
+	const n = 200
+	tokens := lexer.New([]byte(strings.Repeat("a ", n))).Tokens()
+	c := g.recognise(tokens)
+	if !c.accepted() {
+		t.Fatalf("expected %d a's to be accepted", n)
+	}
+
+	// without Leo's optimisation set i holds a completed S for every
+	// earlier origin, so the chart grows quadratically
+	for i, s := range c.sets {
+		if len(s.items) > 6 {
+			t.Fatalf("set %d has %d items, expected a constant number", i, len(s.items))
+		}
+	}
+
+	tree := c.forest().Tree()
+	depth := 0
+	for node := tree; node != nil; depth++ {
+		if len(node.Children) < 2 {
+			break
+		}
+		node = node.Children[1]
+	}
+	if depth != n-1 {
+		t.Errorf("expected a right leaning tree of depth %d, got %d", n-1, depth)
+	}
+}
@@ -0,0 +1,156 @@
+package earley
+
+import (
+	"strings"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/token"
+)
+
+// nodeList carries the values of several children up to a rule without
+// an action of its own.
+type nodeList struct {
+	nodes []ast.Node
+}
+
+func (l *nodeList) TokenLiteral() string { return "" }
+
+func (l *nodeList) String() string {
+	parts := make([]string, len(l.nodes))
+	for i, n := range l.nodes {
+		parts[i] = n.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+type astParser struct {
+	parse  func() (*Node, []diagnostics.Diagnostic)
+	errors []diagnostics.Diagnostic
+
+	// the first token of the tree node each value was built from
+	first map[ast.Node]token.Token
+}
+
+// NewParser returns a parser.Parser that parses with g, building the AST
+// with the actions on g's rules. Rules without an action pass their
+// children's values up; the statements and expressions that reach the
+// top of the tree become the program, unless the start symbol's action
+// builds the *ast.Program itself.
+func NewParser(g *Grammar, l *lexer.Lexer) parser.Parser {
+	return newParser(func() (*Node, []diagnostics.Diagnostic) { return g.Parse(l) })
+}
+
+// NewParserFrom returns a parser.Parser like NewParser's that reads its
+// tokens from s.
+func NewParserFrom(g *Grammar, s Scanner) parser.Parser {
+	return newParser(func() (*Node, []diagnostics.Diagnostic) { return g.ParseFrom(s) })
+}
+
+func newParser(parse func() (*Node, []diagnostics.Diagnostic)) *astParser {
+	return &astParser{
+		parse:  parse,
+		errors: []diagnostics.Diagnostic{},
+		first:  make(map[ast.Node]token.Token),
+	}
+}
+
+func (p *astParser) Errors() []diagnostics.Diagnostic {
+	return p.errors
+}
+
+func (p *astParser) ParseProgram() *ast.Program {
+	program := &ast.Program{}
+	program.Statements = []ast.Statement{}
+
+	tree, errors := p.parse()
+	p.errors = append(p.errors, errors...)
+	if tree == nil {
+		return program
+	}
+
+	v := p.build(tree)
+	if built, ok := v.(*ast.Program); ok {
+		return built
+	}
+	for _, n := range Flatten(v) {
+		switch n := n.(type) {
+		case ast.Statement:
+			program.Statements = append(program.Statements, n)
+		case ast.Expression:
+			stmt := &ast.ExpressionStatement{Token: p.first[n], Expression: n}
+			program.Statements = append(program.Statements, stmt)
+		}
+	}
+	return program
+}
+
+func (p *astParser) build(n *Node) ast.Node {
+	if n.IsTerminal() {
+		v := ast.TokenToAstNode(n.Token)
+		if v != nil {
+			p.first[v] = n.Token
+		}
+		return v
+	}
+
+	children := make([]ast.Node, len(n.Children))
+	for i, c := range n.Children {
+		children[i] = p.build(c)
+	}
+
+	var v ast.Node
+	if n.Rule.Action != nil {
+		v = n.Rule.Action(n, children)
+	} else {
+		v = passThrough(children)
+	}
+	if _, ok := v.(*nodeList); v != nil && !ok {
+		if _, seen := p.first[v]; !seen {
+			p.first[v] = n.firstToken()
+		}
+	}
+	return v
+}
+
+func (n *Node) firstToken() token.Token {
+	for n != nil && !n.IsTerminal() {
+		if len(n.Children) == 0 {
+			return token.Token{}
+		}
+		n = n.Children[0]
+	}
+	return n.Token
+}
+
+// passThrough is the action for rules without one. Punctuation and
+// keywords have no value; a single remaining value is passed up as is.
+func passThrough(children []ast.Node) ast.Node {
+	values := Flatten(children...)
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return values[0]
+	default:
+		return &nodeList{nodes: values}
+	}
+}
+
+// Flatten expands the lists of values passed up by rules without an
+// action, and drops nils, so an action sees just the values it can use.
+func Flatten(nodes ...ast.Node) []ast.Node {
+	var result []ast.Node
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case nil:
+		case *nodeList:
+			result = append(result, Flatten(n.nodes...)...)
+		default:
+			result = append(result, n)
+		}
+	}
+	return result
+}
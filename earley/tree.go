@@ -0,0 +1,120 @@
+package earley
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/token"
+)
+
+// Node is a node of the parse tree covering tokens [Start, End). Leaves
+// are terminals and hold the token they matched; interior nodes hold the
+// rule used to derive them.
+type Node struct {
+	Symbol   string
+	Rule     *Rule
+	Start    int
+	End      int
+	Token    token.Token
+	Children []*Node
+}
+
+// IsTerminal reports whether n is a leaf.
+func (n *Node) IsTerminal() bool {
+	return n.Rule == nil
+}
+
+// String prints n as an s-expression of symbols and token literals.
+func (n *Node) String() string {
+	if n.IsTerminal() {
+		return fmt.Sprintf("%s(%q)", n.Symbol, n.Token.Literal)
+	}
+	parts := []string{n.Symbol}
+	for _, c := range n.Children {
+		parts = append(parts, c.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// Parse reads the tokens from l and returns their parse tree, choosing
+// one derivation wherever the input is ambiguous. When the input does
+// not match the grammar the tree is nil and the diagnostics say where
+// the parse failed.
+func (g *Grammar) Parse(l *lexer.Lexer) (*Node, []diagnostics.Diagnostic) {
+	forest, errors := g.ParseForest(l)
+	if forest == nil {
+		return nil, errors
+	}
+	return forest.Tree(), errors
+}
+
+// ParseForest reads the tokens from l and returns every parse of them as
+// a shared packed parse forest.
+func (g *Grammar) ParseForest(l *lexer.Lexer) (*Forest, []diagnostics.Diagnostic) {
+	var tokens []token.Token
+	tok := l.NextToken()
+	for ; tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type != token.INVALID {
+			tokens = append(tokens, tok)
+		}
+	}
+
+	errors := append([]diagnostics.Diagnostic{}, l.Diagnostics()...)
+	c := g.recognise(tokens)
+	if !c.accepted() {
+		return nil, append(errors, c.failure(tok))
+	}
+	return c.forest(), errors
+}
+
+// Scanner splits the input into tokens as the parse goes, so what the
+// grammar expects can decide where each token ends, as in Marpa's
+// scanless interface.
+type Scanner interface {
+	// Scan returns the next token given the terminals the parser can
+	// accept there, along with the terminals the token is. At the end of
+	// the input it returns an EOF token.
+	Scan(expected []string) (token.Token, []string)
+
+	Diagnostics() []diagnostics.Diagnostic
+}
+
+// ParseFrom returns the parse tree of the tokens s returns, as Parse
+// does for a lexer.
+func (g *Grammar) ParseFrom(s Scanner) (*Node, []diagnostics.Diagnostic) {
+	forest, errors := g.ParseForestFrom(s)
+	if forest == nil {
+		return nil, errors
+	}
+	return forest.Tree(), errors
+}
+
+// ParseForestFrom returns every parse of the tokens s returns as a shared
+// packed parse forest.
+func (g *Grammar) ParseForestFrom(s Scanner) (*Forest, []diagnostics.Diagnostic) {
+	c, eof := g.recogniseFrom(s)
+	errors := append([]diagnostics.Diagnostic{}, s.Diagnostics()...)
+	if !c.accepted() {
+		return nil, append(errors, c.failure(eof))
+	}
+	return c.forest(), errors
+}
+
+// failure describes where the recogniser stopped.
+func (c *chart) failure(eof token.Token) diagnostics.Diagnostic {
+	found := eof
+	description := "end of input"
+	if c.last < len(c.tokens) {
+		found = c.tokens[c.last]
+		description = fmt.Sprintf("`%s`", found.Literal)
+	}
+
+	d := diagnostics.Errorf(diagnostics.UnexpectedToken, diagnostics.SpanOf(found),
+		"unexpected %s", description)
+	if expected := c.expected(c.last); len(expected) > 0 {
+		d.Label = "expected " + strings.Join(expected, ", ")
+	}
+	return d
+}
@@ -0,0 +1,172 @@
+// Package ecs stores data about a program as entities and components, so
+// analyses can attach what they learn (types, scopes, lint results) to
+// the things they analyse without changing the AST.
+//
+// An Entity is just an ID. Components are plain Go values kept in one
+// Store per component type, and Systems are functions over a World that
+// a Schedule runs in dependency order. Materialize adds an entity for
+// every node of an AST.
+package ecs
+
+import (
+	"iter"
+	"reflect"
+	"sort"
+)
+
+// Entity identifies something in a World. IDs are never reused, and the
+// zero Entity is never issued, so it can stand for no entity.
+type Entity uint32
+
+// World holds entities and their components.
+type World struct {
+	last   Entity
+	alive  map[Entity]bool
+	stores map[reflect.Type]store
+}
+
+// store is what a World needs of a Store without knowing its type.
+type store interface {
+	Remove(e Entity)
+}
+
+// NewWorld returns an empty World.
+func NewWorld() *World {
+	return &World{
+		alive:  make(map[Entity]bool),
+		stores: make(map[reflect.Type]store),
+	}
+}
+
+// NewEntity returns a new entity without components.
+func (w *World) NewEntity() Entity {
+	w.last++
+	w.alive[w.last] = true
+	return w.last
+}
+
+// Alive reports whether e was issued by w and not yet destroyed.
+func (w *World) Alive(e Entity) bool {
+	return w.alive[e]
+}
+
+// Destroy removes e and all its components.
+func (w *World) Destroy(e Entity) {
+	if !w.alive[e] {
+		return
+	}
+	delete(w.alive, e)
+	for _, s := range w.stores {
+		s.Remove(e)
+	}
+}
+
+// Entities returns the live entities in the order they were made.
+func (w *World) Entities() []Entity {
+	entities := make([]Entity, 0, len(w.alive))
+	for e := range w.alive {
+		entities = append(entities, e)
+	}
+	sort.Slice(entities, func(i, j int) bool { return entities[i] < entities[j] })
+	return entities
+}
+
+// Store holds the components of type T, at most one per entity. It keeps
+// them in a dense slice with an index by entity, so lookups are constant
+// time and iteration doesn't visit entities without a T.
+type Store[T any] struct {
+	w        *World
+	values   []T
+	entities []Entity
+	index    map[Entity]int
+}
+
+// Components returns w's store for components of type T, creating it the
+// first time it's asked for.
+func Components[T any](w *World) *Store[T] {
+	t := reflect.TypeFor[T]()
+	if s, ok := w.stores[t]; ok {
+		return s.(*Store[T])
+	}
+	s := &Store[T]{w: w, index: make(map[Entity]int)}
+	w.stores[t] = s
+	return s
+}
+
+// Set gives e the component v, replacing any T it had. Setting a
+// component on a destroyed entity does nothing.
+func (s *Store[T]) Set(e Entity, v T) {
+	if !s.w.alive[e] {
+		return
+	}
+	if i, ok := s.index[e]; ok {
+		s.values[i] = v
+		return
+	}
+	s.index[e] = len(s.values)
+	s.values = append(s.values, v)
+	s.entities = append(s.entities, e)
+}
+
+// Get returns e's T and whether it has one.
+func (s *Store[T]) Get(e Entity) (T, bool) {
+	if i, ok := s.index[e]; ok {
+		return s.values[i], true
+	}
+	var zero T
+	return zero, false
+}
+
+// Has reports whether e has a T.
+func (s *Store[T]) Has(e Entity) bool {
+	_, ok := s.index[e]
+	return ok
+}
+
+// Remove takes e's T away, moving the last component into its place.
+func (s *Store[T]) Remove(e Entity) {
+	i, ok := s.index[e]
+	if !ok {
+		return
+	}
+	last := len(s.values) - 1
+	s.values[i], s.entities[i] = s.values[last], s.entities[last]
+	s.index[s.entities[i]] = i
+	var zero T
+	s.values[last] = zero
+	s.values, s.entities = s.values[:last], s.entities[:last]
+	delete(s.index, e)
+}
+
+// Len returns the number of entities with a T.
+func (s *Store[T]) Len() int {
+	return len(s.values)
+}
+
+// All yields each entity with a T and its component, in the order they
+// were set except where Remove has moved one. The store must not be
+// changed during iteration, except to Set components that already exist.
+func (s *Store[T]) All() iter.Seq2[Entity, T] {
+	return func(yield func(Entity, T) bool) {
+		for i, e := range s.entities {
+			if !yield(e, s.values[i]) {
+				return
+			}
+		}
+	}
+}
+
+// Set gives e the component v in w.
+func Set[T any](w *World, e Entity, v T) {
+	Components[T](w).Set(e, v)
+}
+
+// Get returns e's component of type T in w, and whether it has one.
+func Get[T any](w *World, e Entity) (T, bool) {
+	return Components[T](w).Get(e)
+}
+
+// Has reports whether e has a component of type T in w.
+func Has[T any](w *World, e Entity) bool {
+	return Components[T](w).Has(e)
+}
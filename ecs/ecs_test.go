@@ -0,0 +1,151 @@
+package ecs_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/ecs"
+)
+
+type position struct{ x, y int }
+type name string
+
+func TestStore(t *testing.T) {
+	w := ecs.NewWorld()
+	a, b, c := w.NewEntity(), w.NewEntity(), w.NewEntity()
+	if a == 0 || a == b || b == c {
+		t.Fatalf("entities should be distinct and non-zero: %d %d %d", a, b, c)
+	}
+
+	positions := ecs.Components[position](w)
+	positions.Set(a, position{1, 2})
+	positions.Set(c, position{5, 6})
+	ecs.Set(w, b, name("b"))
+
+	if p, ok := positions.Get(a); !ok || p != (position{1, 2}) {
+		t.Errorf("expected a at 1,2, got %v %t", p, ok)
+	}
+	if positions.Has(b) {
+		t.Errorf("b has no position")
+	}
+	if n, ok := ecs.Get[name](w, b); !ok || n != "b" {
+		t.Errorf("expected b's name, got %q %t", n, ok)
+	}
+	if ecs.Components[position](w) != positions {
+		t.Errorf("expected the same store for the same type")
+	}
+
+	positions.Set(a, position{3, 4})
+	positions.Remove(a)
+	if positions.Has(a) || positions.Len() != 1 {
+		t.Errorf("expected only c to have a position, got %d", positions.Len())
+	}
+	if p, _ := positions.Get(c); p != (position{5, 6}) {
+		t.Errorf("removing a moved c's position: %v", p)
+	}
+
+	var seen []ecs.Entity
+	for e := range positions.All() {
+		seen = append(seen, e)
+	}
+	if !slices.Equal(seen, []ecs.Entity{c}) {
+		t.Errorf("expected to iterate over c, got %v", seen)
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	w := ecs.NewWorld()
+	a, b := w.NewEntity(), w.NewEntity()
+	ecs.Set(w, a, position{1, 1})
+	ecs.Set(w, a, name("a"))
+	ecs.Set(w, b, name("b"))
+
+	w.Destroy(a)
+	if w.Alive(a) || !w.Alive(b) {
+		t.Errorf("expected only b alive")
+	}
+	if ecs.Has[position](w, a) || ecs.Has[name](w, a) {
+		t.Errorf("destroying a should remove its components")
+	}
+	ecs.Set(w, a, name("again"))
+	if ecs.Has[name](w, a) {
+		t.Errorf("components can't be set on destroyed entities")
+	}
+	if c := w.NewEntity(); c == a {
+		t.Errorf("entity IDs must not be reused")
+	}
+	if got := w.Entities(); len(got) != 2 || got[0] != b {
+		t.Errorf("expected b and the new entity, got %v", got)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	var ran []string
+	system := func(name string, after ...string) ecs.System {
+		return ecs.System{Name: name, After: after, Run: func(*ecs.World) error {
+			ran = append(ran, name)
+			return nil
+		}}
+	}
+
+	var s ecs.Schedule
+	s.Add(
+		system("types", "scopes"),
+		system("lint", "types", "scopes"),
+		system("scopes"),
+		system("context"),
+	)
+	if err := s.Run(ecs.NewWorld()); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "scopes types lint context"; strings.Join(ran, " ") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(ran, " "))
+	}
+}
+
+func TestScheduleErrors(t *testing.T) {
+	noop := func(*ecs.World) error { return nil }
+	tests := []struct {
+		systems  []ecs.System
+		expected string
+	}{
+		{[]ecs.System{{Name: "a", Run: noop}, {Name: "a", Run: noop}}, "two systems are named a"},
+		{[]ecs.System{{Name: "a", After: []string{"b"}, Run: noop}}, "a runs after unknown system b"},
+		{[]ecs.System{
+			{Name: "a", After: []string{"b"}, Run: noop},
+			{Name: "b", After: []string{"a"}, Run: noop},
+			{Name: "c", Run: noop},
+		}, "systems depend on each other in a cycle: a, b"},
+	}
+
+	for _, tt := range tests {
+		var s ecs.Schedule
+		s.Add(tt.systems...)
+		if _, err := s.Order(); err == nil || err.Error() != tt.expected {
+			t.Errorf("expected %q, got %v", tt.expected, err)
+		}
+	}
+}
+
+func TestScheduleStopsAtError(t *testing.T) {
+	broken := errors.New("broken")
+	ran := false
+	var s ecs.Schedule
+	s.Add(
+		ecs.System{Name: "first", Run: func(*ecs.World) error { return broken }},
+		ecs.System{Name: "second", After: []string{"first"}, Run: func(*ecs.World) error {
+			ran = true
+			return nil
+		}},
+	)
+
+	err := s.Run(ecs.NewWorld())
+	if !errors.Is(err, broken) || err.Error() != "first: broken" {
+		t.Errorf("expected first's error, got %v", err)
+	}
+	if ran {
+		t.Errorf("systems after a failure should not run")
+	}
+}
@@ -0,0 +1,113 @@
+package ecs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// System is a named step over a World, such as resolving names or
+// inferring types. After names the systems whose results it reads,
+// which a Schedule runs first.
+type System struct {
+	Name  string
+	After []string
+	Run   func(w *World) error
+}
+
+// Schedule runs systems in an order that respects their dependencies.
+// Systems that don't depend on each other run in the order they were
+// added.
+type Schedule struct {
+	systems []System
+}
+
+// Add adds systems to s.
+func (s *Schedule) Add(systems ...System) {
+	s.systems = append(s.systems, systems...)
+}
+
+// Order returns the names of s's systems in the order Run runs them. It
+// is an error for two systems to share a name, for a system to run
+// after one that doesn't exist, or for systems to depend on each other
+// in a cycle.
+func (s *Schedule) Order() ([]string, error) {
+	order, err := s.order()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(order))
+	for i, sys := range order {
+		names[i] = sys.Name
+	}
+	return names, nil
+}
+
+// Run runs each system on w in order, stopping at the first to fail.
+func (s *Schedule) Run(w *World) error {
+	order, err := s.order()
+	if err != nil {
+		return err
+	}
+	for _, sys := range order {
+		if err := sys.Run(w); err != nil {
+			return fmt.Errorf("%s: %w", sys.Name, err)
+		}
+	}
+	return nil
+}
+
+// order sorts the systems topologically, always taking the earliest
+// added system that is ready to run.
+func (s *Schedule) order() ([]System, error) {
+	byName := make(map[string]int, len(s.systems))
+	for i, sys := range s.systems {
+		if _, ok := byName[sys.Name]; ok {
+			return nil, fmt.Errorf("two systems are named %s", sys.Name)
+		}
+		byName[sys.Name] = i
+	}
+
+	waiting := make([]int, len(s.systems)) // unfinished dependencies
+	followers := make([][]int, len(s.systems))
+	for i, sys := range s.systems {
+		for _, dep := range sys.After {
+			j, ok := byName[dep]
+			if !ok {
+				return nil, fmt.Errorf("%s runs after unknown system %s", sys.Name, dep)
+			}
+			waiting[i]++
+			followers[j] = append(followers[j], i)
+		}
+	}
+
+	var ready []int
+	for i := range s.systems {
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	order := make([]System, 0, len(s.systems))
+	for len(ready) > 0 {
+		sort.Ints(ready)
+		i := ready[0]
+		ready = ready[1:]
+		order = append(order, s.systems[i])
+		for _, j := range followers[i] {
+			if waiting[j]--; waiting[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+
+	if len(order) < len(s.systems) {
+		var stuck []string
+		for i, sys := range s.systems {
+			if waiting[i] > 0 {
+				stuck = append(stuck, sys.Name)
+			}
+		}
+		return nil, fmt.Errorf("systems depend on each other in a cycle: %s", strings.Join(stuck, ", "))
+	}
+	return order, nil
+}
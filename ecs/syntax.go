@@ -0,0 +1,103 @@
+package ecs
+
+import (
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+)
+
+// Syntax is the component holding the AST node an entity stands for.
+type Syntax struct {
+	Node ast.Node
+}
+
+// Parent is the component linking a node's entity to its parent's. Field
+// and Index say where the node is held, as ast.Cursor reports them:
+// Index is -1 unless the field is a slice.
+type Parent struct {
+	Entity Entity
+	Field  string
+	Index  int
+}
+
+// Children is the component listing a node's child entities in source
+// order.
+type Children []Entity
+
+// Tree is an AST materialised in a World by Materialize.
+type Tree struct {
+	Root     Entity
+	entities map[ast.Node]Entity
+}
+
+// Entity returns the entity made for n.
+func (t *Tree) Entity(n ast.Node) (Entity, bool) {
+	e, ok := t.entities[n]
+	return e, ok
+}
+
+// Len returns the number of nodes in the tree.
+func (t *Tree) Len() int {
+	return len(t.entities)
+}
+
+// Materialize adds an entity to w for every node under root, in the
+// order ast.Inspect visits them. Each gets a Syntax component holding
+// the node and a diagnostics.Span component with its extent as
+// ast.SpanOf reports it; every node but the root gets a Parent, and
+// nodes with children get Children. The AST isn't changed.
+func Materialize(w *World, root ast.Node) *Tree {
+	t := &Tree{entities: make(map[ast.Node]Entity)}
+	syntax := Components[Syntax](w)
+	parents := Components[Parent](w)
+	children := Components[Children](w)
+	spans := Components[diagnostics.Span](w)
+
+	// each node's span is its own tokens' and its children's, which are
+	// gathered into its frame as they finish
+	type frame struct {
+		entity Entity
+		span   diagnostics.Span
+		found  bool
+	}
+	var stack []frame
+	ast.Apply(root, func(c *ast.Cursor) bool {
+		n := c.Node()
+		if n == nil {
+			return false
+		}
+		e := w.NewEntity()
+		t.entities[n] = e
+		syntax.Set(e, Syntax{Node: n})
+		if len(stack) == 0 {
+			t.Root = e
+		} else {
+			parent := stack[len(stack)-1].entity
+			parents.Set(e, Parent{Entity: parent, Field: c.Name(), Index: c.Index()})
+			siblings, _ := children.Get(parent)
+			children.Set(parent, append(siblings, e))
+		}
+		stack = append(stack, frame{entity: e})
+		return true
+	}, func(c *ast.Cursor) bool {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if own, ok := ast.OwnSpan(c.Node()); ok {
+			f.span, f.found = cover(f.span, f.found, own), true
+		}
+		spans.Set(f.entity, f.span)
+		if f.found && len(stack) > 0 {
+			parent := &stack[len(stack)-1]
+			parent.span, parent.found = cover(parent.span, parent.found, f.span), true
+		}
+		return true
+	})
+	return t
+}
+
+// cover returns the span covering span, if found, and s.
+func cover(span diagnostics.Span, found bool, s diagnostics.Span) diagnostics.Span {
+	if !found {
+		return s
+	}
+	return diagnostics.Span{Start: min(span.Start, s.Start), End: max(span.End, s.End)}
+}
@@ -0,0 +1,131 @@
+package ecs_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/ecs"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	return program
+}
+
+func TestMaterialize(t *testing.T) {
+	src := "my $x = 1 + $y;\nsub f { return $x; }"
+	program := parse(t, src)
+	before := program.String()
+
+	w := ecs.NewWorld()
+	tree := ecs.Materialize(w, program)
+
+	count := 0
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		count++
+		e, ok := tree.Entity(n)
+		if !ok {
+			t.Fatalf("no entity for %T %s", n, n)
+		}
+		if s, _ := ecs.Get[ecs.Syntax](w, e); s.Node != n {
+			t.Errorf("entity %d holds %v, expected %v", e, s.Node, n)
+		}
+		if span, _ := ecs.Get[diagnostics.Span](w, e); span != ast.SpanOf(n) {
+			t.Errorf("%T %s spans %v, expected %v", n, n, span, ast.SpanOf(n))
+		}
+		return true
+	})
+	if tree.Len() != count || ecs.Components[ecs.Syntax](w).Len() != count {
+		t.Errorf("expected %d entities, got %d", count, tree.Len())
+	}
+	if program.String() != before {
+		t.Errorf("materialising changed the program")
+	}
+
+	if ecs.Has[ecs.Parent](w, tree.Root) {
+		t.Errorf("the root has no parent")
+	}
+	if children, _ := ecs.Get[ecs.Children](w, tree.Root); len(children) != 2 {
+		t.Fatalf("expected 2 statements under the root, got %v", children)
+	}
+
+	infix := program.Statements[0].(*ast.MyStatement).Value.(*ast.InfixExpression)
+	e, _ := tree.Entity(infix.Right)
+	parent, _ := ecs.Get[ecs.Parent](w, e)
+	if p, _ := tree.Entity(infix); parent.Entity != p || parent.Field != "Right" || parent.Index != -1 {
+		t.Errorf("wrong parent for $y: %+v", parent)
+	}
+	span, _ := ecs.Get[diagnostics.Span](w, e)
+	if src[span.Start:span.End] != "$y" {
+		t.Errorf("expected span over $y, got %q", src[span.Start:span.End])
+	}
+
+	sub, _ := tree.Entity(program.Statements[1])
+	parent, _ = ecs.Get[ecs.Parent](w, sub)
+	if parent.Entity != tree.Root || parent.Field != "Statements" || parent.Index != 1 {
+		t.Errorf("wrong parent for the sub: %+v", parent)
+	}
+}
+
+// an analysis's own component, attached without touching the AST
+type literalCount int
+
+func TestSystemsOverAST(t *testing.T) {
+	program := parse(t, "my $x = 1 + 2; my $y = 'a';")
+	w := ecs.NewWorld()
+	tree := ecs.Materialize(w, program)
+
+	var s ecs.Schedule
+	s.Add(
+		ecs.System{Name: "report", After: []string{"count"}, Run: func(w *ecs.World) error {
+			for _, stmt := range program.Statements {
+				e, _ := tree.Entity(stmt)
+				n, _ := ecs.Get[literalCount](w, e)
+				ecs.Set(w, e, name(stmt.String()+" has literals: "+strconv.Itoa(int(n))))
+			}
+			return nil
+		}},
+		ecs.System{Name: "count", Run: func(w *ecs.World) error {
+			for e, syn := range ecs.Components[ecs.Syntax](w).All() {
+				switch syn.Node.(type) {
+				case *ast.IntegerLiteral, *ast.StringLiteral:
+				default:
+					continue
+				}
+				// credit the literal to its statement
+				for p, ok := ecs.Get[ecs.Parent](w, e); ok; p, ok = ecs.Get[ecs.Parent](w, e) {
+					if p.Entity == tree.Root {
+						n, _ := ecs.Get[literalCount](w, e)
+						ecs.Set(w, e, n+1)
+						break
+					}
+					e = p.Entity
+				}
+			}
+			return nil
+		}},
+	)
+	if err := s.Run(w); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []name{"my $x = (1 + 2) has literals: 2", "my $y = 'a' has literals: 1"}
+	for i, stmt := range program.Statements {
+		e, _ := tree.Entity(stmt)
+		if n, _ := ecs.Get[name](w, e); n != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], n)
+		}
+	}
+}
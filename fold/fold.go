@@ -0,0 +1,287 @@
+// Package fold evaluates what a program computes from constants alone,
+// as perl does while compiling it, and rewrites the tree with the
+// results: arithmetic, string and comparison operators on literals
+// become literals, names defined by `use constant` become their values,
+// and an if or unless whose condition is constant is replaced by the
+// statements of the branch that runs, so that `if (0) { ... }` and
+// `debug() if 0` disappear.
+//
+// A division or modulus by a constant zero would die when it runs, and
+// is reported instead of folded. Strings with something to interpolate,
+// numbers too large to represent and `x` repetitions longer than a few
+// kilobytes are left as they are.
+package fold
+
+import (
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/resolve"
+	"github.com/perigrin/simian/token"
+)
+
+// Fold folds the constant expressions and branches of program in place,
+// and returns what it finds wrong with them. info is what Resolve
+// learned about program before it was folded.
+func Fold(program *ast.Program, info *resolve.Info) []diagnostics.Diagnostic {
+	f := &folder{info: info, constants: make(map[string]value)}
+	ast.Apply(program, nil, f.post)
+	return f.diagnostics
+}
+
+type folder struct {
+	info *resolve.Info
+
+	// the value of each constant declared so far, by qualified name
+	constants map[string]value
+
+	diagnostics []diagnostics.Diagnostic
+}
+
+func (f *folder) post(cur *ast.Cursor) bool {
+	switch n := cur.Node().(type) {
+	case *ast.UseStatement:
+		if n.Module != nil && n.Module.Value == "constant" {
+			f.declare(n)
+		}
+
+	case *ast.Identifier:
+		switch cur.Name() {
+		case "Name", "Module", "Method", "Function", "Invocant":
+			// names of things, not barewords with a value
+		default:
+			f.inline(cur, n, n)
+		}
+	case *ast.CallExpression:
+		if name, ok := n.Function.(*ast.Identifier); ok && !n.Arrow && n.Block == nil && len(n.Arguments) == 0 {
+			f.inline(cur, n, name)
+		}
+
+	case *ast.PrefixExpression:
+		f.prefix(cur, n)
+	case *ast.InfixExpression:
+		f.infix(cur, n)
+	case *ast.ConditionalExpression:
+		if v, ok := constantOf(n.Condition); ok {
+			if truth(v) {
+				cur.Replace(n.Consequence)
+			} else {
+				cur.Replace(n.Alternative)
+			}
+		}
+
+	case *ast.IfStatement:
+		f.branch(cur, n)
+	case *ast.ModifiedStatement:
+		f.modifier(cur, n)
+	}
+	return true
+}
+
+// declare records the constants of a use constant statement whose
+// value is a single constant, in either of its forms: use constant
+// NAME => VALUE and use constant { NAME => VALUE, ... }. A constant
+// that is a list, or isn't known until run time, isn't folded.
+func (f *folder) declare(use *ast.UseStatement) {
+	imports := use.Imports
+	if len(imports) == 0 {
+		return
+	}
+	switch first := imports[0].(type) {
+	case *ast.StringLiteral:
+		if len(imports) != 2 {
+			return
+		}
+		if v, ok := constantOf(imports[1]); ok {
+			f.constants[f.info.Qualify(use, first.Value)] = v
+		}
+	case *ast.HashLiteral:
+		for i := 0; i+1 < len(first.Elements); i += 2 {
+			key, ok := first.Elements[i].(*ast.StringLiteral)
+			if !ok {
+				continue
+			}
+			if v, ok := constantOf(first.Elements[i+1]); ok {
+				f.constants[f.info.Qualify(use, key.Value)] = v
+			}
+		}
+	}
+}
+
+// inline replaces n, a use of the sub name, with its value if name is
+// a constant.
+func (f *folder) inline(cur *ast.Cursor, n ast.Node, name *ast.Identifier) {
+	if v, ok := f.constants[f.info.Qualify(name, name.Value)]; ok {
+		cur.Replace(literal(v, ast.SpanOf(n).Start))
+	}
+}
+
+func (f *folder) prefix(cur *ast.Cursor, n *ast.PrefixExpression) {
+	v, ok := constantOf(n.Right)
+	if !ok {
+		return
+	}
+	switch n.Operator {
+	case "!", "not":
+		cur.Replace(literal(!truth(v), n.Token.Offset))
+	case "-":
+		if neg, ok := negate(v); ok {
+			cur.Replace(literal(neg, n.Token.Offset))
+		}
+	case "+":
+		cur.Replace(n.Right)
+	}
+}
+
+func (f *folder) infix(cur *ast.Cursor, n *ast.InfixExpression) {
+	r, rok := constantOf(n.Right)
+	switch n.Operator {
+	case "/", "/=":
+		if rok && isZero(r) {
+			f.divisionByZero(n.Right, "Illegal division by zero")
+			return
+		}
+	case "%", "%=":
+		if rok && isZero(r) {
+			f.divisionByZero(n.Right, "Illegal modulus zero")
+			return
+		}
+	}
+
+	l, lok := constantOf(n.Left)
+	if !lok {
+		return
+	}
+	switch n.Operator {
+	case "&&", "and":
+		if truth(l) {
+			cur.Replace(n.Right)
+		} else {
+			cur.Replace(n.Left)
+		}
+		return
+	case "||", "or":
+		if truth(l) {
+			cur.Replace(n.Left)
+		} else {
+			cur.Replace(n.Right)
+		}
+		return
+	case "//":
+		// a constant is never undef
+		cur.Replace(n.Left)
+		return
+	}
+	if !rok {
+		return
+	}
+	if v, ok := binary(n.Operator, l, r); ok {
+		cur.Replace(literal(v, ast.SpanOf(n).Start))
+	}
+}
+
+func (f *folder) divisionByZero(zero ast.Expression, message string) {
+	d := diagnostics.Errorf(diagnostics.DivisionByZero, ast.SpanOf(zero), "%s", message)
+	d.Label = "this is zero"
+	f.diagnostics = append(f.diagnostics, d)
+}
+
+// branch replaces an if or unless statement whose condition is constant
+// with the block that runs, or the rest of its elsif chain.
+func (f *folder) branch(cur *ast.Cursor, n *ast.IfStatement) {
+	v, ok := constantOf(n.Condition)
+	if !ok {
+		return
+	}
+	if truth(v) == (n.TokenLiteral() != "unless") {
+		splice(cur, n.Consequence)
+		return
+	}
+
+	switch alt := n.Alternative.(type) {
+	case *ast.BlockStatement:
+		splice(cur, alt)
+	case *ast.IfStatement:
+		if cur.Name() != "Alternative" {
+			// the elsif that follows is the whole statement now
+			alt.Token = token.Token{Type: token.IF, Literal: []byte("if"), Offset: alt.Token.Offset}
+		}
+		cur.Replace(alt)
+	default:
+		remove(cur)
+	}
+}
+
+// splice replaces the if statement at cur with b, the branch that runs.
+// The block of an if isn't a loop, as a bare block is, so its statements
+// join the list holding the if, where next and last still leave the
+// enclosing loop; as an elsif the branch becomes the else. The if is
+// kept anywhere else, or if the branch declares something that lasts to
+// the end of its block.
+func splice(cur *ast.Cursor, b *ast.BlockStatement) {
+	switch {
+	case cur.Name() == "Alternative":
+		cur.Replace(b)
+	case cur.Index() >= 0 && !scoped(b.Statements):
+		for _, s := range b.Statements {
+			cur.InsertBefore(s)
+		}
+		cur.Delete()
+	}
+}
+
+// scoped reports whether list declares something that lasts until the
+// end of the block holding it: a lexical variable, a package or a
+// pragma.
+func scoped(list []ast.Statement) bool {
+	found := false
+	for _, s := range list {
+		ast.Inspect(s, func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.MyStatement, *ast.Declaration, *ast.PackageDeclaration,
+				*ast.ClassStatement, *ast.UseStatement, *ast.NoStatement:
+				found = true
+			case *ast.BlockStatement, *ast.SubStatement, *ast.MethodStatement:
+				// these have their own scope
+				return false
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// modifier replaces a statement with an if or unless modifier whose
+// condition is constant with the statement, or removes it if it never
+// runs.
+func (f *folder) modifier(cur *ast.Cursor, n *ast.ModifiedStatement) {
+	if n.Token.Type != token.IF && n.Token.Type != token.UNLESS {
+		return
+	}
+	if _, ok := n.Statement.(*ast.MyStatement); ok {
+		// `my $x if 0` still declares $x, which perl then keeps
+		// between calls
+		return
+	}
+	v, ok := constantOf(n.Condition)
+	if !ok {
+		return
+	}
+	if truth(v) == (n.Token.Type == token.IF) {
+		cur.Replace(n.Statement)
+	} else {
+		remove(cur)
+	}
+}
+
+// remove removes the statement at cur: from the list that holds it, or
+// else by leaving an empty block or no else branch in its place.
+func remove(cur *ast.Cursor) {
+	switch {
+	case cur.Index() >= 0:
+		cur.Delete()
+	case cur.Name() == "Alternative":
+		cur.Replace(nil)
+	default:
+		cur.Replace(&ast.BlockStatement{})
+	}
+}
@@ -0,0 +1,167 @@
+package fold_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/fold"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+)
+
+func foldInput(t *testing.T, input string) (*ast.Program, []diagnostics.Diagnostic) {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	return program, fold.Fold(program, resolve.Resolve(program))
+}
+
+// found describes diagnostics as code@offset.
+func found(diags []diagnostics.Diagnostic) string {
+	var out []string
+	for _, d := range diags {
+		out = append(out, fmt.Sprintf("%s@%d", d.Code, d.Span.Start))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 + 2 * 3;`, `7`},
+		{`$x = 2 ** 10 - 1;`, `($x = 1023)`},
+		{`7 / 2; 8 / 2; 1.5 * 2; 0.1 + 0.2;`, "3.5;\n4;\n3;\n0.3"},
+		{`-7 % 3; 7 % -3; 7.9 % 3;`, "2;\n-2;\n1"},
+		{`9223372036854775807 + 1;`, `9.22337203685478e+18`},
+		{`-(3 ** 2); - -4; +5;`, "-9;\n4;\n5"},
+		{`"ab" . 'c' . 1; "-" x 3; "=" x -1;`, "'abc1';\n'---';\n''"},
+		{`'it\'s' . "!";`, `'it\'s!'`},
+		{`"$x" . "y"; "a\n" . "b"; "\$5" . 0;`, "(\"$x\" . \"y\");\n'a\nb';\n'$50'"},
+		{`"10" + 5; "3 apples" + 1;`, "15;\n(\"3 apples\" + 1)"},
+		{`1 < 2; "a" eq "b"; 2 <=> 1; "a" cmp "b";`, "true;\nfalse;\n1;\n-1"},
+		{`!0; not 1; !"0.0";`, "true;\nfalse;\nfalse"},
+		{`0 || f(); 1 && $y; 0 // 2; 1 or die;`, "f();\n$y;\n0;\n1"},
+		{`$x && 0; f(1 + 1);`, "($x && 0);\nf(2)"},
+		{`my $t = 1 > 2 ? "big" : $small;`, `my $t = $small`},
+		{`(1, 2) x 3;`, `((1, 2) x 3)`},
+	}
+
+	for _, tt := range tests {
+		program, diags := foldInput(t, tt.input)
+		if len(diags) > 0 {
+			t.Errorf("%s: unexpected diagnostics %v", tt.input, diags)
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFoldedString(t *testing.T) {
+	program, _ := foldInput(t, `'it\'s' . "c\x41\t";`)
+	str, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("expected a folded string, got %s", program)
+	}
+	if str.Value != "it'scA\t" {
+		t.Errorf("expected the escapes decoded, got %q", str.Value)
+	}
+}
+
+func TestConstants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`use constant PI => 3.14159; my $c = 2 * PI * $r;`, "use constant PI => 3.14159;\nmy $c = (6.28318 * $r)"},
+		{`use constant { A => 1, B => "b" }; A + 1; B() . B;`, "use constant {A => 1, B => \"b\"};\n2;\n'bb'"},
+		{`use constant ONE => 1; use constant TWO => ONE + ONE; TWO;`, "use constant ONE => 1;\nuse constant TWO => 2;\n2"},
+		{`use constant DAYS => qw(Mon Tue); DAYS;`, "use constant DAYS => qw(Mon Tue);\nDAYS"},
+		{`use constant N => 1; package Foo; N; main::N; package main; N;`, "use constant N => 1;\npackage Foo;\nN;\n1;\npackage main;\n1"},
+		{`use constant N => 1; sub N2 { N } $o->N; Foo->N;`, "use constant N => 1;\nsub N2 { 1 }\n$o->N;\nFoo->N"},
+		{`N; use constant N => 1;`, "N;\nuse constant N => 1"},
+	}
+
+	for _, tt := range tests {
+		program, diags := foldInput(t, tt.input)
+		if len(diags) > 0 {
+			t.Errorf("%s: unexpected diagnostics %v", tt.input, diags)
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBranches(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`if (0) { f() } g();`, `g()`},
+		{`if (1) { f() } else { g() }`, `f()`},
+		{`if (0) { f() } else { g() }`, `g()`},
+		{`if (1) { f(); g() } h();`, "f();\ng();\nh()"},
+		{`if (0) { f() } elsif ($x) { g() } else { h() }`, `if ($x) { g() } else { h() }`},
+		{`if ($x) { f() } elsif (1) { g() } else { h() }`, `if ($x) { f() } else { g() }`},
+		{`if ($x) { f() } elsif (0) { g() }`, `if ($x) { f() }`},
+		{`if ($x) { f() } elsif ("") { g() } elsif ($y) { h() }`, `if ($x) { f() } elsif ($y) { h() }`},
+		{`unless (1) { f() } unless (0) { g() }`, `g()`},
+		{`use constant DEBUG => 0; sub log { if (DEBUG) { print @_ } }`, "use constant DEBUG => 0;\nsub log {}"},
+		{`if ($x) { f() }`, `if ($x) { f() }`},
+		// the block of an if isn't a loop, so last still leaves the for
+		{`for (@x) { if (1) { last } f() }`, `for (@x) { last; f() }`},
+		{`while ($x) { if (0) { f() } else { next } }`, `while ($x) { next }`},
+		// a declaration in the branch lasts only until the end of it
+		{`my $x = 1; if (1) { my $x = 2; f($x) } g($x);`, "my $x = 1;\nif (1) { my $x = 2; f($x) }\ng($x)"},
+		{`if (1) { use integer; f() }`, `if (1) { use integer; f() }`},
+		{`L: if (1) { f() }`, `L: if (1) { f() }`},
+		{`f() if 1; g() if 0; h() unless 0; i() while 0; j() if $x;`, "f();\nh();\ni() while 0;\nj() if $x"},
+	}
+
+	for _, tt := range tests {
+		program, diags := foldInput(t, tt.input)
+		if len(diags) > 0 {
+			t.Errorf("%s: unexpected diagnostics %v", tt.input, diags)
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 / 0;`, "E0700@4"},
+		{`$x / 0.0; $x % "0"; $x /= 0; $x %= 1 - 1;`, "E0700@5 E0700@15 E0700@26 E0700@35"},
+		{`use constant ZERO => 0; $x / ZERO;`, "E0700@29"},
+		{`$x / 1; $x / $y; 0 / 2;`, ""},
+	}
+
+	for _, tt := range tests {
+		_, diags := foldInput(t, tt.input)
+		if got := found(diags); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q (%v)", tt.input, tt.expected, got, diags)
+		}
+	}
+
+	program, diags := foldInput(t, `my $r = 1 % 0;`)
+	if d := diags[0]; d.Severity != diagnostics.Error || d.Message != "Illegal modulus zero" || d.Label != "this is zero" {
+		t.Errorf("unexpected diagnostic %v", d)
+	}
+	if got := program.String(); got != `my $r = (1 % 0)` {
+		t.Errorf("expected the division to be left alone, got %s", got)
+	}
+}
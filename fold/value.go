@@ -0,0 +1,309 @@
+package fold
+
+import (
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/token"
+)
+
+// A value is what a constant expression evaluates to: an int64, a
+// float64, a string or a bool.
+type value interface{}
+
+// maxRepeat is the longest string `x` is folded into; a longer one is
+// left for run time rather than written out in the tree.
+const maxRepeat = 4096
+
+// constantOf returns the value of e if it is a literal. A double quoted
+// string is only constant if it has nothing to interpolate.
+func constantOf(e ast.Expression) (value, bool) {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return e.Value, true
+	case *ast.NumberLiteral:
+		return e.Value, true
+	case *ast.BooleanLiteral:
+		return e.Value, true
+	case *ast.StringLiteral:
+		if e.Interpolates() {
+			return nil, false
+		}
+		return e.Value, true
+	}
+	return nil, false
+}
+
+// literal returns the literal for v, at offset in the source of the
+// expression it replaces.
+func literal(v value, offset int) ast.Expression {
+	switch v := v.(type) {
+	case int64:
+		lit := strconv.FormatInt(v, 10)
+		return &ast.IntegerLiteral{Token: tok(token.DIGIT, lit, offset), Value: v}
+	case float64:
+		return &ast.NumberLiteral{Token: tok(token.NUMBER, formatFloat(v), offset), Value: v}
+	case bool:
+		if v {
+			return &ast.BooleanLiteral{Token: tok(token.TRUE, "true", offset), Value: true}
+		}
+		return &ast.BooleanLiteral{Token: tok(token.FALSE, "false", offset), Value: false}
+	case string:
+		quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)
+		return &ast.StringLiteral{Token: tok(token.STRING, "'"+quoted+"'", offset), Value: v}
+	}
+	return nil
+}
+
+func tok(t token.TokenType, lit string, offset int) token.Token {
+	return token.Token{Type: t, Literal: []byte(lit), Offset: offset}
+}
+
+// formatFloat formats f as perl prints a number, to 15 significant
+// digits.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', 15, 64)
+}
+
+// str returns v as a string.
+func str(v value) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatFloat(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return ""
+	}
+	return v.(string)
+}
+
+var numeric = regexp.MustCompile(`^\s*[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?\s*$`)
+
+// number returns v as an int64 or a float64, and whether it is a
+// number. A string is only a number if all of it is one: perl reads
+// "3 apples" as 3 but warns about it, so it is left for run time.
+func number(v value) (value, bool) {
+	switch v := v.(type) {
+	case int64, float64:
+		return v, true
+	case bool:
+		if v {
+			return int64(1), true
+		}
+		return int64(0), true
+	}
+	s := v.(string)
+	if !numeric.MatchString(s) {
+		return nil, false
+	}
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil || math.IsInf(f, 0)
+}
+
+func float(n value) float64 {
+	if i, ok := n.(int64); ok {
+		return float64(i)
+	}
+	return n.(float64)
+}
+
+// truth reports whether v is true: everything but 0, "" and "0".
+func truth(v value) bool {
+	switch v := v.(type) {
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case bool:
+		return v
+	}
+	s := v.(string)
+	return s != "" && s != "0"
+}
+
+// isZero reports whether v is the number 0, which a division by it
+// dies on.
+func isZero(v value) bool {
+	n, ok := number(v)
+	return ok && float(n) == 0
+}
+
+// binary returns the value of l op r, and whether it can be folded.
+func binary(op string, l, r value) (value, bool) {
+	switch op {
+	case ".":
+		return str(l) + str(r), true
+	case "x":
+		n, ok := number(r)
+		if !ok {
+			return nil, false
+		}
+		count := int(math.Max(float(n), 0))
+		if len(str(l))*count > maxRepeat {
+			return nil, false
+		}
+		return strings.Repeat(str(l), count), true
+	case "eq", "ne", "lt", "gt", "le", "ge":
+		c := strings.Compare(str(l), str(r))
+		return compare(op, c), true
+	case "cmp":
+		return int64(strings.Compare(str(l), str(r))), true
+	}
+
+	a, ok := number(l)
+	if !ok {
+		return nil, false
+	}
+	b, ok := number(r)
+	if !ok {
+		return nil, false
+	}
+	switch op {
+	case "+", "-", "*":
+		return arithmetic(op, a, b)
+	case "/":
+		if float(b) == 0 {
+			return nil, false
+		}
+		if x, ok := a.(int64); ok {
+			if y, ok := b.(int64); ok && x%y == 0 && !(x == math.MinInt64 && y == -1) {
+				return x / y, true
+			}
+		}
+		return checked(float(a) / float(b))
+	case "%":
+		return modulus(a, b)
+	case "**":
+		f := math.Pow(float(a), float(b))
+		if _, ok := a.(int64); ok && math.Trunc(f) == f && math.Abs(f) < 1<<53 {
+			if y, ok := b.(int64); ok && y >= 0 {
+				return int64(f), true
+			}
+		}
+		return checked(f)
+	case "==", "!=", "<", ">", "<=", ">=", "<=>":
+		x, y := float(a), float(b)
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return nil, false
+		}
+		c := 0
+		if x < y {
+			c = -1
+		} else if x > y {
+			c = 1
+		}
+		if op == "<=>" {
+			return int64(c), true
+		}
+		return compare(map[string]string{"==": "eq", "!=": "ne", "<": "lt", ">": "gt", "<=": "le", ">=": "ge"}[op], c), true
+	}
+	return nil, false
+}
+
+// compare returns whether a comparison op, as a string operator, holds
+// for two values that compare as c.
+func compare(op string, c int) bool {
+	switch op {
+	case "eq":
+		return c == 0
+	case "ne":
+		return c != 0
+	case "lt":
+		return c < 0
+	case "gt":
+		return c > 0
+	case "le":
+		return c <= 0
+	}
+	return c >= 0
+}
+
+// arithmetic adds, subtracts or multiplies two numbers, in integers
+// unless either is a float or the result overflows.
+func arithmetic(op string, a, b value) (value, bool) {
+	x, xok := a.(int64)
+	y, yok := b.(int64)
+	if xok && yok {
+		z := new(big.Int)
+		switch op {
+		case "+":
+			z.Add(big.NewInt(x), big.NewInt(y))
+		case "-":
+			z.Sub(big.NewInt(x), big.NewInt(y))
+		default:
+			z.Mul(big.NewInt(x), big.NewInt(y))
+		}
+		if z.IsInt64() {
+			return z.Int64(), true
+		}
+	}
+	switch op {
+	case "+":
+		return checked(float(a) + float(b))
+	case "-":
+		return checked(float(a) - float(b))
+	}
+	return checked(float(a) * float(b))
+}
+
+// modulus returns a % b in integers, with the sign of b as in perl.
+func modulus(a, b value) (value, bool) {
+	x, xok := integer(a)
+	y, yok := integer(b)
+	if !xok || !yok || y == 0 {
+		return nil, false
+	}
+	if y == -1 {
+		return int64(0), true
+	}
+	m := x % y
+	if m != 0 && (m < 0) != (y < 0) {
+		m += y
+	}
+	return m, true
+}
+
+// integer truncates n to an int64, if it fits.
+func integer(n value) (int64, bool) {
+	if i, ok := n.(int64); ok {
+		return i, true
+	}
+	f := math.Trunc(n.(float64))
+	if f < math.MinInt64 || f >= math.MaxInt64 || math.IsNaN(f) {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// checked returns f unless it is infinite or not a number, which are
+// left for run time.
+func checked(f float64) (value, bool) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, false
+	}
+	return f, true
+}
+
+// negate returns -v for a number.
+func negate(v value) (value, bool) {
+	n, ok := number(v)
+	if !ok {
+		return nil, false
+	}
+	if i, ok := n.(int64); ok && i != math.MinInt64 {
+		return -i, true
+	}
+	return -float(n), true
+}
@@ -0,0 +1,441 @@
+// Package hierarchy builds the inheritance graph of the Corinna classes
+// and roles in a program and checks it: that each class inherits, with
+// :isa, from a class and composes, with :does, roles that exist, without
+// a cycle; that it implements the methods its roles require; and that
+// its fields and the constructor parameters they take don't clash.
+//
+// A role requires a method by declaring it without a body, as in
+// `method name;`. A parent or role that isn't declared in the program
+// is unknown unless the program loads a module of that name, which may
+// declare it.
+package hierarchy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+)
+
+// Class is a class or role in the program.
+type Class struct {
+	Name string
+	Decl *ast.ClassStatement
+
+	// Parent is the class this one inherits from, and Roles the roles
+	// it composes, of those declared in the program.
+	Parent *Class
+	Roles  []*Class
+
+	Fields []*ast.FieldStatement
+
+	// Methods holds the methods declared in the class by name. Those a
+	// role requires have no body.
+	Methods map[string]*ast.MethodStatement
+
+	// the names of Methods in the order they are declared
+	order []string
+}
+
+// IsRole reports whether c is a role.
+func (c *Class) IsRole() bool { return c.Decl.IsRole() }
+
+// Ancestors returns the classes c inherits from, nearest first.
+func (c *Class) Ancestors() []*Class {
+	var out []*Class
+	for p := c.Parent; p != nil; p = p.Parent {
+		out = append(out, p)
+	}
+	return out
+}
+
+// Composed returns every role c composes, directly or through another
+// role, in the order they are named.
+func (c *Class) Composed() []*Class {
+	var out []*Class
+	seen := make(map[*Class]bool)
+	var visit func(*Class)
+	visit = func(c *Class) {
+		for _, r := range c.Roles {
+			if !seen[r] {
+				seen[r] = true
+				out = append(out, r)
+				visit(r)
+			}
+		}
+	}
+	visit(c)
+	return out
+}
+
+// Method returns the method an instance of c calls by name: its own, one
+// from a role it composes, or one it inherits. It is nil if c has no
+// such method, or only one a role requires.
+func (c *Class) Method(name string) *ast.MethodStatement {
+	for k := c; k != nil; k = k.Parent {
+		for _, r := range append([]*Class{k}, k.Composed()...) {
+			if m := r.Methods[name]; m != nil && m.Body != nil {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// Info is what Check learns about a program.
+type Info struct {
+	// Classes holds every class and role by name, and Order the same
+	// in the order they are declared.
+	Classes map[string]*Class
+	Order   []*Class
+
+	Diagnostics []diagnostics.Diagnostic
+}
+
+// Check builds the class hierarchy of program and reports what is wrong
+// with it.
+func Check(program *ast.Program) *Info {
+	c := &checker{
+		info:    &Info{Classes: make(map[string]*Class)},
+		modules: make(map[string]bool),
+	}
+	c.statements(program.Statements)
+	c.link()
+	c.cycles()
+	for _, class := range c.info.Order {
+		c.fields(class)
+		if !class.IsRole() {
+			c.params(class)
+			c.required(class)
+		}
+	}
+	return c.info
+}
+
+type checker struct {
+	info *Info
+
+	// the class a `class NAME;` statement opened, which lasts until the
+	// next class or package
+	current *Class
+
+	// the modules the program loads, which may declare classes
+	modules map[string]bool
+}
+
+func (c *checker) errorf(code string, n ast.Node, format string, args ...interface{}) *diagnostics.Diagnostic {
+	c.info.Diagnostics = append(c.info.Diagnostics, diagnostics.Errorf(code, ast.SpanOf(n), format, args...))
+	return &c.info.Diagnostics[len(c.info.Diagnostics)-1]
+}
+
+// statements collects the classes declared in a list of statements, and
+// their fields and methods.
+func (c *checker) statements(list []ast.Statement) {
+	current := c.current
+	defer func() { c.current = current }()
+
+	for _, s := range list {
+		switch s := s.(type) {
+		case *ast.ClassStatement:
+			class := c.info.Classes[s.Name.Value]
+			if class == nil {
+				class = &Class{Name: s.Name.Value, Decl: s, Methods: make(map[string]*ast.MethodStatement)}
+				c.info.Classes[class.Name] = class
+				c.info.Order = append(c.info.Order, class)
+			}
+			if s.Body == nil {
+				c.current = class
+				break
+			}
+			outer := c.current
+			c.current = class
+			c.statements(s.Body.Statements)
+			c.current = outer
+
+		case *ast.PackageDeclaration:
+			c.current = nil
+		case *ast.PackageStatement:
+			outer := c.current
+			c.current = nil
+			c.statements(s.Body.Statements)
+			c.current = outer
+
+		case *ast.BlockStatement:
+			c.statements(s.Statements)
+
+		case *ast.FieldStatement:
+			if c.current != nil {
+				c.current.Fields = append(c.current.Fields, s)
+			}
+		case *ast.MethodStatement:
+			if c.current != nil && c.current.Methods[s.Name.Value] == nil {
+				c.current.Methods[s.Name.Value] = s
+				c.current.order = append(c.current.order, s.Name.Value)
+			}
+
+		case *ast.UseStatement:
+			if s.Module != nil {
+				c.modules[s.Module.Value] = true
+			}
+		case *ast.RequireStatement:
+			if s.Module != nil {
+				c.modules[s.Module.Value] = true
+			}
+		}
+	}
+}
+
+// link finds the parent and roles named by each class's :isa and :does
+// attributes.
+func (c *checker) link() {
+	for _, class := range c.info.Order {
+		for _, attr := range class.Decl.Attributes {
+			switch attr.Name {
+			case "isa":
+				names := attributeNames(attr.Args)
+				if len(names) == 0 {
+					continue
+				}
+				if class.IsRole() {
+					c.errorf(diagnostics.WrongParentKind, attr, "role %s cannot inherit with :isa", class.Name).Label = "roles are composed with :does"
+					continue
+				}
+				if parent := c.lookup(attr, names[0], false); parent != nil {
+					class.Parent = parent
+				}
+			case "does":
+				for _, name := range attributeNames(attr.Args) {
+					if role := c.lookup(attr, name, true); role != nil {
+						class.Roles = append(class.Roles, role)
+					}
+				}
+			}
+		}
+	}
+}
+
+// lookup returns the class or role name, named by attr, reporting it if
+// it isn't declared or is the wrong kind.
+func (c *checker) lookup(attr *ast.Attribute, name string, role bool) *Class {
+	kind, other := "class", "role"
+	if role {
+		kind, other = "role", "class"
+	}
+	found := c.info.Classes[name]
+	switch {
+	case found == nil && !c.modules[name]:
+		c.errorf(diagnostics.UnknownParent, attr, "unknown %s %s", kind, name).Label = "not declared in this program"
+	case found == nil:
+	case found.IsRole() != role:
+		d := c.errorf(diagnostics.WrongParentKind, attr, "%s is a %s, not a %s", name, other, kind)
+		d.Label = fmt.Sprintf(":%s names a %s", attr.Name, kind)
+		d.Labels = []diagnostics.Label{{Span: ast.SpanOf(found.Decl.Name), Message: name + " is declared here"}}
+	default:
+		return found
+	}
+	return nil
+}
+
+// attributeNames returns the package names in the arguments of :isa or
+// :does, leaving out any version each requires.
+func attributeNames(args string) []string {
+	var names []string
+	for _, f := range strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if f[0] >= '0' && f[0] <= '9' || len(f) > 1 && f[0] == 'v' && f[1] >= '0' && f[1] <= '9' {
+			continue
+		}
+		names = append(names, f)
+	}
+	return names
+}
+
+// cycles reports each cycle of classes inheriting from or roles
+// composing themselves, and breaks it so the hierarchy is a tree.
+func (c *checker) cycles() {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[*Class]int)
+	var path []*Class
+
+	var visit func(*Class)
+	visit = func(class *Class) {
+		state[class] = visiting
+		path = append(path, class)
+
+		edges := class.Roles
+		if class.Parent != nil {
+			edges = append([]*Class{class.Parent}, edges...)
+		}
+		for _, next := range edges {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				c.cycle(class, next, path)
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[class] = done
+	}
+	for _, class := range c.info.Order {
+		if state[class] == unvisited {
+			visit(class)
+		}
+	}
+}
+
+// cycle reports the cycle closed by class naming next, which is on path,
+// and removes that edge.
+func (c *checker) cycle(class, next *Class, path []*Class) {
+	var names []string
+	for i := len(path) - 1; i >= 0; i-- {
+		names = append([]string{path[i].Name}, names...)
+		if path[i] == next {
+			break
+		}
+	}
+	names = append(names, next.Name)
+
+	attrName, relation := "does", "composes"
+	if class.Parent == next {
+		attrName, relation = "isa", "inherits from"
+		class.Parent = nil
+	} else {
+		for i, r := range class.Roles {
+			if r == next {
+				class.Roles = append(class.Roles[:i:i], class.Roles[i+1:]...)
+				break
+			}
+		}
+	}
+
+	var at ast.Node = class.Decl.Name
+	for _, attr := range class.Decl.Attributes {
+		if attr.Name == attrName {
+			at = attr
+		}
+	}
+	d := c.errorf(diagnostics.InheritanceCycle, at, "%s %s itself: %s", next.Name, relation, strings.Join(names, " -> "))
+	d.Label = "this closes the cycle"
+}
+
+// fields reports fields declared more than once in a class.
+func (c *checker) fields(class *Class) {
+	seen := make(map[string]*ast.FieldStatement)
+	for _, f := range class.Fields {
+		name := f.Name.String()
+		if first := seen[name]; first != nil {
+			d := c.errorf(diagnostics.DuplicateField, f.Name, "field %s is already declared in %s", name, class.Name)
+			d.Label = "declared again here"
+			d.Labels = []diagnostics.Label{{Span: ast.SpanOf(first.Name), Message: "first declared here"}}
+			continue
+		}
+		seen[name] = f
+	}
+}
+
+// params reports a field of class, or of a role it composes, whose
+// :param names a constructor parameter another field already takes:
+// one of the classes it inherits from and their roles, of an earlier
+// role, or of the class itself. Both would be set by the same argument
+// to new.
+func (c *checker) params(class *Class) {
+	type param struct {
+		field *ast.FieldStatement
+		class *Class
+	}
+	taken := make(map[string]param)
+	seen := make(map[*Class]bool)
+	ancestors := class.Ancestors()
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		for _, k := range append(ancestors[i].Composed(), ancestors[i]) {
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			for _, f := range k.Fields {
+				if name, ok := paramName(f); ok {
+					if _, dup := taken[name]; !dup {
+						taken[name] = param{f, k}
+					}
+				}
+			}
+		}
+	}
+
+	for _, k := range append(class.Composed(), class) {
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		for _, f := range k.Fields {
+			name, ok := paramName(f)
+			if !ok {
+				continue
+			}
+			first, dup := taken[name]
+			if !dup {
+				taken[name] = param{f, k}
+				continue
+			}
+			d := c.errorf(diagnostics.DuplicateParam, f.Name, "parameter %s is already taken by field %s of %s", name, first.field.Name, first.class.Name)
+			d.Label = "a second field takes " + name
+			d.Labels = []diagnostics.Label{{Span: ast.SpanOf(first.field.Name), Message: "first taken here"}}
+		}
+	}
+}
+
+// paramName returns the name of the constructor parameter f takes, and
+// whether it takes one: the argument of its :param, or its own name.
+func paramName(f *ast.FieldStatement) (string, bool) {
+	return attribute(f, "param")
+}
+
+// attribute returns the argument of f's attribute name, or f's name if
+// it has none, and whether f has the attribute.
+func attribute(f *ast.FieldStatement, name string) (string, bool) {
+	for _, a := range f.Attributes {
+		if a.Name == name {
+			if a.Args != "" {
+				return strings.TrimSpace(a.Args), true
+			}
+			return f.Name.Name, true
+		}
+	}
+	return "", false
+}
+
+// required reports the methods the roles class composes require that
+// neither it, nor the classes it inherits from, nor its roles implement.
+// A field with :reader implements the method that reads it.
+func (c *checker) required(class *Class) {
+	for _, role := range class.Composed() {
+		for _, name := range role.order {
+			m := role.Methods[name]
+			if m.Body != nil || class.Method(name) != nil || hasReader(class, name) {
+				continue
+			}
+			d := c.errorf(diagnostics.MissingMethod, class.Decl.Name, "class %s does not implement method %s, which role %s requires", class.Name, name, role.Name)
+			d.Label = "missing method " + name
+			d.Labels = []diagnostics.Label{{Span: ast.SpanOf(m), Message: "required here"}}
+		}
+	}
+}
+
+// hasReader reports whether class or a class it inherits from has a
+// field with a :reader for the method name.
+func hasReader(class *Class, name string) bool {
+	for k := class; k != nil; k = k.Parent {
+		for _, f := range k.Fields {
+			if reader, ok := attribute(f, "reader"); ok && reader == name {
+				return true
+			}
+		}
+	}
+	return false
+}
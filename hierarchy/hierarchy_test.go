@@ -0,0 +1,142 @@
+package hierarchy_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/hierarchy"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+)
+
+func check(t *testing.T, input string) *hierarchy.Info {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	return hierarchy.Check(program)
+}
+
+// found describes diagnostics as code@offset.
+func found(diags []diagnostics.Diagnostic) string {
+	var out []string
+	for _, d := range diags {
+		out = append(out, fmt.Sprintf("%s@%d", d.Code, d.Span.Start))
+	}
+	return strings.Join(out, " ")
+}
+
+func names(classes []*hierarchy.Class) string {
+	var out []string
+	for _, c := range classes {
+		out = append(out, c.Name)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestHierarchy(t *testing.T) {
+	info := check(t, `
+role Named { method name; method hello { "hi" } }
+role Aged :does(Named) { method age; }
+class Animal { field $name :param :reader; method age { 1 } }
+class Dog :isa(Animal) :does(Aged) { method bark { } }
+class Puppy 1.0 :isa(Dog 1.0);
+method hello { "yip" }
+package main;
+`)
+	if len(info.Diagnostics) > 0 {
+		t.Fatalf("expected no diagnostics, got %v", info.Diagnostics)
+	}
+	if got := names(info.Order); got != "Named Aged Animal Dog Puppy" {
+		t.Errorf("unexpected classes %s", got)
+	}
+
+	puppy := info.Classes["Puppy"]
+	if got := names(puppy.Ancestors()); got != "Dog Animal" {
+		t.Errorf("expected Puppy to inherit from Dog Animal, got %s", got)
+	}
+	if got := names(info.Classes["Dog"].Composed()); got != "Aged Named" {
+		t.Errorf("expected Dog to compose Aged Named, got %s", got)
+	}
+	if !info.Classes["Named"].IsRole() || puppy.IsRole() {
+		t.Errorf("expected only the roles to be roles")
+	}
+
+	tests := map[string]string{
+		"hello": "Puppy", // its own, rather than the role's
+		"bark":  "Dog",
+		"age":   "Animal",
+		"name":  "", // only a :reader, which isn't a method statement
+	}
+	for method, class := range tests {
+		m := puppy.Method(method)
+		var got string
+		for _, c := range info.Order {
+			if m != nil && c.Methods[method] == m {
+				got = c.Name
+			}
+		}
+		if got != class {
+			t.Errorf("%s: expected the method of %q, got %q", method, class, got)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`class A :isa(B) { }`, "E0600@8"},
+		{`class A :does(R) { }`, "E0600@8"},
+		{`use B; class A :isa(B) { }`, ""},
+		{`class A :isa(B) { } class B :isa(C) { } class C :isa(A) { } class D :isa(A) { }`, "E0601@48"},
+		{`role R :does(S) { } role S :does(R) { }`, "E0601@27"},
+		{`class A :isa(A) { }`, "E0601@8"},
+		{`role R { } class A :isa(R) { }`, "E0602@19"},
+		{`class C { } class A :does(C) { }`, "E0602@20"},
+		{`class P { } role R :isa(P) { }`, "E0602@19"},
+		{`role R { method m; method n; } class A :does(R) { method n { } }`, "E0603@37"},
+		{`role R { method m; } role S :does(R) { } class A :does(S) { }`, "E0603@47"},
+		{`role R { method m; } class P { method m { } } class A :isa(P) :does(R) { }`, ""},
+		{`role R { method m; } class A :does(R) { field $x :reader(m); }`, ""},
+		{`role R { method m; } role S { method m { } } class A :does(R, S) { }`, ""},
+		{`role R { method m; } class A :does(R) { }`, "E0603@27"},
+		{`class A { field $x; field @x; field $x; }`, "E0604@36"},
+		{`class A; field $x; field $x;`, "E0604@25"},
+		{`class A { field $x :param; field $y :param(x); }`, "E0605@33"},
+		{`class A { field $x :param; } class B :isa(A) { field $z :param(x); field $x; }`, "E0605@53"},
+		{`class A { field $x :param; } class B { field $x :param; }`, ""},
+		{`role R { field $id :param; } class A :does(R) { field $key :param(id); }`, "E0605@54"},
+		{`role R { field $x :param; } role S { field $x :param; } class A :does(R, S) { }`, "E0605@43"},
+		{`role R { field $x :param; } class P :does(R) { } class A :isa(P) :does(R) { field $y :param(x); }`, "E0605@82"},
+		{`role R { field $x :param; } class A :does(R) { } class B :does(R) { }`, ""},
+	}
+
+	for _, tt := range tests {
+		info := check(t, tt.input)
+		if got := found(info.Diagnostics); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q (%v)", tt.input, tt.expected, got, info.Diagnostics)
+		}
+	}
+
+	info := check(t, `class A :isa(B) { } class B :isa(A) { }`)
+	if d := info.Diagnostics[0]; d.Message != "A inherits from itself: A -> B -> A" {
+		t.Errorf("unexpected diagnostic %v", d)
+	}
+	if info.Classes["A"].Parent == nil || info.Classes["B"].Parent != nil {
+		t.Errorf("expected the cycle to be broken where it closes")
+	}
+
+	info = check(t, `role R { method m; } class A :does(R) { }`)
+	d := info.Diagnostics[0]
+	if d.Message != "class A does not implement method m, which role R requires" ||
+		len(d.Labels) != 1 || d.Labels[0].Span != ast.SpanOf(info.Classes["R"].Methods["m"]) {
+		t.Errorf("unexpected diagnostic %v with labels %v", d, d.Labels)
+	}
+}
@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"github.com/perigrin/simian/diagnostics"
 	"github.com/perigrin/simian/token"
 )
 
@@ -23,6 +24,9 @@ var stateTable = map[token.TokenType]state{
 	token.WHITESPACE: {name: "readWhitespace", run: (*Lexer).readWhitespace},
 	token.OPERATOR:   {name: "readOperator", run: (*Lexer).readOperator},
 	token.COLON:      {name: "readIdentifier", run: (*Lexer).readIdentifier},
+	token.ASTERISK:   {name: "readOperator", run: (*Lexer).readOperator},
+	token.QUOTE:      {name: "readString", run: (*Lexer).readString},
+	token.HASH:       {name: "readComment", run: (*Lexer).readComment},
 }
 
 func readerForToken(t token.TokenType) state {
@@ -38,6 +42,10 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	diagnostics  []diagnostics.Diagnostic
+
+	// where input starts in the file, added to every offset
+	base int
 }
 
 func New(input []byte) *Lexer {
@@ -46,22 +54,74 @@ func New(input []byte) *Lexer {
 	return l
 }
 
+// NewAt returns a Lexer for input that starts at offset in a larger
+// file, such as an expression interpolated into a string, so its tokens
+// carry their offsets in the file.
+func NewAt(input []byte, offset int) *Lexer {
+	l := New(input)
+	l.base = offset
+	return l
+}
+
 func (l *Lexer) NextToken() token.Token {
 	if l.isAtEnd() {
-		return token.Token{Type: token.EOF}
+		return token.Token{Type: token.EOF, Offset: l.base + len(l.input)}
 	}
 
 	nextToken := token.LookupSingleToken(l.ch)
+	switch {
+	case nextToken == token.SIGIL && !startsVariable(l.peekChar()) && token.IsOperator([]byte{l.ch}):
+		// % and & are only sigils when a name follows them
+		nextToken = token.OPERATOR
+	case nextToken == token.COLON && !startsAttribute(l.peekChar()):
+		nextToken = token.INVALID
+	}
 	reader := readerForToken(nextToken)
+	offset := l.position
 	tok := reader.run(l)
+	tok.Offset = l.base + offset
 
-	// skip whitespace
-	if tok.Type == token.WHITESPACE {
+	// skip whitespace and comments
+	if tok.Type == token.WHITESPACE || tok.Type == token.COMMENT {
 		return l.NextToken()
 	}
+	if tok.Type == token.INVALID {
+		d := diagnostics.Errorf(diagnostics.UnknownCharacter, diagnostics.SpanOf(tok),
+			"unknown character `%s`", tok.Literal)
+		l.diagnostics = append(l.diagnostics, d)
+	}
 	return tok
 }
 
+// Diagnostics returns the problems found in the input read so far.
+func (l *Lexer) Diagnostics() []diagnostics.Diagnostic {
+	return l.diagnostics
+}
+
+// unterminated reports a string starting at offset that runs to the end
+// of the input.
+func (l *Lexer) unterminated(offset int) {
+	d := diagnostics.Errorf(diagnostics.UnterminatedString, diagnostics.Span{Start: l.base + offset, End: l.base + offset + 1},
+		"unterminated string")
+	d.Label = "string starts here"
+	l.diagnostics = append(l.diagnostics, d)
+}
+
+func startsVariable(ch byte) bool {
+	switch {
+	case token.IsLetter(ch):
+		return true
+	case ch == '_', ch == '{', ch == '$', ch == ':', ch == '*', ch == '^':
+		return true
+	default:
+		return false
+	}
+}
+
+func startsAttribute(ch byte) bool {
+	return token.IsLetter(ch) || ch == '_' || ch == ':'
+}
+
 func (l *Lexer) peekChar() byte {
 	if l.readPosition >= len(l.input) {
 		return 0
@@ -71,13 +131,17 @@ func (l *Lexer) peekChar() byte {
 }
 
 func (l *Lexer) readChar() {
+	if l.readPosition > len(l.input) {
+		// an escape at the very end already took us past the input
+		return
+	}
 	l.ch = l.peekChar()
 	l.position = l.readPosition
 	l.readPosition += 1
 }
 
 func (l *Lexer) isAtEnd() bool {
-	return l.readPosition >= len(l.input)
+	return l.position >= len(l.input)
 }
 
 func (l *Lexer) readSequence(check func(byte) bool) []byte {
@@ -106,20 +170,189 @@ func (l *Lexer) readIdentifier() token.Token {
 		}
 	}
 
+	position := l.position
+	if l.ch == '$' && l.peekChar() == '#' {
+		// $#array, $#{...} and the $#* postfix dereference
+		l.readChar()
+		l.readChar()
+	}
+	l.readSequence(matcher)
+
 	tok := token.Token{}
-	tok.Literal = l.readSequence(matcher)
+	tok.Literal = l.input[position:l.position]
 	tok.Type = token.LookupIdent(tok.Literal)
+
+	switch {
+	case isVString(tok.Literal) && l.ch == '.' && token.IsDigit(l.peekChar()):
+		l.readSequence(func(ch byte) bool {
+			return token.IsDigit(ch) || ch == '.' || ch == '_'
+		})
+		tok.Literal = l.input[position:l.position]
+		tok.Type = token.VERSION
+	case isQuoteLike(tok.Literal) && isQuoteDelimiter(l.ch):
+		tok.Type = token.STRING
+		if string(tok.Literal) == "qw" {
+			tok.Type = token.QW
+		}
+		if !l.readDelimited() {
+			l.unterminated(position)
+		}
+		tok.Literal = l.input[position:l.position]
+	}
 	return tok
 }
 
+// isVString reports whether ident looks like the start of a v-string
+// such as v5.36.
+func isVString(ident []byte) bool {
+	if len(ident) < 2 || ident[0] != 'v' {
+		return false
+	}
+	for _, ch := range ident[1:] {
+		if !token.IsDigit(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+func isQuoteLike(ident []byte) bool {
+	switch string(ident) {
+	case "q", "qq", "qw":
+		return true
+	default:
+		return false
+	}
+}
+
+func isQuoteDelimiter(ch byte) bool {
+	switch ch {
+	case '(', '[', '{', '<', '/', '|', '!', '\'', '"', '#', '~':
+		return true
+	default:
+		return false
+	}
+}
+
+func closingDelimiter(open byte) byte {
+	switch open {
+	case '(':
+		return ')'
+	case '[':
+		return ']'
+	case '{':
+		return '}'
+	case '<':
+		return '>'
+	default:
+		return open
+	}
+}
+
+// readDelimited consumes a quoted body starting at the opening delimiter,
+// honouring backslash escapes and nesting of bracketing delimiters. It
+// reports whether the closing delimiter was found.
+func (l *Lexer) readDelimited() bool {
+	open := l.ch
+	close := closingDelimiter(open)
+	depth := 0
+	l.readChar()
+	for !l.isAtEnd() {
+		switch {
+		case l.ch == '\\':
+			l.readChar()
+		case l.ch == close && depth == 0:
+			l.readChar()
+			return true
+		case l.ch == close:
+			depth--
+		case l.ch == open && open != close:
+			depth++
+		}
+		l.readChar()
+	}
+	return false
+}
+
 func (l *Lexer) readNumber() token.Token {
 	matcher := func(ch byte) bool {
-		return token.IsDigit(ch)
+		return token.IsDigit(ch) || ch == '_'
 	}
 
+	position := l.position
 	tok := token.Token{}
-	tok.Literal = l.readSequence(matcher)
 	tok.Type = token.DIGIT
+	if l.ch == '0' && isRadixPrefix(l.peekChar()) {
+		// 0x1F and 0b101
+		l.readChar()
+		l.readChar()
+		l.readSequence(func(ch byte) bool {
+			return isHexDigit(ch) || ch == '_'
+		})
+		tok.Literal = l.input[position:l.position]
+		return tok
+	}
+	l.readSequence(matcher)
+	for l.ch == '.' && token.IsDigit(l.peekChar()) {
+		l.readChar()
+		l.readSequence(matcher)
+		if tok.Type == token.DIGIT {
+			tok.Type = token.NUMBER
+		} else {
+			tok.Type = token.VERSION
+		}
+	}
+	if tok.Type != token.VERSION && l.startsExponent() {
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		l.readSequence(matcher)
+		tok.Type = token.NUMBER
+	}
+	tok.Literal = l.input[position:l.position]
+	return tok
+}
+
+func isRadixPrefix(ch byte) bool {
+	return ch == 'x' || ch == 'X' || ch == 'b' || ch == 'B'
+}
+
+func isHexDigit(ch byte) bool {
+	return token.IsDigit(ch) || ch >= 'a' && ch <= 'f' || ch >= 'A' && ch <= 'F'
+}
+
+// startsExponent reports whether the current character begins the
+// exponent of a number, as in 1e3 or 1.5E-2.
+func (l *Lexer) startsExponent() bool {
+	if l.ch != 'e' && l.ch != 'E' {
+		return false
+	}
+	next := l.peekChar()
+	if (next == '+' || next == '-') && l.readPosition+1 < len(l.input) {
+		next = l.input[l.readPosition+1]
+	}
+	return token.IsDigit(next)
+}
+
+func (l *Lexer) readString() token.Token {
+	position := l.position
+	if !l.readDelimited() {
+		l.unterminated(position)
+	}
+
+	tok := token.Token{}
+	tok.Literal = l.input[position:l.position]
+	tok.Type = token.STRING
+	return tok
+}
+
+func (l *Lexer) readComment() token.Token {
+	tok := token.Token{}
+	tok.Literal = l.readSequence(func(ch byte) bool {
+		return ch != '\n' && ch != 0
+	})
+	tok.Type = token.COMMENT
 	return tok
 }
 
@@ -55,6 +55,11 @@ func TestReaders(t *testing.T) {
 		{"&sub", (*Lexer).readIdentifier, newToken(token.IDENTIFIER, "&sub")},
 		{"*glob", (*Lexer).readIdentifier, newToken(token.IDENTIFIER, "*glob")},
 		{"10", (*Lexer).readNumber, newToken(token.DIGIT, "10")},
+		{"0x1F", (*Lexer).readNumber, newToken(token.DIGIT, "0x1F")},
+		{"0b1_01", (*Lexer).readNumber, newToken(token.DIGIT, "0b1_01")},
+		{"1e3", (*Lexer).readNumber, newToken(token.NUMBER, "1e3")},
+		{"1.5E-2", (*Lexer).readNumber, newToken(token.NUMBER, "1.5E-2")},
+		{"1.2.3", (*Lexer).readNumber, newToken(token.VERSION, "1.2.3")},
 		{"**", (*Lexer).readOperator, newToken(token.OP_POWER, "**")},
 	}
 
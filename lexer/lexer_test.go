@@ -3,6 +3,7 @@ package lexer_test
 import (
 	"testing"
 
+	"github.com/perigrin/simian/diagnostics"
 	"github.com/perigrin/simian/lexer"
 	"github.com/perigrin/simian/token"
 )
@@ -167,3 +168,156 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestModuleTokens(t *testing.T) {
+	input := `package Foo::Bar 1.23; # the package
+use v5.36;
+use POSIX qw(floor ceil);
+no strict 'refs';
+require "lib/file.pl";
+BEGIN { $x % 2 && $y }
+use Foo q{a {nested} b}, 1.2.3;`
+
+	tests := []struct {
+		Type    token.TokenType
+		Literal string
+	}{
+		{token.PACKAGE, "package"},
+		{token.IDENTIFIER, "Foo::Bar"},
+		{token.NUMBER, "1.23"},
+		{token.SEMICOLON, ";"},
+		{token.USE, "use"},
+		{token.VERSION, "v5.36"},
+		{token.SEMICOLON, ";"},
+		{token.USE, "use"},
+		{token.IDENTIFIER, "POSIX"},
+		{token.QW, "qw(floor ceil)"},
+		{token.SEMICOLON, ";"},
+		{token.NO, "no"},
+		{token.IDENTIFIER, "strict"},
+		{token.STRING, "'refs'"},
+		{token.SEMICOLON, ";"},
+		{token.REQUIRE, "require"},
+		{token.STRING, `"lib/file.pl"`},
+		{token.SEMICOLON, ";"},
+		{token.BEGIN, "BEGIN"},
+		{token.LBRACE, "{"},
+		{token.IDENTIFIER, "$x"},
+		{token.OP_MODULUS, "%"},
+		{token.DIGIT, "2"},
+		{token.OP_LOGICAL_AND, "&&"},
+		{token.IDENTIFIER, "$y"},
+		{token.RBRACE, "}"},
+		{token.USE, "use"},
+		{token.IDENTIFIER, "Foo"},
+		{token.STRING, "q{a {nested} b}"},
+		{token.COMMA, ","},
+		{token.VERSION, "1.2.3"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New([]byte(input))
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.Type {
+			t.Fatalf("tests[%d] (%v) - token.type wrong, expected %+v, got %+v", i, tt.Literal, tt.Type, tok.Type)
+		}
+
+		if string(tok.Literal) != tt.Literal {
+			t.Fatalf("tests[%d] - token.literal wrong, expected %+v, got %+v", i, tt.Literal, string(tok.Literal))
+		}
+	}
+}
+
+func TestDereferenceTokens(t *testing.T) {
+	input := `$aref->[0]; $#array; $x->$#*; $x->@*; $x->%*;`
+
+	tests := []struct {
+		Type    token.TokenType
+		Literal string
+	}{
+		{token.IDENTIFIER, "$aref"},
+		{token.OP_ARROW, "->"},
+		{token.LBRACKET, "["},
+		{token.DIGIT, "0"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "$#array"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "$x"},
+		{token.OP_ARROW, "->"},
+		{token.IDENTIFIER, "$#*"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "$x"},
+		{token.OP_ARROW, "->"},
+		{token.IDENTIFIER, "@*"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "$x"},
+		{token.OP_ARROW, "->"},
+		{token.IDENTIFIER, "%*"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New([]byte(input))
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.Type {
+			t.Fatalf("tests[%d] (%v) - token.type wrong, expected %+v, got %+v", i, tt.Literal, tt.Type, tok.Type)
+		}
+
+		if string(tok.Literal) != tt.Literal {
+			t.Fatalf("tests[%d] - literal wrong, expected %+v, got %+v", i, tt.Literal, string(tok.Literal))
+		}
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	input := "my $x = 'a';\n  $x->y;"
+	offsets := []int{0, 3, 6, 8, 11, 15, 17, 19, 20}
+
+	l := lexer.New([]byte(input))
+	for i, expected := range offsets {
+		tok := l.NextToken()
+		if tok.Offset != expected {
+			t.Errorf("tests[%d] - %s offset wrong. expected=%d, got=%d", i, tok.Literal, expected, tok.Offset)
+		}
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF || tok.Offset != len(input) {
+		t.Errorf("expected EOF at %d, got %s at %d", len(input), tok.Type, tok.Offset)
+	}
+}
+
+func TestLexerDiagnostics(t *testing.T) {
+	l := lexer.New([]byte("my $x = \\ 'abc"))
+	l.Tokens()
+
+	diags := l.Diagnostics()
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d: %v", len(diags), diags)
+	}
+	if diags[0].Code != diagnostics.UnknownCharacter || diags[0].Span.Start != 8 {
+		t.Errorf("expected unknown character at 8, got %v at %d", diags[0], diags[0].Span.Start)
+	}
+	if diags[1].Code != diagnostics.UnterminatedString || diags[1].Span.Start != 10 {
+		t.Errorf("expected unterminated string at 10, got %v at %d", diags[1], diags[1].Span.Start)
+	}
+}
+
+func TestTrailingEscape(t *testing.T) {
+	for _, input := range []string{"'abc\\", "q{\\", "\"\\"} {
+		l := lexer.New([]byte(input))
+		tokens := l.Tokens()
+		if len(tokens) != 1 || string(tokens[0].Literal) != input {
+			t.Errorf("%q: expected one token, got %v", input, tokens)
+		}
+		if len(l.Diagnostics()) != 1 || l.Diagnostics()[0].Code != diagnostics.UnterminatedString {
+			t.Errorf("%q: expected an unterminated string, got %v", input, l.Diagnostics())
+		}
+	}
+}
@@ -9,6 +9,19 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "parse":
+			os.Exit(parseCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "check":
+			os.Exit(checkCommand(os.Args[2:], os.Stdin, os.Stderr))
+		case "xref":
+			os.Exit(xrefCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "cfg":
+			os.Exit(cfgCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
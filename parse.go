@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/fold"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+)
+
+// parseCommand implements `simian parse [--format=json|sexp] [--fold]
+// [file]`. It parses file, or standard input when no file is given, and
+// writes the AST to stdout; with --fold it writes the tree after its
+// constant expressions and branches are folded. Diagnostics go to
+// stderr; the exit status is 1 if any of them is an error, and 2 for a
+// usage problem.
+func parseCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "json", "output format: json or sexp")
+	folded := flags.Bool("fold", false, "fold constant expressions and branches before writing the tree")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: simian parse [--format=json|sexp] [--fold] [file]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var write func(io.Writer, ast.Node) error
+	switch *format {
+	case "json":
+		write = ast.WriteJSON
+	case "sexp":
+		write = ast.WriteSExpr
+	default:
+		fmt.Fprintf(stderr, "simian parse: unknown format %q\n", *format)
+		flags.Usage()
+		return 2
+	}
+
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	filename, src, err := readSource(flags, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "simian parse: %v\n", err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	diags := p.Errors()
+	if *folded {
+		diags = append(diags, fold.Fold(program, resolve.Resolve(program))...)
+	}
+	if err := write(stdout, program); err != nil {
+		fmt.Fprintf(stderr, "simian parse: %v\n", err)
+		return 1
+	}
+
+	diagnostics.Render(stderr, filename, src, diags...)
+	if diagnostics.HasErrors(diags) {
+		return 1
+	}
+	return 0
+}
+
+// readSource reads the file named by the only argument left in flags,
+// or stdin if there is none, and returns a name for it to use in
+// diagnostics.
+func readSource(flags *flag.FlagSet, stdin io.Reader) (string, []byte, error) {
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(stdin)
+		return "<stdin>", src, err
+	}
+	src, err := os.ReadFile(flags.Arg(0))
+	return flags.Arg(0), src, err
+}
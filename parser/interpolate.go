@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/token"
+)
+
+// parseInterpolated parses what the double quoted string t interpolates:
+// each variable, as in "$x" or "@{$list}", with the subscripts that
+// follow it, as in "$h{key}" or "$x->[0]". If the subscripts don't parse
+// as an expression the variable alone is kept.
+func (p *parser) parseInterpolated(t token.Token) []ast.Expression {
+	lit := string(t.Literal)
+	start := 1
+	if strings.HasPrefix(lit, "qq") {
+		start = 3
+	}
+	if len(lit) <= start {
+		return nil
+	}
+	body := lit[start : len(lit)-1]
+
+	var parts []ast.Expression
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '$', '@':
+			name, end := interpolationEnd(body, i)
+			if name == i {
+				continue
+			}
+			e := parseAt(body[i:end], t.Offset+start+i)
+			if e == nil && name < end {
+				e = parseAt(body[i:name], t.Offset+start+i)
+			}
+			if e != nil {
+				parts = append(parts, e)
+			}
+			i = end - 1
+		}
+	}
+	return parts
+}
+
+// parseAt parses src, found at offset in the file, as one expression,
+// returning nil if it has errors.
+func parseAt(src string, offset int) ast.Expression {
+	p := New(lexer.NewAt([]byte(src), offset)).(*parser)
+	if e := p.parseExpression(LOWEST); len(p.Errors()) == 0 {
+		return e
+	}
+	return nil
+}
+
+// interpolationEnd returns where the name of the variable starting at
+// body[i] ends, and where its subscripts end; both are i if nothing is
+// interpolated there.
+func interpolationEnd(body string, i int) (name, end int) {
+	j := i + 1
+	// the sigils of a dereference, as in $$ref
+	for j < len(body) && body[j] == '$' {
+		j++
+	}
+	switch {
+	case j == len(body):
+		return i, i
+	case body[j] == '{':
+		close := closing(body, j)
+		if close < 0 {
+			return i, i
+		}
+		j = close + 1
+	case token.IsLetter(body[j]) || body[j] == '_' || strings.HasPrefix(body[j:], "::"):
+		for j < len(body) && (token.IsLetter(body[j]) || token.IsDigit(body[j]) || body[j] == '_' ||
+			strings.HasPrefix(body[j:], "::") && j+2 < len(body) && token.IsLetter(body[j+2])) {
+			if body[j] == ':' {
+				j++
+			}
+			j++
+		}
+	case body[i] == '$' && j == i+1 && token.IsDigit(body[j]):
+		// a match variable, as in $1
+		for j < len(body) && token.IsDigit(body[j]) {
+			j++
+		}
+	default:
+		return i, i
+	}
+
+	name = j
+	for {
+		k := j
+		if strings.HasPrefix(body[k:], "->") {
+			k += 2
+		}
+		if k == len(body) || body[k] != '[' && body[k] != '{' {
+			return name, j
+		}
+		close := closing(body, k)
+		if close < 0 {
+			return name, j
+		}
+		j = close + 1
+	}
+}
+
+// closing returns the index of the bracket closing the one at body[i],
+// or -1 if it isn't closed.
+func closing(body string, i int) int {
+	open, close := body[i], byte(']')
+	if open == '{' {
+		close = '}'
+	}
+	depth := 0
+	for j := i; j < len(body); j++ {
+		switch body[j] {
+		case '\\':
+			j++
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
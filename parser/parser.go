@@ -2,14 +2,125 @@ package parser
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
 	"github.com/perigrin/simian/lexer"
 	"github.com/perigrin/simian/token"
 )
 
+// Precedence levels follow `perldoc perlop`, lowest first.
+const (
+	_ int = iota
+	LOWEST
+	LOWOR       // or xor
+	LOWAND      // and
+	LOWNOT      // not
+	ASSIGN      // = += -= etc.
+	TERNARY     // ?:
+	RANGE       // .. ...
+	OROR        // || //
+	ANDAND      // &&
+	BITOR       // | ^
+	BITAND      // &
+	EQUALS      // == != <=> eq ne cmp
+	LESSGREATER // < > <= >= lt gt le ge
+	SHIFT       // << >>
+	SUM         // + - .
+	PRODUCT     // * / % x
+	BIND        // =~ !~
+	PREFIX      // ! ~ \ unary + and -
+	POWER       // **
+	INCDEC      // ++ --
+	ARROW       // ->
+)
+
+var precedences = map[token.TokenType]int{
+	token.OP_LOGICAL_OR_LOW_PRECEDENCE:  LOWOR,
+	token.OP_LOGICAL_XOR_LOW_PRECEDENCE: LOWOR,
+	token.OP_LOGICAL_AND_LOW_PRECEDENCE: LOWAND,
+
+	token.ASSIGN:                ASSIGN,
+	token.OP_ADD_ASSIGN:         ASSIGN,
+	token.OP_SUB_ASSIGN:         ASSIGN,
+	token.OP_MUL_ASSIGN:         ASSIGN,
+	token.OP_DIV_ASSIGN:         ASSIGN,
+	token.OP_MOD_ASSIGN:         ASSIGN,
+	token.OP_POWER_ASSIGN:       ASSIGN,
+	token.OP_LEFT_SHIFT_ASSIGN:  ASSIGN,
+	token.OP_RIGHT_SHIFT_ASSIGN: ASSIGN,
+	token.OP_BITWISE_AND_ASSIGN: ASSIGN,
+	token.OP_BITWISE_OR_ASSIGN:  ASSIGN,
+	token.OP_BITWISE_XOR_ASSIGN: ASSIGN,
+	token.OP_LOGICAL_AND_ASSIGN: ASSIGN,
+	token.OP_LOGICAL_OR_ASSIGN:  ASSIGN,
+	token.OP_DEFINED_OR_ASSIGN:  ASSIGN,
+	token.OP_CONCAT_ASSIGN:      ASSIGN,
+
+	token.OP_TRI_THEN: TERNARY,
+
+	token.OP_RANGE:           RANGE,
+	token.OP_RANGE_INCLUSIVE: RANGE,
+
+	token.OP_LOGICAL_OR:         OROR,
+	token.OP_LOGICAL_DEFINED_OR: OROR,
+	token.OP_LOGICAL_AND:        ANDAND,
+	token.OP_BITWISE_OR:         BITOR,
+	token.OP_BITWISE_XOR:        BITOR,
+	token.OP_BITWISE_AND:        BITAND,
+
+	token.EQUAL:      EQUALS,
+	token.NOT_EQUAL:  EQUALS,
+	token.OP_COMPARE: EQUALS,
+	token.OP_STR_EQ:  EQUALS,
+	token.OP_STR_NE:  EQUALS,
+	token.OP_STR_CMP: EQUALS,
+
+	token.LT:                    LESSGREATER,
+	token.GT:                    LESSGREATER,
+	token.OP_LESS_THAN_EQUAL:    LESSGREATER,
+	token.OP_GREATER_THAN_EQUAL: LESSGREATER,
+	token.OP_STR_LT:             LESSGREATER,
+	token.OP_STR_GT:             LESSGREATER,
+	token.OP_STR_LE:             LESSGREATER,
+	token.OP_STR_GE:             LESSGREATER,
+
+	token.OP_LEFT_SHIFT:  SHIFT,
+	token.OP_RIGHT_SHIFT: SHIFT,
+
+	token.PLUS:  SUM,
+	token.MINUS: SUM,
+	token.DOT:   SUM,
+
+	token.ASTERISK:   PRODUCT,
+	token.SLASH:      PRODUCT,
+	token.OP_MODULUS: PRODUCT,
+
+	token.OP_MATCH:   BIND,
+	token.OP_NOMATCH: BIND,
+
+	token.OP_POWER: POWER,
+
+	token.OP_DEC:   INCDEC,
+	token.OP_ARROW: ARROW,
+}
+
+// rightAssociative operators bind their right operand first.
+var rightAssociative = map[int]bool{
+	ASSIGN:  true,
+	TERNARY: true,
+	POWER:   true,
+}
+
+type (
+	prefixParseFn func() ast.Expression
+	infixParseFn  func(ast.Expression) ast.Expression
+)
+
 type Parser interface {
-	Errors() []string
+	Errors() []diagnostics.Diagnostic
 	ParseProgram() *ast.Program
 }
 
@@ -17,14 +128,60 @@ type parser struct {
 	l         *lexer.Lexer
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []diagnostics.Diagnostic
+
+	// set after an error until the parser resynchronises, so a single
+	// mistake does not produce a cascade of follow-on errors
+	panicking bool
+
+	// tokens read past peekToken by peekAhead
+	lookahead []token.Token
+
+	prefixParseFns map[token.TokenType]prefixParseFn
+	infixParseFns  map[token.TokenType]infixParseFn
 }
 
 func New(l *lexer.Lexer) Parser {
 	p := &parser{
 		l:      l,
-		errors: []string{},
+		errors: []diagnostics.Diagnostic{},
+	}
+
+	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
+	p.registerPrefix(token.IDENTIFIER, p.parseIdentifier)
+	p.registerPrefix(token.DIGIT, p.parseNumberLiteral)
+	p.registerPrefix(token.NUMBER, p.parseNumberLiteral)
+	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
+	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
+	p.registerPrefix(token.VERSION, p.parseVersionLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.QW, p.parseQuoteWords)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ASTERISK, p.parseGlobDereference)
+	p.registerPrefix(token.MY, p.parseDeclaration)
+	p.registerPrefix(token.OUR, p.parseDeclaration)
+	p.registerPrefix(token.STATE, p.parseDeclaration)
+	for _, t := range []token.TokenType{
+		token.NOT,
+		token.MINUS,
+		token.PLUS,
+		token.OP_COMPLEMENT,
+		token.OP_DEC,
+		token.OP_LOGICAL_NOT_LOW_PRECEDENCE,
+	} {
+		p.registerPrefix(t, p.parsePrefixExpression)
+	}
+
+	p.infixParseFns = make(map[token.TokenType]infixParseFn)
+	for t := range precedences {
+		p.registerInfix(t, p.parseInfixExpression)
 	}
+	p.registerInfix(token.OP_TRI_THEN, p.parseConditionalExpression)
+	p.registerInfix(token.OP_DEC, p.parsePostfixExpression)
+	p.registerInfix(token.OP_ARROW, p.parseArrowExpression)
+	p.registerInfix(token.IDENTIFIER, p.parseInfixExpression) // the x operator
 
 	p.nextToken()
 	p.nextToken()
@@ -32,18 +189,130 @@ func New(l *lexer.Lexer) Parser {
 	return p
 }
 
-func (p *parser) Errors() []string {
-	return p.errors
+func (p *parser) registerPrefix(t token.TokenType, fn prefixParseFn) {
+	p.prefixParseFns[t] = fn
+}
+
+func (p *parser) registerInfix(t token.TokenType, fn infixParseFn) {
+	p.infixParseFns[t] = fn
+}
+
+// Errors returns the problems found by the lexer and parser, in source
+// order.
+func (p *parser) Errors() []diagnostics.Diagnostic {
+	errors := append([]diagnostics.Diagnostic{}, p.l.Diagnostics()...)
+	errors = append(errors, p.errors...)
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[i].Span.Start < errors[j].Span.Start
+	})
+	return errors
+}
+
+// addError records a parse error unless the parser is still recovering
+// from an earlier one.
+func (p *parser) addError(d diagnostics.Diagnostic) {
+	if p.panicking {
+		return
+	}
+	p.errors = append(p.errors, d)
+	p.panicking = true
 }
 
 func (p *parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token %s got %s", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	d := diagnostics.Errorf(diagnostics.UnexpectedToken, diagnostics.SpanOf(p.peekToken),
+		"expected %s, found %s", describeType(t), describe(p.peekToken))
+	d.Label = "expected " + describeType(t)
+	if spelling, ok := punctuation[t]; ok {
+		d.Fix = &diagnostics.Fix{
+			Message:     fmt.Sprintf("insert `%s` after `%s`", spelling, p.curToken.Literal),
+			Span:        diagnostics.After(p.curToken),
+			Replacement: spelling,
+		}
+	}
+	p.addError(d)
+}
+
+func (p *parser) noPrefixParseFnError(t token.Token) {
+	d := diagnostics.Errorf(diagnostics.ExpectedExpression, diagnostics.SpanOf(t),
+		"expected expression, found %s", describe(t))
+	d.Label = "expected expression"
+	p.addError(d)
+}
+
+// unclosedError reports end of input before the delimiter opened by open
+// was closed.
+func (p *parser) unclosedError(open token.Token, close string) {
+	d := diagnostics.Errorf(diagnostics.UnclosedDelimiter, diagnostics.SpanOf(p.peekToken),
+		"unclosed delimiter `%s`", open.Literal)
+	if p.curTokenIs(token.EOF) {
+		d.Span = diagnostics.SpanOf(p.curToken)
+	}
+	d.Label = fmt.Sprintf("expected `%s`", close)
+	d.Labels = []diagnostics.Label{{Span: diagnostics.SpanOf(open), Message: "unclosed delimiter"}}
+	d.Fix = &diagnostics.Fix{
+		Message:     fmt.Sprintf("insert `%s`", close),
+		Span:        d.Span,
+		Replacement: close,
+	}
+	p.addError(d)
+}
+
+// punctuation spells the tokens a fix can insert.
+var punctuation = map[token.TokenType]string{
+	token.ASSIGN:    "=",
+	token.SEMICOLON: ";",
+	token.LPAREN:    "(",
+	token.RPAREN:    ")",
+	token.LBRACE:    "{",
+	token.RBRACE:    "}",
+	token.LBRACKET:  "[",
+	token.RBRACKET:  "]",
+}
+
+func describeType(t token.TokenType) string {
+	if spelling, ok := punctuation[t]; ok {
+		return "`" + spelling + "`"
+	}
+	if t == token.IDENTIFIER {
+		return "a name"
+	}
+	return string(t)
+}
+
+func describe(t token.Token) string {
+	if t.Type == token.EOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("`%s`", t.Literal)
 }
 
 func (p *parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	if len(p.lookahead) > 0 {
+		p.peekToken = p.lookahead[0]
+		p.lookahead = p.lookahead[1:]
+		return
+	}
+	p.peekToken = p.readToken()
+}
+
+// readToken returns the next token from the lexer, passing over invalid
+// characters which the lexer has already reported.
+func (p *parser) readToken() token.Token {
+	tok := p.l.NextToken()
+	for tok.Type == token.INVALID {
+		tok = p.l.NextToken()
+	}
+	return tok
+}
+
+// peekAhead returns the token n places after peekToken without
+// consuming anything.
+func (p *parser) peekAhead(n int) token.Token {
+	for len(p.lookahead) < n {
+		p.lookahead = append(p.lookahead, p.readToken())
+	}
+	return p.lookahead[n-1]
 }
 
 func (p *parser) ParseProgram() *ast.Program {
@@ -55,39 +324,1746 @@ func (p *parser) ParseProgram() *ast.Program {
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
+		if p.panicking {
+			p.synchronize()
+		}
 		p.nextToken()
 	}
 	return program
 }
 
+// synchronize recovers from a parse error by discarding tokens up to the
+// end of the broken statement: a ;, or the token before a } or a
+// keyword that starts a new statement. A block in the statement is
+// discarded whole, ending it, rather than resuming inside it.
+func (p *parser) synchronize() {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		if p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) || statementKeywords[p.peekToken.Type] {
+			break
+		}
+		p.nextToken()
+		if p.curTokenIs(token.LBRACE) {
+			p.skipBlock()
+		}
+	}
+	p.panicking = false
+}
+
+// skipBlock discards tokens from the { at the current token through the
+// } that closes it, or to the end of input.
+func (p *parser) skipBlock() {
+	depth := 0
+	for !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth--; depth == 0 {
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
+// recoverHeader recovers from an error in the parenthesised header of a
+// compound statement, such as the condition of an if, by discarding
+// tokens up to the ) followed by the statement's block, passing over
+// anything bracketed. It reports whether it found one, leaving the
+// current token on the ), so the statement's block can still be parsed.
+// It gives up at the end of input, or at a ; beyond the number the
+// header may hold, which a C-style for's has two of.
+func (p *parser) recoverHeader(semicolons int) bool {
+	depth := 0
+	for !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if depth > 0 {
+				depth--
+			} else if p.curTokenIs(token.RPAREN) && p.peekTokenIs(token.LBRACE) {
+				p.panicking = false
+				return true
+			}
+		case token.SEMICOLON:
+			if depth > 0 {
+				break
+			}
+			if semicolons == 0 {
+				return false
+			}
+			semicolons--
+		}
+		p.nextToken()
+	}
+	return false
+}
+
+// statementKeywords begin a new statement, so are safe places to resume
+// parsing after an error.
+var statementKeywords = map[token.TokenType]bool{
+	token.MY:        true,
+	token.OUR:       true,
+	token.STATE:     true,
+	token.RETURN:    true,
+	token.IF:        true,
+	token.UNLESS:    true,
+	token.WHILE:     true,
+	token.UNTIL:     true,
+	token.FOR:       true,
+	token.FOREACH:   true,
+	token.PACKAGE:   true,
+	token.USE:       true,
+	token.NO:        true,
+	token.REQUIRE:   true,
+	token.SUB:       true,
+	token.CLASS:     true,
+	token.FIELD:     true,
+	token.METHOD:    true,
+	token.BEGIN:     true,
+	token.END:       true,
+	token.INIT:      true,
+	token.CHECK:     true,
+	token.UNITCHECK: true,
+}
+
 func (p *parser) parseStatement() ast.Statement {
+	if isWord(p.curToken) && isFatComma(p.peekToken) {
+		return p.parseExpressionStatement()
+	}
 	switch p.curToken.Type {
-	case token.MY:
+	case token.SEMICOLON:
+		return nil
+	case token.MY, token.OUR, token.STATE:
+		if p.declaresList() {
+			// my ($a, $b) = @_;
+			return p.parseExpressionStatement()
+		}
 		return p.parseMyStatement()
+	case token.IF, token.UNLESS:
+		return p.parseIfStatement()
+	case token.WHILE, token.UNTIL:
+		return p.parseWhileStatement()
+	case token.FOR, token.FOREACH:
+		return p.parseForStatement()
+	case token.RETURN:
+		return p.parseReturnStatement()
+	case token.LBRACE:
+		return p.parseBlockStatement()
+	case token.PACKAGE:
+		return p.parsePackageStatement()
+	case token.USE:
+		return p.parseUseStatement()
+	case token.NO:
+		return p.parseNoStatement()
+	case token.REQUIRE:
+		return p.parseRequireStatement()
+	case token.BEGIN, token.END, token.INIT, token.CHECK, token.UNITCHECK:
+		return p.parsePhaseBlock()
+	case token.SUB:
+		return p.parseSubStatement()
+	case token.CLASS:
+		return p.parseClassStatement()
+	case token.FIELD:
+		return p.parseFieldStatement()
+	case token.METHOD:
+		return p.parseMethodStatement()
+	case token.IDENTIFIER:
+		if isLabel(p.curToken) {
+			return p.parseLabeledStatement()
+		}
+		if p.isRole() {
+			return p.parseClassStatement()
+		}
+		if loopControls[string(p.curToken.Literal)] && !isFatComma(p.peekToken) {
+			return p.parseLoopControlStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
-		return nil
+		return p.parseExpressionStatement()
 	}
 }
 
-func (p *parser) parseMyStatement() *ast.MyStatement {
+func (p *parser) parseMyStatement() ast.Statement {
 	stmt := &ast.MyStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENTIFIER) {
+	stmt.Type = p.parseOptionalType()
+	stmt.Name = p.expectVariable()
+	if stmt.Name == nil {
+		return nil
+	}
+
+	switch {
+	case p.peekTokenIs(token.ASSIGN):
+		p.nextToken()
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+	case !endsList(p.peekToken):
+		p.peekError(token.ASSIGN)
+		return stmt
+	}
+
+	return p.parseModifier(stmt)
+}
+
+// parseDeclaration parses my, our or state where an expression is
+// expected, declaring one variable or a parenthesised list.
+func (p *parser) parseDeclaration() ast.Expression {
+	decl := &ast.Declaration{Token: p.curToken}
+	decl.Type = p.parseOptionalType()
+	if !p.peekTokenIs(token.LPAREN) {
+		variable := p.expectVariable()
+		if variable == nil {
+			return nil
+		}
+		decl.Variables = []*ast.Variable{variable}
+		return decl
+	}
+
+	p.nextToken()
+	decl.Parens = true
+	decl.Variables = []*ast.Variable{}
+	for !p.peekTokenIs(token.RPAREN) {
+		variable := p.expectVariable()
+		if variable == nil {
+			return nil
+		}
+		decl.Variables = append(decl.Variables, variable)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return decl
+}
+
+// parseIfStatement parses if and unless statements, and an elsif with
+// the rest of its chain.
+func (p *parser) parseIfStatement() ast.Statement {
+	stmt := &ast.IfStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	stmt.Condition = p.parseCondition()
+	if p.panicking && !p.recoverHeader(0) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Consequence = p.parseBlockStatement()
+
+	switch {
+	case p.peekTokenIs(token.ELSIF):
+		p.nextToken()
+		alternative := p.parseIfStatement()
+		if alternative == nil {
+			return stmt
+		}
+		stmt.Alternative = alternative
+	case p.peekTokenIs(token.ELSE):
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return stmt
+		}
+		stmt.Alternative = p.parseBlockStatement()
+	}
+	return stmt
+}
+
+// parseCondition parses a parenthesised condition with the current
+// token on the (, through the ).
+func (p *parser) parseCondition() ast.Expression {
+	p.nextToken()
+	condition := p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return condition
+}
+
+func (p *parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if p.peekTokenIs(token.RPAREN) {
+		// while () loops forever
+		p.nextToken()
+	} else if stmt.Condition = p.parseCondition(); p.panicking && !p.recoverHeader(0) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+	stmt.Continue = p.parseContinueBlock()
+	return stmt
+}
+
+// parseForStatement parses both kinds of for loop: foreach over a list,
+// with or without an iterator variable, and the C-style for.
+func (p *parser) parseForStatement() ast.Statement {
+	tok := p.curToken
+
+	var variable ast.Expression
+	switch {
+	case p.peekTokenIs(token.MY) || p.peekTokenIs(token.OUR) || p.peekTokenIs(token.STATE):
+		p.nextToken()
+		decl := &ast.Declaration{Token: p.curToken}
+		decl.Type = p.parseOptionalType()
+		name := p.expectVariable()
+		if name == nil {
+			return nil
+		}
+		decl.Variables = []*ast.Variable{name}
+		variable = decl
+	case p.peekTokenIs(token.IDENTIFIER) && hasSigil(p.peekToken):
+		p.nextToken()
+		variable = ast.NewVariable(p.curToken)
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	open := p.curToken
+	if variable == nil && p.peekCStyleFor() {
+		return p.parseCStyleFor(tok)
+	}
+	var list []ast.Expression
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+		switch {
+		case p.panicking:
+		case p.peekTokenIs(token.COMMA):
+			for p.peekTokenIs(token.COMMA) {
+				p.nextToken()
+			}
+			if !p.peekTokenIs(token.RPAREN) {
+				p.nextToken()
+				list = append(list, p.parseExpressionList(token.RPAREN)...)
+			}
+		case !p.peekTokenIs(token.RPAREN) && !p.peekTokenIs(token.EOF):
+			p.commaError(token.RPAREN)
+			p.skipList(token.RPAREN)
+		}
+	}
+	if p.panicking {
+		if !p.recoverHeader(2) {
+			return nil
+		}
+		list = nil
+	} else if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt := &ast.ForeachStatement{Token: tok, Variable: variable, List: listValue(open, list)}
+	stmt.Body = p.parseBlockStatement()
+	stmt.Continue = p.parseContinueBlock()
+	return stmt
+}
+
+// peekCStyleFor reports whether the parenthesised header following the
+// current ( is a C-style for's, holding a ; outside any brackets.
+func (p *parser) peekCStyleFor() bool {
+	depth := 0
+	for i := 0; ; i++ {
+		t := p.peekToken
+		if i > 0 {
+			t = p.peekAhead(i)
+		}
+		switch t.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				return true
+			}
+		case token.EOF:
+			return false
+		}
+	}
+}
+
+// parseCStyleFor parses the rest of `for (INIT; CONDITION; STEP) BLOCK`
+// with the current token on the (.
+func (p *parser) parseCStyleFor(tok token.Token) ast.Statement {
+	stmt := &ast.ForStatement{Token: tok}
+	stmt.Init = p.parseOptionalExpression(token.SEMICOLON)
+	if !p.panicking {
+		stmt.Condition = p.parseOptionalExpression(token.SEMICOLON)
+	}
+	if !p.panicking {
+		stmt.Step = p.parseOptionalExpression(token.RPAREN)
+	}
+	if p.panicking && !p.recoverHeader(2) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
+
+// parseOptionalExpression parses an expression, if there is one before
+// the end token, and advances to the end token.
+func (p *parser) parseOptionalExpression(end token.TokenType) ast.Expression {
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return nil
+	}
+	p.nextToken()
+	exp := p.parseExpression(LOWEST)
+	if !p.expectPeek(end) {
+		return nil
+	}
+	return exp
+}
+
+// parseContinueBlock parses the continue block that may follow a loop.
+func (p *parser) parseContinueBlock() *ast.BlockStatement {
+	if !p.peekTokenIs(token.IDENTIFIER) || string(p.peekToken.Literal) != "continue" ||
+		p.peekAhead(1).Type != token.LBRACE {
+		return nil
+	}
+	p.nextToken()
+	p.nextToken()
+	return p.parseBlockStatement()
+}
+
+func (p *parser) parseLabeledStatement() ast.Statement {
+	stmt := &ast.LabeledStatement{
+		Token: p.curToken,
+		Label: strings.TrimSuffix(string(p.curToken.Literal), ":"),
+	}
+	p.nextToken()
+	stmt.Statement = p.parseStatement()
+	if stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
+
+// isLabel reports whether t is a statement label such as OUTER:.
+func isLabel(t token.Token) bool {
+	lit := string(t.Literal)
+	return isWord(t) && strings.HasSuffix(lit, ":") && !strings.HasSuffix(lit, "::")
+}
+
+func (p *parser) parseReturnStatement() ast.Statement {
+	stmt := &ast.ReturnStatement{Token: p.curToken}
+
+	if !endsList(p.peekToken) {
+		stmt.ReturnValue = listValue(stmt.Token, p.parseListOperands())
+	}
+
+	return p.parseModifier(stmt)
+}
+
+// loopControls are the statements that jump within a loop.
+var loopControls = map[string]bool{"next": true, "last": true, "redo": true}
+
+func (p *parser) parseLoopControlStatement() ast.Statement {
+	stmt := &ast.LoopControlStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.IDENTIFIER) && isWord(p.peekToken) {
+		p.nextToken()
+		stmt.Label = p.parseName()
+	}
+
+	return p.parseModifier(stmt)
+}
+
+func (p *parser) parseExpressionStatement() ast.Statement {
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt.Expression = p.parseCommaList(p.parseExpression(LOWEST))
+	if stmt.Expression == nil {
+		return nil
+	}
+
+	return p.parseModifier(stmt)
+}
+
+// parseCommaList parses the rest of a list joined by the comma operator,
+// as in `$a = 1, $b = 2`, after its first element.
+func (p *parser) parseCommaList(first ast.Expression) ast.Expression {
+	if first == nil || !p.peekTokenIs(token.COMMA) {
+		return first
+	}
+	p.nextToken()
+	list := []ast.Expression{first}
+	tok := p.curToken
+	if !endsList(p.peekToken) {
+		list = append(list, p.parseListOperands()...)
+	}
+	return listValue(tok, list)
+}
+
+// isModifier reports whether t is a keyword that can follow a simple
+// statement to make it conditional or loop over it.
+func isModifier(t token.Token) bool {
+	switch t.Type {
+	case token.IF, token.UNLESS, token.WHILE, token.UNTIL, token.FOR, token.FOREACH:
+		return true
+	}
+	return false
+}
+
+// parseModifier parses the statement modifier that may follow stmt, as
+// in `print if $x;`, and the semicolon that ends them.
+func (p *parser) parseModifier(stmt ast.Statement) ast.Statement {
+	if !isModifier(p.peekToken) {
+		p.skipSemicolon()
+		return stmt
+	}
+	p.nextToken()
+	mod := &ast.ModifiedStatement{Token: p.curToken, Statement: stmt}
+	p.nextToken()
+	mod.Condition = p.parseCommaList(p.parseExpression(LOWEST))
+	if mod.Condition == nil {
 		return nil
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: string(p.curToken.Literal)}
+	p.skipSemicolon()
+	return mod
+}
+
+func (p *parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		if p.panicking {
+			p.synchronize()
+			if p.curTokenIs(token.RBRACE) {
+				// the error was at this block's closing brace
+				continue
+			}
+		}
+		p.nextToken()
+	}
+	if !p.curTokenIs(token.RBRACE) {
+		p.unclosedError(block.Token, "}")
+	}
+	return block
+}
+
+// parsePackageStatement handles both `package NAME VERSION;` and the
+// block form `package NAME VERSION { ... }`.
+func (p *parser) parsePackageStatement() ast.Statement {
+	tok := p.curToken
 
-	if !p.expectPeek(token.ASSIGN) {
+	if !p.expectPeek(token.IDENTIFIER) {
 		return nil
 	}
-	// TODO: skip the expression until we get a semicolon
-	for !p.curTokenIs(token.SEMICOLON) {
+	name := p.parseName()
+	version := p.parseOptionalVersion()
+
+	if p.peekTokenIs(token.LBRACE) {
 		p.nextToken()
+		return &ast.PackageStatement{
+			Token:   tok,
+			Name:    name,
+			Version: version,
+			Body:    p.parseBlockStatement(),
+		}
+	}
+
+	p.skipSemicolon()
+	return &ast.PackageDeclaration{Token: tok, Name: name, Version: version}
+}
+
+func (p *parser) parseUseStatement() ast.Statement {
+	stmt := &ast.UseStatement{Token: p.curToken}
+	stmt.Module, stmt.Version, stmt.Imports = p.parseModuleImport()
+	if stmt.Module == nil && stmt.Version == nil {
+		return nil
+	}
+	return stmt
+}
+
+func (p *parser) parseNoStatement() ast.Statement {
+	stmt := &ast.NoStatement{Token: p.curToken}
+	stmt.Module, stmt.Version, stmt.Imports = p.parseModuleImport()
+	if stmt.Module == nil && stmt.Version == nil {
+		return nil
 	}
 	return stmt
 }
 
+// parseModuleImport parses what follows `use` or `no`: either a bare
+// VERSION, or MODULE with an optional VERSION and import list.
+func (p *parser) parseModuleImport() (*ast.Identifier, *ast.VersionLiteral, []ast.Expression) {
+	if isVersionToken(p.peekToken) {
+		p.nextToken()
+		version := p.parseVersion()
+		p.skipSemicolon()
+		return nil, version, nil
+	}
+
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil, nil, nil
+	}
+	module := p.parseName()
+	version := p.parseOptionalVersion()
+
+	var imports []ast.Expression
+	if version != nil && p.peekTokenIs(token.COMMA) {
+		// `use Foo 1, 2` imports (1, 2); a version is never followed by a comma
+		imports = append(imports, p.versionAsNumber(version))
+		version = nil
+		p.nextToken()
+		p.nextToken()
+		imports = append(imports, p.parseExpressionList(token.SEMICOLON)...)
+	} else if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		imports = p.parseParenList()
+	} else if !p.peekTokenIs(token.SEMICOLON) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+		imports = p.parseExpressionList(token.SEMICOLON)
+	}
+
+	p.skipSemicolon()
+	return module, version, imports
+}
+
+func (p *parser) parseRequireStatement() ast.Statement {
+	stmt := &ast.RequireStatement{Token: p.curToken}
+	p.nextToken()
+
+	switch {
+	case isVersionToken(p.curToken):
+		stmt.Version = p.parseVersion()
+	case p.curTokenIs(token.IDENTIFIER) && !hasSigil(p.curToken) && !p.peekTokenIs(token.LPAREN):
+		stmt.Module = p.parseName()
+	default:
+		stmt.Value = p.parseExpression(LOWEST)
+		if stmt.Value == nil {
+			return nil
+		}
+	}
+
+	p.skipSemicolon()
+	return stmt
+}
+
+func (p *parser) parsePhaseBlock() ast.Statement {
+	stmt := &ast.PhaseBlock{Token: p.curToken, Phase: string(p.curToken.Literal)}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
+
+func (p *parser) parseSubStatement() ast.Statement {
+	tok := p.curToken
+
+	switch p.peekToken.Type {
+	case token.BEGIN, token.END, token.INIT, token.CHECK, token.UNITCHECK:
+		p.nextToken()
+		return p.parsePhaseBlock()
+	}
+
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	stmt := &ast.SubStatement{Token: tok, Name: p.parseName()}
+	stmt.Attributes = p.parseAttributes()
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		stmt.Signature = p.parseSignature()
+	}
+	// attributes may also follow the signature
+	stmt.Attributes = append(stmt.Attributes, p.parseAttributes()...)
+
+	if !p.peekTokenIs(token.LBRACE) {
+		p.skipSemicolon()
+		return stmt
+	}
+	p.nextToken()
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
+
+func (p *parser) parseMethodStatement() ast.Statement {
+	stmt := &ast.MethodStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	stmt.Name = p.parseName()
+	stmt.Attributes = p.parseAttributes()
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		stmt.Signature = p.parseSignature()
+	}
+	stmt.Attributes = append(stmt.Attributes, p.parseAttributes()...)
+
+	if !p.peekTokenIs(token.LBRACE) {
+		p.skipSemicolon()
+		return stmt
+	}
+	p.nextToken()
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
+
+// isRole reports whether the current token starts a Corinna role,
+// which is declared like a class. Since role isn't a keyword, it must be
+// followed by the role's name and what may follow a class name.
+func (p *parser) isRole() bool {
+	if string(p.curToken.Literal) != "role" || !isTypeName(p.peekToken) {
+		return false
+	}
+	switch next := p.peekAhead(1); {
+	case next.Type == token.LBRACE, next.Type == token.SEMICOLON, isVersionToken(next):
+		return true
+	default:
+		return next.Type == token.IDENTIFIER && strings.HasPrefix(string(next.Literal), ":")
+	}
+}
+
+// parseClassStatement parses a class, or a role.
+func (p *parser) parseClassStatement() ast.Statement {
+	stmt := &ast.ClassStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	stmt.Name = p.parseName()
+	stmt.Version = p.parseOptionalVersion()
+	stmt.Attributes = p.parseAttributes()
+
+	if !p.peekTokenIs(token.LBRACE) {
+		p.skipSemicolon()
+		return stmt
+	}
+	p.nextToken()
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
+
+func (p *parser) parseFieldStatement() ast.Statement {
+	stmt := &ast.FieldStatement{Token: p.curToken}
+
+	stmt.Type = p.parseOptionalType()
+	stmt.Name = p.expectVariable()
+	if stmt.Name == nil {
+		return nil
+	}
+	stmt.Attributes = p.parseAttributes()
+
+	if p.peekTokenIs(token.ASSIGN) || p.peekTokenIs(token.OP_LOGICAL_OR_ASSIGN) || p.peekTokenIs(token.OP_DEFINED_OR_ASSIGN) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+	}
+
+	p.skipSemicolon()
+	return stmt
+}
+
+// parseAttributes collects any `:name` or `:name(args)` attributes
+// following the current token. As in perl, the arguments' ( must
+// directly follow the name.
+func (p *parser) parseAttributes() []*ast.Attribute {
+	var attrs []*ast.Attribute
+	for p.peekTokenIs(token.IDENTIFIER) && strings.HasPrefix(string(p.peekToken.Literal), ":") {
+		p.nextToken()
+		attr := &ast.Attribute{
+			Token: p.curToken,
+			Name:  strings.TrimPrefix(string(p.curToken.Literal), ":"),
+		}
+		if p.peekTokenIs(token.LPAREN) && p.peekToken.Offset == p.curToken.Offset+len(p.curToken.Literal) {
+			// only a ( touching the name holds arguments; after a space
+			// it starts a signature: sub f :lvalue ($x)
+			p.nextToken()
+			attr.Args = p.readRawArgs()
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
+
+// readRawArgs consumes tokens up to the matching ) and returns their
+// literals, since attribute arguments are not perl expressions.
+func (p *parser) readRawArgs() string {
+	open := p.curToken
+	var args []string
+	depth := 0
+	for {
+		p.nextToken()
+		switch {
+		case p.curTokenIs(token.EOF):
+			p.unclosedError(open, ")")
+			return strings.Join(args, " ")
+		case p.curTokenIs(token.RPAREN) && depth == 0:
+			return strings.Join(args, " ")
+		case p.curTokenIs(token.RPAREN):
+			depth--
+		case p.curTokenIs(token.LPAREN):
+			depth++
+		}
+		args = append(args, string(p.curToken.Literal))
+	}
+}
+
+// parseSignature parses a sub's signature with the current token on the
+// (, through the ). As in perl, the last parameter may be followed by a
+// comma.
+func (p *parser) parseSignature() *ast.Signature {
+	sig := &ast.Signature{Token: p.curToken}
+	sig.Parameters = []*ast.Parameter{}
+
+	for !p.peekTokenIs(token.RPAREN) {
+		param := &ast.Parameter{Type: p.parseOptionalType()}
+		param.Name = p.expectVariable()
+		if param.Name == nil {
+			return p.recoverSignature(sig)
+		}
+		if p.peekTokenIs(token.ASSIGN) || p.peekTokenIs(token.OP_LOGICAL_OR_ASSIGN) || p.peekTokenIs(token.OP_DEFINED_OR_ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			param.Default = p.parseExpression(LOWEST)
+		}
+		sig.Parameters = append(sig.Parameters, param)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return p.recoverSignature(sig)
+	}
+	return sig
+}
+
+// recoverSignature recovers from an error in a signature, keeping the
+// parameters parsed before it if the sub's block follows.
+func (p *parser) recoverSignature(sig *ast.Signature) *ast.Signature {
+	if !p.recoverHeader(0) {
+		return nil
+	}
+	return sig
+}
+
+// declaresList reports whether the my, our or state at the current
+// token declares a parenthesised list, after any type annotation.
+func (p *parser) declaresList() bool {
+	if p.peekTokenIs(token.LPAREN) {
+		return true
+	}
+	if !p.peekTypeName() {
+		return false
+	}
+	depth := 0
+	for i := 1; ; i++ {
+		switch t := p.peekAhead(i); t.Type {
+		case token.LBRACKET:
+			depth++
+		case token.RBRACKET:
+			depth--
+		case token.EOF:
+			return false
+		default:
+			if depth == 0 {
+				return t.Type == token.LPAREN
+			}
+		}
+	}
+}
+
+// isTypeName reports whether t can name the type in an annotation: a
+// bareword that isn't an attribute.
+func isTypeName(t token.Token) bool {
+	return t.Type == token.IDENTIFIER && !hasSigil(t) && !strings.HasPrefix(string(t.Literal), ":")
+}
+
+// peekTypeName reports whether the next token starts a type annotation:
+// a bareword followed by its parameters or by what it annotates, so that
+// in `my foo = 1` foo is a missing variable rather than a type.
+func (p *parser) peekTypeName() bool {
+	if !isTypeName(p.peekToken) {
+		return false
+	}
+	next := p.peekAhead(1)
+	return next.Type == token.LBRACKET || next.Type == token.LPAREN ||
+		next.Type == token.IDENTIFIER && hasSigil(next)
+}
+
+// parseOptionalType parses the type annotation following the current
+// token, if there is one.
+func (p *parser) parseOptionalType() *ast.TypeName {
+	if !p.peekTypeName() {
+		return nil
+	}
+	return p.parseTypeName()
+}
+
+// parseTypeName parses the type following the current token: a name,
+// and optionally its parameters in brackets, as in ArrayRef[Str].
+func (p *parser) parseTypeName() *ast.TypeName {
+	p.nextToken()
+	t := &ast.TypeName{Token: p.curToken, Name: string(p.curToken.Literal)}
+	if !p.peekTokenIs(token.LBRACKET) {
+		return t
+	}
+	p.nextToken()
+	for {
+		if !isTypeName(p.peekToken) {
+			d := diagnostics.Errorf(diagnostics.UnexpectedToken, diagnostics.SpanOf(p.peekToken),
+				"expected a type, found %s", describe(p.peekToken))
+			d.Label = "expected a type"
+			p.addError(d)
+			return t
+		}
+		t.Args = append(t.Args, p.parseTypeName())
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	p.expectPeek(token.RBRACKET)
+	return t
+}
+
+// expectVariable advances to the variable named by a declaration.
+func (p *parser) expectVariable() *ast.Variable {
+	if !p.peekTokenIs(token.IDENTIFIER) || !hasSigil(p.peekToken) {
+		d := diagnostics.Errorf(diagnostics.UnexpectedToken, diagnostics.SpanOf(p.peekToken),
+			"expected a variable, found %s", describe(p.peekToken))
+		d.Label = "expected a variable"
+		p.addError(d)
+		return nil
+	}
+	p.nextToken()
+	return ast.NewVariable(p.curToken)
+}
+
+func (p *parser) parseName() *ast.Identifier {
+	return &ast.Identifier{Token: p.curToken, Value: string(p.curToken.Literal)}
+}
+
+func (p *parser) parseOptionalVersion() *ast.VersionLiteral {
+	if !isVersionToken(p.peekToken) {
+		return nil
+	}
+	p.nextToken()
+	return p.parseVersion()
+}
+
+func (p *parser) parseVersion() *ast.VersionLiteral {
+	return &ast.VersionLiteral{Token: p.curToken, Value: string(p.curToken.Literal)}
+}
+
+// versionAsNumber returns what was taken for a version as the number it
+// is; a v-string or dotted version stays a version.
+func (p *parser) versionAsNumber(v *ast.VersionLiteral) ast.Expression {
+	if v.Token.Type == token.VERSION {
+		return v
+	}
+	return p.number(v.Token)
+}
+
+func isVersionToken(t token.Token) bool {
+	switch t.Type {
+	case token.VERSION, token.NUMBER, token.DIGIT:
+		return true
+	default:
+		return false
+	}
+}
+
+// isWord reports whether t is spelled as a bareword, including keywords.
+func isWord(t token.Token) bool {
+	return len(t.Literal) > 0 && (token.IsLetter(t.Literal[0]) || t.Literal[0] == '_')
+}
+
+func hasSigil(t token.Token) bool {
+	return len(t.Literal) > 0 && token.IsSigil(t.Literal[0])
+}
+
+// parseExpressionList parses comma separated expressions starting at the
+// current token until the end token is next. It gives up at the first
+// error, leaving the rest of the statement to synchronize.
+func (p *parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	for {
+		if exp := p.parseExpression(LOWEST); exp != nil {
+			list = append(list, exp)
+		}
+		if p.panicking {
+			return list
+		}
+		if !p.peekTokenIs(token.COMMA) {
+			if !p.peekTokenIs(end) && !p.peekTokenIs(token.EOF) && end != token.SEMICOLON {
+				// a statement's own ; is left to skipSemicolon
+				p.commaError(end)
+				p.skipList(end)
+			}
+			return list
+		}
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+		if p.peekTokenIs(end) || p.peekTokenIs(token.EOF) {
+			return list
+		}
+		p.nextToken()
+	}
+}
+
+// skipList discards the rest of a list after a missing comma, up to the
+// end token that closes it. It stops early at a ; or a closing
+// delimiter that isn't the list's, where the end token must be missing.
+func (p *parser) skipList(end token.TokenType) {
+	depth := 0
+	for !p.peekTokenIs(token.EOF) {
+		switch p.peekToken.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
+// commaError reports a missing comma between the elements of a list
+// closed by end.
+func (p *parser) commaError(end token.TokenType) {
+	d := diagnostics.Errorf(diagnostics.UnexpectedToken, diagnostics.SpanOf(p.peekToken),
+		"expected `,` or %s, found %s", describeType(end), describe(p.peekToken))
+	d.Label = "expected `,`"
+	d.Fix = &diagnostics.Fix{
+		Message:     fmt.Sprintf("insert `,` after `%s`", p.curToken.Literal),
+		Span:        diagnostics.After(p.curToken),
+		Replacement: ",",
+	}
+	p.addError(d)
+}
+
+// parseParenList parses `( LIST )` with the current token on the (.
+func (p *parser) parseParenList() []ast.Expression {
+	return p.parseDelimitedList(token.RPAREN)
+}
+
+// parseDelimitedList parses a possibly empty comma separated list with
+// the current token on the opening delimiter, through the end token.
+func (p *parser) parseDelimitedList(end token.TokenType) []ast.Expression {
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return []ast.Expression{}
+	}
+	p.nextToken()
+	list := p.parseExpressionList(end)
+	if !p.expectPeek(end) {
+		return nil
+	}
+	return list
+}
+
+func (p *parser) parseExpression(precedence int) ast.Expression {
+	prefix := p.prefixParseFns[p.curToken.Type]
+	if isWord(p.curToken) && isFatComma(p.peekToken) {
+		// a word before => is a string, even when it is a keyword
+		prefix = p.parseBareString
+	}
+	if prefix == nil {
+		p.noPrefixParseFnError(p.curToken)
+		return nil
+	}
+	leftExp := prefix()
+
+	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+		infix := p.infixParseFns[p.peekToken.Type]
+		if infix == nil {
+			return leftExp
+		}
+		p.nextToken()
+		leftExp = infix(leftExp)
+	}
+	return leftExp
+}
+
+func (p *parser) parseIdentifier() ast.Expression {
+	if hasSigil(p.curToken) {
+		if isBareSigil(p.curToken) && p.peekTokenIs(token.LBRACE) {
+			return p.parseDereference()
+		}
+		variable := ast.NewVariableExpression(p.curToken)
+		switch {
+		case isCallable(p.curToken) && p.peekTokenIs(token.LPAREN):
+			p.nextToken()
+			call := &ast.CallExpression{Token: p.curToken, Function: variable}
+			call.Arguments = p.parseParenList()
+			return call
+		case isVariable(p.curToken):
+			return p.parseElements(variable, false)
+		}
+		return variable
+	}
+
+	ident := &ast.Identifier{Token: p.curToken, Value: string(p.curToken.Literal)}
+	switch {
+	case p.peekTokenIs(token.LPAREN):
+		p.nextToken()
+		call := &ast.CallExpression{Token: p.curToken, Function: ident}
+		call.Arguments = p.parseParenList()
+		return call
+	case p.peekTokenIs(token.LBRACE) && (blockListOperators[ident.Value] || blockOperators[ident.Value]):
+		return p.parseBlockListOperator(ident)
+	case p.peekTokenIs(token.LBRACE):
+		// any other list operator takes an anonymous hash: bless { ... }
+		call := &ast.CallExpression{Token: p.curToken, Function: ident}
+		call.Arguments = p.parseListOperands()
+		return call
+	case blockListOperators[ident.Value] && p.peekTokenIs(token.PLUS) &&
+		p.peekAhead(1).Type == token.LBRACE:
+		// map +{ ... }, LIST
+		call := &ast.CallExpression{Token: p.curToken, Function: ident}
+		call.Arguments = p.parseListOperands()
+		return call
+	case namedUnaryOperators[ident.Value] && p.peekStartsTerm():
+		call := &ast.CallExpression{Token: p.curToken, Function: ident}
+		p.nextToken()
+		call.Arguments = []ast.Expression{p.parseExpression(LESSGREATER)}
+		return call
+	case filehandleOperators[ident.Value] && p.peekFilehandle():
+		return p.parseFilehandle(ident)
+	case ident.Value == "new" && p.peekIndirectInvocant():
+		return p.parseIndirectMethodCall(ident)
+	case p.peekStartsTerm():
+		call := &ast.CallExpression{Token: p.curToken, Function: ident}
+		call.Arguments = p.parseListOperands()
+		return call
+	case ident.Value == "undef":
+		return &ast.Undef{Token: p.curToken}
+	}
+	return ident
+}
+
+// isBareSigil reports whether t is a sigil without a name, as in @{...}.
+func isBareSigil(t token.Token) bool {
+	switch string(t.Literal) {
+	case "$", "@", "%", "&", "$#":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseDereference parses a sigil followed by a block, which holds an
+// expression giving the reference. A bareword in the braces names a
+// variable instead: ${name} is $name.
+func (p *parser) parseDereference() ast.Expression {
+	sigil, _ := ast.LookupSigil(string(p.curToken.Literal))
+	deref := &ast.Dereference{Token: p.curToken, Sigil: sigil}
+	open := p.peekToken
+	p.nextToken()
+
+	if isWord(p.peekToken) && !isFatComma(p.peekAhead(1)) && p.peekAhead(1).Type == token.RBRACE {
+		p.nextToken()
+		name := p.curToken
+		p.nextToken()
+		variable := ast.NewVariable(token.Token{
+			Type:    token.IDENTIFIER,
+			Literal: append([]byte(deref.Sigil.String()), name.Literal...),
+			Offset:  deref.Token.Offset,
+		})
+		return p.derefElements(variable)
+	}
+
+	p.nextToken()
+	deref.Value = p.parseExpression(LOWEST)
+	if deref.Value == nil {
+		return nil
+	}
+	if !p.peekTokenIs(token.RBRACE) {
+		if p.peekTokenIs(token.EOF) {
+			p.unclosedError(open, "}")
+		} else {
+			p.peekError(token.RBRACE)
+		}
+		return nil
+	}
+	p.nextToken()
+	return p.derefElements(deref)
+}
+
+// derefElements parses what may follow a dereference: the arguments
+// of &{...}(...), or subscripts of the others.
+func (p *parser) derefElements(left ast.Expression) ast.Expression {
+	if deref, ok := left.(*ast.Dereference); ok && deref.Sigil == ast.CodeSigil {
+		if !p.peekTokenIs(token.LPAREN) {
+			return left
+		}
+		p.nextToken()
+		call := &ast.CallExpression{Token: p.curToken, Function: left}
+		call.Arguments = p.parseParenList()
+		return call
+	}
+	if v, ok := left.(*ast.Variable); ok && v.Sigil == ast.CodeSigil {
+		return left
+	}
+	return p.parseElements(left, false)
+}
+
+// parseGlobDereference parses *{...}; other uses of a leading * aren't
+// supported.
+func (p *parser) parseGlobDereference() ast.Expression {
+	if !p.peekTokenIs(token.LBRACE) {
+		p.noPrefixParseFnError(p.curToken)
+		return nil
+	}
+	deref := &ast.Dereference{Token: p.curToken, Sigil: ast.GlobSigil}
+	p.nextToken()
+	p.nextToken()
+	deref.Value = p.parseExpression(LOWEST)
+	if deref.Value == nil || !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return deref
+}
+
+// isFatComma reports whether t is =>, which the lexer returns as a comma.
+func isFatComma(t token.Token) bool {
+	return t.Type == token.COMMA && string(t.Literal) == "=>"
+}
+
+// blockListOperators take an optional leading block: `map BLOCK LIST`.
+var blockListOperators = map[string]bool{
+	"map":  true,
+	"grep": true,
+	"sort": true,
+}
+
+// blockOperators take a block, never an anonymous hash, when a {
+// follows them: `eval { ... }` or `print { $fh } LIST`.
+var blockOperators = map[string]bool{
+	"do": true, "eval": true, "exec": true, "print": true, "printf": true,
+	"say": true, "system": true,
+}
+
+// namedUnaryOperators take a single argument that binds tighter than
+// comparison: `defined $x && $y` is `defined($x) && $y`.
+var namedUnaryOperators = map[string]bool{
+	"abs": true, "chdir": true, "chomp": true, "chop": true, "chr": true,
+	"defined": true, "delete": true, "each": true, "exists": true,
+	"exit": true, "fc": true, "hex": true, "int": true, "keys": true,
+	"lc": true, "lcfirst": true, "length": true, "oct": true, "ord": true,
+	"pop": true, "quotemeta": true, "ref": true, "scalar": true,
+	"shift": true, "uc": true, "ucfirst": true, "undef": true,
+	"values": true,
+}
+
+// filehandleOperators may be given a filehandle before their list, as
+// in `print STDERR LIST` or `print $fh LIST`.
+var filehandleOperators = map[string]bool{"print": true, "printf": true, "say": true}
+
+// peekFilehandle reports whether the next token is a filehandle: a
+// bareword followed by a term, or in capitals on its own, or a scalar
+// followed by a term other than a subscript.
+func (p *parser) peekFilehandle() bool {
+	next := p.peekAhead(1)
+	lit := string(p.peekToken.Literal)
+	switch {
+	case isTypeName(p.peekToken):
+		return startsTerm(next) || endsList(next) && lit == strings.ToUpper(lit)
+	case isVariable(p.peekToken) && lit[0] == '$':
+		return startsTerm(next) && next.Type != token.LBRACKET
+	default:
+		return false
+	}
+}
+
+// parseFilehandle parses print, printf or say given a filehandle, which
+// is kept as their block, as though written `print {STDERR} LIST`.
+func (p *parser) parseFilehandle(ident *ast.Identifier) ast.Expression {
+	call := &ast.CallExpression{Token: p.curToken, Function: ident}
+	p.nextToken()
+	var handle ast.Expression = p.parseName()
+	if hasSigil(p.curToken) {
+		handle = ast.NewVariableExpression(p.curToken)
+	}
+	call.Block = &ast.BlockStatement{
+		Token:      p.curToken,
+		Statements: []ast.Statement{&ast.ExpressionStatement{Token: p.curToken, Expression: handle}},
+	}
+	call.Arguments = []ast.Expression{}
+	if !endsList(p.peekToken) {
+		call.Arguments = p.parseListOperands()
+	}
+	return call
+}
+
+// peekIndirectInvocant reports whether the next token is the class of
+// an indirect method call, as in `new Foo(1)`: a capitalised bareword
+// that isn't a hash key.
+func (p *parser) peekIndirectInvocant() bool {
+	lit := p.peekToken.Literal
+	return isTypeName(p.peekToken) && lit[0] >= 'A' && lit[0] <= 'Z' && !isFatComma(p.peekAhead(1))
+}
+
+// parseIndirectMethodCall parses the indirect object syntax `new Class`,
+// `new Class(LIST)` or `new Class LIST`, giving the same call as
+// Class->new.
+func (p *parser) parseIndirectMethodCall(method *ast.Identifier) ast.Expression {
+	call := &ast.MethodCall{Token: p.curToken, Method: method}
+	p.nextToken()
+	call.Invocant = p.parseName()
+	switch {
+	case p.peekTokenIs(token.LPAREN):
+		p.nextToken()
+		call.Arguments = p.parseParenList()
+	case p.peekStartsTerm():
+		call.Arguments = p.parseListOperands()
+	}
+	return call
+}
+
+// parseBlockListOperator parses an operator that may take a block
+// followed by a {. After map, grep and sort it guesses as perl does
+// whether the { opens a block or an anonymous hash; after the others it
+// always opens a block.
+func (p *parser) parseBlockListOperator(ident *ast.Identifier) ast.Expression {
+	call := &ast.CallExpression{Token: p.curToken, Function: ident}
+
+	if blockListOperators[ident.Value] && looksLikeAnonHash(p.peekAhead(1), p.peekAhead(2)) {
+		// map { "a" => 1 }, LIST
+		call.Arguments = p.parseListOperands()
+		return call
+	}
+
+	p.nextToken()
+	call.Block = p.parseBlockStatement()
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+	}
+	call.Arguments = []ast.Expression{}
+	if !endsList(p.peekToken) {
+		call.Arguments = p.parseListOperands()
+	}
+	return call
+}
+
+// looksLikeAnonHash applies perl's guess for a { that could start either
+// a block or an anonymous hash, given the two tokens following it: an
+// empty {} or a leading word or string followed by , or => is a hash.
+func looksLikeAnonHash(first, second token.Token) bool {
+	switch {
+	case first.Type == token.RBRACE:
+		return true
+	case isWord(first) || first.Type == token.STRING:
+		return second.Type == token.COMMA
+	default:
+		return false
+	}
+}
+
+// startsTerm reports whether t can only begin an operand, so a bareword
+// before it must be a list operator call without parentheses.
+func startsTerm(t token.Token) bool {
+	switch t.Type {
+	case token.STRING, token.QW, token.DIGIT, token.NUMBER, token.LBRACKET:
+		return true
+	case token.IDENTIFIER:
+		return hasSigil(t) && len(t.Literal) > 1
+	default:
+		return false
+	}
+}
+
+// peekStartsTerm reports whether the next token can only begin an
+// operand, as startsTerm does, counting a dereference such as @{...}.
+func (p *parser) peekStartsTerm() bool {
+	return startsTerm(p.peekToken) || isBareSigil(p.peekToken) && p.peekAhead(1).Type == token.LBRACE
+}
+
+// endsList reports whether t closes a list operator's arguments.
+func endsList(t token.Token) bool {
+	switch t.Type {
+	case token.SEMICOLON, token.RPAREN, token.RBRACE, token.RBRACKET, token.EOF,
+		token.COLON, token.IF, token.UNLESS, token.WHILE, token.UNTIL,
+		token.FOR, token.FOREACH:
+		return true
+	}
+	return precedenceOf(t) > LOWEST && precedenceOf(t) < LOWNOT
+}
+
+// parseListOperands parses the comma separated arguments of a list
+// operator, which extend up to a low precedence and/or/xor.
+func (p *parser) parseListOperands() []ast.Expression {
+	list := []ast.Expression{}
+	for {
+		p.nextToken()
+		if exp := p.parseExpression(LOWNOT); exp != nil {
+			list = append(list, exp)
+		}
+		if !p.peekTokenIs(token.COMMA) {
+			return list
+		}
+		p.nextToken()
+		if endsList(p.peekToken) {
+			return list
+		}
+	}
+}
+
+// listValue collapses a single element list to that element; longer
+// lists become a ListLiteral introduced by tok.
+func listValue(tok token.Token, list []ast.Expression) ast.Expression {
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	default:
+		return &ast.ListLiteral{Token: tok, Elements: list}
+	}
+}
+
+// isCallable reports whether t names a sub that can be called with
+// parentheses: a bareword or an &name.
+func isCallable(t token.Token) bool {
+	return !hasSigil(t) || (t.Literal[0] == '&' && len(t.Literal) > 1)
+}
+
+// isVariable reports whether t is a named scalar, array or hash, which
+// may be followed directly by element subscripts.
+func isVariable(t token.Token) bool {
+	if len(t.Literal) < 2 {
+		return false
+	}
+	switch t.Literal[0] {
+	case '$', '@', '%':
+		return string(t.Literal) != "$#"
+	default:
+		return false
+	}
+}
+
+// parseElements parses a sequence of [...] and {...} subscripts following
+// left. Every subscript after the first goes through a reference, so it
+// is marked as an arrow subscript even when the arrow is omitted.
+func (p *parser) parseElements(left ast.Expression, arrow bool) ast.Expression {
+	for p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		index := &ast.Index{Token: p.curToken, Left: left, Arrow: arrow}
+
+		end := token.TokenType(token.RBRACKET)
+		if index.IsHash() {
+			end = token.RBRACE
+		}
+		p.nextToken()
+		if index.IsHash() && isWord(p.curToken) && p.peekTokenIs(token.RBRACE) {
+			// {word} is always a string key, even when word is a keyword
+			index.Index = ast.NewBareString(p.curToken)
+		} else {
+			// a slice's subscript is a list: @x[0, 1]
+			index.Index = listValue(index.Token, p.parseExpressionList(end))
+		}
+		if !p.expectPeek(end) {
+			return nil
+		}
+		left = index
+		arrow = true
+	}
+	return left
+}
+
+// parseArrowExpression parses the right hand side of ->: a code call, a
+// subscript, a postfix dereference or slice, or a method call.
+func (p *parser) parseArrowExpression(left ast.Expression) ast.Expression {
+	arrow := p.curToken
+
+	switch p.peekToken.Type {
+	case token.LPAREN:
+		p.nextToken()
+		call := &ast.CallExpression{Token: arrow, Function: left, Arrow: true}
+		call.Arguments = p.parseParenList()
+		return p.parseElements(call, true)
+	case token.LBRACKET, token.LBRACE:
+		return p.parseElements(left, true)
+	case token.OP_POWER:
+		p.nextToken()
+		return &ast.PostfixDeref{Token: p.curToken, Left: left, Sigil: ast.GlobSigil}
+	default:
+		if !p.peekTokenIs(token.IDENTIFIER) && !isWord(p.peekToken) {
+			d := diagnostics.Errorf(diagnostics.UnexpectedToken, diagnostics.SpanOf(p.peekToken),
+				"expected method or dereference after `->`, found %s", describe(p.peekToken))
+			d.Label = "expected method or dereference"
+			d.Labels = []diagnostics.Label{{Span: diagnostics.SpanOf(arrow), Message: "after this arrow"}}
+			p.addError(d)
+			return nil
+		}
+		p.nextToken()
+	}
+
+	lit := string(p.curToken.Literal)
+	switch {
+	case isPostfixDeref(lit):
+		sigil, _ := ast.LookupSigil(strings.TrimSuffix(lit, "*"))
+		return &ast.PostfixDeref{Token: p.curToken, Left: left, Sigil: sigil}
+	case (lit == "@" || lit == "%") && (p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE)):
+		return p.parsePostfixSlice(left)
+	case hasSigil(p.curToken) && p.curToken.Literal[0] != '$':
+		d := diagnostics.Errorf(diagnostics.UnexpectedToken, diagnostics.SpanOf(p.curToken),
+			"unexpected `%s` after `->`", lit)
+		d.Label = "not a method or dereference"
+		p.addError(d)
+		return nil
+	}
+
+	call := &ast.MethodCall{Token: arrow, Invocant: left, Method: p.parseName()}
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		call.Arguments = p.parseParenList()
+	}
+	return call
+}
+
+func isPostfixDeref(lit string) bool {
+	switch lit {
+	case "$*", "@*", "%*", "&*", "$#*":
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *parser) parsePostfixSlice(left ast.Expression) ast.Expression {
+	sigil, _ := ast.LookupSigil(string(p.curToken.Literal))
+	slice := &ast.PostfixSlice{
+		Token: p.curToken,
+		Left:  left,
+		Sigil: sigil,
+	}
+
+	p.nextToken()
+	slice.Bracket = p.curToken
+	end := token.TokenType(token.RBRACKET)
+	if p.curTokenIs(token.LBRACE) {
+		end = token.RBRACE
+	}
+	p.nextToken()
+	slice.Index = listValue(slice.Bracket, p.parseExpressionList(end))
+	if !p.expectPeek(end) {
+		return nil
+	}
+	return slice
+}
+
+func (p *parser) parseNumberLiteral() ast.Expression {
+	return p.number(p.curToken)
+}
+
+// number converts a DIGIT or NUMBER token. A bad number is reported but
+// doesn't upset the parse, so the parser carries on without recovering.
+func (p *parser) number(t token.Token) ast.Expression {
+	n, err := ast.NewNumber(t)
+	if err != nil && !p.panicking {
+		d := diagnostics.Errorf(diagnostics.InvalidNumber, diagnostics.SpanOf(t), "%v", err)
+		d.Label = "invalid number"
+		p.errors = append(p.errors, d)
+	}
+	return n
+}
+
+func (p *parser) parseBooleanLiteral() ast.Expression {
+	return &ast.BooleanLiteral{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+func (p *parser) parseVersionLiteral() ast.Expression {
+	return p.parseVersion()
+}
+
+func (p *parser) parseStringLiteral() ast.Expression {
+	s := ast.NewStringLiteral(p.curToken)
+	if s.Interpolates() {
+		s.Parts = p.parseInterpolated(s.Token)
+	}
+	return s
+}
+
+func (p *parser) parseBareString() ast.Expression {
+	return ast.NewBareString(p.curToken)
+}
+
+func (p *parser) parseQuoteWords() ast.Expression {
+	return ast.NewQuoteWords(p.curToken)
+}
+
+// parseGroupedExpression parses a parenthesised expression, which is a
+// ListLiteral when it is empty or contains a comma.
+func (p *parser) parseGroupedExpression() ast.Expression {
+	tok := p.curToken
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return p.parseElements(&ast.ListLiteral{Token: tok, Elements: []ast.Expression{}}, false)
+	}
+
+	p.nextToken()
+	elements := p.parseExpressionList(token.RPAREN)
+	var exp ast.Expression = &ast.ListLiteral{Token: tok, Elements: elements}
+	if len(elements) == 1 && !p.curTokenIs(token.COMMA) {
+		// no comma, so just parentheses for grouping
+		exp = elements[0]
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	// (LIST)[...] is a list slice
+	return p.parseElements(exp, false)
+}
+
+func (p *parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseDelimitedList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+	return array
+}
+
+// parseHashLiteral parses { ... } where a term is expected. Statement
+// level braces are blocks and never reach here.
+func (p *parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Elements = p.parseDelimitedList(token.RBRACE)
+	if hash.Elements == nil {
+		return nil
+	}
+	return hash
+}
+
+func (p *parser) parsePrefixExpression() ast.Expression {
+	expression := &ast.PrefixExpression{
+		Token:    p.curToken,
+		Operator: string(p.curToken.Literal),
+	}
+
+	precedence := PREFIX
+	switch {
+	case isIncDec(p.curToken):
+		precedence = INCDEC
+	case p.curTokenIs(token.OP_LOGICAL_NOT_LOW_PRECEDENCE):
+		precedence = LOWNOT
+	}
+
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+	return expression
+}
+
+func (p *parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	if isIncDec(p.curToken) {
+		return p.parsePostfixExpression(left)
+	}
+
+	expression := &ast.InfixExpression{
+		Token:    p.curToken,
+		Operator: string(p.curToken.Literal),
+		Left:     left,
+	}
+
+	precedence := p.curPrecedence()
+	if rightAssociative[precedence] {
+		precedence--
+	}
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+	return expression
+}
+
+func (p *parser) parsePostfixExpression(left ast.Expression) ast.Expression {
+	return &ast.PostfixExpression{
+		Token:    p.curToken,
+		Left:     left,
+		Operator: string(p.curToken.Literal),
+	}
+}
+
+func (p *parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{Token: p.curToken, Condition: condition}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(TERNARY)
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+	p.nextToken()
+	expression.Alternative = p.parseExpression(TERNARY - 1)
+	return expression
+}
+
+// isIncDec reports whether t is ++ or --; the lexer currently emits ++
+// as PLUS.
+func isIncDec(t token.Token) bool {
+	lit := string(t.Literal)
+	return lit == "++" || lit == "--"
+}
+
+// skipSemicolon consumes the ; that ends a statement, which may only be
+// left out before a } or the end of the input.
+func (p *parser) skipSemicolon() {
+	switch {
+	case p.peekTokenIs(token.SEMICOLON):
+		p.nextToken()
+	case !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF):
+		p.peekError(token.SEMICOLON)
+	}
+}
+
+func (p *parser) peekPrecedence() int {
+	return precedenceOf(p.peekToken)
+}
+
+func (p *parser) curPrecedence() int {
+	return precedenceOf(p.curToken)
+}
+
+func precedenceOf(t token.Token) int {
+	if isIncDec(t) {
+		return INCDEC
+	}
+	if t.Type == token.IDENTIFIER && string(t.Literal) == "x" {
+		return PRODUCT
+	}
+	if p, ok := precedences[t.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 func (p *parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -1,9 +1,12 @@
 package parser_test
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
 	"github.com/perigrin/simian/lexer"
 	"github.com/perigrin/simian/parser"
 )
@@ -53,8 +56,8 @@ func testMyStatement(t *testing.T, s ast.Statement, name string) bool {
 		t.Errorf("s not *ast.MyStatement: got %T", s)
 		return false
 	}
-	if myStmt.Name.Value != name {
-		t.Errorf("myStmt.Name.Value != '%s': got %s", name, myStmt.Name.Value)
+	if myStmt.Name.String() != name {
+		t.Errorf("myStmt.Name.String() != '%s': got %s", name, myStmt.Name.String())
 		return false
 	}
 	if myStmt.Name.TokenLiteral() != name {
@@ -76,3 +79,1182 @@ func checkParseErrors(t *testing.T, p parser.Parser) {
 	}
 	t.FailNow()
 }
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	l := lexer.New([]byte(input))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+	return program
+}
+
+func TestPackageStatements(t *testing.T) {
+	input := `
+	package Foo;
+	package Foo::Bar 1.23;
+	package Baz v1.2.3 {
+		my $x = 1;
+	}
+	`
+	program := parse(t, input)
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(program.Statements))
+	}
+
+	tests := []struct {
+		name    string
+		version string
+		block   bool
+	}{
+		{"Foo", "", false},
+		{"Foo::Bar", "1.23", false},
+		{"Baz", "v1.2.3", true},
+	}
+
+	for i, tt := range tests {
+		var (
+			name    *ast.Identifier
+			version *ast.VersionLiteral
+		)
+		switch stmt := program.Statements[i].(type) {
+		case *ast.PackageDeclaration:
+			if tt.block {
+				t.Fatalf("tests[%d]: expected *ast.PackageStatement, got %T", i, stmt)
+			}
+			name, version = stmt.Name, stmt.Version
+		case *ast.PackageStatement:
+			if !tt.block {
+				t.Fatalf("tests[%d]: expected *ast.PackageDeclaration, got %T", i, stmt)
+			}
+			if len(stmt.Body.Statements) != 1 {
+				t.Fatalf("tests[%d]: expected 1 statement in block, got %d", i, len(stmt.Body.Statements))
+			}
+			name, version = stmt.Name, stmt.Version
+		default:
+			t.Fatalf("tests[%d]: unexpected statement %T", i, stmt)
+		}
+
+		if name.Value != tt.name {
+			t.Errorf("tests[%d]: name wrong, expected %q got %q", i, tt.name, name.Value)
+		}
+		testVersion(t, version, tt.version)
+	}
+}
+
+func TestUseStatements(t *testing.T) {
+	tests := []struct {
+		input   string
+		module  string
+		version string
+		imports []string
+	}{
+		{"use strict;", "strict", "", nil},
+		{"use v5.36;", "", "v5.36", nil},
+		{"use 5.036;", "", "5.036", nil},
+		{"use Foo 1.2 qw(a b);", "Foo", "1.2", []string{"qw(a b)"}},
+		{"use Foo ();", "Foo", "", []string{}},
+		{"use Foo 'a', \"b\";", "Foo", "", []string{"'a'", "\"b\""}},
+		{"use Foo ('a', 'b');", "Foo", "", []string{"'a'", "'b'"}},
+		{"use Foo 1, 2;", "Foo", "", []string{"1", "2"}},
+		{"use constant PI => 3.14;", "constant", "", []string{"PI", "3.14"}},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if len(program.Statements) != 1 {
+			t.Fatalf("%s: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.UseStatement)
+		if !ok {
+			t.Fatalf("%s: expected *ast.UseStatement, got %T", tt.input, program.Statements[0])
+		}
+		testModuleImport(t, tt.input, stmt.Module, stmt.Version, stmt.Imports, tt.module, tt.version, tt.imports)
+	}
+}
+
+func TestNoStatements(t *testing.T) {
+	program := parse(t, "no strict 'refs';\nno v5.10;")
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.NoStatement)
+	if !ok {
+		t.Fatalf("expected *ast.NoStatement, got %T", program.Statements[0])
+	}
+	testModuleImport(t, "no strict", stmt.Module, stmt.Version, stmt.Imports, "strict", "", []string{"'refs'"})
+
+	stmt, ok = program.Statements[1].(*ast.NoStatement)
+	if !ok {
+		t.Fatalf("expected *ast.NoStatement, got %T", program.Statements[1])
+	}
+	testModuleImport(t, "no v5.10", stmt.Module, stmt.Version, stmt.Imports, "", "v5.10", nil)
+}
+
+func TestRequireStatements(t *testing.T) {
+	input := `
+	require Foo::Bar;
+	require 5.006;
+	require "file.pl";
+	`
+	program := parse(t, input)
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(program.Statements))
+	}
+
+	module := program.Statements[0].(*ast.RequireStatement)
+	if module.Module == nil || module.Module.Value != "Foo::Bar" {
+		t.Errorf("expected module Foo::Bar, got %+v", module.Module)
+	}
+
+	version := program.Statements[1].(*ast.RequireStatement)
+	testVersion(t, version.Version, "5.006")
+
+	file := program.Statements[2].(*ast.RequireStatement)
+	str, ok := file.Value.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.StringLiteral, got %T", file.Value)
+	}
+	if str.Value != "file.pl" || !str.Interpolated {
+		t.Errorf("expected interpolated \"file.pl\", got %+v", str)
+	}
+}
+
+func TestPhaseBlocks(t *testing.T) {
+	input := `
+	BEGIN { my $x = 1; }
+	sub END { }
+	INIT { }
+	CHECK { }
+	UNITCHECK { }
+	`
+	program := parse(t, input)
+
+	phases := []string{"BEGIN", "END", "INIT", "CHECK", "UNITCHECK"}
+	if len(program.Statements) != len(phases) {
+		t.Fatalf("expected %d statements, got %d", len(phases), len(program.Statements))
+	}
+	for i, phase := range phases {
+		stmt, ok := program.Statements[i].(*ast.PhaseBlock)
+		if !ok {
+			t.Fatalf("tests[%d]: expected *ast.PhaseBlock, got %T", i, program.Statements[i])
+		}
+		if stmt.Phase != phase {
+			t.Errorf("tests[%d]: expected phase %s, got %s", i, phase, stmt.Phase)
+		}
+		if stmt.Body == nil {
+			t.Errorf("tests[%d]: missing body", i)
+		}
+	}
+}
+
+func TestSubStatements(t *testing.T) {
+	input := `
+	sub add($x, $y = 0) { $x + $y }
+	sub forward;
+	sub lv :lvalue { }
+	`
+	program := parse(t, input)
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(program.Statements))
+	}
+
+	add := program.Statements[0].(*ast.SubStatement)
+	if add.Name.Value != "add" {
+		t.Errorf("expected name add, got %s", add.Name.Value)
+	}
+	if len(add.Signature.Parameters) != 2 {
+		t.Fatalf("expected 2 parameters, got %d", len(add.Signature.Parameters))
+	}
+	if add.Signature.Parameters[1].Default == nil {
+		t.Errorf("expected default for $y")
+	}
+	if len(add.Body.Statements) != 1 {
+		t.Errorf("expected 1 statement in body, got %d", len(add.Body.Statements))
+	}
+
+	forward := program.Statements[1].(*ast.SubStatement)
+	if forward.Body != nil {
+		t.Errorf("expected forward declaration to have no body")
+	}
+
+	lv := program.Statements[2].(*ast.SubStatement)
+	if len(lv.Attributes) != 1 || lv.Attributes[0].Name != "lvalue" {
+		t.Errorf("expected :lvalue attribute, got %+v", lv.Attributes)
+	}
+}
+
+func TestAttributesBeforeSignatures(t *testing.T) {
+	tests := []struct {
+		input      string
+		attributes string
+		parameters int
+	}{
+		{"sub f :lvalue ($a, $b) { }", ":lvalue", 2},
+		{"sub f :prototype($) ($a) { }", ":prototype($)", 1},
+		{"sub f :lvalue :method ($a) { }", ":lvalue :method", 1},
+		{"class C { method m :common ($x) { } }", ":common", 1},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		var attrs []*ast.Attribute
+		var sig *ast.Signature
+		ast.Inspect(program, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SubStatement:
+				attrs, sig = n.Attributes, n.Signature
+			case *ast.MethodStatement:
+				attrs, sig = n.Attributes, n.Signature
+			}
+			return true
+		})
+		var got []string
+		for _, a := range attrs {
+			got = append(got, a.String())
+		}
+		if strings.Join(got, " ") != tt.attributes {
+			t.Errorf("%s: expected attributes %s, got %s", tt.input, tt.attributes, strings.Join(got, " "))
+		}
+		if sig == nil || len(sig.Parameters) != tt.parameters {
+			t.Errorf("%s: expected %d parameters, got %v", tt.input, tt.parameters, sig)
+		}
+
+		// the attributes are written before the signature, which must
+		// read back the same way
+		if again := parse(t, program.String()).String(); again != program.String() {
+			t.Errorf("%s: %q reads back as %q", tt.input, program.String(), again)
+		}
+	}
+}
+
+func TestClassStatements(t *testing.T) {
+	input := `
+	class Foo 1.0 :isa(Bar) {
+		field $id :param :reader = 1;
+		field @items;
+
+		method set_count($i) { $count = $i }
+	}
+	`
+	program := parse(t, input)
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(program.Statements))
+	}
+
+	class, ok := program.Statements[0].(*ast.ClassStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ClassStatement, got %T", program.Statements[0])
+	}
+	testVersion(t, class.Version, "1.0")
+	if len(class.Attributes) != 1 || class.Attributes[0].Name != "isa" || class.Attributes[0].Args != "Bar" {
+		t.Errorf("expected :isa(Bar), got %+v", class.Attributes)
+	}
+	if len(class.Body.Statements) != 3 {
+		t.Fatalf("expected 3 statements in class body, got %d", len(class.Body.Statements))
+	}
+
+	id := class.Body.Statements[0].(*ast.FieldStatement)
+	if id.Name.Sigil != ast.ScalarSigil || id.Name.Name != "id" || len(id.Attributes) != 2 || id.Value == nil {
+		t.Errorf("unexpected field %+v", id)
+	}
+
+	method := class.Body.Statements[2].(*ast.MethodStatement)
+	if method.Name.Value != "set_count" || len(method.Signature.Parameters) != 1 {
+		t.Errorf("unexpected method %+v", method)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"role Greets :does(Named) { method name; method greet { } }", "role Greets :does(Named) { method name; method greet {} }"},
+		{"role Printable;", "role Printable"},
+		{"role(1); my $role = role;", "role(1);\nmy $role = role"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+	if role, ok := parse(t, "role R { }").Statements[0].(*ast.ClassStatement); !ok || !role.IsRole() {
+		t.Errorf("expected a role, got %+v", role)
+	}
+}
+
+func TestLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ast.Expression
+	}{
+		{"42;", &ast.IntegerLiteral{Value: 42}},
+		{"1_000_000;", &ast.IntegerLiteral{Value: 1000000}},
+		{"0755;", &ast.IntegerLiteral{Value: 0755}},
+		{"1.5;", &ast.NumberLiteral{Value: 1.5}},
+		{"99999999999999999999;", &ast.NumberLiteral{Value: 1e20}},
+		{"1e3;", &ast.NumberLiteral{Value: 1000}},
+		{"1.5E-2;", &ast.NumberLiteral{Value: 0.015}},
+		{"0x1F;", &ast.IntegerLiteral{Value: 31}},
+		{"0b101;", &ast.IntegerLiteral{Value: 5}},
+		{"true;", &ast.BooleanLiteral{Value: true}},
+		{"false;", &ast.BooleanLiteral{Value: false}},
+		{"undef;", &ast.Undef{}},
+		{"'a b';", &ast.StringLiteral{Value: "a b"}},
+		{`"a $b";`, &ast.StringLiteral{Value: "a $b", Interpolated: true}},
+		{`"a\t$b\n";`, &ast.StringLiteral{Value: `a\t$b\n`, Interpolated: true}},
+		{`"a\t\$b\x{263A}\101\n";`, &ast.StringLiteral{Value: "a\t$b\u263aA\n", Interpolated: true}},
+		{`'it\'s \\ \n';`, &ast.StringLiteral{Value: `it's \ \n`}},
+		{`q{a \} b};`, &ast.StringLiteral{Value: "a } b"}},
+		{"$x;", &ast.Variable{Sigil: ast.ScalarSigil, Name: "x"}},
+		{"@Foo::list;", &ast.Variable{Sigil: ast.ArraySigil, Name: "Foo::list"}},
+		{"%h;", &ast.Variable{Sigil: ast.HashSigil, Name: "h"}},
+		{"&f;", &ast.Variable{Sigil: ast.CodeSigil, Name: "f"}},
+		{"$#list;", &ast.Variable{Sigil: ast.LastIndexSigil, Name: "list"}},
+		{"$$;", &ast.Variable{Sigil: ast.ScalarSigil, Name: "$"}},
+		{"@$ref;", &ast.Dereference{Sigil: ast.ArraySigil, Value: &ast.Variable{Sigil: ast.ScalarSigil, Name: "ref"}}},
+		{"$#$ref;", &ast.Dereference{Sigil: ast.LastIndexSigil, Value: &ast.Variable{Sigil: ast.ScalarSigil, Name: "ref"}}},
+		{"$$$ref;", &ast.Dereference{Sigil: ast.ScalarSigil, Value: &ast.Dereference{Sigil: ast.ScalarSigil, Value: &ast.Variable{Sigil: ast.ScalarSigil, Name: "ref"}}}},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		got := program.Statements[0].(*ast.ExpressionStatement).Expression
+		switch expected := tt.expected.(type) {
+		case *ast.IntegerLiteral:
+			n, ok := got.(*ast.IntegerLiteral)
+			if !ok || n.Value != expected.Value {
+				t.Errorf("%s: expected integer %d, got %#v", tt.input, expected.Value, got)
+			}
+		case *ast.NumberLiteral:
+			n, ok := got.(*ast.NumberLiteral)
+			if !ok || n.Value != expected.Value {
+				t.Errorf("%s: expected number %g, got %#v", tt.input, expected.Value, got)
+			}
+		case *ast.BooleanLiteral:
+			b, ok := got.(*ast.BooleanLiteral)
+			if !ok || b.Value != expected.Value {
+				t.Errorf("%s: expected %t, got %#v", tt.input, expected.Value, got)
+			}
+		case *ast.Undef:
+			if _, ok := got.(*ast.Undef); !ok {
+				t.Errorf("%s: expected undef, got %#v", tt.input, got)
+			}
+		case *ast.StringLiteral:
+			s, ok := got.(*ast.StringLiteral)
+			if !ok || s.Value != expected.Value || s.Interpolated != expected.Interpolated {
+				t.Errorf("%s: expected string %q, got %#v", tt.input, expected.Value, got)
+			}
+		case *ast.Variable:
+			v, ok := got.(*ast.Variable)
+			if !ok || v.Sigil != expected.Sigil || v.Name != expected.Name {
+				t.Errorf("%s: expected %s variable %q, got %#v", tt.input, expected.Sigil, expected.Name, got)
+			}
+			if ok && v.String() != v.TokenLiteral() {
+				t.Errorf("%s: variable prints as %s", tt.input, v)
+			}
+		case *ast.Dereference:
+			if got.String() != expected.String() {
+				t.Errorf("%s: expected %s, got %#v", tt.input, expected, got)
+			}
+			if _, ok := got.(*ast.Dereference); !ok {
+				t.Errorf("%s: expected a dereference, got %T", tt.input, got)
+			}
+		}
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`"a $b";`, []string{"$b@3"}},
+		{`"$x @list $h{key} $r->[0]{a} ${name} @{$r}";`, []string{"$x@1", "@list@4", "$h{key}@10", "$r->[0]->{a}@18", "$name@29", "@{$r}@37"}},
+		{`qq{$x-$y};`, []string{"$x@3", "$y@6"}},
+		{`"\$x $1 a@b.com";`, []string{"$1@5", "@b@9"}},
+		{`"$x->method $";`, []string{"$x@1"}},
+		{`"@x[1, 2] $y[";`, []string{"@x[1, 2]@1", "$y@10"}},
+		{`"@h{'a','b'} $z";`, []string{"@h{'a', 'b'}@1", "$z@13"}},
+		{`"\U$x\E";`, []string{"$x@3"}},
+		{`"no vars";`, nil},
+		{`'$x';`, nil},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		s, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("%s: expected a string, got %s", tt.input, program.Statements[0])
+		}
+		var got []string
+		for _, e := range s.Parts {
+			got = append(got, fmt.Sprintf("%s@%d", e, ast.SpanOf(e).Start))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("%s: expected %v, got %v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBarewordStrings(t *testing.T) {
+	program := parse(t, "my %h = (name => 1, no => 2, if => 3); $h{if}; undef $x;")
+
+	list := program.Statements[0].(*ast.MyStatement).Value.(*ast.ListLiteral)
+	for i, word := range []string{"name", "no", "if"} {
+		if key, ok := list.Elements[2*i].(*ast.StringLiteral); !ok || key.Value != word {
+			t.Errorf("expected the word before => to be a string, got %#v", list.Elements[2*i])
+		}
+	}
+
+	index := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.Index)
+	if key, ok := index.Index.(*ast.StringLiteral); !ok || key.Value != "if" {
+		t.Errorf("expected the hash key to be a string, got %#v", index.Index)
+	}
+
+	// undef with an operand is a call
+	call, ok := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if !ok || call.Function.String() != "undef" || len(call.Arguments) != 1 {
+		t.Errorf("expected a call to undef, got %#v", program.Statements[2])
+	}
+}
+
+func TestInfixExpressions(t *testing.T) {
+	program := parse(t, "1 + 2 * 3;")
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+
+	sum, ok := stmt.Expression.(*ast.InfixExpression)
+	if !ok || sum.Operator != "+" {
+		t.Fatalf("expected + at the root, got %+v", stmt.Expression)
+	}
+	product, ok := sum.Right.(*ast.InfixExpression)
+	if !ok || product.Operator != "*" {
+		t.Fatalf("expected * on the right, got %+v", sum.Right)
+	}
+}
+
+func TestOperatorPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3 - 4", "((1 + (2 * 3)) - 4)"},
+		{"-$a * $b", "((-$a) * $b)"},
+		{"!$a", "(!$a)"},
+		{"$a + $b + $c", "(($a + $b) + $c)"},
+		{"$a ** $b ** $c", "($a ** ($b ** $c))"},
+		{"-$a ** 2", "(-($a ** 2))"},
+		{"$a * $b / $c % $d", "((($a * $b) / $c) % $d)"},
+		{"$a . $b x 3", "($a . ($b x 3))"},
+		{"$a << 1 + 2", "($a << (1 + 2))"},
+		{"$a < $b == $c > $d", "(($a < $b) == ($c > $d))"},
+		{"$a lt $b eq $c", "(($a lt $b) eq $c)"},
+		{"$a & $b | $c ^ $d", "((($a & $b) | $c) ^ $d)"},
+		{"$a && $b || $c // $d", "((($a && $b) || $c) // $d)"},
+		{"$a || $b && $c", "($a || ($b && $c))"},
+		{"$a ? $b : $c ? $d : $e", "($a ? $b : ($c ? $d : $e))"},
+		{"$x = $y = 1 + 2", "($x = ($y = (1 + 2)))"},
+		{"$x += 2 * 3", "($x += (2 * 3))"},
+		{"$a or $b and not $c", "($a or ($b and (not $c)))"},
+		{"$a = 1 or die", "(($a = 1) or die)"},
+		{"1 .. $n + 1", "(1 .. ($n + 1))"},
+		{"$x =~ $re && 1", "(($x =~ $re) && 1)"},
+		{"$i++ + ++$j", "(($i++) + (++$j))"},
+		{"(1 + 2) * 3", "((1 + 2) * 3)"},
+		{"1 + 2; 3 * 4", "(1 + 2);\n(3 * 4)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestProgramString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"my $x = 5;", "my $x = 5"},
+		{"return;", "return"},
+		{"package Foo::Bar 1.2;", "package Foo::Bar 1.2"},
+		{"package Foo { 1 }", "package Foo { 1 }"},
+		{"use strict; use List::Util qw(sum max); use Foo ();", "use strict;\nuse List::Util qw(sum max);\nuse Foo ()"},
+		{"use v5.36;", "use v5.36"},
+		{"no warnings 'once';", "no warnings 'once'"},
+		{"require Foo::Bar; require 5.006;", "require Foo::Bar;\nrequire 5.006"},
+		{"BEGIN { $x = 1 }", "BEGIN { ($x = 1) }"},
+		{"sub add ($a, $b = 1) :lvalue { return $a + $b; }", "sub add :lvalue ($a, $b = 1) { return ($a + $b) }"},
+		{"sub f; sub g {}", "sub f;\nsub g {}"},
+		{"sub f($x,) { 1 }", "sub f ($x) { 1 }"},
+		{"class Point 1.0 :isa(Base) { field $x :param = 0; method x { $x } }",
+			"class Point 1.0 :isa(Base) { field $x :param = 0; method x { $x } }"},
+		{"my $h = { a => [1, 2], b => () };", "my $h = {a => [1, 2], b => ()}"},
+		{"f(a => 1, \"b\" => 2);", "f(a => 1, \"b\", 2)"},
+		{"$obj->method(1, 2)->{key}[0];", "$obj->method(1, 2)->{key}->[0]"},
+		{"Foo->new;", "Foo->new"},
+		{"$code->(1); foo(2); print 3, 4;", "$code->(1);\nfoo(2);\nprint 3, 4"},
+		{"map { $_ * 2 } @x;", "map { ($_ * 2) } @x"},
+		{"$x->@*; $x->@{'a'};", "$x->@*;\n$x->@{'a'}"},
+		{"defined $x && $y;", "(defined $x && $y)"},
+		{"return bless { %args }, $class;", "return bless {%args}, $class"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func testVersion(t *testing.T, v *ast.VersionLiteral, expected string) {
+	t.Helper()
+	if expected == "" {
+		if v != nil {
+			t.Errorf("expected no version, got %s", v.Value)
+		}
+		return
+	}
+	if v == nil {
+		t.Errorf("expected version %s, got none", expected)
+		return
+	}
+	if v.Value != expected {
+		t.Errorf("expected version %s, got %s", expected, v.Value)
+	}
+}
+
+func testModuleImport(t *testing.T, input string, module *ast.Identifier, version *ast.VersionLiteral, imports []ast.Expression, expectedModule, expectedVersion string, expectedImports []string) {
+	t.Helper()
+	switch {
+	case expectedModule == "" && module != nil:
+		t.Errorf("%s: expected no module, got %s", input, module.Value)
+	case expectedModule != "" && (module == nil || module.Value != expectedModule):
+		t.Errorf("%s: expected module %s, got %+v", input, expectedModule, module)
+	}
+	testVersion(t, version, expectedVersion)
+
+	if (imports == nil) != (expectedImports == nil) {
+		t.Fatalf("%s: expected imports %v, got %v", input, expectedImports, imports)
+	}
+	if len(imports) != len(expectedImports) {
+		t.Fatalf("%s: expected %d imports, got %d", input, len(expectedImports), len(imports))
+	}
+	for i, lit := range expectedImports {
+		if imports[i].TokenLiteral() != lit {
+			t.Errorf("%s: imports[%d] expected %s, got %s", input, i, lit, imports[i].TokenLiteral())
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		invocant string
+		method   string
+		args     int
+		indirect bool
+	}{
+		{"$obj->method(@args);", "$obj", "method", 1, false},
+		{"Class->new;", "Class", "new", -1, false},
+		{"Foo::Bar->new(1, 2);", "Foo::Bar", "new", 2, false},
+		{"$obj->$name();", "$obj", "$name", 0, true},
+		{"$self->SUPER::init;", "$self", "SUPER::init", -1, false},
+		{"new Foo(1);", "Foo", "new", 1, false},
+		{"new Foo;", "Foo", "new", -1, false},
+		{"new Foo::Bar 1, 2;", "Foo::Bar", "new", 2, false},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		call, ok := stmt.Expression.(*ast.MethodCall)
+		if !ok {
+			t.Fatalf("%s: expected *ast.MethodCall, got %T", tt.input, stmt.Expression)
+		}
+		if call.Invocant.TokenLiteral() != tt.invocant {
+			t.Errorf("%s: invocant expected %s, got %s", tt.input, tt.invocant, call.Invocant.TokenLiteral())
+		}
+		if call.Method.Value != tt.method {
+			t.Errorf("%s: method expected %s, got %s", tt.input, tt.method, call.Method.Value)
+		}
+		if call.Indirect() != tt.indirect {
+			t.Errorf("%s: indirect expected %t", tt.input, tt.indirect)
+		}
+		switch {
+		case tt.args < 0 && call.Arguments != nil:
+			t.Errorf("%s: expected no argument list, got %v", tt.input, call.Arguments)
+		case tt.args >= 0 && len(call.Arguments) != tt.args:
+			t.Errorf("%s: expected %d arguments, got %d", tt.input, tt.args, len(call.Arguments))
+		}
+	}
+}
+
+func TestArrowChains(t *testing.T) {
+	program := parse(t, "$obj->items->[0]{name}->@*;")
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+
+	deref, ok := stmt.Expression.(*ast.PostfixDeref)
+	if !ok || deref.Sigil != ast.ArraySigil {
+		t.Fatalf("expected ->@* at the root, got %T", stmt.Expression)
+	}
+	name, ok := deref.Left.(*ast.Index)
+	if !ok || !name.IsHash() || !name.Arrow || name.Index.TokenLiteral() != "name" {
+		t.Fatalf("expected {name} subscript, got %+v", deref.Left)
+	}
+	first, ok := name.Left.(*ast.Index)
+	if !ok || first.IsHash() || !first.Arrow || first.Index.TokenLiteral() != "0" {
+		t.Fatalf("expected ->[0] subscript, got %+v", name.Left)
+	}
+	items, ok := first.Left.(*ast.MethodCall)
+	if !ok || items.Method.Value != "items" {
+		t.Fatalf("expected ->items call, got %+v", first.Left)
+	}
+}
+
+func TestDereferences(t *testing.T) {
+	tests := []struct {
+		input string
+		check func(ast.Expression) bool
+	}{
+		{"$code->(1);", func(e ast.Expression) bool {
+			c, ok := e.(*ast.CallExpression)
+			return ok && c.Arrow && len(c.Arguments) == 1
+		}},
+		{"foo(1, 2);", func(e ast.Expression) bool {
+			c, ok := e.(*ast.CallExpression)
+			return ok && !c.Arrow && c.Function.TokenLiteral() == "foo" && len(c.Arguments) == 2
+		}},
+		{"$aref->[0];", func(e ast.Expression) bool {
+			i, ok := e.(*ast.Index)
+			return ok && i.Arrow && !i.IsHash()
+		}},
+		{"$href->{k};", func(e ast.Expression) bool {
+			i, ok := e.(*ast.Index)
+			return ok && i.Arrow && i.IsHash()
+		}},
+		{"$array[1];", func(e ast.Expression) bool {
+			i, ok := e.(*ast.Index)
+			return ok && !i.Arrow && i.Left.TokenLiteral() == "$array"
+		}},
+		{"$x->%*;", func(e ast.Expression) bool {
+			d, ok := e.(*ast.PostfixDeref)
+			return ok && d.Sigil == ast.HashSigil
+		}},
+		{"$x->$#*;", func(e ast.Expression) bool {
+			d, ok := e.(*ast.PostfixDeref)
+			return ok && d.Sigil == ast.LastIndexSigil
+		}},
+		{"$x->@{'a'};", func(e ast.Expression) bool {
+			s, ok := e.(*ast.PostfixSlice)
+			return ok && s.Sigil == ast.ArraySigil && s.Bracket.Type == "LBRACE"
+		}},
+		{"$i++;", func(e ast.Expression) bool {
+			pe, ok := e.(*ast.PostfixExpression)
+			return ok && pe.Operator == "++"
+		}},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if !tt.check(stmt.Expression) {
+			t.Errorf("%s: unexpected expression %T %+v", tt.input, stmt.Expression, stmt.Expression)
+		}
+	}
+}
+
+func TestSlices(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"@a[0, 1];", "@a[0, 1]"},
+		{`@h{"a", "b"};`, `@h{"a", "b"}`},
+		{`%h{"a", "b"};`, `%h{"a", "b"}`},
+		{"(1, 2, 3)[0, 1];", "(1, 2, 3)[0, 1]"},
+		{"$r->@[0, 1];", "$r->@[0, 1]"},
+		{"$r->%{'a', 'b'};", "$r->%{'a', 'b'}"},
+		{"@a[(0, 1)];", "@a[(0, 1)]"},
+		{"@a[0];", "@a[0]"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		e := program.Statements[0].(*ast.ExpressionStatement).Expression
+		var index ast.Expression
+		switch e := e.(type) {
+		case *ast.Index:
+			index = e.Index
+		case *ast.PostfixSlice:
+			index = e.Index
+		default:
+			t.Fatalf("%s: expected a slice, got %T", tt.input, e)
+		}
+		if list, ok := index.(*ast.ListLiteral); ok && len(list.Elements) < 2 {
+			t.Errorf("%s: expected a list of several elements, got %s", tt.input, list)
+		}
+		if got := e.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	program := parse(t, "my $h = { a => 1, b => [1, 2], c => {} };\nmy @x = (1, 2, 3);\nmy @empty = ();")
+
+	hash, ok := program.Statements[0].(*ast.MyStatement).Value.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.HashLiteral, got %T", program.Statements[0].(*ast.MyStatement).Value)
+	}
+	if len(hash.Elements) != 6 {
+		t.Fatalf("expected 6 hash elements, got %d", len(hash.Elements))
+	}
+	if array, ok := hash.Elements[3].(*ast.ArrayLiteral); !ok || len(array.Elements) != 2 {
+		t.Errorf("expected [1, 2], got %+v", hash.Elements[3])
+	}
+	if inner, ok := hash.Elements[5].(*ast.HashLiteral); !ok || len(inner.Elements) != 0 {
+		t.Errorf("expected {}, got %+v", hash.Elements[5])
+	}
+
+	list, ok := program.Statements[1].(*ast.MyStatement).Value.(*ast.ListLiteral)
+	if !ok || len(list.Elements) != 3 {
+		t.Errorf("expected (1, 2, 3), got %+v", program.Statements[1].(*ast.MyStatement).Value)
+	}
+	empty, ok := program.Statements[2].(*ast.MyStatement).Value.(*ast.ListLiteral)
+	if !ok || len(empty.Elements) != 0 {
+		t.Errorf("expected (), got %+v", program.Statements[2].(*ast.MyStatement).Value)
+	}
+}
+
+func TestBlockOrHash(t *testing.T) {
+	tests := []struct {
+		input string
+		block bool
+		args  int
+	}{
+		{"map { $_ * 2 } @x;", true, 1},
+		{"map { $_ => 1 } @x;", true, 1},
+		{"map {; 'a' => $_ } @x;", true, 1},
+		{"map +{ name => $_ }, @x;", false, 2},
+		{"map { 'a' => $_ }, @x;", false, 2},
+		{"map { name => $_ }, @x;", false, 2},
+		{"grep { defined } @x, @y;", true, 2},
+		{"sort { $a <=> $b } @x;", true, 1},
+		{"bless {}, $class;", false, 2},
+		{"die { code => 1 };", false, 1},
+		{"eval { 1 };", true, 0},
+		{"do { 1 };", true, 0},
+		{"bless { %args }, $class;", false, 2},
+		{"bless { %$proto, x => 1 }, $class;", false, 2},
+		{"foo { $x => 1 };", false, 1},
+		{"print { $fh } 'x';", true, 1},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		call, ok := stmt.Expression.(*ast.CallExpression)
+		if !ok {
+			t.Fatalf("%s: expected *ast.CallExpression, got %T", tt.input, stmt.Expression)
+		}
+		if (call.Block != nil) != tt.block {
+			t.Errorf("%s: expected block %t, got %+v", tt.input, tt.block, call.Block)
+		}
+		if len(call.Arguments) != tt.args {
+			t.Errorf("%s: expected %d arguments, got %d", tt.input, tt.args, len(call.Arguments))
+		}
+		if !tt.block {
+			first := call.Arguments[0]
+			if prefix, ok := first.(*ast.PrefixExpression); ok {
+				first = prefix.Right
+			}
+			if _, ok := first.(*ast.HashLiteral); !ok {
+				t.Errorf("%s: expected a hash constructor, got %T", tt.input, first)
+			}
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	program := parse(t, "sub f { return { ok => 1 }; return; return 1, 2 }\n{ a => 1 }")
+
+	body := program.Statements[0].(*ast.SubStatement).Body.Statements
+	if len(body) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(body))
+	}
+	if _, ok := body[0].(*ast.ReturnStatement).ReturnValue.(*ast.HashLiteral); !ok {
+		t.Errorf("expected return {...} to return a hash, got %T", body[0].(*ast.ReturnStatement).ReturnValue)
+	}
+	if body[1].(*ast.ReturnStatement).ReturnValue != nil {
+		t.Errorf("expected bare return to have no value")
+	}
+	if list, ok := body[2].(*ast.ReturnStatement).ReturnValue.(*ast.ListLiteral); !ok || len(list.Elements) != 2 {
+		t.Errorf("expected return 1, 2 to return a list, got %+v", body[2].(*ast.ReturnStatement).ReturnValue)
+	}
+
+	// a brace at statement level is always a block
+	if _, ok := program.Statements[1].(*ast.BlockStatement); !ok {
+		t.Errorf("expected a block statement, got %T", program.Statements[1])
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		errors     int
+		statements int
+	}{
+		{"my 5 = 3;\nmy $y = 10;", 1, 1},
+		{"my $x = ;\nmy $y = 10;", 1, 2},
+		{"my $x = 1 + * 2 - 3;\nmy $y = 10;", 1, 2},
+		{"my $x 5\nmy $y = 10;", 1, 2},
+		{"my $x = ;\nmy $y = ;\nmy $z = 1;", 2, 3},
+		{"sub f { my $x = ; return 1 }\nmy $y = 10;", 1, 2},
+		{"sub f { my $x = }\nmy $y = 10;", 1, 2},
+		{"package 1;\nuse strict;", 1, 1},
+		{"sub f { my $x = 1;", 1, 1},
+		{"sub f { my $a = (1, ; }\nmy $w = 1;", 1, 2},
+		{"my @a = [1, ;\nmy $w = 1;", 1, 2},
+		{"f(1, + );\nmy $w = 1;", 1, 2},
+		{"foo(1, (2 3), 4);\nmy $w = 1;", 1, 2},
+		{"if ($x == ) { foo(); } bar();", 1, 2},
+		{"if ($x) { 1 } elsif ($y == ) { 2 } else { 3 } bar();", 1, 2},
+		{"while ($x +) {} bar();", 1, 2},
+		{"foreach my $x (@a { }", 1, 0},
+		{"for (my $i = ; $i < 3; $i++) { f() } g();", 1, 2},
+		{"sub f($x, 1) { 1 } bar();", 1, 2},
+		{"my $x = 1 + ) { g(); h() } i();", 1, 2},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New([]byte(tt.input))
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		if program == nil {
+			t.Fatalf("%q: ParseProgram() returned nil", tt.input)
+		}
+		if len(p.Errors()) != tt.errors {
+			t.Errorf("%q: expected %d errors, got %d: %q", tt.input, tt.errors, len(p.Errors()), p.Errors())
+		}
+		if len(program.Statements) != tt.statements {
+			t.Errorf("%q: expected %d statements, got %d", tt.input, tt.statements, len(program.Statements))
+		}
+		for i, stmt := range program.Statements {
+			if stmt == nil {
+				t.Errorf("%q: statement %d is nil", tt.input, i)
+			}
+		}
+	}
+}
+
+func TestPartialHeaders(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if ($x == ) { foo(); }", "if () { foo() }"},
+		{"unless ($x ==) { 1 } else { 2 }", "unless () { 1 } else { 2 }"},
+		{"while ($x +) { bar() }", "while () { bar() }"},
+		{"for my $x (1 +) { $x }", "for my $x () { $x }"},
+		{"for (my $i = 0; $i < ; $i++) { f() }", "for ((my $i = 0); ; ) { f() }"},
+		{"sub f($x, 1) { $x }", "sub f ($x) { $x }"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New([]byte(tt.input)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 1 {
+			t.Errorf("%s: expected one error, got %v", tt.input, p.Errors())
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMissingSeparators(t *testing.T) {
+	tests := []struct {
+		input      string
+		statements int
+	}{
+		{"foo(1 2);\nbar();", 2},
+		{"my $a = [1 $x];\nbar();", 2},
+		{"my $h = {a => 1 b => 2};\nbar();", 2},
+		{"my @a = (1 2);\nbar();", 2},
+		{"for my $x (1 2) { f() }\nbar();", 2},
+		{"my $x = 1 my $y = 2;", 2},
+		{"return 1 2;\nbar();", 2},
+		{"print 1\nprint 2;", 1},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New([]byte(tt.input))
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0].Code != diagnostics.UnexpectedToken {
+			t.Errorf("%q: expected one %s error, got %q", tt.input, diagnostics.UnexpectedToken, errors)
+		}
+		if len(program.Statements) != tt.statements {
+			t.Errorf("%q: expected %d statements, got %d", tt.input, tt.statements, len(program.Statements))
+		}
+	}
+
+	// the ; may be left out before a } or the end of the input
+	parse(t, "sub f { return 1 } f(1, 2,)")
+}
+
+func TestFilehandles(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`print STDERR "x", 1;`, `print { STDERR } "x", 1`},
+		{`print $fh "x";`, `print { $fh } "x"`},
+		{`print {$fh} "x";`, `print { $fh } "x"`},
+		{`say STDOUT;`, `say { STDOUT }`},
+		{`print $x[0];`, `print $x[0]`},
+		{`print $x, "y";`, `print $x, "y"`},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if len(program.Statements) != 1 {
+			t.Fatalf("%s: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestPartialProgram(t *testing.T) {
+	l := lexer.New([]byte("my $x = 1;\nsub f { my = 2; my $y = 3 }\nmy $z = 4;"))
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 error, got %q", p.Errors())
+	}
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(program.Statements))
+	}
+	testMyStatement(t, program.Statements[0], "$x")
+	testMyStatement(t, program.Statements[2], "$z")
+
+	body := program.Statements[1].(*ast.SubStatement).Body
+	if len(body.Statements) != 1 {
+		t.Fatalf("expected 1 statement in sub body, got %d", len(body.Statements))
+	}
+	testMyStatement(t, body.Statements[0], "$y")
+}
+
+func TestPartialString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"my $x = 1 + ;", "my $x = (1 + )"},
+		{"use X not;", "use X (not )"},
+		{"$x ? 1 : ;", "($x ? 1 : )"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New([]byte(tt.input)))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input  string
+		code   string
+		span   diagnostics.Span
+		labels int
+		fix    string
+	}{
+		{"my $x 5;", diagnostics.UnexpectedToken, diagnostics.Span{Start: 6, End: 7}, 0, "="},
+		{"my $x = ;", diagnostics.ExpectedExpression, diagnostics.Span{Start: 8, End: 9}, 0, ""},
+		{"sub f { 1;", diagnostics.UnclosedDelimiter, diagnostics.Span{Start: 10, End: 10}, 1, "}"},
+		{"$x->@;", diagnostics.UnexpectedToken, diagnostics.Span{Start: 4, End: 5}, 0, ""},
+		{"my $x = 'a;", diagnostics.UnterminatedString, diagnostics.Span{Start: 8, End: 9}, 0, ""},
+		{"my $x = 0789;", diagnostics.InvalidNumber, diagnostics.Span{Start: 8, End: 12}, 0, ""},
+		{"my foo = 1;", diagnostics.UnexpectedToken, diagnostics.Span{Start: 3, End: 6}, 0, ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New([]byte(tt.input))
+		p := parser.New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		d := errors[0]
+		if d.Severity != diagnostics.Error {
+			t.Errorf("%q: expected severity error, got %s", tt.input, d.Severity)
+		}
+		if d.Code != tt.code {
+			t.Errorf("%q: expected code %s, got %s", tt.input, tt.code, d.Code)
+		}
+		if d.Span != tt.span {
+			t.Errorf("%q: expected span %v, got %v", tt.input, tt.span, d.Span)
+		}
+		if len(d.Labels) != tt.labels {
+			t.Errorf("%q: expected %d labels, got %d", tt.input, tt.labels, len(d.Labels))
+		}
+		switch {
+		case tt.fix == "" && d.Fix != nil:
+			t.Errorf("%q: expected no fix, got %+v", tt.input, d.Fix)
+		case tt.fix != "" && (d.Fix == nil || d.Fix.Replacement != tt.fix):
+			t.Errorf("%q: expected fix inserting %q, got %+v", tt.input, tt.fix, d.Fix)
+		}
+	}
+}
+
+func TestControlStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if ($x) { 1 }", "if ($x) { 1 }"},
+		{"unless ($x) { 1 } else { 2 }", "unless ($x) { 1 } else { 2 }"},
+		{"if ($x) { 1 } elsif ($y) { 2 } elsif ($z) { 3 } else { 4 }",
+			"if ($x) { 1 } elsif ($y) { 2 } elsif ($z) { 3 } else { 4 }"},
+		{"while (my $line = shift @lines) { print $line }", "while ((my $line = shift @lines)) { print $line }"},
+		{"until ($done) { 1 } continue { 2 }", "until ($done) { 1 } continue { 2 }"},
+		{"while () { 1 }", "while () { 1 }"},
+		{"for my $i (1, 2) { $i }", "for my $i (1, 2) { $i }"},
+		{"foreach $x (@list) { }", "foreach $x (@list) {}"},
+		{"for (@list) { 1 }", "for (@list) { 1 }"},
+		{"for (my $i = 0; $i < 10; $i++) { 1 }", "for ((my $i = 0); ($i < 10); ($i++)) { 1 }"},
+		{"for (;;) { 1 }", "for (; ; ) { 1 }"},
+		{"OUTER: for my $i (@x) { 1 } 2;", "OUTER: for my $i (@x) { 1 }\n2"},
+		{"for (@x) { next; last OUTER; redo }", "for (@x) { next; last OUTER; redo }"},
+		{"print $x if $y or $z;", "print $x if ($y or $z)"},
+		{"return unless $ok; next LINE if $blank;", "return unless $ok;\nnext LINE if $blank"},
+		{"f($_) for 1, 2; $i++ until $i > 3;", "f($_) for (1, 2);\n($i++) until ($i > 3)"},
+		{"my $x = 1 if $y; my %h = (next => 1);", "my $x = 1 if $y;\nmy %h = (next => 1)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+
+	program := parse(t, "if ($x) { 1 } elsif ($y) { 2 }")
+	stmt := program.Statements[0].(*ast.IfStatement)
+	elsif, ok := stmt.Alternative.(*ast.IfStatement)
+	if !ok || elsif.TokenLiteral() != "elsif" || elsif.Alternative != nil {
+		t.Errorf("expected an elsif without else, got %+v", stmt.Alternative)
+	}
+
+	program = parse(t, "last OUTER if $done;")
+	mod := program.Statements[0].(*ast.ModifiedStatement)
+	if ctl, ok := mod.Statement.(*ast.LoopControlStatement); !ok || ctl.Label == nil || ctl.Label.Value != "OUTER" || mod.TokenLiteral() != "if" {
+		t.Errorf("expected last OUTER under an if modifier, got %+v", mod)
+	}
+
+	program = parse(t, "for my $x (@a) { }")
+	loop := program.Statements[0].(*ast.ForeachStatement)
+	if decl, ok := loop.Variable.(*ast.Declaration); !ok || decl.Variables[0].Name != "x" {
+		t.Errorf("expected the loop to declare $x, got %+v", loop.Variable)
+	}
+}
+
+func TestDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"my $x;", "my $x"},
+		{"our $VERSION = '1.0';", "our $VERSION = '1.0'"},
+		{"state $n = 0;", "state $n = 0"},
+		{"my ($a, $b) = @_;", "(my ($a, $b) = @_)"},
+		{"my ($x) = @_;", "(my ($x) = @_)"},
+		{"our (@a, %h);", "our (@a, %h)"},
+		{"f(my $x = 1);", "f((my $x = 1))"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+
+	program := parse(t, "my ($x) = @_;")
+	assign := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	if decl := assign.Left.(*ast.Declaration); !decl.Parens || len(decl.Variables) != 1 {
+		t.Errorf("expected a parenthesised declaration of one variable, got %+v", decl)
+	}
+}
+
+func TestDereference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"@{$r};", "@{$r}"},
+		{"%{ $self->{h} };", "%{$self->{h}}"},
+		{"${$r}[0];", "${$r}[0]"},
+		{"@{$r}{'a'};", "@{$r}{'a'}"},
+		{"&{$code}(1, 2);", "&{$code}(1, 2)"},
+		{"*{\"main::f\"} = $f;", "(*{\"main::f\"} = $f)"},
+		{"${name};", "$name"},
+		{"defined &{$f};", "defined &{$f}"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"my Int $x = 5;", "my Int $x = 5"},
+		{"my ArrayRef[Int] $r;", "my ArrayRef[Int] $r"},
+		{"my HashRef[ArrayRef[Str]] $h;", "my HashRef[ArrayRef[Str]] $h"},
+		{"my Int ($a, $b) = @_;", "(my Int ($a, $b) = @_)"},
+		{"my Foo::Bar $o;", "my Foo::Bar $o"},
+		{"for my Num $n (@a) { }", "for my Num $n (@a) {}"},
+		{"class P { field Str $name :param; }", "class P { field Str $name :param }"},
+		{"sub add(Int $a, Int $b = 1) :returns(Int) { }", "sub add :returns(Int) (Int $a, Int $b = 1) {}"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+
+	program := parse(t, "my ArrayRef[Int] $r;")
+	typ := program.Statements[0].(*ast.MyStatement).Type
+	if typ == nil || typ.Name != "ArrayRef" || len(typ.Args) != 1 || typ.Args[0].Name != "Int" {
+		t.Errorf("expected ArrayRef[Int], got %+v", typ)
+	}
+}
@@ -0,0 +1,481 @@
+// Package resolve binds each variable in a program to the declaration it
+// refers to. Resolve builds the tree of lexical scopes, a Symbol for
+// every my, our, state and field declaration, and a Global symbol for
+// each package variable used without one, and warns about declarations
+// that shadow or repeat another.
+//
+// Element access refers to the aggregate: $x[0] uses @x and $x{k} uses
+// %x. Variables interpolated into strings are uses like any other.
+package resolve
+
+import (
+	"strings"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/token"
+)
+
+// Info is what Resolve learns about a program.
+type Info struct {
+	// File is the outermost scope.
+	File *Scope
+
+	// Scopes maps each node that opens a scope to it. An if statement
+	// opens a scope for its condition and each of its blocks opens its
+	// own; the body of a sub or method shares the sub's scope with its
+	// parameters.
+	Scopes map[ast.Node]*Scope
+
+	// Defs maps the variable in each declaration to its symbol, and
+	// Uses every other variable to the symbol it refers to.
+	Defs map[*ast.Variable]*Symbol
+	Uses map[*ast.Variable]*Symbol
+
+	// Globals holds the package variables by qualified name, such as
+	// "$main::x".
+	Globals map[string]*Symbol
+
+	// Packages maps each statement, identifier and variable to the
+	// package in effect where it appears.
+	Packages map[ast.Node]string
+
+	Diagnostics []diagnostics.Diagnostic
+}
+
+// SymbolOf returns the symbol v declares or refers to, or nil.
+func (info *Info) SymbolOf(v *ast.Variable) *Symbol {
+	if sym := info.Defs[v]; sym != nil {
+		return sym
+	}
+	return info.Uses[v]
+}
+
+// PackageOf returns the package in effect at n, a statement, identifier
+// or variable.
+func (info *Info) PackageOf(n ast.Node) string {
+	if pkg, ok := info.Packages[n]; ok {
+		return pkg
+	}
+	return "main"
+}
+
+// Qualify returns the full name of the sub or constant called name at
+// n: name without a leading :: if it names its package, and otherwise
+// name in the package in effect at n.
+func (info *Info) Qualify(n ast.Node, name string) string {
+	if strings.Contains(name, "::") {
+		return strings.TrimPrefix(name, "::")
+	}
+	return info.PackageOf(n) + "::" + name
+}
+
+// Resolve resolves the variables in program.
+func Resolve(program *ast.Program) *Info {
+	r := &resolver{
+		info: &Info{
+			Scopes:   make(map[ast.Node]*Scope),
+			Defs:     make(map[*ast.Variable]*Symbol),
+			Uses:     make(map[*ast.Variable]*Symbol),
+			Globals:  make(map[string]*Symbol),
+			Packages: make(map[ast.Node]string),
+		},
+		pkg: "main",
+	}
+	r.scope = newScope(FileScope, program, r.pkg, nil)
+	r.info.File = r.scope
+	r.info.Scopes[program] = r.scope
+	r.statements(program.Statements)
+	return r.info
+}
+
+type resolver struct {
+	info  *Info
+	scope *Scope
+	pkg   string
+
+	// declarations made by expressions in the current statement, which
+	// take effect after it
+	pending []*ast.Declaration
+}
+
+func (r *resolver) open(kind ScopeKind, n ast.Node) {
+	r.scope = newScope(kind, n, r.pkg, r.scope)
+	r.info.Scopes[n] = r.scope
+}
+
+func (r *resolver) close() {
+	r.scope = r.scope.Parent
+}
+
+// statements resolves a list of statements in the current scope. A
+// package declaration lasts until the end of the list, and a class
+// declaration without a block opens a class scope that lasts until the
+// next package or class declaration or the end of the list, labelled or
+// not.
+func (r *resolver) statements(list []ast.Statement) {
+	pkg := r.pkg
+	var class *Scope
+	endClass := func() {
+		if class != nil {
+			r.scope = class.Parent
+			class = nil
+		}
+	}
+
+	for _, s := range list {
+		switch d := unlabeled(s).(type) {
+		case *ast.PackageDeclaration:
+			endClass()
+			r.pkg = d.Name.Value
+		case *ast.ClassStatement:
+			if d.Body == nil {
+				endClass()
+				r.pkg = d.Name.Value
+				r.info.Packages[s] = r.pkg
+				r.info.Packages[d] = r.pkg
+				r.open(ClassScope, d)
+				class = r.scope
+				continue
+			}
+		}
+		r.statement(s)
+		r.flush()
+	}
+	endClass()
+	r.pkg = pkg
+}
+
+// unlabeled returns s without its labels.
+func unlabeled(s ast.Statement) ast.Statement {
+	for {
+		l, ok := s.(*ast.LabeledStatement)
+		if !ok {
+			return s
+		}
+		s = l.Statement
+	}
+}
+
+func (r *resolver) statement(s ast.Statement) {
+	r.info.Packages[s] = r.pkg
+	switch s := s.(type) {
+	case *ast.MyStatement:
+		r.expression(s.Value)
+		r.declare(s.Name, declarationKind(s.Token))
+
+	case *ast.ExpressionStatement:
+		r.expression(s.Expression)
+
+	case *ast.ReturnStatement:
+		r.expression(s.ReturnValue)
+
+	case *ast.BlockStatement:
+		r.block(s)
+
+	case *ast.PackageStatement:
+		pkg := r.pkg
+		r.pkg = s.Name.Value
+		r.open(PackageScope, s)
+		r.statements(s.Body.Statements)
+		r.close()
+		r.pkg = pkg
+
+	case *ast.ClassStatement:
+		if s.Body == nil {
+			// statements opens the scope of a class without a block
+			break
+		}
+		pkg := r.pkg
+		r.pkg = s.Name.Value
+		r.open(ClassScope, s)
+		r.statements(s.Body.Statements)
+		r.close()
+		r.pkg = pkg
+
+	case *ast.UseStatement:
+		r.expressions(s.Imports)
+
+	case *ast.NoStatement:
+		r.expressions(s.Imports)
+
+	case *ast.RequireStatement:
+		r.expression(s.Value)
+
+	case *ast.PhaseBlock:
+		r.open(SubScope, s)
+		r.statements(s.Body.Statements)
+		r.close()
+
+	case *ast.SubStatement:
+		r.sub(s, s.Signature, s.Body, false)
+
+	case *ast.MethodStatement:
+		r.sub(s, s.Signature, s.Body, true)
+
+	case *ast.FieldStatement:
+		r.expression(s.Value)
+		r.declare(s.Name, Field)
+
+	case *ast.IfStatement:
+		r.open(BlockScope, s)
+		r.expression(s.Condition)
+		r.flush()
+		r.block(s.Consequence)
+		if s.Alternative != nil {
+			r.statement(s.Alternative)
+		}
+		r.close()
+
+	case *ast.WhileStatement:
+		r.open(LoopScope, s)
+		r.expression(s.Condition)
+		r.flush()
+		r.block(s.Body)
+		r.block(s.Continue)
+		r.close()
+
+	case *ast.ForStatement:
+		r.open(LoopScope, s)
+		r.expression(s.Init)
+		r.flush()
+		r.expression(s.Condition)
+		r.expression(s.Step)
+		r.flush()
+		r.block(s.Body)
+		r.close()
+
+	case *ast.ForeachStatement:
+		r.open(LoopScope, s)
+		// the list is evaluated before the iterator is declared
+		r.expression(s.List)
+		r.expression(s.Variable)
+		r.flush()
+		r.block(s.Body)
+		r.block(s.Continue)
+		r.close()
+
+	case *ast.LabeledStatement:
+		r.statement(s.Statement)
+
+	case *ast.ModifiedStatement:
+		// the condition is evaluated first, so a variable the statement
+		// declares isn't visible in it
+		r.expression(s.Condition)
+		r.statement(s.Statement)
+	}
+}
+
+// sub resolves a sub or method. Its parameters and body share one scope,
+// and a method's scope declares $self.
+func (r *resolver) sub(n ast.Node, sig *ast.Signature, body *ast.BlockStatement, method bool) {
+	if body == nil && sig == nil {
+		return
+	}
+	r.open(SubScope, n)
+	if method {
+		r.scope.declare(&Symbol{Name: "$self", Kind: My})
+	}
+	if sig != nil {
+		for _, param := range sig.Parameters {
+			// a default can refer to earlier parameters only
+			r.expression(param.Default)
+			r.declare(param.Name, My)
+		}
+	}
+	if body != nil {
+		r.statements(body.Statements)
+	}
+	r.close()
+}
+
+func (r *resolver) block(b *ast.BlockStatement) {
+	if b == nil {
+		return
+	}
+	// a block inside an expression, as in map { ... } LIST, doesn't
+	// see the declarations of the statement it is part of
+	pending := r.pending
+	r.pending = nil
+	r.open(BlockScope, b)
+	r.statements(b.Statements)
+	r.close()
+	r.pending = pending
+}
+
+func (r *resolver) expressions(list []ast.Expression) {
+	for _, e := range list {
+		r.expression(e)
+	}
+}
+
+func (r *resolver) expression(e ast.Expression) {
+	if e == nil {
+		return
+	}
+	ast.Inspect(e, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			r.info.Packages[n] = r.pkg
+		case *ast.Variable:
+			r.use(n, n.Sigil)
+		case *ast.Declaration:
+			r.pending = append(r.pending, n)
+			return false
+		case *ast.Index:
+			// $x[0] and @x[0, 1] are elements of @x, $x{k} and @x{...}
+			// of %x
+			if v, ok := n.Left.(*ast.Variable); ok && !n.Arrow {
+				if n.IsHash() {
+					r.use(v, ast.HashSigil)
+				} else {
+					r.use(v, ast.ArraySigil)
+				}
+				r.expression(n.Index)
+				return false
+			}
+		case *ast.CallExpression:
+			if n.Block != nil {
+				r.expression(n.Function)
+				r.block(n.Block)
+				r.expressions(n.Arguments)
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// flush declares the variables of the pending declarations.
+func (r *resolver) flush() {
+	for _, d := range r.pending {
+		kind := declarationKind(d.Token)
+		for _, v := range d.Variables {
+			r.declare(v, kind)
+		}
+	}
+	r.pending = nil
+}
+
+func declarationKind(t token.Token) SymbolKind {
+	switch t.Type {
+	case token.OUR:
+		return Our
+	case token.STATE:
+		return State
+	default:
+		return My
+	}
+}
+
+// declare declares v in the current scope, reporting a declaration of
+// the same name in this scope or one enclosing it.
+func (r *resolver) declare(v *ast.Variable, kind SymbolKind) {
+	if v == nil {
+		return
+	}
+	r.info.Packages[v] = r.pkg
+	sym := &Symbol{Name: v.String(), Kind: kind, Decl: v}
+	if kind == Our {
+		sym.Package = r.pkg
+	}
+
+	if earlier := r.scope.LookupLocal(sym.Name); earlier != nil {
+		d := warning(diagnostics.Redeclared, v,
+			"%q variable %s masks an earlier declaration in the same scope", kind.String(), sym.Name)
+		d.Label = "redeclared here"
+		r.earlier(&d, earlier, "first declared here")
+		r.info.Diagnostics = append(r.info.Diagnostics, d)
+	} else if outer := r.scope.Parent.Lookup(sym.Name); outer != nil {
+		d := warning(diagnostics.Shadowed, v,
+			"%q variable %s shadows a declaration in an outer scope", kind.String(), sym.Name)
+		d.Label = "shadows the outer " + sym.Name
+		r.earlier(&d, outer, "outer declaration here")
+		r.info.Diagnostics = append(r.info.Diagnostics, d)
+	}
+
+	r.scope.declare(sym)
+	r.info.Defs[v] = sym
+}
+
+func warning(code string, v *ast.Variable, format string, args ...any) diagnostics.Diagnostic {
+	d := diagnostics.Errorf(code, diagnostics.SpanOf(v.Token), format, args...)
+	d.Severity = diagnostics.Warning
+	return d
+}
+
+// earlier points d at sym's declaration, if it has one in the source.
+func (r *resolver) earlier(d *diagnostics.Diagnostic, sym *Symbol, message string) {
+	if sym.Decl != nil {
+		d.Labels = append(d.Labels, diagnostics.Label{Span: diagnostics.SpanOf(sym.Decl.Token), Message: message})
+	}
+}
+
+// use binds v, used with the given sigil, to its symbol.
+func (r *resolver) use(v *ast.Variable, sigil ast.Sigil) {
+	r.info.Packages[v] = r.pkg
+	name := v.Name
+	switch sigil {
+	case ast.ScalarSigil, ast.ArraySigil, ast.HashSigil:
+	case ast.LastIndexSigil:
+		sigil = ast.ArraySigil
+	default:
+		// subs and globs aren't variables
+		return
+	}
+	if name == "" || strings.ContainsAny(name, "{}") {
+		return
+	}
+
+	full := sigil.String() + name
+	if !strings.Contains(name, "::") {
+		if sym := r.scope.Lookup(full); sym != nil {
+			r.info.Uses[v] = sym
+			return
+		}
+	}
+	r.info.Uses[v] = r.global(sigil, name)
+}
+
+// global returns the package variable for a name that isn't lexically
+// declared, qualifying it with the current package unless it is
+// already qualified or perl forces it into main.
+func (r *resolver) global(sigil ast.Sigil, name string) *Symbol {
+	pkg := r.pkg
+	switch {
+	case strings.Contains(name, "::"):
+		i := strings.LastIndex(name, "::")
+		pkg, name = name[:i], name[i+2:]
+		if pkg == "" {
+			pkg = "main"
+		}
+	case IsSpecial(name):
+		pkg = "main"
+	}
+
+	sym := &Symbol{Name: sigil.String() + name, Kind: Global, Package: pkg}
+	if existing := r.info.Globals[sym.QualifiedName()]; existing != nil {
+		return existing
+	}
+	r.info.Globals[sym.QualifiedName()] = sym
+	return sym
+}
+
+// forcedIntoMain are the names perl always looks up in package main.
+var forcedIntoMain = map[string]bool{
+	"ENV": true, "INC": true, "ARGV": true, "ARGVOUT": true,
+	"SIG": true, "STDIN": true, "STDOUT": true, "STDERR": true,
+	"_": true,
+}
+
+// IsSpecial reports whether a variable name, without its sigil, is one
+// of perl's special variables, which always belong to package main:
+// punctuation variables such as $@, the match variables $1, $2 and so
+// on, ${^NAME} variables, and names such as %ENV and @ARGV.
+func IsSpecial(name string) bool {
+	if name == "" || forcedIntoMain[name] {
+		return true
+	}
+	c := name[0]
+	return !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z')
+}
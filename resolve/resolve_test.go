@@ -0,0 +1,319 @@
+package resolve_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	return program
+}
+
+// bindings describes each variable in program in source order: what it
+// is, and the offset of the declaration it refers to, if any.
+func bindings(program *ast.Program, info *resolve.Info) []string {
+	var out []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		v, ok := n.(*ast.Variable)
+		if !ok {
+			return true
+		}
+		sym := info.SymbolOf(v)
+		switch {
+		case sym == nil:
+			out = append(out, v.String()+" unresolved")
+		case info.Defs[v] != nil:
+			out = append(out, fmt.Sprintf("%s@%d declares %s", v, v.Token.Offset, sym))
+		case sym.Decl != nil:
+			out = append(out, fmt.Sprintf("%s@%d uses %s@%d", v, v.Token.Offset, sym, sym.Decl.Token.Offset))
+		default:
+			out = append(out, fmt.Sprintf("%s@%d uses %s", v, v.Token.Offset, sym))
+		}
+		return true
+	})
+	return out
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"my $x = 1; $x + $y;",
+			[]string{"$x@3 declares my $x", "$x@11 uses my $x@3", "$y@16 uses global $main::y"},
+		},
+		{
+			// a declaration takes effect after its statement
+			"my $x = 1; { my $x = $x; }",
+			[]string{"$x@3 declares my $x", "$x@16 declares my $x", "$x@21 uses my $x@3"},
+		},
+		{
+			"my @a; my %h; $a[0]; $h{k}; @a[1]; $#a; scalar(@a);",
+			[]string{
+				"@a@3 declares my @a", "%h@10 declares my %h",
+				"$a@14 uses my @a@3", "$h@21 uses my %h@10", "@a@28 uses my @a@3",
+				"$#a@35 uses my @a@3", "@a@47 uses my @a@3",
+			},
+		},
+		{
+			"my $r; @$r; $$r[0]; $r->[0];",
+			[]string{"$r@3 declares my $r", "$r@8 uses my $r@3", "$r@13 uses my $r@3", "$r@20 uses my $r@3"},
+		},
+		{
+			"my ($a, $b) = @_; our $v; state $n; $v;",
+			[]string{
+				"$a@4 declares my $a", "$b@8 declares my $b", "@_@14 uses global @main::_",
+				"$v@22 declares our $main::v", "$n@32 declares state $n", "$v@36 uses our $main::v@22",
+			},
+		},
+		{
+			"for my $i (@i) { $i } $i;",
+			[]string{"$i@7 declares my $i", "@i@11 uses global @main::i", "$i@17 uses my $i@7", "$i@22 uses global $main::i"},
+		},
+		{
+			"for (my $i = 0; $i < 3; $i++) { $i } while (my $l = shift) { $l } continue { $l }",
+			[]string{
+				"$i@8 declares my $i", "$i@16 uses my $i@8", "$i@24 uses my $i@8", "$i@32 uses my $i@8",
+				"$l@47 declares my $l", "$l@61 uses my $l@47", "$l@77 uses my $l@47",
+			},
+		},
+		{
+			"if ((my $x = 1) > 0) { $x } elsif ($x) { $x } else { $x } $x;",
+			[]string{
+				"$x@8 declares my $x", "$x@23 uses my $x@8", "$x@35 uses my $x@8",
+				"$x@41 uses my $x@8", "$x@53 uses my $x@8", "$x@58 uses global $main::x",
+			},
+		},
+		{
+			"sub f($a, $b = $a) { $a + $b } $a;",
+			[]string{
+				"$a@6 declares my $a", "$b@10 declares my $b", "$a@15 uses my $a@6",
+				"$a@21 uses my $a@6", "$b@26 uses my $b@10", "$a@31 uses global $main::a",
+			},
+		},
+		{
+			"class P { field $x :param; method m($dx) { $self; $x + $dx } }",
+			[]string{"$x@16 declares field $x", "$dx@36 declares my $dx", "$self@43 uses my $self", "$x@50 uses field $x@16", "$dx@55 uses my $dx@36"},
+		},
+		{
+			"my @x = map { my $y = $_; $y } @x;",
+			[]string{"@x@3 declares my @x", "$y@17 declares my $y", "$_@22 uses global $main::_", "$y@26 uses my $y@17", "@x@31 uses global @main::x"},
+		},
+		{
+			`my %h; my $x; "$x: $h{$x} $y\n";`,
+			[]string{"%h@3 declares my %h", "$x@10 declares my $x", "$x@15 uses my $x@10", "$h@19 uses my %h@3", "$x@22 uses my $x@10", "$y@26 uses global $main::y"},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		info := resolve.Resolve(program)
+		got := bindings(program, info)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s:\nexpected\n\t%s\ngot\n\t%s", tt.input,
+				strings.Join(tt.expected, "\n\t"), strings.Join(got, "\n\t"))
+		}
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	program := parse(t, `
+$x;
+package Foo;
+$x; $Foo::y; $::z; $_; %ENV; $1; $@;
+our @list;
+package Bar { @list; }
+@list;
+class Baz;
+$x;
+`)
+	info := resolve.Resolve(program)
+
+	var names []string
+	for name := range info.Globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	expected := []string{
+		"$Baz::x", "$Foo::x", "$Foo::y", "$main::1", "$main::@",
+		"$main::_", "$main::x", "$main::z", "%main::ENV",
+	}
+	if strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected globals %v, got %v", expected, names)
+	}
+
+	// `our` is lexical, so it outlives package Foo
+	ast.Inspect(program, func(n ast.Node) bool {
+		if v, ok := n.(*ast.Variable); ok && v.Name == "list" {
+			if sym := info.SymbolOf(v); sym.Kind != resolve.Our || sym.QualifiedName() != "@Foo::list" {
+				t.Errorf("expected @list at %d to be our @Foo::list, got %s", v.Token.Offset, sym)
+			}
+		}
+		return true
+	})
+}
+
+func TestPackages(t *testing.T) {
+	program := parse(t, `
+sub a { b() }
+package Foo;
+sub c { Bar::d(); { package Bar; e() } f() }
+package Baz { g() }
+class Qux;
+method h { &i }
+`)
+	info := resolve.Resolve(program)
+
+	var names []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SubStatement:
+			names = append(names, info.Qualify(n, n.Name.Value))
+		case *ast.MethodStatement:
+			names = append(names, info.Qualify(n, n.Name.Value))
+		case *ast.CallExpression:
+			if name, ok := n.Function.(*ast.Identifier); ok {
+				names = append(names, info.Qualify(name, name.Value))
+			}
+		case *ast.Variable:
+			names = append(names, info.Qualify(n, n.Name))
+		}
+		return true
+	})
+	expected := "main::a main::b Foo::c Bar::d Bar::e Foo::f Baz::g Qux::h Qux::i"
+	if got := strings.Join(names, " "); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	program := parse(t, `
+package Foo {
+    sub f { for my $i (1) { if ($i) { 1 } } }
+}
+class Bar;
+method m { map { 1 } @_ }
+BEGIN { 1 }
+`)
+	info := resolve.Resolve(program)
+
+	var describe func(s *resolve.Scope) string
+	describe = func(s *resolve.Scope) string {
+		var out strings.Builder
+		out.WriteString(s.Kind.String())
+		if len(s.Children) > 0 {
+			out.WriteString("(")
+			for i, c := range s.Children {
+				if i > 0 {
+					out.WriteString(" ")
+				}
+				out.WriteString(describe(c))
+			}
+			out.WriteString(")")
+		}
+		return out.String()
+	}
+	expected := "file(package(sub(loop(block(block(block))))) class(sub(block) sub))"
+	if got := describe(info.File); got != expected {
+		t.Errorf("expected scopes\n\t%s\ngot\n\t%s", expected, got)
+	}
+
+	for node, scope := range info.Scopes {
+		if scope.Node != node {
+			t.Errorf("scope for %T records node %T", node, scope.Node)
+		}
+	}
+	sub := program.Statements[0].(*ast.PackageStatement).Body.Statements[0]
+	if scope := info.Scopes[sub]; scope.Kind != resolve.SubScope || scope.Package != "Foo" {
+		t.Errorf("expected a sub scope in Foo, got %s in %s", scope.Kind, scope.Package)
+	}
+	method := info.Scopes[program.Statements[2]]
+	if self := method.LookupLocal("$self"); self == nil || self.Kind != resolve.My {
+		t.Errorf("expected the method to declare $self, got %v", self)
+	}
+	if method.Lookup("$i") != nil {
+		t.Errorf("the loop variable leaked out of its loop")
+	}
+}
+
+func TestLabeledDeclarations(t *testing.T) {
+	program := parse(t, "L: class A; field $x; method m { $x } M: package B; $y;")
+	info := resolve.Resolve(program)
+
+	expected := []string{"$x@18 declares field $x", "$x@33 uses field $x@18", "$y@52 uses global $B::y"}
+	if got := bindings(program, info); strings.Join(got, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if len(info.File.Children) != 1 || info.File.Children[0].Kind != resolve.ClassScope {
+		t.Errorf("expected the labelled class to open a class scope, got %v", info.File.Children)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input  string
+		code   string
+		span   diagnostics.Span
+		labels []diagnostics.Span
+	}{
+		{"my $x; my $x;", diagnostics.Redeclared, diagnostics.Span{Start: 10, End: 12},
+			[]diagnostics.Span{{Start: 3, End: 5}}},
+		{"my $x; { my $x; }", diagnostics.Shadowed, diagnostics.Span{Start: 12, End: 14},
+			[]diagnostics.Span{{Start: 3, End: 5}}},
+		{"sub f($x) { my $x }", diagnostics.Redeclared, diagnostics.Span{Start: 15, End: 17},
+			[]diagnostics.Span{{Start: 6, End: 8}}},
+		{"class C { field $n; method m($n) { } }", diagnostics.Shadowed, diagnostics.Span{Start: 29, End: 31},
+			[]diagnostics.Span{{Start: 16, End: 18}}},
+		{"class C { method m { my $self } }", diagnostics.Redeclared, diagnostics.Span{Start: 24, End: 29}, nil},
+		{"my ($a, $a);", diagnostics.Redeclared, diagnostics.Span{Start: 8, End: 10},
+			[]diagnostics.Span{{Start: 4, End: 6}}},
+	}
+
+	for _, tt := range tests {
+		info := resolve.Resolve(parse(t, tt.input))
+		if len(info.Diagnostics) != 1 {
+			t.Errorf("%s: expected 1 diagnostic, got %v", tt.input, info.Diagnostics)
+			continue
+		}
+		d := info.Diagnostics[0]
+		if d.Code != tt.code || d.Severity != diagnostics.Warning {
+			t.Errorf("%s: expected warning[%s], got %s", tt.input, tt.code, d)
+		}
+		if d.Span != tt.span {
+			t.Errorf("%s: expected span %v, got %v", tt.input, tt.span, d.Span)
+		}
+		var labels []diagnostics.Span
+		for _, l := range d.Labels {
+			labels = append(labels, l.Span)
+		}
+		if fmt.Sprint(labels) != fmt.Sprint(tt.labels) {
+			t.Errorf("%s: expected labels at %v, got %v", tt.input, tt.labels, labels)
+		}
+	}
+
+	clean := []string{
+		"my $x; sub f { my $y }",
+		"for my $i (1) { } for my $i (2) { }",
+		"my $x = 1; $x = 2;",
+	}
+	for _, input := range clean {
+		if diags := resolve.Resolve(parse(t, input)).Diagnostics; len(diags) > 0 {
+			t.Errorf("%s: expected no diagnostics, got %v", input, diags)
+		}
+	}
+}
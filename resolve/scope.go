@@ -0,0 +1,128 @@
+package resolve
+
+import (
+	"fmt"
+
+	"github.com/perigrin/simian/ast"
+)
+
+// ScopeKind says what opened a Scope.
+type ScopeKind int
+
+const (
+	FileScope    ScopeKind = iota // the whole program
+	PackageScope                  // package NAME BLOCK
+	ClassScope                    // a class, with or without a block
+	SubScope                      // a sub, method or phase block
+	BlockScope                    // a bare block, a branch, or an if's condition
+	LoopScope                     // a loop and the variables its header declares
+)
+
+var scopeKinds = [...]string{"file", "package", "class", "sub", "block", "loop"}
+
+func (k ScopeKind) String() string {
+	if k < 0 || int(k) >= len(scopeKinds) {
+		return fmt.Sprintf("ScopeKind(%d)", int(k))
+	}
+	return scopeKinds[k]
+}
+
+// SymbolKind says how a Symbol was declared.
+type SymbolKind int
+
+const (
+	My     SymbolKind = iota // my, including signature parameters and $self
+	Our                      // our, a lexical alias for a package variable
+	State                    // state
+	Field                    // a class field
+	Global                   // a package variable used without a declaration
+)
+
+var symbolKinds = [...]string{"my", "our", "state", "field", "global"}
+
+func (k SymbolKind) String() string {
+	if k < 0 || int(k) >= len(symbolKinds) {
+		return fmt.Sprintf("SymbolKind(%d)", int(k))
+	}
+	return symbolKinds[k]
+}
+
+// Symbol is a variable: one declared with my, our, state or field, or a
+// package variable.
+type Symbol struct {
+	Name    string // with its sigil, such as "$x" or "@list"
+	Kind    SymbolKind
+	Package string // the package an our or Global variable lives in
+
+	// Decl is the variable in the declaration, nil for package
+	// variables and for the $self every method has.
+	Decl *ast.Variable
+
+	// Scope is the scope the symbol was declared in, nil for package
+	// variables.
+	Scope *Scope
+}
+
+// QualifiedName returns the full name of an our or Global variable,
+// such as "$main::x", and the plain name of any other.
+func (s *Symbol) QualifiedName() string {
+	if s.Kind != Our && s.Kind != Global {
+		return s.Name
+	}
+	return s.Name[:1] + s.Package + "::" + s.Name[1:]
+}
+
+func (s *Symbol) String() string {
+	return s.Kind.String() + " " + s.QualifiedName()
+}
+
+// Scope is a region of a program in which lexical variables are
+// visible. Scopes nest: a name not declared in a scope is looked for in
+// its Parent.
+type Scope struct {
+	Kind     ScopeKind
+	Node     ast.Node // what opened the scope; the Program for the file
+	Package  string   // the package in effect where the scope starts
+	Parent   *Scope
+	Children []*Scope
+
+	symbols []*Symbol
+	names   map[string]*Symbol // the latest declaration of each name
+}
+
+func newScope(kind ScopeKind, n ast.Node, pkg string, parent *Scope) *Scope {
+	s := &Scope{Kind: kind, Node: n, Package: pkg, Parent: parent, names: make(map[string]*Symbol)}
+	if parent != nil {
+		parent.Children = append(parent.Children, s)
+	}
+	return s
+}
+
+// Symbols returns the symbols declared in s, in the order they were
+// declared.
+func (s *Scope) Symbols() []*Symbol {
+	return s.symbols
+}
+
+// LookupLocal returns the symbol name is bound to in s itself, or nil.
+// When a name is declared twice in a scope the later declaration wins.
+func (s *Scope) LookupLocal(name string) *Symbol {
+	return s.names[name]
+}
+
+// Lookup returns the symbol name is bound to in s or the nearest
+// enclosing scope that declares it, or nil.
+func (s *Scope) Lookup(name string) *Symbol {
+	for ; s != nil; s = s.Parent {
+		if sym := s.names[name]; sym != nil {
+			return sym
+		}
+	}
+	return nil
+}
+
+func (s *Scope) declare(sym *Symbol) {
+	sym.Scope = s
+	s.symbols = append(s.symbols, sym)
+	s.names[sym.Name] = sym
+}
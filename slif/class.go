@@ -0,0 +1,143 @@
+package slif
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Class is a perl style character class such as [a-z_] or [^\s].
+type Class struct {
+	Negated bool
+	Ranges  []Range
+
+	// classes such as \s or \d included by escape
+	Tables []*unicode.RangeTable
+}
+
+// Range is the inclusive range of runes Lo to Hi.
+type Range struct {
+	Lo, Hi rune
+}
+
+// Matches reports whether r is in the class.
+func (c *Class) Matches(r rune) bool {
+	in := false
+	for _, rg := range c.Ranges {
+		if rg.Lo <= r && r <= rg.Hi {
+			in = true
+			break
+		}
+	}
+	if !in {
+		for _, t := range c.Tables {
+			if unicode.Is(t, r) {
+				in = true
+				break
+			}
+		}
+	}
+	return in != c.Negated
+}
+
+var (
+	spaceTable = &unicode.RangeTable{R16: []unicode.Range16{{Lo: '\t', Hi: '\r', Stride: 1}, {Lo: ' ', Hi: ' ', Stride: 1}}}
+	wordTable  = &unicode.RangeTable{R16: []unicode.Range16{
+		{Lo: '0', Hi: '9', Stride: 1},
+		{Lo: 'A', Hi: 'Z', Stride: 1},
+		{Lo: '_', Hi: '_', Stride: 1},
+		{Lo: 'a', Hi: 'z', Stride: 1},
+	}}
+)
+
+// ParseClass parses the text of a character class, brackets included.
+func ParseClass(text string) (*Class, error) {
+	if !strings.HasPrefix(text, "[") || !strings.HasSuffix(text, "]") || len(text) < 3 {
+		return nil, fmt.Errorf("malformed character class %s", text)
+	}
+	c := &Class{}
+	body := text[1 : len(text)-1]
+	if strings.HasPrefix(body, "^") {
+		c.Negated = true
+		body = body[1:]
+	}
+
+	for body != "" {
+		lo, table, rest, err := classChar(body)
+		if err != nil {
+			return nil, err
+		}
+		body = rest
+		if table != nil {
+			c.Tables = append(c.Tables, table)
+			continue
+		}
+
+		hi := lo
+		if len(body) > 1 && body[0] == '-' {
+			hi, table, rest, err = classChar(body[1:])
+			if err != nil {
+				return nil, err
+			}
+			if table != nil || hi < lo {
+				return nil, fmt.Errorf("invalid range in character class %s", text)
+			}
+			body = rest
+		}
+		c.Ranges = append(c.Ranges, Range{Lo: lo, Hi: hi})
+	}
+	return c, nil
+}
+
+// classChar reads one character, escape or named class from the start
+// of s.
+func classChar(s string) (rune, *unicode.RangeTable, string, error) {
+	if s[0] != '\\' {
+		r, size := utf8.DecodeRuneInString(s)
+		return r, nil, s[size:], nil
+	}
+	if len(s) < 2 {
+		return 0, nil, "", fmt.Errorf("trailing backslash in character class")
+	}
+
+	switch s[1] {
+	case 's':
+		return 0, spaceTable, s[2:], nil
+	case 'd':
+		return 0, unicode.Digit, s[2:], nil
+	case 'w':
+		return 0, wordTable, s[2:], nil
+	case 'n':
+		return '\n', nil, s[2:], nil
+	case 'r':
+		return '\r', nil, s[2:], nil
+	case 't':
+		return '\t', nil, s[2:], nil
+	case 'x':
+		hex, rest := s[2:], ""
+		if strings.HasPrefix(hex, "{") {
+			end := strings.IndexByte(hex, '}')
+			if end < 0 {
+				return 0, nil, "", fmt.Errorf("unclosed \\x{ in character class")
+			}
+			hex, rest = hex[1:end], hex[end+1:]
+		} else {
+			n := 0
+			for n < len(hex) && n < 2 && strings.IndexByte("0123456789abcdefABCDEF", hex[n]) >= 0 {
+				n++
+			}
+			hex, rest = hex[:n], hex[n:]
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return 0, nil, "", fmt.Errorf("invalid \\x escape in character class")
+		}
+		return rune(v), nil, rest, nil
+	default:
+		// any other escaped character stands for itself
+		r, size := utf8.DecodeRuneInString(s[1:])
+		return r, nil, s[1+size:], nil
+	}
+}
@@ -0,0 +1,175 @@
+package slif
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/earley"
+	"github.com/perigrin/simian/token"
+)
+
+// MatchLexeme reports whether the whole of text is a sym according to
+// the lexical rules.
+func (g *Grammar) MatchLexeme(sym, text string) bool {
+	m := &matcher{g: g, text: text, memo: make(map[position]map[int]bool)}
+	return m.ends(Symbol{Kind: Name, Name: sym}, 0)[len(text)]
+}
+
+type position struct {
+	symbol string
+	offset int
+}
+
+// matcher finds every way the lexical rules can match a prefix of text.
+type matcher struct {
+	g    *Grammar
+	text string
+	memo map[position]map[int]bool
+}
+
+// ends returns the offsets at which a match of sym starting at offset
+// can end.
+func (m *matcher) ends(sym Symbol, offset int) map[int]bool {
+	rest := m.text[offset:]
+	switch sym.Kind {
+	case Literal:
+		if strings.HasSuffix(sym.Name, ":i") {
+			if len(rest) >= len(sym.Value) && strings.EqualFold(rest[:len(sym.Value)], sym.Value) {
+				return map[int]bool{offset + len(sym.Value): true}
+			}
+		} else if strings.HasPrefix(rest, sym.Value) {
+			return map[int]bool{offset + len(sym.Value): true}
+		}
+		return nil
+	case CharClass:
+		r, size := utf8.DecodeRuneInString(rest)
+		if size > 0 && sym.Class != nil && sym.Class.Matches(r) {
+			return map[int]bool{offset + size: true}
+		}
+		return nil
+	}
+
+	key := position{sym.Name, offset}
+	if ends, ok := m.memo[key]; ok {
+		return ends
+	}
+	// left recursion matches nothing more on the way back in
+	m.memo[key] = nil
+
+	ends := make(map[int]bool)
+	for _, r := range m.g.lexical[sym.Name] {
+		for end := range m.ruleEnds(r, offset) {
+			ends[end] = true
+		}
+	}
+	m.memo[key] = ends
+	return ends
+}
+
+func (m *matcher) ruleEnds(r *Rule, offset int) map[int]bool {
+	if r.Quantifier != 0 {
+		ends := make(map[int]bool)
+		if r.Quantifier == '*' {
+			ends[offset] = true
+		}
+		frontier := []int{offset}
+		for len(frontier) > 0 {
+			var next []int
+			for _, p := range frontier {
+				for end := range m.ends(r.RHS[0], p) {
+					if !ends[end] && end > p {
+						ends[end] = true
+						next = append(next, end)
+					}
+				}
+			}
+			frontier = next
+		}
+		return ends
+	}
+
+	current := map[int]bool{offset: true}
+	for _, sym := range r.RHS {
+		next := make(map[int]bool)
+		for p := range current {
+			for end := range m.ends(sym, p) {
+				next[end] = true
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// Earley returns an earley grammar for the structural rules. Lexemes are
+// terminals, matching a token when the lexical rules derive its text, and
+// literals match tokens spelled the same. Rules take the action they
+// name from actions; ::first passes up its first child's value.
+//
+// Tokens from the perl lexer rarely line up with lexemes, which split
+// $x into a sigil and a name, so parse source with the grammar's
+// Scanner instead.
+func (g *Grammar) Earley(actions map[string]earley.Action) *earley.Grammar {
+	var rules []*earley.Rule
+	for _, r := range g.Rules {
+		action := actions[r.Action]
+		if r.Action == "::first" && action == nil {
+			action = first
+		}
+
+		rhs := make([]string, len(r.RHS))
+		for i, sym := range r.RHS {
+			rhs[i] = sym.Name
+		}
+		if r.Quantifier == 0 {
+			rules = append(rules, &earley.Rule{LHS: r.LHS, RHS: rhs, Action: action})
+			continue
+		}
+
+		// A ::= B* becomes A ::= | A B, and A ::= B+ becomes A ::= B | A B
+		if r.Quantifier == '*' {
+			rules = append(rules, &earley.Rule{LHS: r.LHS, Action: action})
+		} else {
+			rules = append(rules, &earley.Rule{LHS: r.LHS, RHS: rhs, Action: action})
+		}
+		repeat := []string{r.LHS}
+		if sep, ok := r.Adverbs["separator"]; ok {
+			repeat = append(repeat, sep)
+		}
+		repeat = append(repeat, rhs...)
+		rules = append(rules, &earley.Rule{LHS: r.LHS, RHS: repeat, Action: action})
+	}
+
+	eg := earley.NewGrammar(g.Start, rules...)
+	literals := make(map[string]string)
+	for _, r := range g.Rules {
+		for _, sym := range r.RHS {
+			if sym.Kind == Literal {
+				literals[sym.Name] = sym.Value
+			}
+		}
+	}
+	matches := make(map[string]bool)
+	eg.Match = func(terminal string, tok token.Token) bool {
+		if value, ok := literals[terminal]; ok {
+			return string(tok.Literal) == value
+		}
+		// the same few spellings recur, so remember each answer
+		key := terminal + " " + string(tok.Literal)
+		if matched, ok := matches[key]; ok {
+			return matched
+		}
+		matched := g.MatchLexeme(terminal, string(tok.Literal))
+		matches[key] = matched
+		return matched
+	}
+	return eg
+}
+
+func first(n *earley.Node, children []ast.Node) ast.Node {
+	if len(children) == 0 {
+		return nil
+	}
+	return children[0]
+}
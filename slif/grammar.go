@@ -0,0 +1,231 @@
+// Package slif loads grammars written in the BNF dialect of Marpa's
+// scanless interface, such as docs/guacamole_grammar.txt, and checks
+// them for undefined and unreachable symbols.
+//
+// Structural rules (::=) describe how lexemes combine into a program and
+// become earley rules. Lexical rules (~) describe the characters making
+// up each lexeme, and the Scanner uses them to split source into the
+// lexemes the parse expects.
+package slif
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/perigrin/simian/diagnostics"
+)
+
+type SymbolKind int
+
+const (
+	Name      SymbolKind = iota // a symbol defined by rules
+	Literal                     // a quoted string such as 'sub'
+	CharClass                   // a character class such as [a-z]
+)
+
+type Symbol struct {
+	Kind SymbolKind
+
+	// Name is the symbol's name, or for literals and character classes
+	// its spelling in the grammar file
+	Name string
+
+	// Value is the text of a literal
+	Value string
+
+	// Class is the set of characters matched by a character class
+	Class *Class
+
+	// Offset of the symbol in the grammar file
+	Offset int
+}
+
+type Level int
+
+const (
+	Structural Level = iota // ::= rules
+	Lexical                 // ~ rules
+)
+
+func (l Level) String() string {
+	if l == Lexical {
+		return "~"
+	}
+	return "::="
+}
+
+// Rule is one alternative of a rule in the grammar file. A sequence rule
+// has a single symbol on its right hand side repeated zero (*) or one
+// (+) or more times.
+type Rule struct {
+	LHS        string
+	RHS        []Symbol
+	Level      Level
+	Quantifier byte
+
+	// Action names the semantic action from `action =>`
+	Action string
+
+	// Adverbs holds every adverb given for the alternative, including
+	// the action, as written
+	Adverbs map[string]string
+
+	Offset int
+}
+
+func (r *Rule) String() string {
+	s := fmt.Sprintf("%s %s", r.LHS, r.Level)
+	for _, sym := range r.RHS {
+		s += " " + sym.Name
+	}
+	if r.Quantifier != 0 {
+		s += string(r.Quantifier)
+	}
+	return s
+}
+
+type Grammar struct {
+	// Start is the start symbol: from `:start ::= Symbol`, or else the
+	// left hand side of the first structural rule
+	Start string
+
+	Rules   []*Rule // structural rules in file order
+	Lexemes []*Rule // lexical rules in file order
+
+	// Discard lists the lexemes skipped between other lexemes
+	Discard []string
+
+	// Priority holds the priorities from `:lexeme ~ X priority => N`
+	Priority map[string]int
+
+	// Defaults holds the adverbs of `:default ::=` for structural rules
+	// and `lexeme default =` for lexemes
+	Defaults       map[string]string
+	LexemeDefaults map[string]string
+
+	structural map[string][]*Rule
+	lexical    map[string][]*Rule
+	offsets    map[string]int
+}
+
+func newGrammar() *Grammar {
+	return &Grammar{
+		Priority:       make(map[string]int),
+		Defaults:       make(map[string]string),
+		LexemeDefaults: make(map[string]string),
+		structural:     make(map[string][]*Rule),
+		lexical:        make(map[string][]*Rule),
+		offsets:        make(map[string]int),
+	}
+}
+
+func (g *Grammar) addRule(r *Rule) {
+	if r.Level == Lexical {
+		g.Lexemes = append(g.Lexemes, r)
+		g.lexical[r.LHS] = append(g.lexical[r.LHS], r)
+	} else {
+		g.Rules = append(g.Rules, r)
+		g.structural[r.LHS] = append(g.structural[r.LHS], r)
+		if g.Start == "" {
+			g.Start = r.LHS
+		}
+	}
+	if _, ok := g.offsets[r.LHS]; !ok {
+		g.offsets[r.LHS] = r.Offset
+	}
+}
+
+// RulesFor returns the structural rules defining sym.
+func (g *Grammar) RulesFor(sym string) []*Rule {
+	return g.structural[sym]
+}
+
+// LexemeRulesFor returns the lexical rules defining sym.
+func (g *Grammar) LexemeRulesFor(sym string) []*Rule {
+	return g.lexical[sym]
+}
+
+// IsLexeme reports whether sym is defined by lexical rules.
+func (g *Grammar) IsLexeme(sym string) bool {
+	_, ok := g.lexical[sym]
+	return ok
+}
+
+// Check reports symbols used but never defined, as errors, and symbols
+// defined but not reachable from the start symbol or the discarded
+// lexemes, as warnings.
+func (g *Grammar) Check() []diagnostics.Diagnostic {
+	var diags []diagnostics.Diagnostic
+
+	for _, rules := range [][]*Rule{g.Rules, g.Lexemes} {
+		for _, r := range rules {
+			for _, sym := range r.RHS {
+				if sym.Kind != Name || g.defined(sym.Name) {
+					continue
+				}
+				d := diagnostics.Errorf(diagnostics.UndefinedSymbol,
+					diagnostics.Span{Start: sym.Offset, End: sym.Offset + len(sym.Name)},
+					"undefined symbol `%s`", sym.Name)
+				d.Label = "not defined by any rule"
+				diags = append(diags, d)
+			}
+		}
+	}
+
+	reached := g.reachable()
+	var unreachable []string
+	for name := range g.offsets {
+		if !reached[name] {
+			unreachable = append(unreachable, name)
+		}
+	}
+	sort.Slice(unreachable, func(i, j int) bool {
+		return g.offsets[unreachable[i]] < g.offsets[unreachable[j]]
+	})
+	for _, name := range unreachable {
+		offset := g.offsets[name]
+		diags = append(diags, diagnostics.Diagnostic{
+			Severity: diagnostics.Warning,
+			Code:     diagnostics.UnreachableSymbol,
+			Message:  fmt.Sprintf("symbol `%s` is never used", name),
+			Span:     diagnostics.Span{Start: offset, End: offset + len(name)},
+			Label:    "not reachable from " + g.Start,
+		})
+	}
+	return diags
+}
+
+func (g *Grammar) defined(sym string) bool {
+	return len(g.structural[sym]) > 0 || len(g.lexical[sym]) > 0
+}
+
+func (g *Grammar) reachable() map[string]bool {
+	reached := make(map[string]bool)
+	var visit func(sym string)
+	visit = func(sym string) {
+		if reached[sym] {
+			return
+		}
+		reached[sym] = true
+		for _, r := range g.structural[sym] {
+			for _, s := range r.RHS {
+				if s.Kind == Name {
+					visit(s.Name)
+				}
+			}
+		}
+		for _, r := range g.lexical[sym] {
+			for _, s := range r.RHS {
+				if s.Kind == Name {
+					visit(s.Name)
+				}
+			}
+		}
+	}
+
+	visit(g.Start)
+	for _, sym := range g.Discard {
+		visit(sym)
+	}
+	return reached
+}
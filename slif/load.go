@@ -0,0 +1,401 @@
+package slif
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/perigrin/simian/diagnostics"
+)
+
+type itemKind int
+
+const (
+	itemEOF      itemKind = iota
+	itemName              // Symbol or <symbol with spaces>
+	itemPseudo            // :discard, :lexeme, :default or :start
+	itemOp                // ::= ~ | || = =>
+	itemLiteral           // 'text'
+	itemClass             // [chars]
+	itemQuantity          // * or +
+	itemValue             // an adverb value other than a name
+)
+
+// item is a lexical item of a grammar file.
+type item struct {
+	kind   itemKind
+	text   string
+	offset int
+}
+
+type loader struct {
+	src   []byte
+	items []item
+	pos   int
+	g     *Grammar
+	diags []diagnostics.Diagnostic
+}
+
+// Load reads a grammar file. The grammar is returned even when there
+// are diagnostics, holding every rule that could be read.
+func Load(src []byte) (*Grammar, []diagnostics.Diagnostic) {
+	l := &loader{src: src, g: newGrammar()}
+	l.scan()
+	for l.peek().kind != itemEOF {
+		l.statement()
+	}
+	return l.g, l.diags
+}
+
+func (l *loader) errorf(offset, length int, code, format string, args ...interface{}) {
+	d := diagnostics.Errorf(code, diagnostics.Span{Start: offset, End: offset + length}, format, args...)
+	l.diags = append(l.diags, d)
+}
+
+// scan splits the file into items.
+func (l *loader) scan() {
+	src := l.src
+	for i := 0; i < len(src); {
+		ch := src[i]
+		start := i
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+			continue
+		case ch == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(string(src[i:]), "::="):
+			i += 3
+			l.emit(itemOp, start, i)
+		case ch == ':' && i+1 < len(src) && src[i+1] == ':':
+			// ::first and other reserved action names
+			i = scanWord(src, i+2)
+			l.emit(itemValue, start, i)
+		case ch == ':' && i+1 < len(src) && isWordChar(src[i+1]):
+			i = scanWord(src, i+1)
+			l.emit(itemPseudo, start, i)
+		case strings.HasPrefix(string(src[i:]), "=>"):
+			i += 2
+			l.emit(itemOp, start, i)
+			if j := skipSpace(src, i); j < len(src) && src[j] == '[' {
+				// an array adverb value such as [ name, values ]
+				end := strings.IndexByte(string(src[j:]), ']')
+				if end < 0 {
+					l.errorf(j, 1, diagnostics.UnclosedDelimiter, "unclosed `[`")
+					i = len(src)
+					continue
+				}
+				i = j + end + 1
+				l.emit(itemValue, j, i)
+			}
+		case strings.HasPrefix(string(src[i:]), "||"):
+			i += 2
+			l.emit(itemOp, start, i)
+		case ch == '~' || ch == '|' || ch == '=':
+			i++
+			l.emit(itemOp, start, i)
+		case ch == '*' || ch == '+':
+			i++
+			l.emit(itemQuantity, start, i)
+		case ch == '\'':
+			end := strings.IndexAny(string(src[i+1:]), "'\n")
+			if end < 0 || src[i+1+end] != '\'' {
+				l.errorf(i, 1, diagnostics.UnterminatedString, "unterminated literal")
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+				continue
+			}
+			i += end + 2
+			if strings.HasPrefix(string(src[i:]), ":i") {
+				// case insensitive literal
+				i += 2
+			}
+			l.emit(itemLiteral, start, i)
+		case ch == '[':
+			i = scanClass(src, i)
+			if i < 0 {
+				l.errorf(start, 1, diagnostics.UnclosedDelimiter, "unclosed character class")
+				i = len(src)
+				continue
+			}
+			l.emit(itemClass, start, i)
+		case ch == '<':
+			end := strings.IndexAny(string(src[i:]), ">\n")
+			if end < 0 || src[i+end] != '>' {
+				l.errorf(i, 1, diagnostics.UnclosedDelimiter, "unclosed `<`")
+				i++
+				continue
+			}
+			i += end + 1
+			l.emit(itemName, start, i)
+		case isWordChar(ch) || ch == '-':
+			i = scanWord(src, i)
+			l.emit(itemName, start, i)
+		default:
+			l.errorf(i, 1, diagnostics.UnknownCharacter, "unknown character `%c`", ch)
+			i++
+		}
+	}
+	l.items = append(l.items, item{kind: itemEOF, offset: len(src)})
+}
+
+func (l *loader) emit(kind itemKind, start, end int) {
+	l.items = append(l.items, item{kind: kind, text: string(l.src[start:end]), offset: start})
+}
+
+func isWordChar(ch byte) bool {
+	return ch == '_' || ch == '-' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9')
+}
+
+func scanWord(src []byte, i int) int {
+	for i < len(src) && isWordChar(src[i]) {
+		i++
+	}
+	return i
+}
+
+func skipSpace(src []byte, i int) int {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// scanClass returns the offset just past the character class starting
+// at i, or -1 if it is not closed on the same line.
+func scanClass(src []byte, i int) int {
+	for i++; i < len(src) && src[i] != '\n'; i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case ']':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func (l *loader) peek() item {
+	return l.items[l.pos]
+}
+
+func (l *loader) peekAt(n int) item {
+	if l.pos+n >= len(l.items) {
+		return l.items[len(l.items)-1]
+	}
+	return l.items[l.pos+n]
+}
+
+func (l *loader) next() item {
+	it := l.items[l.pos]
+	if it.kind != itemEOF {
+		l.pos++
+	}
+	return it
+}
+
+func (l *loader) expect(kind itemKind, text string) bool {
+	it := l.peek()
+	if it.kind == kind && (text == "" || it.text == text) {
+		l.next()
+		return true
+	}
+	l.unexpected(it, "expected `"+text+"`")
+	return false
+}
+
+func (l *loader) unexpected(it item, label string) {
+	found := "`" + it.text + "`"
+	if it.kind == itemEOF {
+		found = "end of input"
+	}
+	d := diagnostics.Errorf(diagnostics.UnexpectedToken, diagnostics.Span{Start: it.offset, End: it.offset + len(it.text)},
+		"unexpected %s", found)
+	d.Label = label
+	l.diags = append(l.diags, d)
+}
+
+// startsStatement reports whether the items from the current one begin
+// a new rule or declaration.
+func (l *loader) startsStatement() bool {
+	it := l.peek()
+	switch it.kind {
+	case itemPseudo:
+		return true
+	case itemName:
+		next := l.peekAt(1)
+		if next.kind == itemOp && (next.text == "::=" || next.text == "~") {
+			return true
+		}
+		return it.text == "lexeme" && next.kind == itemName && next.text == "default"
+	}
+	return false
+}
+
+// statement reads one rule or declaration.
+func (l *loader) statement() {
+	start := l.pos
+	it := l.peek()
+	switch {
+	case it.kind == itemPseudo:
+		l.pseudoRule()
+	case it.kind == itemName && it.text == "lexeme" && l.peekAt(1).text == "default":
+		l.next()
+		l.next()
+		if l.expect(itemOp, "=") {
+			l.adverbs(l.g.LexemeDefaults)
+		}
+	case l.startsStatement():
+		l.rule()
+	default:
+		l.unexpected(it, "expected a rule")
+	}
+
+	if l.pos == start {
+		l.next()
+	}
+	// skip anything left over up to the next statement
+	for l.peek().kind != itemEOF && !l.startsStatement() {
+		l.next()
+	}
+}
+
+func (l *loader) pseudoRule() {
+	it := l.next()
+	switch it.text {
+	case ":discard":
+		if l.expect(itemOp, "~") {
+			if sym, ok := l.symbol(); ok {
+				l.g.Discard = append(l.g.Discard, sym.Name)
+			}
+		}
+	case ":lexeme":
+		if !l.expect(itemOp, "~") {
+			return
+		}
+		sym, ok := l.symbol()
+		if !ok {
+			return
+		}
+		adverbs := make(map[string]string)
+		l.adverbs(adverbs)
+		if p, ok := adverbs["priority"]; ok {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				l.errorf(sym.Offset, len(sym.Name), diagnostics.UnexpectedToken, "priority of `%s` is not a number", sym.Name)
+			}
+			l.g.Priority[sym.Name] = n
+		}
+	case ":default":
+		if l.expect(itemOp, "::=") {
+			l.adverbs(l.g.Defaults)
+		}
+	case ":start":
+		if l.expect(itemOp, "::=") {
+			if sym, ok := l.symbol(); ok {
+				l.g.Start = sym.Name
+			}
+		}
+	default:
+		l.errorf(it.offset, len(it.text), diagnostics.UnexpectedToken, "unknown declaration `%s`", it.text)
+	}
+}
+
+// rule reads `LHS ::= alternatives` or `LHS ~ alternatives`.
+func (l *loader) rule() {
+	lhs := l.next()
+	op := l.next()
+	level := Structural
+	if op.text == "~" {
+		level = Lexical
+	}
+
+	for {
+		r := &Rule{LHS: symbolName(lhs.text), Level: level, Offset: lhs.offset}
+		for l.isSymbol() {
+			sym, _ := l.symbol()
+			r.RHS = append(r.RHS, sym)
+		}
+		if l.peek().kind == itemQuantity {
+			q := l.next()
+			if len(r.RHS) != 1 {
+				l.errorf(q.offset, 1, diagnostics.UnexpectedToken, "a sequence rule must have exactly one symbol")
+			}
+			r.Quantifier = q.text[0]
+		}
+		if l.isAdverb() {
+			r.Adverbs = make(map[string]string)
+			l.adverbs(r.Adverbs)
+			r.Action = r.Adverbs["action"]
+		}
+		l.g.addRule(r)
+
+		if it := l.peek(); it.kind == itemOp && (it.text == "|" || it.text == "||") {
+			l.next()
+			continue
+		}
+		return
+	}
+}
+
+func (l *loader) isSymbol() bool {
+	switch l.peek().kind {
+	case itemName:
+		return !l.isAdverb() && !l.startsStatement()
+	case itemLiteral, itemClass:
+		return true
+	}
+	return false
+}
+
+func (l *loader) isAdverb() bool {
+	return l.peek().kind == itemName && l.peekAt(1).kind == itemOp && l.peekAt(1).text == "=>"
+}
+
+// adverbs reads `name => value` pairs into into.
+func (l *loader) adverbs(into map[string]string) {
+	for l.isAdverb() {
+		name := l.next()
+		l.next()
+		value := l.next()
+		switch value.kind {
+		case itemName, itemValue:
+			into[name.text] = value.text
+		default:
+			l.unexpected(value, "expected a value for "+name.text)
+			return
+		}
+	}
+}
+
+func (l *loader) symbol() (Symbol, bool) {
+	it := l.next()
+	switch it.kind {
+	case itemName:
+		return Symbol{Kind: Name, Name: symbolName(it.text), Offset: it.offset}, true
+	case itemLiteral:
+		value := strings.TrimSuffix(it.text, ":i")
+		return Symbol{Kind: Literal, Name: it.text, Value: value[1 : len(value)-1], Offset: it.offset}, true
+	case itemClass:
+		class, err := ParseClass(it.text)
+		if err != nil {
+			l.errorf(it.offset, len(it.text), diagnostics.UnexpectedToken, "%s", err)
+		}
+		return Symbol{Kind: CharClass, Name: it.text, Class: class, Offset: it.offset}, true
+	default:
+		l.unexpected(it, "expected a symbol")
+		return Symbol{}, false
+	}
+}
+
+// symbolName strips the angle brackets from <symbol names>, which may
+// contain spaces.
+func symbolName(text string) string {
+	if strings.HasPrefix(text, "<") {
+		return strings.Join(strings.Fields(text[1:len(text)-1]), " ")
+	}
+	return text
+}
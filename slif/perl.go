@@ -0,0 +1,952 @@
+package slif
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/earley"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/token"
+)
+
+// NewParser returns a parser.Parser reading src with g, a grammar for
+// perl that uses the symbol names of docs/guacamole_grammar.txt. Its
+// actions build the same AST as parser.Parser does for the perl both
+// understand.
+func NewParser(g *Grammar, src []byte) parser.Parser {
+	eg := g.Earley(nil)
+	b := &builder{src: src, values: make(map[*earley.Node]ast.Node)}
+	for _, r := range eg.Rules {
+		r.Action = b.action(r.LHS)
+	}
+	return earley.NewParserFrom(eg, g.Scanner(src))
+}
+
+// builder holds the actions building the AST for a perl grammar.
+type builder struct {
+	src []byte
+
+	// the value built for each node, so an action can look past its
+	// children
+	values map[*earley.Node]ast.Node
+}
+
+// values is several values passed up together, such as the items of a
+// comma list before anything decides what they are.
+type values struct {
+	nodes []ast.Node
+}
+
+func (v *values) TokenLiteral() string { return "" }
+
+func (v *values) String() string {
+	parts := make([]string, len(v.nodes))
+	for i, n := range v.nodes {
+		parts[i] = n.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// commaList is the items of an unparenthesised comma list.
+type commaList struct {
+	values
+}
+
+func (c *commaList) expressionNode() {}
+
+var (
+	binaryRule      = regexp.MustCompile(`^(NonBrace|BlockLevel)?Expr(Power|Regex|Mul|Add|Shift|Neq|Eq|BinAnd|BinOr|LogAnd|LogOr|Range|Assign|NameAnd|NameOr)[U0LR]?$`)
+	unaryRule       = regexp.MustCompile(`^(NonBrace|BlockLevel)?Expr(Unary[U0LR]|NameNot)$`)
+	incrementRule   = regexp.MustCompile(`^(NonBrace)?ExprInc[U0LR]$`)
+	conditionalRule = regexp.MustCompile(`^(NonBrace)?ExprCond[0LR]$`)
+	arrowRule       = regexp.MustCompile(`^(NonBrace)?ExprArrow[U0LR]$`)
+	commaRule       = regexp.MustCompile(`^(NonBrace)?ExprComma$`)
+	keywordRule     = regexp.MustCompile(`^OpKeyword\w+Expr$`)
+)
+
+// action returns the action for rules deriving lhs. Each records the
+// values of its children before building its own.
+func (b *builder) action(lhs string) earley.Action {
+	build := b.build(lhs)
+	return func(n *earley.Node, children []ast.Node) ast.Node {
+		for i, c := range n.Children {
+			if c.IsTerminal() {
+				children[i] = terminal(c)
+			}
+			b.values[c] = children[i]
+		}
+		return build(n, children)
+	}
+}
+
+// terminal returns the value of a lexeme: numbers and quote-like
+// strings have one, punctuation and keywords do not.
+func terminal(n *earley.Node) ast.Node {
+	switch n.Symbol {
+	case "NumberDec", "NumberOct", "NumberHex", "NumberBin", "QLikeValueExpr", "QLikeValueExprWithMods":
+		return ast.TokenToAstNode(n.Token)
+	default:
+		return nil
+	}
+}
+
+func (b *builder) build(lhs string) earley.Action {
+	switch {
+	case binaryRule.MatchString(lhs):
+		return b.binary
+	case unaryRule.MatchString(lhs):
+		return b.unary
+	case incrementRule.MatchString(lhs):
+		return b.increment
+	case conditionalRule.MatchString(lhs):
+		return b.conditional
+	case arrowRule.MatchString(lhs):
+		return b.arrow
+	case commaRule.MatchString(lhs):
+		return b.comma
+	case keywordRule.MatchString(lhs):
+		return b.keyword
+	}
+
+	switch lhs {
+	case "Program":
+		return b.program
+	case "Statement":
+		return b.statement
+	case "BlockEmpty", "BlockNonEmpty":
+		return b.block
+	case "UseStatement", "NoStatement":
+		return b.use
+	case "RequireStatement":
+		return b.require
+	case "PackageStatement", "PackageDeclaration":
+		return b.pkg
+	case "SubStatement", "SubDeclaration":
+		return b.sub
+	case "Condition", "ConditionIfExpr", "ConditionUnlessExpr", "ConditionElsifExpr":
+		return b.condition
+	case "WhileStatement", "UntilStatement":
+		return b.while
+	case "ForStatement":
+		return b.forStatement
+	case "ParenExpr":
+		return b.parens
+	case "NonLiteral":
+		return b.nonLiteral
+	case "VarScalar", "VarArray", "VarHash", "VarCode", "VarGlob", "VarArrayTop", "GlobalVarExpr", "VarDefaultArg":
+		return b.variable
+	case "ArrayElem", "HashElem":
+		return b.element
+	case "DerefVariable":
+		return b.deref
+	case "LitString", "InterpolString":
+		return b.str
+	case "LitArray":
+		return b.array
+	case "LitHashEmpty", "LitHashNonEmpty":
+		return b.hash
+	case "SubCall":
+		return b.call
+	case "SubNameExpr", "SubNameCallExpr", "VarIdentExpr":
+		return b.identifier
+	case "VersionExpr":
+		return b.version
+	case "PackageArrow":
+		return b.arrow
+	case "ArrowDerefCall":
+		return b.arrowCall
+	case "ArrowMethodCall", "ArrowIndirectCall":
+		return b.methodCall
+	case "DerefVariableArgsAll":
+		return b.postfixDeref
+	case "DerefVariableSlice":
+		return b.postfixSlice
+	}
+	return pass
+}
+
+// pass is the action for rules with nothing of their own to build: it
+// passes up the values of the children.
+func pass(n *earley.Node, children []ast.Node) ast.Node {
+	nodes := flatten(children)
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	default:
+		return &values{nodes: nodes}
+	}
+}
+
+// flatten expands the values passed up together and drops nils.
+func flatten(nodes []ast.Node) []ast.Node {
+	var result []ast.Node
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case nil:
+		case *values:
+			result = append(result, flatten(n.nodes)...)
+		default:
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// expressions returns the items of a comma list, or v alone.
+func expressions(v ast.Node) []ast.Expression {
+	var nodes []ast.Node
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case *commaList:
+		nodes = v.nodes
+	case *values:
+		nodes = flatten(v.nodes)
+	default:
+		nodes = []ast.Node{v}
+	}
+	var result []ast.Expression
+	for _, n := range nodes {
+		if e, ok := n.(ast.Expression); ok {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// arguments returns the items of a parenthesised list, or v alone.
+func arguments(v ast.Node) []ast.Expression {
+	if list, ok := v.(*ast.ListLiteral); ok {
+		return list.Elements
+	}
+	return expressions(v)
+}
+
+// expression returns v as an expression, making a comma list a list.
+func expression(v ast.Node, tok token.Token) ast.Expression {
+	switch v := v.(type) {
+	case *commaList:
+		return &ast.ListLiteral{Token: tok, Elements: expressions(v)}
+	case ast.Expression:
+		return v
+	default:
+		return nil
+	}
+}
+
+// statements returns the statements among nodes, wrapping expressions.
+func (b *builder) statements(nodes []ast.Node) []ast.Statement {
+	result := []ast.Statement{}
+	for _, n := range flatten(nodes) {
+		switch n := n.(type) {
+		case ast.Statement:
+			result = append(result, n)
+		case ast.Expression:
+			result = append(result, &ast.ExpressionStatement{Expression: n})
+		}
+	}
+	return result
+}
+
+// edge returns the first or last token n derives.
+func edge(n *earley.Node, last bool) (token.Token, bool) {
+	for !n.IsTerminal() {
+		var next *earley.Node
+		for i := range n.Children {
+			c := n.Children[i]
+			if last {
+				c = n.Children[len(n.Children)-1-i]
+			}
+			if c.End > c.Start {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return token.Token{}, false
+		}
+		n = next
+	}
+	return n.Token, true
+}
+
+// firstToken returns the first token n derives.
+func firstToken(n *earley.Node) token.Token {
+	tok, _ := edge(n, false)
+	return tok
+}
+
+// text returns a token of type t spanning the source of nodes.
+func (b *builder) text(t token.TokenType, nodes ...*earley.Node) token.Token {
+	start, ok := edge(nodes[0], false)
+	if !ok {
+		return token.Token{Type: t}
+	}
+	end, _ := edge(nodes[len(nodes)-1], true)
+	return token.Token{
+		Type:    t,
+		Literal: b.src[start.Offset : end.Offset+len(end.Literal)],
+		Offset:  start.Offset,
+	}
+}
+
+// child returns the index of n's first child deriving sym, or -1.
+func child(n *earley.Node, sym string) int {
+	for i, c := range n.Children {
+		if c.Symbol == sym {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *builder) program(n *earley.Node, children []ast.Node) ast.Node {
+	return &ast.Program{Statements: b.statements(children)}
+}
+
+func (b *builder) block(n *earley.Node, children []ast.Node) ast.Node {
+	return &ast.BlockStatement{Token: n.Children[0].Token, Statements: b.statements(children)}
+}
+
+func (b *builder) statement(n *earley.Node, children []ast.Node) ast.Node {
+	if s, ok := children[0].(ast.Statement); ok {
+		return s
+	}
+	stmt := b.simple(expression(children[0], firstToken(n)), firstToken(n))
+	if len(n.Children) == 1 {
+		return stmt
+	}
+	// BlockLevelExpression StatementModifier
+	modifier := n.Children[1]
+	return &ast.ModifiedStatement{
+		Token:     firstToken(modifier),
+		Statement: stmt,
+		Condition: expression(children[1], firstToken(modifier)),
+	}
+}
+
+// simple returns the statement an expression at the top of a statement
+// is: a declaration, a return or loop control, or else just itself.
+func (b *builder) simple(e ast.Expression, tok token.Token) ast.Statement {
+	switch e := e.(type) {
+	case *ast.Declaration:
+		if !e.Parens {
+			return &ast.MyStatement{Token: e.Token, Type: e.Type, Name: e.Variables[0]}
+		}
+	case *ast.InfixExpression:
+		if d, ok := e.Left.(*ast.Declaration); ok && e.Operator == "=" && !d.Parens {
+			return &ast.MyStatement{Token: d.Token, Type: d.Type, Name: d.Variables[0], Value: e.Right}
+		}
+	case *ast.Identifier:
+		switch e.Value {
+		case "return":
+			return &ast.ReturnStatement{Token: e.Token}
+		case "next", "last", "redo":
+			return &ast.LoopControlStatement{Token: e.Token}
+		}
+	case *ast.CallExpression:
+		name, _ := e.Function.(*ast.Identifier)
+		switch {
+		case name == nil:
+		case name.Value == "return":
+			rs := &ast.ReturnStatement{Token: name.Token}
+			if len(e.Arguments) == 1 {
+				rs.ReturnValue = e.Arguments[0]
+			} else if len(e.Arguments) > 1 {
+				rs.ReturnValue = &ast.ListLiteral{Token: e.Token, Elements: e.Arguments}
+			}
+			return rs
+		case name.Value == "next" || name.Value == "last" || name.Value == "redo":
+			lc := &ast.LoopControlStatement{Token: name.Token}
+			if len(e.Arguments) == 1 {
+				lc.Label, _ = e.Arguments[0].(*ast.Identifier)
+			}
+			return lc
+		}
+	}
+	return &ast.ExpressionStatement{Token: tok, Expression: e}
+}
+
+func (b *builder) binary(n *earley.Node, children []ast.Node) ast.Node {
+	if len(n.Children) != 3 {
+		return pass(n, children)
+	}
+	op := n.Children[1].Token
+	return &ast.InfixExpression{
+		Token:    op,
+		Left:     expression(children[0], firstToken(n)),
+		Operator: string(op.Literal),
+		Right:    expression(children[2], firstToken(n.Children[2])),
+	}
+}
+
+func (b *builder) unary(n *earley.Node, children []ast.Node) ast.Node {
+	if len(n.Children) != 2 {
+		return pass(n, children)
+	}
+	op := n.Children[0].Token
+	return &ast.PrefixExpression{
+		Token:    op,
+		Operator: string(op.Literal),
+		Right:    expression(children[1], firstToken(n.Children[1])),
+	}
+}
+
+func (b *builder) increment(n *earley.Node, children []ast.Node) ast.Node {
+	switch {
+	case len(n.Children) != 2:
+		return pass(n, children)
+	case n.Children[0].IsTerminal():
+		op := n.Children[0].Token
+		return &ast.PrefixExpression{Token: op, Operator: string(op.Literal), Right: expression(children[1], op)}
+	default:
+		op := n.Children[1].Token
+		return &ast.PostfixExpression{Token: op, Left: expression(children[0], op), Operator: string(op.Literal)}
+	}
+}
+
+func (b *builder) conditional(n *earley.Node, children []ast.Node) ast.Node {
+	if len(n.Children) != 5 {
+		return pass(n, children)
+	}
+	tok := n.Children[1].Token
+	return &ast.ConditionalExpression{
+		Token:       tok,
+		Condition:   expression(children[0], tok),
+		Consequence: expression(children[2], tok),
+		Alternative: expression(children[4], tok),
+	}
+}
+
+func (b *builder) comma(n *earley.Node, children []ast.Node) ast.Node {
+	if len(n.Children) == 1 {
+		return children[0]
+	}
+	list := &commaList{}
+	list.nodes = append(list.nodes, children[0])
+	if len(children) == 3 {
+		if rest, ok := children[2].(*commaList); ok {
+			list.nodes = append(list.nodes, rest.nodes...)
+		} else if children[2] != nil {
+			list.nodes = append(list.nodes, children[2])
+		}
+	}
+	return list
+}
+
+// parens is ( EXPR ), which is EXPR unless it is a list.
+func (b *builder) parens(n *earley.Node, children []ast.Node) ast.Node {
+	tok := n.Children[0].Token
+	if len(n.Children) == 2 {
+		return &ast.ListLiteral{Token: tok, Elements: []ast.Expression{}}
+	}
+	return expression(children[1], tok)
+}
+
+// parenthesised reports whether n derives nothing but a parenthesised
+// expression, as the arguments in print("x") do.
+func parenthesised(n *earley.Node) bool {
+	for !n.IsTerminal() {
+		if n.Symbol == "ParenExpr" {
+			return true
+		}
+		var next *earley.Node
+		for _, c := range n.Children {
+			if c.End == c.Start {
+				continue
+			}
+			if next != nil {
+				return false
+			}
+			next = c
+		}
+		if next == nil {
+			return false
+		}
+		n = next
+	}
+	return false
+}
+
+func (b *builder) nonLiteral(n *earley.Node, children []ast.Node) ast.Node {
+	switch {
+	case n.Children[0].Symbol == "Modifier":
+		tok := firstToken(n)
+		if string(tok.Literal) == "local" {
+			return &ast.CallExpression{
+				Token:     tok,
+				Function:  &ast.Identifier{Token: tok, Value: "local"},
+				Arguments: expressions(children[1]),
+			}
+		}
+		d := &ast.Declaration{Token: tok, Parens: n.Children[1].Symbol == "ParenExpr"}
+		for _, e := range arguments(children[1]) {
+			if v, ok := e.(*ast.Variable); ok {
+				d.Variables = append(d.Variables, v)
+			}
+		}
+		return d
+	case n.Children[0].Symbol == "ParenExpr" && len(n.Children) == 2:
+		return chain(expression(children[0], firstToken(n)), children[1])
+	}
+	return pass(n, children)
+}
+
+// chain applies the subscripts in elements to e in turn. Subscripts
+// after the first are reached through an implied arrow.
+func chain(e ast.Expression, elements ast.Node) ast.Expression {
+	for i, el := range flatten([]ast.Node{elements}) {
+		ix, ok := el.(*ast.Index)
+		if !ok {
+			continue
+		}
+		ix.Left = e
+		ix.Arrow = i > 0
+		e = ix
+	}
+	return e
+}
+
+// variable is a sigil and name, and any subscripts after them.
+func (b *builder) variable(n *earley.Node, children []ast.Node) ast.Node {
+	last := len(n.Children) - 1
+	if last == 0 || !strings.HasPrefix(n.Children[last].Symbol, "ElemSeq") {
+		return ast.NewVariableExpression(b.text(token.IDENTIFIER, n))
+	}
+	v := ast.NewVariableExpression(b.text(token.IDENTIFIER, n.Children[:last]...))
+	return chain(v, children[last])
+}
+
+func (b *builder) element(n *earley.Node, children []ast.Node) ast.Node {
+	tok := n.Children[0].Token
+	return &ast.Index{Token: tok, Index: expression(children[1], tok)}
+}
+
+func (b *builder) deref(n *earley.Node, children []ast.Node) ast.Node {
+	sigil := n.Children[0].Token
+	var value ast.Expression
+	if block, ok := children[1].(*ast.BlockStatement); ok && len(block.Statements) == 1 {
+		if es, ok := block.Statements[0].(*ast.ExpressionStatement); ok {
+			value = es.Expression
+		}
+	}
+	s, _ := ast.LookupSigil(string(sigil.Literal))
+	d := &ast.Dereference{Token: sigil, Sigil: s, Value: value}
+	if len(children) > 2 {
+		return chain(d, children[2])
+	}
+	return d
+}
+
+func (b *builder) str(n *earley.Node, children []ast.Node) ast.Node {
+	return ast.NewStringLiteral(b.text(token.STRING, n))
+}
+
+func (b *builder) array(n *earley.Node, children []ast.Node) ast.Node {
+	tok := n.Children[0].Token
+	elements := []ast.Expression{}
+	if len(children) == 3 {
+		elements = append(elements, expressions(children[1])...)
+	}
+	return &ast.ArrayLiteral{Token: tok, Elements: elements}
+}
+
+func (b *builder) hash(n *earley.Node, children []ast.Node) ast.Node {
+	tok := n.Children[0].Token
+	elements := []ast.Expression{}
+	if len(children) == 3 {
+		elements = append(elements, expressions(children[1])...)
+	}
+	return &ast.HashLiteral{Token: tok, Elements: elements}
+}
+
+func (b *builder) identifier(n *earley.Node, children []ast.Node) ast.Node {
+	tok := b.text(token.IDENTIFIER, n)
+	return &ast.Identifier{Token: tok, Value: string(tok.Literal)}
+}
+
+func (b *builder) version(n *earley.Node, children []ast.Node) ast.Node {
+	tok := b.text(token.VERSION, n)
+	return &ast.VersionLiteral{Token: tok, Value: string(tok.Literal)}
+}
+
+// call is NAME(ARGS) or &NAME(ARGS).
+func (b *builder) call(n *earley.Node, children []ast.Node) ast.Node {
+	function, _ := children[0].(ast.Expression)
+	return &ast.CallExpression{
+		Token:     firstToken(n.Children[1]),
+		Function:  function,
+		Arguments: arguments(children[1]),
+	}
+}
+
+// keyword is a named operator such as print, shift or return, and its
+// operands.
+func (b *builder) keyword(n *earley.Node, children []ast.Node) ast.Node {
+	kw := n.Children[0].Token
+	name := &ast.Identifier{Token: kw, Value: string(kw.Literal)}
+	if len(n.Children) == 1 {
+		return name
+	}
+
+	call := &ast.CallExpression{Token: kw, Function: name}
+	for i, c := range n.Children[1:] {
+		v := children[i+1]
+		switch c.Symbol {
+		case "BlockNonEmpty":
+			call.Block, _ = v.(*ast.BlockStatement)
+		case "BuiltinFilehandle":
+			fh := &ast.Identifier{Token: c.Token, Value: string(c.Token.Literal)}
+			call.Block = &ast.BlockStatement{
+				Token:      c.Token,
+				Statements: []ast.Statement{&ast.ExpressionStatement{Token: c.Token, Expression: fh}},
+			}
+		case "LParen":
+			call.Token = c.Token
+			call.Arguments = []ast.Expression{}
+		case "Label":
+			tok := firstToken(c)
+			call.Arguments = append(call.Arguments, &ast.Identifier{Token: tok, Value: string(tok.Literal)})
+		default:
+			if c.IsTerminal() {
+				continue
+			}
+			if call.Block == nil && parenthesised(c) {
+				// print("x") rather than print ("x"), 1
+				call.Token = firstToken(c)
+				call.Arguments = append([]ast.Expression{}, arguments(v)...)
+				continue
+			}
+			call.Arguments = append(call.Arguments, expressions(v)...)
+		}
+	}
+	return call
+}
+
+// arrow is EXPR -> RHS, where the right hand side was built without
+// knowing what it applies to.
+func (b *builder) arrow(n *earley.Node, children []ast.Node) ast.Node {
+	if len(n.Children) != 3 {
+		return pass(n, children)
+	}
+	arrow := n.Children[1].Token
+	left := expression(children[0], firstToken(n))
+	switch rhs := children[2].(type) {
+	case *ast.CallExpression:
+		rhs.Token, rhs.Function = arrow, left
+		return rhs
+	case *ast.MethodCall:
+		rhs.Token, rhs.Invocant = arrow, left
+		return rhs
+	case *ast.PostfixDeref:
+		rhs.Left = left
+		return rhs
+	case *ast.PostfixSlice:
+		rhs.Left = left
+		return rhs
+	case *ast.Variable:
+		return &ast.MethodCall{Token: arrow, Invocant: left, Method: &ast.Identifier{Token: rhs.Token, Value: rhs.String()}}
+	}
+	e := chain(left, children[2])
+	for ix, ok := e.(*ast.Index); ok; ix, ok = ix.Left.(*ast.Index) {
+		ix.Arrow = true
+		if ix.Left == left {
+			break
+		}
+	}
+	return e
+}
+
+func (b *builder) arrowCall(n *earley.Node, children []ast.Node) ast.Node {
+	return &ast.CallExpression{Arrow: true, Arguments: arguments(children[0])}
+}
+
+func (b *builder) methodCall(n *earley.Node, children []ast.Node) ast.Node {
+	mc := &ast.MethodCall{}
+	args := len(n.Children) - 1
+	switch n.Symbol {
+	case "ArrowIndirectCall":
+		tok := b.text(token.IDENTIFIER, n.Children[:2]...)
+		mc.Method = &ast.Identifier{Token: tok, Value: string(tok.Literal)}
+	default:
+		mc.Method, _ = children[0].(*ast.Identifier)
+		if len(n.Children) == 1 {
+			return mc
+		}
+	}
+	mc.Arguments = append([]ast.Expression{}, arguments(children[args])...)
+	return mc
+}
+
+func (b *builder) postfixDeref(n *earley.Node, children []ast.Node) ast.Node {
+	tok := n.Children[0].Token
+	sigil, _ := ast.LookupSigil(strings.TrimSuffix(string(tok.Literal), "*"))
+	return &ast.PostfixDeref{Token: tok, Sigil: sigil}
+}
+
+func (b *builder) postfixSlice(n *earley.Node, children []ast.Node) ast.Node {
+	open := n.Children[0].Token
+	sigil := open
+	sigil.Literal = open.Literal[:1]
+	bracket := open
+	bracket.Literal, bracket.Offset = open.Literal[1:], open.Offset+1
+	bracket.Type = token.LBRACKET
+	if bracket.Literal[0] == '{' {
+		bracket.Type = token.LBRACE
+	}
+	s, _ := ast.LookupSigil(string(sigil.Literal))
+	return &ast.PostfixSlice{
+		Token:   sigil,
+		Sigil:   s,
+		Bracket: bracket,
+		Index:   expression(children[1], open),
+	}
+}
+
+// use is use or no with a module or version and imports.
+func (b *builder) use(n *earley.Node, children []ast.Node) ast.Node {
+	var module *ast.Identifier
+	var version *ast.VersionLiteral
+	var imports []ast.Expression
+	for i, c := range n.Children[1:] {
+		switch v := children[i+1].(type) {
+		case *ast.Identifier:
+			if c.Symbol == "ClassIdent" {
+				module = v
+				continue
+			}
+			imports = append(imports, v)
+		case *ast.VersionLiteral:
+			version = v
+		case *ast.ListLiteral:
+			imports = append([]ast.Expression{}, v.Elements...)
+		default:
+			imports = append(imports, expressions(v)...)
+		}
+	}
+	tok := n.Children[0].Token
+	if n.Symbol == "NoStatement" {
+		return &ast.NoStatement{Token: tok, Module: module, Version: version, Imports: imports}
+	}
+	return &ast.UseStatement{Token: tok, Module: module, Version: version, Imports: imports}
+}
+
+func (b *builder) require(n *earley.Node, children []ast.Node) ast.Node {
+	rs := &ast.RequireStatement{Token: n.Children[0].Token}
+	switch v := children[1].(type) {
+	case *ast.VersionLiteral:
+		rs.Version = v
+	case *ast.Identifier:
+		if n.Children[1].Symbol == "ClassIdent" {
+			rs.Module = v
+		} else {
+			rs.Value = v
+		}
+	default:
+		rs.Value = expression(v, firstToken(n.Children[1]))
+	}
+	return rs
+}
+
+func (b *builder) pkg(n *earley.Node, children []ast.Node) ast.Node {
+	tok := n.Children[0].Token
+	name, _ := children[1].(*ast.Identifier)
+	var version *ast.VersionLiteral
+	var body *ast.BlockStatement
+	for _, v := range children[2:] {
+		switch v := v.(type) {
+		case *ast.VersionLiteral:
+			version = v
+		case *ast.BlockStatement:
+			body = v
+		}
+	}
+	if n.Symbol == "PackageDeclaration" {
+		return &ast.PackageDeclaration{Token: tok, Name: name, Version: version}
+	}
+	return &ast.PackageStatement{Token: tok, Name: name, Version: version, Body: body}
+}
+
+// sub is a named sub, its forward declaration or a phase block.
+func (b *builder) sub(n *earley.Node, children []ast.Node) ast.Node {
+	if i := child(n, "PhaseStatement"); i >= 0 {
+		tok := firstToken(n.Children[i])
+		body, _ := children[len(children)-1].(*ast.BlockStatement)
+		return &ast.PhaseBlock{Token: tok, Phase: string(tok.Literal), Body: body}
+	}
+
+	ss := &ast.SubStatement{Token: n.Children[0].Token}
+	ss.Name, _ = children[1].(*ast.Identifier)
+	if len(n.Children) < 3 {
+		return ss
+	}
+	b.definition(n.Children[2], &ss.Attributes, &ss.Signature, &ss.Body)
+	return ss
+}
+
+// definition fills in the attributes, signature and body of a sub from
+// its SubDefinition.
+func (b *builder) definition(n *earley.Node, attributes *[]*ast.Attribute, signature **ast.Signature, body **ast.BlockStatement) {
+	for _, c := range n.Children {
+		switch c.Symbol {
+		case "SubAttrsDefinitionSeq":
+			*attributes = b.attributes(c)
+		case "SubSigsDefinition":
+			sig := &ast.Signature{Token: firstToken(c), Parameters: []*ast.Parameter{}}
+			for _, e := range arguments(b.values[c]) {
+				param := &ast.Parameter{}
+				if assign, ok := e.(*ast.InfixExpression); ok && assign.Operator == "=" {
+					e, param.Default = assign.Left, assign.Right
+				}
+				if v, ok := e.(*ast.Variable); ok {
+					param.Name = v
+					sig.Parameters = append(sig.Parameters, param)
+				}
+			}
+			*signature = sig
+		case "Block":
+			*body, _ = b.values[c].(*ast.BlockStatement)
+		}
+	}
+}
+
+func (b *builder) attributes(n *earley.Node) []*ast.Attribute {
+	var attrs []*ast.Attribute
+	for !n.IsTerminal() {
+		var def *earley.Node
+		var rest *earley.Node
+		for _, c := range n.Children {
+			switch c.Symbol {
+			case "SubAttrsDefinition":
+				def = c
+			case "SubAttrsDefinitionSeq":
+				rest = c
+			}
+		}
+		if def != nil {
+			tok := b.text(token.IDENTIFIER, def.Children[:2]...)
+			attr := &ast.Attribute{Token: tok, Name: string(def.Children[1].Token.Literal)}
+			if len(def.Children) == 3 {
+				args := string(def.Children[2].Token.Literal)
+				attr.Args = args[1 : len(args)-1]
+			}
+			attrs = append(attrs, attr)
+		}
+		if rest == nil {
+			break
+		}
+		n = rest
+	}
+	return attrs
+}
+
+// condition builds if, unless and elsif statements, chaining the elsif
+// and else branches as alternatives.
+func (b *builder) condition(n *earley.Node, children []ast.Node) ast.Node {
+	if n.Symbol != "Condition" {
+		// KEYWORD ( EXPR ) BLOCK, then any elsifs
+		is := &ast.IfStatement{
+			Token:     n.Children[0].Token,
+			Condition: expression(children[2], n.Children[1].Token),
+		}
+		is.Consequence, _ = children[4].(*ast.BlockStatement)
+		if len(children) > 5 {
+			is.Alternative, _ = children[5].(*ast.IfStatement)
+		}
+		return is
+	}
+
+	is, _ := children[0].(*ast.IfStatement)
+	last := is
+	for _, c := range children[1:] {
+		switch c := c.(type) {
+		case *ast.IfStatement:
+			last.Alternative = c
+			for {
+				next, ok := c.Alternative.(*ast.IfStatement)
+				if !ok {
+					break
+				}
+				c = next
+			}
+			last = c
+		case *ast.BlockStatement:
+			last.Alternative = c
+		}
+	}
+	return is
+}
+
+func (b *builder) while(n *earley.Node, children []ast.Node) ast.Node {
+	ws := &ast.WhileStatement{Token: firstToken(n)}
+	var blocks []*ast.BlockStatement
+	for i, c := range n.Children {
+		switch {
+		case c.Symbol == "Expression":
+			ws.Condition = expression(children[i], firstToken(c))
+		case c.Symbol == "Block":
+			block, _ := children[i].(*ast.BlockStatement)
+			blocks = append(blocks, block)
+		}
+	}
+	ws.Body = blocks[0]
+	if len(blocks) > 1 {
+		ws.Continue = blocks[1]
+	}
+	return ws
+}
+
+func (b *builder) forStatement(n *earley.Node, children []ast.Node) ast.Node {
+	tok := firstToken(n)
+	var body, cont *ast.BlockStatement
+	if i := child(n, "Block"); i >= 0 {
+		body, _ = children[i].(*ast.BlockStatement)
+	}
+	if i := child(n, "ContinueExpr"); i >= 0 {
+		cont, _ = b.values[n.Children[i].Children[1]].(*ast.BlockStatement)
+	}
+
+	if child(n, "Semicolon") < 0 {
+		// foreach: my $x (LIST), $x (LIST) or (LIST)
+		fs := &ast.ForeachStatement{Token: tok, Body: body, Continue: cont}
+		for i, c := range n.Children {
+			switch c.Symbol {
+			case "OpKeywordMy":
+				fs.Variable = &ast.Declaration{Token: c.Token}
+			case "VarScalar":
+				v, _ := children[i].(*ast.Variable)
+				if d, ok := fs.Variable.(*ast.Declaration); ok {
+					d.Variables = []*ast.Variable{v}
+				} else {
+					fs.Variable = v
+				}
+			case "Expression":
+				fs.List = expression(children[i], firstToken(c))
+			}
+		}
+		return fs
+	}
+
+	// C-style: the three parts are statements between the semicolons
+	fs := &ast.ForStatement{Token: tok, Body: body}
+	parts := []*ast.Expression{&fs.Init, &fs.Condition, &fs.Step}
+	part := 0
+	for _, c := range n.Children[2:] {
+		switch c.Symbol {
+		case "Semicolon":
+			part++
+		case "Statement":
+			*parts[part] = b.expressionOf(c)
+		}
+	}
+	return fs
+}
+
+// expressionOf returns the expression a Statement node holds, before
+// statement tells declarations from other expressions.
+func (b *builder) expressionOf(n *earley.Node) ast.Expression {
+	return expression(b.values[n.Children[0]], firstToken(n))
+}
@@ -0,0 +1,129 @@
+package slif
+
+import (
+	"unicode/utf8"
+
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/earley"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/token"
+)
+
+// Scanner returns an earley.Scanner splitting src into lexemes the way
+// Marpa's longest acceptable tokens match does: discarded lexemes are
+// skipped, then of the lexemes and literals the parser expects next the
+// longest matches win, keeping those of the highest priority. Parse the
+// tokens with the grammar from Earley.
+func (g *Grammar) Scanner(src []byte) earley.Scanner {
+	s := &scanner{
+		g:         g,
+		src:       src,
+		m:         &matcher{g: g, text: string(src), memo: make(map[position]map[int]bool)},
+		terminals: make(map[string]Symbol),
+	}
+	for _, r := range g.Rules {
+		for _, sym := range r.RHS {
+			if sym.Kind == Literal || g.IsLexeme(sym.Name) {
+				s.terminals[sym.Name] = sym
+			}
+		}
+	}
+	return s
+}
+
+type scanner struct {
+	g   *Grammar
+	src []byte
+	m   *matcher
+	pos int
+
+	// the symbol each terminal of the structural rules names
+	terminals map[string]Symbol
+
+	diagnostics []diagnostics.Diagnostic
+}
+
+func (s *scanner) Diagnostics() []diagnostics.Diagnostic {
+	return s.diagnostics
+}
+
+func (s *scanner) Scan(expected []string) (token.Token, []string) {
+	s.skip()
+	if s.pos >= len(s.src) {
+		return token.Token{Type: token.EOF, Offset: len(s.src)}, nil
+	}
+
+	end := s.pos
+	var accepted []string
+	for _, t := range expected {
+		sym, ok := s.terminals[t]
+		if !ok {
+			continue
+		}
+		e := s.longest(sym)
+		switch {
+		case e <= s.pos || e < end:
+			continue
+		case e > end:
+			end = e
+			accepted = accepted[:0]
+		case s.g.Priority[t] > s.g.Priority[accepted[0]]:
+			accepted = accepted[:0]
+		case s.g.Priority[t] < s.g.Priority[accepted[0]]:
+			continue
+		}
+		accepted = append(accepted, t)
+	}
+
+	if len(accepted) == 0 {
+		// nothing expected is here, so report the token perl would see
+		end = s.pos + len(lexer.New(s.src[s.pos:]).NextToken().Literal)
+		if end == s.pos {
+			_, size := utf8.DecodeRune(s.src[s.pos:])
+			end += size
+		}
+	}
+
+	tok := token.Token{Literal: s.src[s.pos:end], Offset: s.pos}
+	tok.Type = typeOf(tok.Literal)
+	s.pos = end
+	return tok, accepted
+}
+
+// skip moves past the discarded lexemes at the current position.
+func (s *scanner) skip() {
+	for {
+		end := s.pos
+		for _, d := range s.g.Discard {
+			if e := s.longest(Symbol{Kind: Name, Name: d}); e > end {
+				end = e
+			}
+		}
+		if end == s.pos {
+			return
+		}
+		s.pos = end
+	}
+}
+
+// longest returns where the longest match of sym at the current position
+// ends.
+func (s *scanner) longest(sym Symbol) int {
+	end := s.pos
+	for e := range s.m.ends(sym, s.pos) {
+		if e > end {
+			end = e
+		}
+	}
+	return end
+}
+
+// typeOf returns the type the lexer gives text when it reads it as a
+// single token, so ast.TokenToAstNode can build values from lexemes.
+func typeOf(text []byte) token.TokenType {
+	tok := lexer.New(text).NextToken()
+	if len(tok.Literal) != len(text) {
+		return token.INVALID
+	}
+	return tok.Type
+}
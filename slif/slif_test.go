@@ -0,0 +1,297 @@
+package slif_test
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/slif"
+)
+
+const testGrammar = `
+lexeme default = latm => 1
+:default ::= action => [ name, values ]
+
+Program    ::= Statement+
+Statement  ::= UseStatement Semicolon
+             | Expression Semicolon     action => ::first
+UseStatement ::= OpKeywordUse ClassIdent
+Expression ::= Digits
+             | Expression OpAdd Digits  name => Sum
+Args       ::= Digits* separator => Comma
+
+OpKeywordUse ~ 'use'
+ClassIdent   ~ IdentComp | IdentComp '::' ClassIdent
+IdentComp    ~ [a-zA-Z_] <ident chars>
+<ident chars> ~ [a-zA-Z_0-9]*
+Digits       ~ [0-9]+
+OpAdd        ~ '+' | '-'
+Semicolon    ~ ';'
+Comma        ~ ','
+
+:discard ~ whitespace
+whitespace ~ [\s]+
+
+:lexeme ~ OpKeywordUse priority => 1
+`
+
+func load(t *testing.T, src string) *slif.Grammar {
+	g, diags := slif.Load([]byte(src))
+	for _, d := range diags {
+		t.Errorf("unexpected diagnostic: %s", d)
+	}
+	return g
+}
+
+func TestLoad(t *testing.T) {
+	g := load(t, testGrammar)
+
+	if g.Start != "Program" {
+		t.Errorf("expected start Program, got %s", g.Start)
+	}
+	if len(g.Rules) != 7 {
+		t.Errorf("expected 7 structural rules, got %d", len(g.Rules))
+	}
+	if len(g.Lexemes) != 11 {
+		t.Errorf("expected 11 lexical rules, got %d", len(g.Lexemes))
+	}
+	if g.LexemeDefaults["latm"] != "1" {
+		t.Errorf("expected lexeme default latm => 1, got %v", g.LexemeDefaults)
+	}
+	if g.Defaults["action"] != "[ name, values ]" {
+		t.Errorf("expected default action, got %v", g.Defaults)
+	}
+	if len(g.Discard) != 1 || g.Discard[0] != "whitespace" {
+		t.Errorf("expected whitespace to be discarded, got %v", g.Discard)
+	}
+	if g.Priority["OpKeywordUse"] != 1 {
+		t.Errorf("expected OpKeywordUse priority 1, got %v", g.Priority)
+	}
+
+	program := g.RulesFor("Program")[0]
+	if program.Quantifier != '+' || len(program.RHS) != 1 || program.RHS[0].Name != "Statement" {
+		t.Errorf("expected Program ::= Statement+, got %s", program)
+	}
+	statements := g.RulesFor("Statement")
+	if len(statements) != 2 || statements[0].Action != "" || statements[1].Action != "::first" {
+		t.Errorf("expected the action on the second alternative only, got %v", statements)
+	}
+	if sum := g.RulesFor("Expression")[1]; sum.Adverbs["name"] != "Sum" {
+		t.Errorf("expected name => Sum, got %v", sum.Adverbs)
+	}
+	if args := g.RulesFor("Args")[0]; args.Quantifier != '*' || args.Adverbs["separator"] != "Comma" {
+		t.Errorf("expected Args ::= Digits* separator => Comma, got %s %v", args, args.Adverbs)
+	}
+	if rules := g.LexemeRulesFor("ident chars"); len(rules) != 1 || rules[0].RHS[0].Kind != slif.CharClass {
+		t.Errorf("expected <ident chars> to be a character class sequence, got %v", rules)
+	}
+}
+
+func TestMatchLexeme(t *testing.T) {
+	g := load(t, testGrammar)
+
+	tests := []struct {
+		lexeme string
+		text   string
+		match  bool
+	}{
+		{"OpKeywordUse", "use", true},
+		{"OpKeywordUse", "used", false},
+		{"ClassIdent", "strict", true},
+		{"ClassIdent", "Foo::Bar_2", true},
+		{"ClassIdent", "Foo::", false},
+		{"ClassIdent", "2Foo", false},
+		{"Digits", "123", true},
+		{"Digits", "", false},
+		{"OpAdd", "-", true},
+		{"whitespace", " \t\n", true},
+	}
+
+	for _, tt := range tests {
+		if got := g.MatchLexeme(tt.lexeme, tt.text); got != tt.match {
+			t.Errorf("%s %q: expected %t, got %t", tt.lexeme, tt.text, tt.match, got)
+		}
+	}
+}
+
+func TestClasses(t *testing.T) {
+	tests := []struct {
+		class   string
+		matches string
+		misses  string
+	}{
+		{"[a-c_]", "abc_", "dA-"},
+		{"[^\\]\\x{005C}]", "a[", "]\\"},
+		{"[\\s]", " \t\n", "a"},
+		{"[']", "'", "\""},
+		{"[^\\x{A}\\x{D}]", "a#", "\n\r"},
+	}
+
+	for _, tt := range tests {
+		c, err := slif.ParseClass(tt.class)
+		if err != nil {
+			t.Errorf("%s: %s", tt.class, err)
+			continue
+		}
+		for _, r := range tt.matches {
+			if !c.Matches(r) {
+				t.Errorf("%s: expected to match %q", tt.class, r)
+			}
+		}
+		for _, r := range tt.misses {
+			if c.Matches(r) {
+				t.Errorf("%s: expected not to match %q", tt.class, r)
+			}
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	g := load(t, `
+Program ::= Statement+
+Statement ::= Expression Semicolon
+Unused ::= Semicolon
+Semicolon ~ ';'
+Orphan ~ 'x'
+`)
+
+	diags := g.Check()
+	if len(diags) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %v", diags)
+	}
+	if diags[0].Code != diagnostics.UndefinedSymbol || diags[0].Severity != diagnostics.Error || diags[0].Span.Start != 38 {
+		t.Errorf("expected Expression to be undefined, got %s at %d", diags[0], diags[0].Span.Start)
+	}
+	for i, name := range []string{"Unused", "Orphan"} {
+		d := diags[i+1]
+		if d.Code != diagnostics.UnreachableSymbol || d.Severity != diagnostics.Warning {
+			t.Errorf("expected %s to be unreachable, got %s", name, d)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	g, diags := slif.Load([]byte("Program ::= Statement\nStatement ~ 'unterminated\nOther ::= Program\n"))
+	if len(diags) != 1 || diags[0].Code != diagnostics.UnterminatedString {
+		t.Fatalf("expected an unterminated literal, got %v", diags)
+	}
+	if len(g.RulesFor("Other")) != 1 {
+		t.Errorf("expected loading to continue after the error")
+	}
+}
+
+func TestEarley(t *testing.T) {
+	g := load(t, testGrammar)
+	eg := g.Earley(nil)
+
+	tree, diags := eg.Parse(lexer.New([]byte("use strict; 1 + 2;")))
+	if tree == nil {
+		t.Fatalf("expected a parse, got %v", diags)
+	}
+	expected := `(Program (Program (Statement (UseStatement OpKeywordUse("use") ClassIdent("strict")) Semicolon(";"))) (Statement (Expression (Expression Digits("1")) OpAdd("+") Digits("2")) Semicolon(";")))`
+	if tree.String() != expected {
+		t.Errorf("expected %s\ngot %s", expected, tree)
+	}
+
+	if tree, _ := eg.Parse(lexer.New([]byte("use 1;"))); tree != nil {
+		t.Errorf("expected use 1 not to parse, got %s", tree)
+	}
+}
+
+func TestGuacamoleGrammar(t *testing.T) {
+	src, err := os.ReadFile("../docs/guacamole_grammar.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := load(t, string(src))
+
+	if g.Start != "Program" {
+		t.Errorf("expected start Program, got %s", g.Start)
+	}
+	for _, d := range g.Check() {
+		t.Errorf("unexpected diagnostic: %s", d)
+	}
+	if !g.MatchLexeme("OpKeywordSub", "sub") || !g.MatchLexeme("SubName", "add") {
+		t.Errorf("expected sub and add to match their lexemes")
+	}
+}
+
+func TestGuacamoleParse(t *testing.T) {
+	src, err := os.ReadFile("../docs/guacamole_grammar.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := load(t, string(src))
+	eg := g.Earley(nil)
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"my $x = 1;", []string{`OpKeywordMy("my")`, `SigilScalar("$") (VarIdentExpr VarIdent("x"))`, `NumberDec("1")`}},
+		{"print 1 + 2;", []string{`OpKeywordPrint("print")`, `OpAdd("+")`}},
+		{"use strict;\nmy @a = (1, 2); # two\nprint \"$a[0]\" if @a;", []string{`SubName("strict")`, `SigilArray("@")`, `ConditionIf("if")`}},
+		{"sub add ($a, $b) { return $a + $b }\nadd(1, 2);", []string{`OpKeywordReturn("return")`, `SubNameNonQLike("add")`}},
+	}
+
+	for _, tt := range tests {
+		tree, diags := eg.ParseFrom(g.Scanner([]byte(tt.input)))
+		if tree == nil {
+			t.Errorf("%q: expected a parse, got %v", tt.input, diags)
+			continue
+		}
+		for _, want := range tt.expected {
+			if !strings.Contains(tree.String(), want) {
+				t.Errorf("%q: expected %s in\n%s", tt.input, want, tree)
+			}
+		}
+	}
+
+	tree, diags := eg.ParseFrom(g.Scanner([]byte("my $x = 1 +;")))
+	if tree != nil || len(diags) != 1 || diags[0].Code != diagnostics.UnexpectedToken || diags[0].Span.Start != 11 {
+		t.Errorf("expected an unexpected `;`, got %v", diags)
+	}
+}
+
+func TestParser(t *testing.T) {
+	src, err := os.ReadFile("../docs/guacamole_grammar.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := load(t, string(src))
+
+	// the fixture holds perl both parsers understand
+	input, err := os.ReadFile("testdata/perl.pl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := slif.NewParser(g, input)
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	expected := parser.New(lexer.New(input)).ParseProgram()
+	if len(program.Statements) != len(expected.Statements) {
+		t.Fatalf("expected %d statements, got %d", len(expected.Statements), len(program.Statements))
+	}
+	for i, stmt := range program.Statements {
+		want := expected.Statements[i]
+		if reflect.TypeOf(stmt) != reflect.TypeOf(want) || stmt.String() != want.String() {
+			t.Errorf("statement %d: expected %T %s, got %T %s", i, want, want, stmt, stmt)
+		}
+	}
+
+	p = slif.NewParser(g, []byte("print 1 + 2;"))
+	program = p.ParseProgram()
+	if len(program.Statements) != 1 || program.String() != "print (1 + 2)" {
+		t.Errorf("expected a single print, got %q", program)
+	}
+	p = slif.NewParser(g, []byte("my $x = 1 +;"))
+	if p.ParseProgram(); len(p.Errors()) != 1 {
+		t.Errorf("expected an error, got %v", p.Errors())
+	}
+}
@@ -0,0 +1,57 @@
+use strict;
+my $x = 1;
+my @list = (1, 2, 3);
+print 1 + 2 * 3;
+print "hello\n" if $x;
+$x = $x - 1 unless $x < 0;
+my $y = $x ? "yes" : "no";
+my $total = -$x ** 2 . 'a';
+$x++;
+foo(1, 2);
+sub add { my ($a, $b) = @_; return $a + $b; }
+if ($x == 1) { print "one"; } elsif ($x) { print "some"; } else { print "none"; }
+while ($x > 0) { $x--; }
+foreach my $i (@list) { print $i; }
+package Foo;
+sub new { my $class = shift; return bless {}, $class; }
+my $x;
+my $x = (1);
+my @a = ();
+return;
+return 1, 2;
+return (1, 2);
+print("a", "b");
+defined $x;
+shift;
+shift @a;
+$o->m(1);
+Foo->new;
+for (my $i = 0; $i < 3; $i++) { 1; }
+for my $i (1, 2) { }
+for (@a) { }
+until ($x) { }
+BEGIN { 1; }
+use Foo 1.2 qw(a b);
+use Foo ();
+use v5.36;
+require Foo;
+package Foo { 1; }
+sub f ($a, $b) { }
+[1, 2];
+my $h = { };
+!$x;
+$x =~ $y;
+$#a;
+&foo(1);
+$x = do { 1 };
+map { $_ } @a;
+eval { 1 };
+sort { $a <=> $b } @a;
+die "x" unless $y;
+print STDERR "x";
+print $x for @a;
+"a$x";
+my %opts = ('name', 'simian');
+print $opts{'name'}, $h->{'a'}[0], $x[1][2];
+$o->$name(1)->m;
+print STDOUT "done\n";
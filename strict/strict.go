@@ -0,0 +1,385 @@
+// Package strict reports what perl's `use strict` forbids, without
+// running the program: package variables used without a declaration
+// (strict vars), barewords that aren't subs (strict subs), and
+// references made from strings (strict refs).
+//
+// Strictures follow perl's lexical rules: `use strict` and `no strict`
+// with an optional list of tags change them until the end of the
+// enclosing block, and `use VERSION` of 5.12 or later turns them all on.
+// Strict refs can only be checked where the string is in the source, as
+// in ${"name"} or "name"->(); a reference held in a variable isn't known
+// until run time.
+package strict
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/resolve"
+	"github.com/perigrin/simian/token"
+)
+
+// Mode is a set of strictures.
+type Mode uint8
+
+const (
+	Refs Mode = 1 << iota
+	Subs
+	Vars
+
+	None Mode = 0
+	All       = Refs | Subs | Vars
+)
+
+var tags = map[string]Mode{"refs": Refs, "subs": Subs, "vars": Vars}
+
+func (m Mode) String() string {
+	if m == None {
+		return "none"
+	}
+	var names []string
+	for _, name := range []string{"refs", "subs", "vars"} {
+		if m&tags[name] != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// Check returns the strict violations in program, whose variables info
+// resolves. mode holds the strictures in effect at the start of the
+// file: None checks only what the program asks for, while All checks
+// the whole program as if it began with `use strict`.
+func Check(program *ast.Program, info *resolve.Info, mode Mode) []diagnostics.Diagnostic {
+	c := &checker{
+		info: info,
+		mode: mode,
+		subs: make(map[string]bool),
+		vars: make(map[string]bool),
+	}
+	ast.Apply(program, c.pre, c.post)
+	return c.diagnostics
+}
+
+type checker struct {
+	info *resolve.Info
+	mode Mode
+
+	// the strictures to restore at the end of each block
+	saved []Mode
+
+	// subs declared so far, including constants, and package variables
+	// declared with use vars, by qualified name
+	subs map[string]bool
+	vars map[string]bool
+
+	diagnostics []diagnostics.Diagnostic
+}
+
+func (c *checker) pre(cur *ast.Cursor) bool {
+	switch n := cur.Node().(type) {
+	case nil:
+		return false
+
+	case *ast.BlockStatement, *ast.PackageStatement:
+		c.saved = append(c.saved, c.mode)
+	case *ast.ClassStatement:
+		if n.Body != nil {
+			c.saved = append(c.saved, c.mode)
+		}
+
+	case *ast.UseStatement:
+		c.use(n)
+		return false
+
+	case *ast.NoStatement:
+		if n.Module != nil && n.Module.Value == "strict" {
+			c.mode &^= c.tags(n.Imports)
+		}
+		return false
+
+	case *ast.SubStatement:
+		// a sub can be called by its bare name once it's declared,
+		// including from its own body
+		c.subs[c.info.Qualify(n, n.Name.Value)] = true
+
+	case *ast.Identifier:
+		c.bareword(n, cur)
+
+	case *ast.Variable:
+		c.variable(n)
+
+	case *ast.Dereference:
+		if n.Sigil == ast.CodeSigil && isExistenceTest(cur.Parent()) {
+			// defined &{"name"} is allowed
+			break
+		}
+		c.reference(n.Value, n.Sigil)
+
+	case *ast.PostfixDeref:
+		c.reference(n.Left, n.Sigil)
+
+	case *ast.PostfixSlice:
+		if n.Bracket.Type == token.LBRACKET {
+			c.reference(n.Left, ast.ArraySigil)
+		} else {
+			c.reference(n.Left, ast.HashSigil)
+		}
+
+	case *ast.Index:
+		if n.Arrow {
+			if n.IsHash() {
+				c.reference(n.Left, ast.HashSigil)
+			} else {
+				c.reference(n.Left, ast.ArraySigil)
+			}
+		}
+
+	case *ast.CallExpression:
+		if n.Arrow {
+			c.reference(n.Function, ast.CodeSigil)
+		}
+	}
+	return true
+}
+
+func (c *checker) post(cur *ast.Cursor) bool {
+	switch n := cur.Node().(type) {
+	case *ast.BlockStatement, *ast.PackageStatement:
+		c.restore()
+	case *ast.ClassStatement:
+		if n.Body != nil {
+			c.restore()
+		}
+	}
+	return true
+}
+
+func (c *checker) restore() {
+	c.mode = c.saved[len(c.saved)-1]
+	c.saved = c.saved[:len(c.saved)-1]
+}
+
+// use applies the use statements that change what is strict or declare
+// names: use strict, use VERSION, use vars and use constant.
+func (c *checker) use(n *ast.UseStatement) {
+	if n.Module == nil {
+		if n.Version != nil && enablesStrict(n.Version.Value) {
+			c.mode = All
+		}
+		return
+	}
+
+	switch n.Module.Value {
+	case "strict":
+		c.mode |= c.tags(n.Imports)
+	case "vars":
+		for _, name := range words(n.Imports) {
+			if name != "" {
+				c.vars[name[:1]+c.info.Qualify(n, name[1:])] = true
+			}
+		}
+	case "constant":
+		c.constants(n)
+	}
+}
+
+// tags returns the strictures named by the imports of use or no strict,
+// all of them when there are none, reporting unknown tags.
+func (c *checker) tags(imports []ast.Expression) Mode {
+	if len(imports) == 0 {
+		return All
+	}
+	var mode Mode
+	for _, e := range imports {
+		for _, tag := range words([]ast.Expression{e}) {
+			m, ok := tags[tag]
+			if !ok {
+				d := diagnostics.Errorf(diagnostics.UnknownStrictTag, ast.SpanOf(e), "Unknown 'strict' tag(s) '%s'", tag)
+				d.Label = "expected refs, subs or vars"
+				c.diagnostics = append(c.diagnostics, d)
+			}
+			mode |= m
+		}
+	}
+	return mode
+}
+
+// constants declares the names defined by use constant, in either of
+// its forms: use constant NAME => VALUE and use constant { NAME => VALUE }.
+func (c *checker) constants(use *ast.UseStatement) {
+	imports := use.Imports
+	if len(imports) == 0 {
+		return
+	}
+	switch first := imports[0].(type) {
+	case *ast.StringLiteral:
+		c.subs[c.info.Qualify(use, first.Value)] = true
+	case *ast.HashLiteral:
+		for i := 0; i < len(first.Elements); i += 2 {
+			if key, ok := first.Elements[i].(*ast.StringLiteral); ok {
+				c.subs[c.info.Qualify(use, key.Value)] = true
+			}
+		}
+	}
+}
+
+// words returns the strings in a list of string and qw literals.
+func words(list []ast.Expression) []string {
+	var out []string
+	for _, e := range list {
+		switch e := e.(type) {
+		case *ast.StringLiteral:
+			out = append(out, e.Value)
+		case *ast.QuoteWords:
+			out = append(out, e.Words...)
+		case *ast.ListLiteral:
+			out = append(out, words(e.Elements)...)
+		}
+	}
+	return out
+}
+
+// enablesStrict reports whether `use VERSION` asks for perl 5.12 or
+// later, which turns on all strictures.
+func enablesStrict(version string) bool {
+	v := strings.TrimPrefix(version, "v")
+	parts := strings.Split(v, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major != 5 {
+		return major > 5
+	}
+	minor := parts[1]
+	if len(parts) == 2 && !strings.HasPrefix(version, "v") {
+		// 5.012: the minor version is three decimal places
+		minor = (minor + "000")[:3]
+	}
+	n, err := strconv.Atoi(minor)
+	return err == nil && n >= 12
+}
+
+// variable reports a package variable used without a declaration or a
+// package name under strict vars.
+func (c *checker) variable(v *ast.Variable) {
+	if c.mode&Vars == 0 {
+		return
+	}
+	sym := c.info.Uses[v]
+	if sym == nil || sym.Kind != resolve.Global || strings.Contains(v.Name, "::") {
+		return
+	}
+	name := sym.Name[1:]
+	if resolve.IsSpecial(name) || name == "a" || name == "b" || c.vars[sym.QualifiedName()] {
+		// $a and $b are exempt for sort
+		return
+	}
+	d := diagnostics.Errorf(diagnostics.UndeclaredVariable, diagnostics.SpanOf(v.Token),
+		"Global symbol %q requires explicit package name (did you forget to declare \"my %s\"?)", sym.Name, sym.Name)
+	d.Label = "not declared"
+	c.diagnostics = append(c.diagnostics, d)
+}
+
+// bareword reports a bareword under strict subs, unless it is a name
+// where perl expects one or a sub perl knows about.
+func (c *checker) bareword(ident *ast.Identifier, cur *ast.Cursor) {
+	if c.mode&Subs == 0 || namesSomething(cur) {
+		return
+	}
+	if builtins[ident.Value] || c.subs[c.info.Qualify(ident, ident.Value)] {
+		return
+	}
+	if strings.HasSuffix(ident.Value, "::") {
+		// Foo:: is the string "Foo", a class name
+		return
+	}
+	d := diagnostics.Errorf(diagnostics.BarewordNotAllowed, diagnostics.SpanOf(ident.Token),
+		"Bareword %q not allowed while \"strict subs\" in use", ident.Value)
+	d.Label = "not a known sub"
+	c.diagnostics = append(c.diagnostics, d)
+}
+
+// namesSomething reports whether the identifier at cur is where perl
+// expects a name: of a sub being called or declared, a method, a class
+// or package, or a module; or after a minus, which makes -bareword a
+// string.
+func namesSomething(cur *ast.Cursor) bool {
+	switch parent := cur.Parent().(type) {
+	case *ast.CallExpression:
+		return cur.Name() == "Function"
+	case *ast.MethodCall:
+		return cur.Name() == "Method" || cur.Name() == "Invocant"
+	case *ast.PrefixExpression:
+		return parent.Operator == "-"
+	case *ast.PackageDeclaration, *ast.PackageStatement, *ast.ClassStatement,
+		*ast.SubStatement, *ast.MethodStatement, *ast.RequireStatement:
+		return true
+	}
+	return false
+}
+
+// builtins are the perl functions and filehandles that can be named
+// without arguments.
+var builtins = map[string]bool{
+	"__PACKAGE__": true, "__FILE__": true, "__LINE__": true, "__SUB__": true,
+	"__CLASS__": true, "__END__": true, "__DATA__": true,
+	"STDIN": true, "STDOUT": true, "STDERR": true, "ARGV": true, "ARGVOUT": true, "DATA": true,
+	"abs": true, "alarm": true, "break": true, "caller": true, "chdir": true,
+	"chomp": true, "chop": true, "chr": true, "continue": true, "cos": true,
+	"defined": true, "die": true, "do": true, "dump": true, "eval": true,
+	"exit": true, "exp": true, "fc": true, "fork": true, "getppid": true,
+	"gmtime": true, "hex": true, "int": true, "last": true, "lc": true,
+	"lcfirst": true, "length": true, "local": true, "localtime": true,
+	"log": true, "lstat": true, "next": true, "oct": true, "ord": true,
+	"pop": true, "pos": true, "print": true, "printf": true, "quotemeta": true,
+	"rand": true, "readline": true, "redo": true, "ref": true, "require": true,
+	"reset": true, "return": true, "rmdir": true, "say": true, "shift": true,
+	"sin": true, "sleep": true, "sqrt": true, "srand": true, "stat": true,
+	"study": true, "time": true, "times": true, "uc": true, "ucfirst": true,
+	"umask": true, "unlink": true, "wait": true, "wantarray": true, "warn": true,
+}
+
+// isExistenceTest reports whether n is a call of defined or exists,
+// which may test for a sub by its name.
+func isExistenceTest(n ast.Node) bool {
+	call, ok := n.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	f, ok := call.Function.(*ast.Identifier)
+	return ok && (f.Value == "defined" || f.Value == "exists")
+}
+
+// refTypes name what each sigil dereferences, as perl's messages do.
+var refTypes = [...]string{
+	ast.ScalarSigil: "a SCALAR", ast.ArraySigil: "an ARRAY", ast.HashSigil: "a HASH",
+	ast.CodeSigil: "a subroutine", ast.GlobSigil: "a symbol", ast.LastIndexSigil: "an ARRAY",
+}
+
+// reference reports e used as a reference under strict refs when it is
+// a string: a string literal or a concatenation.
+func (c *checker) reference(e ast.Expression, sigil ast.Sigil) {
+	if c.mode&Refs == 0 {
+		return
+	}
+	var what string
+	switch e := e.(type) {
+	case *ast.StringLiteral:
+		what = "string (" + strconv.Quote(e.Value) + ")"
+	case *ast.InfixExpression:
+		if e.Operator != "." {
+			return
+		}
+		what = "a string"
+	default:
+		return
+	}
+	d := diagnostics.Errorf(diagnostics.SymbolicReference, ast.SpanOf(e),
+		"Can't use %s as %s ref while \"strict refs\" in use", what, refTypes[sigil])
+	d.Label = "symbolic reference"
+	c.diagnostics = append(c.diagnostics, d)
+}
@@ -0,0 +1,164 @@
+package strict_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+	"github.com/perigrin/simian/strict"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	return program
+}
+
+func check(t *testing.T, input string, mode strict.Mode) []diagnostics.Diagnostic {
+	t.Helper()
+	program := parse(t, input)
+	return strict.Check(program, resolve.Resolve(program), mode)
+}
+
+// found describes diagnostics as code@offset.
+func found(diags []diagnostics.Diagnostic) string {
+	var out []string
+	for _, d := range diags {
+		out = append(out, fmt.Sprintf("%s@%d", d.Code, d.Span.Start))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestVars(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"use strict; $x = 1;", "E0302@12"},
+		{"use strict; my $x = 1; $x;", ""},
+		{"use strict; our @x; $x[0];", ""},
+		{"use strict; $main::x; $::y; $Foo::z;", ""},
+		{"use strict; $_; @ARGV; %ENV; $0; $1; $@;", ""},
+		{"use strict; sort { $a <=> $b } @ARGV;", ""},
+		{"use strict; use vars qw($v @w); $v; @w; $u;", "E0302@40"},
+		{"use strict; package Foo; use vars '$v'; package main; $v;", "E0302@54"},
+		{"use strict 'refs'; $x;", ""},
+		{"$x; use strict; $x;", "E0302@16"},
+		{"use strict; sub f($x) { $x + $y }", "E0302@29"},
+		{"use strict; class C { field $f; method m { $self; $f; $g } }", "E0302@54"},
+		{"use strict; for my $i (1) { $i } $i;", "E0302@33"},
+		{`use strict; my @x; print "$undeclared @x $x[0] \$escaped\n";`, "E0302@26"},
+	}
+
+	for _, tt := range tests {
+		if got := found(check(t, tt.input, strict.None)); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+
+	diags := check(t, "use strict; $count++;", strict.None)
+	expected := `Global symbol "$count" requires explicit package name (did you forget to declare "my $count"?)`
+	if len(diags) != 1 || diags[0].Message != expected || diags[0].Severity != diagnostics.Error {
+		t.Errorf("expected %q, got %v", expected, diags)
+	}
+}
+
+func TestSubs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"use strict; my $v = Foo;", "E0303@20"},
+		{"use strict; my $v = Foo::Bar::; my $w = Foo::Bar;", "E0303@40"},
+		{"use strict; f(); g 1; Foo->new; Foo::Bar->new;", ""},
+		{"use strict; my %h = (key => 1); $h{key}; -bareword;", ""},
+		{"use strict; sub f { 1 } my $v = f;", ""},
+		{"use strict; my $v = f; sub f { 1 }", "E0303@20"},
+		{"use strict; sub f { f }", ""},
+		{"use strict; use constant PI => 3; my $v = PI;", ""},
+		{"use strict; use constant { E => 2, PI => 3 }; my $v = E + PI;", ""},
+		{"use strict; package Foo; sub f { 1 } package main; my $v = f;", "E0303@59"},
+		{"use strict; my $t = time; wantarray; print STDERR;", ""},
+		{"use strict 'vars'; my $v = Foo;", ""},
+	}
+
+	for _, tt := range tests {
+		if got := found(check(t, tt.input, strict.None)); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestRefs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`use strict; ${"x"};`, "E0304@14"},
+		{`use strict; @{"Foo::" . "ISA"};`, "E0304@14"},
+		{`use strict; *{"main::f"} = 1;`, "E0304@14"},
+		{`use strict; "f"->(); "x"->[0]; "x"->{k}; "x"->@*;`, "E0304@12 E0304@21 E0304@31 E0304@41"},
+		{`use strict; &{"f"}(1);`, "E0304@14"},
+		{`use strict; defined &{"f"};`, ""},
+		{`use strict; my $r; @{$r}; $r->[0]; "Foo"->new;`, ""},
+		{`use strict; { no strict 'refs'; ${"x"}; } ${"y"};`, "E0304@44"},
+		{`use strict; sub f { no strict; ${"x"}; $y; g } ${"y"};`, "E0304@49"},
+	}
+
+	for _, tt := range tests {
+		if got := found(check(t, tt.input, strict.None)); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+
+	diags := check(t, `use strict; ${"name"};`, strict.None)
+	expected := `Can't use string ("name") as a SCALAR ref while "strict refs" in use`
+	if len(diags) != 1 || diags[0].Message != expected {
+		t.Errorf("expected %q, got %v", expected, diags)
+	}
+}
+
+func TestModes(t *testing.T) {
+	const program = `$x; my $v = Foo; ${"x"};`
+	tests := []struct {
+		prefix   string
+		mode     strict.Mode
+		expected []string
+	}{
+		{"", strict.None, nil},
+		{"", strict.All, []string{diagnostics.UndeclaredVariable, diagnostics.BarewordNotAllowed, diagnostics.SymbolicReference}},
+		{"no strict 'vars'; ", strict.All, []string{diagnostics.BarewordNotAllowed, diagnostics.SymbolicReference}},
+		{"use strict qw(subs refs); ", strict.None, []string{diagnostics.BarewordNotAllowed, diagnostics.SymbolicReference}},
+		{"use v5.36; ", strict.None, []string{diagnostics.UndeclaredVariable, diagnostics.BarewordNotAllowed, diagnostics.SymbolicReference}},
+		{"use 5.012; ", strict.None, []string{diagnostics.UndeclaredVariable, diagnostics.BarewordNotAllowed, diagnostics.SymbolicReference}},
+		{"use 5.010; ", strict.None, nil},
+	}
+
+	for _, tt := range tests {
+		var codes []string
+		for _, d := range check(t, tt.prefix+program, tt.mode) {
+			codes = append(codes, d.Code)
+		}
+		if strings.Join(codes, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("%q with %s: expected %v, got %v", tt.prefix, tt.mode, tt.expected, codes)
+		}
+	}
+
+	diags := check(t, "use strict 'bogus';", strict.None)
+	if len(diags) != 1 || diags[0].Code != diagnostics.UnknownStrictTag {
+		t.Errorf("expected an unknown tag error, got %v", diags)
+	}
+
+	if got := (strict.Refs | strict.Vars).String(); got != "refs vars" {
+		t.Errorf("expected \"refs vars\", got %q", got)
+	}
+}
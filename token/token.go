@@ -12,7 +12,11 @@ const (
 
 	LETTER      = "LETTER"      // Alphabet or underscore (for identifiers)
 	DIGIT       = "DIGIT"       // Digits (for numbers)
-	NUMBER      = "NUMBER"      // Currently a sequence of digits
+	NUMBER      = "NUMBER"      // Decimal number such as 1.5
+	VERSION     = "VERSION"     // Version string such as v5.36 or 1.2.3
+	STRING      = "STRING"      // Quoted string: '', "", q() or qq()
+	QW          = "QW"          // Quoted word list: qw()
+	COMMENT     = "COMMENT"     // # to end of line
 	SIGIL       = "SIGIL"       // $, @, % symbols
 	QUOTE       = "QUOTE"       // ' or " for string literals
 	HASH        = "HASH"        // # for comments
@@ -32,6 +36,8 @@ const (
 	RPAREN      = "RPAREN"      // ')'
 	LBRACE      = "LBRACE"      // '{'
 	RBRACE      = "RBRACE"      // '}'
+	LBRACKET    = "LBRACKET"    // '['
+	RBRACKET    = "RBRACKET"    // ']'
 	SEMICOLON   = "SEMICOLON"   // ';'
 	COMMA       = "COMMA"       // ','
 	FATCOMMA    = "FATCOMMA"    // '=>' (fat comma)
@@ -92,6 +98,11 @@ const (
 	SPLIT   = "SPLIT"   // 'split' function
 	JOIN    = "JOIN"    // 'join' function
 
+	// Phase blocks other than BEGIN and END
+	INIT      = "INIT"      // 'INIT'
+	CHECK     = "CHECK"     // 'CHECK'
+	UNITCHECK = "UNITCHECK" // 'UNITCHECK'
+
 	IDENTIFIER = "IDENTIFIER"
 
 	CLASS  = "CLASS"
@@ -172,6 +183,16 @@ const (
 	OP_OR_KEYWORD            = "or"
 	OP_XOR_KEYWORD           = "xor"
 
+	OP_CONCAT_ASSIGN     = ".="
+	OP_DEFINED_OR_ASSIGN = "//="
+	OP_STR_EQ            = "eq"
+	OP_STR_NE            = "ne"
+	OP_STR_LT            = "lt"
+	OP_STR_GT            = "gt"
+	OP_STR_LE            = "le"
+	OP_STR_GE            = "ge"
+	OP_STR_CMP           = "cmp"
+
 	OP_MATCH   = "=~"
 	OP_NOMATCH = "!~"
 )
@@ -179,6 +200,7 @@ const (
 type Token struct {
 	Type    TokenType
 	Literal []byte
+	Offset  int // byte offset of the token in the input
 }
 
 func (t *Token) String() string {
@@ -186,17 +208,46 @@ func (t *Token) String() string {
 }
 
 var keywords = map[string]TokenType{
-	"sub":    SUB,
-	"my":     MY,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"true":   TRUE,
-	"false":  FALSE,
-	"class":  CLASS,
-	"field":  FIELD,
-	"method": METHOD,
-	"state":  STATE,
+	"sub":     SUB,
+	"my":      MY,
+	"if":      IF,
+	"elsif":   ELSIF,
+	"else":    ELSE,
+	"unless":  UNLESS,
+	"while":   WHILE,
+	"until":   UNTIL,
+	"for":     FOR,
+	"foreach": FOREACH,
+	"our":     OUR,
+	"return":  RETURN,
+	"true":    TRUE,
+	"false":   FALSE,
+	"class":   CLASS,
+	"field":   FIELD,
+	"method":  METHOD,
+	"state":   STATE,
+
+	"package":   PACKAGE,
+	"use":       USE,
+	"no":        NO,
+	"require":   REQUIRE,
+	"BEGIN":     BEGIN,
+	"END":       END,
+	"INIT":      INIT,
+	"CHECK":     CHECK,
+	"UNITCHECK": UNITCHECK,
+
+	"and": OP_LOGICAL_AND_LOW_PRECEDENCE,
+	"or":  OP_LOGICAL_OR_LOW_PRECEDENCE,
+	"xor": OP_LOGICAL_XOR_LOW_PRECEDENCE,
+	"not": OP_LOGICAL_NOT_LOW_PRECEDENCE,
+	"eq":  OP_STR_EQ,
+	"ne":  OP_STR_NE,
+	"lt":  OP_STR_LT,
+	"gt":  OP_STR_GT,
+	"le":  OP_STR_LE,
+	"ge":  OP_STR_GE,
+	"cmp": OP_STR_CMP,
 }
 
 func LookupIdent(ident []byte) TokenType {
@@ -218,10 +269,18 @@ func LookupSingleToken(ch byte) TokenType {
 		return RPAREN
 	case string(ch) == ";":
 		return SEMICOLON
+	case string(ch) == "[":
+		return LBRACKET
+	case string(ch) == "]":
+		return RBRACKET
 	case string(ch) == "*":
 		return ASTERISK
 	case string(ch) == ":":
 		return COLON
+	case string(ch) == "#":
+		return HASH
+	case string(ch) == "'" || string(ch) == "\"":
+		return QUOTE
 	case IsLetter(ch):
 		return LETTER
 	case IsSigil(ch):
@@ -251,12 +310,13 @@ var operators map[string]TokenType = map[string]TokenType{
 	"%":  OP_MODULUS,
 	"x":  OP_REPEAT,
 
-	"==": EQUAL, // TODO OP_EQUAL
-	"!=": NOT_EQUAL,
-	"<=": OP_LESS_THAN_EQUAL,
-	">=": OP_GREATER_THAN_EQUAL,
-	"<":  LT, // TODO OP_LESS_THAN,
-	">":  GT, // TODO OP_GREATER_THAN
+	"==":  EQUAL, // TODO OP_EQUAL
+	"!=":  NOT_EQUAL,
+	"<=>": OP_COMPARE,
+	"<=":  OP_LESS_THAN_EQUAL,
+	">=":  OP_GREATER_THAN_EQUAL,
+	"<":   LT, // TODO OP_LESS_THAN,
+	">":   GT, // TODO OP_GREATER_THAN
 
 	"&":  OP_BITWISE_AND,
 	"|":  OP_BITWISE_OR,
@@ -288,6 +348,11 @@ var operators map[string]TokenType = map[string]TokenType{
 	"&=":  OP_BITWISE_AND_ASSIGN,
 	"|=":  OP_BITWISE_OR_ASSIGN,
 	"^=":  OP_BITWISE_XOR_ASSIGN,
+	"&&=": OP_LOGICAL_AND_ASSIGN,
+	"||=": OP_LOGICAL_OR_ASSIGN,
+	"//=": OP_DEFINED_OR_ASSIGN,
+	".":   DOT,
+	".=":  OP_CONCAT_ASSIGN,
 	"..":  OP_RANGE,
 	"...": OP_RANGE_INCLUSIVE,
 	"?":   OP_TRI_THEN,
@@ -0,0 +1,156 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/resolve"
+)
+
+// scalars are the types an annotation names without parameters.
+var scalars = map[string]Type{
+	"Int": Int, "Num": Num, "Str": Str, "Bool": Bool, "Undef": Undef, "Any": Any,
+}
+
+// Check reports the type errors in program, whose variables names
+// resolves, under gradual typing: variables, parameters and subs
+// without a type annotation are Any, and operators convert their
+// operands as perl does, so only annotated code, the literals given to
+// it, and the signatures of calls are checked.
+func Check(program *ast.Program, names *resolve.Info) []diagnostics.Diagnostic {
+	in := newInferer(names, J)
+	in.gradual = true
+	in.statements(program.Statements)
+	return in.diagnostics
+}
+
+// unknown returns the type of a value inference hasn't seen yet: Any
+// under gradual typing, and otherwise a new variable at level.
+func (in *inferer) unknown(level int) Type {
+	if in.gradual {
+		return Any
+	}
+	return in.freshAt(level)
+}
+
+// annotated returns the type an annotation names, or nil if there is
+// none.
+func (in *inferer) annotated(t *ast.TypeName) Type {
+	if t == nil {
+		return nil
+	}
+	typ, err := parseAnnotation(t.String())
+	if err != nil {
+		in.diagnostics = append(in.diagnostics, diagnostics.Errorf(diagnostics.UnknownType, ast.SpanOf(t), "%s", err))
+		return Any
+	}
+	return typ
+}
+
+// returnType returns the type a :returns(TYPE) attribute names, or nil.
+func (in *inferer) returnType(attributes []*ast.Attribute) Type {
+	for _, a := range attributes {
+		if a.Name != "returns" {
+			continue
+		}
+		t, err := parseAnnotation(a.Args)
+		if err != nil {
+			in.diagnostics = append(in.diagnostics, diagnostics.Errorf(diagnostics.UnknownType, ast.SpanOf(a), "%s", err))
+			return Any
+		}
+		return t
+	}
+	return nil
+}
+
+// declare gives the variables declared with an annotation its type: an
+// array or hash annotated Int holds Ints.
+func (in *inferer) declare(t *ast.TypeName, vars ...*ast.Variable) {
+	typ := in.annotated(t)
+	if typ == nil {
+		return
+	}
+	for _, v := range vars {
+		sym := in.names.SymbolOf(v)
+		if sym == nil {
+			continue
+		}
+		switch v.Sigil {
+		case ast.ArraySigil:
+			in.vars[sym] = Array(typ)
+		case ast.HashSigil:
+			in.vars[sym] = Hash(typ)
+		default:
+			in.vars[sym] = typ
+		}
+	}
+}
+
+// parseAnnotation returns the type written as text, such as Int or
+// HashRef[ArrayRef[Str]]. A name that isn't a type of this package is a
+// class.
+func parseAnnotation(text string) (Type, error) {
+	tokens := strings.FieldsFunc(strings.NewReplacer("[", " [ ", "]", " ] ", ",", " , ").Replace(text), func(r rune) bool {
+		return r == ' '
+	})
+	t, rest, err := annotation(tokens)
+	if err == nil && len(rest) > 0 {
+		err = fmt.Errorf("unexpected %q after type %s", rest[0], t)
+	}
+	return t, err
+}
+
+func annotation(tokens []string) (Type, []string, error) {
+	if len(tokens) == 0 || strings.ContainsAny(tokens[0], "[],") {
+		return nil, nil, fmt.Errorf("expected a type")
+	}
+	name, tokens := tokens[0], tokens[1:]
+
+	var args []Type
+	if len(tokens) > 0 && tokens[0] == "[" {
+		tokens = tokens[1:]
+		for {
+			arg, rest, err := annotation(tokens)
+			if err != nil {
+				return nil, nil, err
+			}
+			args, tokens = append(args, arg), rest
+			if len(tokens) == 0 || tokens[0] != "," {
+				break
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) == 0 || tokens[0] != "]" {
+			return nil, nil, fmt.Errorf("expected ] after the parameters of %s", name)
+		}
+		tokens = tokens[1:]
+	}
+
+	if t, ok := scalars[name]; ok {
+		if len(args) > 0 {
+			return nil, nil, fmt.Errorf("type %s takes no parameters", name)
+		}
+		return t, tokens, nil
+	}
+	switch name {
+	case "ArrayRef", "HashRef":
+		switch len(args) {
+		case 0:
+			return &Con{Name: name, Args: []Type{Any}}, tokens, nil
+		case 1:
+			return &Con{Name: name, Args: args}, tokens, nil
+		}
+		return nil, nil, fmt.Errorf("type %s takes one parameter", name)
+	case "CodeRef":
+		if len(args) > 0 {
+			return nil, nil, fmt.Errorf("type CodeRef takes no parameters")
+		}
+		return &Func{Variadic: true, Return: Any}, tokens, nil
+	}
+	if len(args) > 0 {
+		return nil, nil, fmt.Errorf("unknown type %s", name)
+	}
+	return Object(name), tokens, nil
+}
@@ -0,0 +1,109 @@
+package types
+
+import "github.com/perigrin/simian/ast"
+
+// returns holds what the builtins that always return the same type
+// return.
+var returns = map[string]Type{
+	"abs": Num, "atan2": Num, "cos": Num, "exp": Num, "log": Num,
+	"rand": Num, "sin": Num, "sqrt": Num,
+	"hex": Int, "index": Int, "int": Int, "length": Int, "oct": Int,
+	"ord": Int, "rindex": Int, "time": Int,
+	"chr": Str, "join": Str, "lc": Str, "lcfirst": Str, "quotemeta": Str,
+	"ref": Str, "sprintf": Str, "substr": Str, "uc": Str, "ucfirst": Str,
+	"defined": Bool, "exists": Bool, "print": Bool, "printf": Bool,
+	"say": Bool, "wantarray": Bool,
+	"keys": Array(Str), "split": Array(Str),
+}
+
+// numericArguments are the builtins that take numbers.
+var numericArguments = map[string]bool{
+	"abs": true, "atan2": true, "cos": true, "exp": true, "log": true,
+	"sin": true, "sqrt": true,
+}
+
+// builtin infers a call of the perl builtin name with an optional block
+// and args. It returns false if name isn't a builtin it knows.
+func (in *inferer) builtin(name string, block *ast.BlockStatement, args []ast.Expression) (Type, bool) {
+	switch name {
+	case "map":
+		var t Type
+		if block != nil {
+			t = in.statements(block.Statements)
+		} else if len(args) > 0 {
+			t, args = in.expr(args[0]), args[1:]
+		}
+		in.arguments(args)
+		if t == nil {
+			return Array(in.fresh()), true
+		}
+		elem, _ := in.flatten(t)
+		return Array(elem), true
+
+	case "grep", "sort", "reverse":
+		if block != nil {
+			in.statements(block.Statements)
+		} else if name == "grep" && len(args) > 0 {
+			in.expr(args[0])
+			args = args[1:]
+		}
+		return Array(in.elements(args)), true
+
+	case "shift", "pop":
+		if len(args) == 0 {
+			return in.fresh(), true // from @_ or @ARGV
+		}
+		elem := in.fresh()
+		in.unify(Array(elem), in.expr(args[0]), args[0])
+		return elem, true
+
+	case "push", "unshift":
+		if len(args) == 0 {
+			return Int, true
+		}
+		elem := in.fresh()
+		in.unify(Array(elem), in.expr(args[0]), args[0])
+		for _, a := range args[1:] {
+			t, _ := in.flatten(in.expr(a))
+			in.unify(elem, t, a)
+		}
+		return Int, true
+
+	case "values":
+		if len(args) == 0 {
+			return Array(in.fresh()), true
+		}
+		elem, _ := in.flatten(in.expr(args[0]))
+		return Array(elem), true
+
+	case "scalar":
+		if len(args) != 1 {
+			break
+		}
+		t := in.expr(args[0])
+		if _, ok := in.flatten(t); ok {
+			return Int, true
+		}
+		return t, true
+
+	case "die", "exit":
+		// these don't return, so their value can be of any type
+		in.arguments(args)
+		return in.fresh(), true
+	}
+
+	t, ok := returns[name]
+	if !ok {
+		return nil, false
+	}
+	if block != nil {
+		in.statements(block.Statements)
+	}
+	for _, a := range args {
+		at := in.expr(a)
+		if numericArguments[name] {
+			in.coerce(Num, at, a)
+		}
+	}
+	return t, true
+}
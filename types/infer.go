@@ -0,0 +1,1093 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/resolve"
+	"github.com/perigrin/simian/token"
+)
+
+// Info is what Infer learns about a program.
+type Info struct {
+	// Types holds the type of every expression, with everything
+	// inference learned about it applied.
+	Types map[ast.Expression]Type
+
+	// Subs holds the type scheme of each sub by qualified name, such as
+	// "main::f", and of each method by its class, as in "Point::x".
+	Subs map[string]*Scheme
+
+	Diagnostics []diagnostics.Diagnostic
+}
+
+// TypeOf returns the type of e, or nil if e wasn't inferred.
+func (info *Info) TypeOf(e ast.Expression) Type {
+	return info.Types[e]
+}
+
+// Algorithm is a way of solving the types of a program. Both give the
+// same types.
+type Algorithm int
+
+const (
+	// W binds type variables in a substitution, which it applies to
+	// the types of the variables in scope to generalise each sub.
+	W Algorithm = iota
+
+	// J binds type variables in place, with union-find, and generalises
+	// by how deeply each variable was created. It is faster on large
+	// programs.
+	J
+)
+
+// Infer infers the types in program, whose variables names resolves,
+// with Algorithm W: each expression gets a type, unification binds type
+// variables as uses constrain them, and a sub's type is generalised over
+// what its body leaves unconstrained, so it may be called with
+// different types in different places.
+//
+// As in perl, a sub is known from its definition on, so calls before
+// it are not checked, and calls of subs defined elsewhere return
+// anything.
+func Infer(program *ast.Program, names *resolve.Info) *Info {
+	return InferWith(program, names, W)
+}
+
+// InferWith infers the types in program like Infer, with algorithm.
+func InferWith(program *ast.Program, names *resolve.Info, algorithm Algorithm) *Info {
+	in := newInferer(names, algorithm)
+	in.statements(program.Statements)
+
+	info := &Info{
+		Types:       make(map[ast.Expression]Type, len(in.types)),
+		Subs:        in.subs,
+		Diagnostics: in.diagnostics,
+	}
+	for e, t := range in.types {
+		info.Types[e] = apply(in.solve, t)
+	}
+	for _, s := range in.subs {
+		s.Type = apply(in.solve, s.Type)
+	}
+	return info
+}
+
+func newInferer(names *resolve.Info, algorithm Algorithm) *inferer {
+	in := &inferer{
+		names: names,
+		solve: make(Subst),
+		vars:  make(map[*resolve.Symbol]Type),
+		subs:  make(map[string]*Scheme),
+		types: make(map[ast.Expression]Type),
+	}
+	if algorithm == J {
+		in.solve = unionFind{}
+	}
+	return in
+}
+
+type inferer struct {
+	names *resolve.Info
+	solve solver
+	next  int
+
+	// whether what has no annotation is Any, rather than inferred
+	gradual bool
+
+	// how many subs deep inference is
+	level int
+
+	// vars holds the type of each variable; subs the scheme of each sub
+	// and method inferred so far, by qualified name
+	vars map[*resolve.Symbol]Type
+	subs map[string]*Scheme
+
+	classes map[string]bool
+
+	// the return type of each sub being inferred, innermost last
+	returns []Type
+
+	types       map[ast.Expression]Type
+	diagnostics []diagnostics.Diagnostic
+}
+
+func (in *inferer) fresh() Type {
+	return in.freshAt(in.level)
+}
+
+func (in *inferer) freshAt(level int) Type {
+	in.next++
+	return &Var{ID: in.next, level: level}
+}
+
+// unify unifies found, the type of the value at n, with the type
+// expected there, reporting a mismatch at n.
+func (in *inferer) unify(expected, found Type, n ast.Node) {
+	err := unify(in.solve, expected, found)
+	switch err := err.(type) {
+	case nil:
+	case *InfiniteError:
+		d := diagnostics.Errorf(diagnostics.InfiniteType, ast.SpanOf(n), "infinite type: %s", err)
+		in.diagnostics = append(in.diagnostics, d)
+	case *MismatchError:
+		d := diagnostics.Errorf(diagnostics.TypeMismatch, ast.SpanOf(n), "type mismatch: %s", err)
+		d.Label = "this is " + apply(in.solve, found).String()
+		in.diagnostics = append(in.diagnostics, d)
+	}
+}
+
+// coerce unifies found, the type of the operand at n, with the type its
+// operator expects, reporting whether they agree. perl converts the
+// operands of its operators as it needs to, so under gradual typing,
+// which only checks what annotations declare, a mismatch isn't an error.
+func (in *inferer) coerce(expected, found Type, n ast.Node) bool {
+	if !in.gradual {
+		in.unify(expected, found, n)
+		return true
+	}
+	return unify(in.solve, expected, found) == nil
+}
+
+// statements infers the types in a list of statements, returning the
+// type of the last if it is an expression: the value of a sub that
+// ends there.
+func (in *inferer) statements(list []ast.Statement) Type {
+	var last Type
+	for _, s := range list {
+		last = in.statement(s)
+	}
+	return last
+}
+
+func (in *inferer) statement(s ast.Statement) Type {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		return in.expr(s.Expression)
+
+	case *ast.MyStatement:
+		in.declare(s.Type, s.Name)
+		t := in.expr(s.Name)
+		if s.Value != nil {
+			in.assignTo(t, s.Value)
+		}
+
+	case *ast.ReturnStatement:
+		if s.ReturnValue == nil {
+			break
+		}
+		t := in.expr(s.ReturnValue)
+		if len(in.returns) > 0 {
+			in.unify(in.returns[len(in.returns)-1], t, s.ReturnValue)
+		}
+
+	case *ast.BlockStatement:
+		return in.statements(s.Statements)
+
+	case *ast.IfStatement:
+		in.expr(s.Condition)
+		in.statements(s.Consequence.Statements)
+		if s.Alternative != nil {
+			in.statement(s.Alternative)
+		}
+
+	case *ast.WhileStatement:
+		if s.Condition != nil {
+			in.expr(s.Condition)
+		}
+		in.statements(s.Body.Statements)
+		if s.Continue != nil {
+			in.statements(s.Continue.Statements)
+		}
+
+	case *ast.ForStatement:
+		for _, e := range []ast.Expression{s.Init, s.Condition, s.Step} {
+			if e != nil {
+				in.expr(e)
+			}
+		}
+		in.statements(s.Body.Statements)
+
+	case *ast.ForeachStatement:
+		if list, ok := s.List.(*ast.ListLiteral); ok && s.Variable != nil {
+			// each item must suit the variable, which may be annotated
+			in.types[list] = Array(in.elementsOf(in.expr(s.Variable), list.Elements))
+		} else {
+			elem := in.listOf(s.List)
+			if s.Variable != nil {
+				in.unify(in.expr(s.Variable), elem, s.Variable)
+			}
+		}
+		in.statements(s.Body.Statements)
+		if s.Continue != nil {
+			in.statements(s.Continue.Statements)
+		}
+
+	case *ast.LabeledStatement:
+		return in.statement(s.Statement)
+
+	case *ast.ModifiedStatement:
+		in.expr(s.Condition)
+		in.statement(s.Statement)
+
+	case *ast.PackageStatement:
+		in.statements(s.Body.Statements)
+
+	case *ast.ClassStatement:
+		if in.classes == nil {
+			in.classes = make(map[string]bool)
+		}
+		in.classes[s.Name.Value] = true
+		if s.Body != nil {
+			in.statements(s.Body.Statements)
+		}
+
+	case *ast.FieldStatement:
+		in.declare(s.Type, s.Name)
+		t := in.expr(s.Name)
+		if s.Value != nil {
+			in.assignTo(t, s.Value)
+		}
+
+	case *ast.UseStatement:
+		in.use(s)
+
+	case *ast.SubStatement:
+		if s.Body != nil {
+			in.sub(s, in.names.Qualify(s, s.Name.Value), s.Signature, s.Attributes, s.Body, nil)
+		}
+
+	case *ast.MethodStatement:
+		if s.Body != nil {
+			in.sub(s, in.names.Qualify(s, s.Name.Value), s.Signature, s.Attributes, s.Body, Object(in.names.PackageOf(s)))
+		}
+
+	case *ast.PhaseBlock:
+		in.statements(s.Body.Statements)
+
+	case *ast.RequireStatement:
+		if s.Value != nil {
+			in.expr(s.Value)
+		}
+	}
+	return nil
+}
+
+// use gives the constants declared by use constant the type of their
+// values.
+func (in *inferer) use(s *ast.UseStatement) {
+	for _, e := range s.Imports {
+		in.expr(e)
+	}
+	if s.Module == nil || s.Module.Value != "constant" || len(s.Imports) == 0 {
+		return
+	}
+	switch first := s.Imports[0].(type) {
+	case *ast.StringLiteral:
+		var value Type = Undef
+		switch rest := s.Imports[1:]; len(rest) {
+		case 0:
+		case 1:
+			value = in.types[rest[0]]
+		default:
+			elem := in.fresh()
+			for _, e := range rest {
+				t, _ := in.flatten(in.types[e])
+				in.unify(elem, t, e)
+			}
+			value = Array(elem)
+		}
+		in.subs[in.names.Qualify(s, first.Value)] = &Scheme{Type: &Func{Return: value}}
+	case *ast.HashLiteral:
+		for i := 0; i+1 < len(first.Elements); i += 2 {
+			if name, ok := first.Elements[i].(*ast.StringLiteral); ok {
+				value := in.types[first.Elements[i+1]]
+				in.subs[in.names.Qualify(s, name.Value)] = &Scheme{Type: &Func{Return: value}}
+			}
+		}
+	}
+}
+
+// sub infers the type of a sub or method and generalises it. While its
+// body is inferred the sub has a single type, so a recursive call must
+// use it the same way as the sub itself. A :returns attribute gives the
+// type it returns.
+func (in *inferer) sub(n ast.Node, name string, sig *ast.Signature, attributes []*ast.Attribute, body *ast.BlockStatement, self Type) {
+	scope := in.names.Scopes[n]
+	if self != nil {
+		if sym := scope.LookupLocal("$self"); sym != nil {
+			in.vars[sym] = self
+		}
+	}
+
+	in.level++
+	f := &Func{Return: in.returnType(attributes), Variadic: sig == nil}
+	if f.Return == nil {
+		f.Return = in.unknown(in.level)
+	}
+	if sig != nil {
+		for _, p := range sig.Parameters {
+			in.declare(p.Type, p.Name)
+			t := in.expr(p.Name)
+			if p.Name.Sigil != ast.ScalarSigil {
+				f.Variadic = true // slurpy
+				continue
+			}
+			if p.Default != nil {
+				in.unify(t, in.expr(p.Default), p.Default)
+				f.Optional++
+			}
+			f.Params = append(f.Params, t)
+		}
+	}
+	in.subs[name] = &Scheme{Type: f}
+
+	in.returns = append(in.returns, f.Return)
+	if last := in.statements(body.Statements); last != nil {
+		in.unify(f.Return, last, body.Statements[len(body.Statements)-1])
+	}
+	in.returns = in.returns[:len(in.returns)-1]
+	in.level--
+
+	delete(in.subs, name)
+	in.subs[name] = in.solve.generalize(f, in.level, func(used map[int]*Var) {
+		in.environment(scope, used)
+	})
+}
+
+// environment adds the variables in the types of everything in scope
+// outside the sub that opened scope to used: variables declared outside
+// it, the subs enclosing it, and the subs inferred before it.
+func (in *inferer) environment(scope *resolve.Scope, used map[int]*Var) {
+	for sym, t := range in.vars {
+		if !within(sym.Scope, scope) {
+			freeVars(in.solve, t, used)
+		}
+	}
+	for _, t := range in.returns {
+		freeVars(in.solve, t, used)
+	}
+	for _, s := range in.subs {
+		free := make(map[int]*Var)
+		freeVars(in.solve, s.Type, free)
+		for _, v := range s.Vars {
+			delete(free, v.ID)
+		}
+		for id, v := range free {
+			used[id] = v
+		}
+	}
+}
+
+// within reports whether s is scope or nested inside it.
+func within(s, scope *resolve.Scope) bool {
+	for ; s != nil; s = s.Parent {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// instantiate returns the type of s with fresh variables for its bound
+// ones.
+func (in *inferer) instantiate(s *Scheme) Type {
+	if len(s.Vars) == 0 {
+		return s.Type
+	}
+	fresh := make(map[int]Type, len(s.Vars))
+	for _, v := range s.Vars {
+		fresh[v.ID] = in.fresh()
+	}
+	var copy func(Type) Type
+	copy = func(t Type) Type {
+		switch t := in.solve.resolve(t).(type) {
+		case *Var:
+			if f, ok := fresh[t.ID]; ok {
+				return f
+			}
+			return t
+		case *Con:
+			if len(t.Args) == 0 {
+				return t
+			}
+			args := make([]Type, len(t.Args))
+			for i, a := range t.Args {
+				args[i] = copy(a)
+			}
+			return &Con{Name: t.Name, Args: args}
+		case *Func:
+			params := make([]Type, len(t.Params))
+			for i, p := range t.Params {
+				params[i] = copy(p)
+			}
+			return &Func{Params: params, Optional: t.Optional, Variadic: t.Variadic, Return: copy(t.Return)}
+		default:
+			return t
+		}
+	}
+	return copy(s.Type)
+}
+
+// expr infers and records the type of e.
+func (in *inferer) expr(e ast.Expression) Type {
+	t := in.infer(e)
+	in.types[e] = t
+	return t
+}
+
+func (in *inferer) infer(e ast.Expression) Type {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.NumberLiteral:
+		return Num
+	case *ast.StringLiteral, *ast.VersionLiteral:
+		return Str
+	case *ast.BooleanLiteral:
+		return Bool
+	case *ast.Undef:
+		return Undef
+	case *ast.QuoteWords:
+		return Array(Str)
+
+	case *ast.Variable:
+		return in.variable(e)
+
+	case *ast.Declaration:
+		in.declare(e.Type, e.Variables...)
+		for _, v := range e.Variables {
+			in.expr(v)
+		}
+		if len(e.Variables) == 1 && !e.Parens {
+			return in.types[e.Variables[0]]
+		}
+		return in.fresh()
+
+	case *ast.ArrayLiteral:
+		return ArrayRef(in.elements(e.Elements))
+	case *ast.ListLiteral:
+		return Array(in.elements(e.Elements))
+	case *ast.HashLiteral:
+		return HashRef(in.values(e.Elements))
+
+	case *ast.PrefixExpression:
+		return in.prefix(e)
+	case *ast.PostfixExpression:
+		t := in.expr(e.Left)
+		in.coerce(Num, t, e.Left)
+		return t
+	case *ast.InfixExpression:
+		return in.infix(e)
+
+	case *ast.ConditionalExpression:
+		in.expr(e.Condition)
+		t, f := in.expr(e.Consequence), in.expr(e.Alternative)
+		if w := in.widest(t, f); w != nil {
+			return w
+		}
+		if !in.coerce(t, f, e.Alternative) {
+			return Any
+		}
+		return t
+
+	case *ast.Identifier:
+		name := in.names.Qualify(e, e.Value)
+		if s := in.subs[name]; s != nil {
+			return in.call(in.instantiate(s), name, nil, e)
+		}
+		if t, ok := in.builtin(e.Value, nil, nil); ok {
+			return t
+		}
+		return in.fresh()
+
+	case *ast.CallExpression:
+		return in.callExpression(e)
+	case *ast.MethodCall:
+		return in.methodCall(e)
+
+	case *ast.Index:
+		return in.index(e)
+
+	case *ast.Dereference:
+		return in.deref(e.Sigil, in.expr(e.Value), e.Value)
+	case *ast.PostfixDeref:
+		return in.deref(e.Sigil, in.expr(e.Left), e.Left)
+	case *ast.PostfixSlice:
+		in.expr(e.Index)
+		elem := in.fresh()
+		if e.Bracket.Type == token.LBRACE {
+			in.unify(HashRef(elem), in.expr(e.Left), e.Left)
+		} else {
+			in.unify(ArrayRef(elem), in.expr(e.Left), e.Left)
+		}
+		return Array(elem)
+	}
+
+	// anything else is unconstrained, but its parts are still inferred
+	ast.Inspect(e, func(n ast.Node) bool {
+		if sub, ok := n.(ast.Expression); ok && n != ast.Node(e) {
+			in.expr(sub)
+			return false
+		}
+		return true
+	})
+	return in.fresh()
+}
+
+// aggregate returns the type a variable with sigil holds when nothing
+// is known about its contents, for a variable first seen at level.
+func (in *inferer) aggregate(sigil byte, level int) Type {
+	switch sigil {
+	case '@':
+		return Array(in.unknown(level))
+	case '%':
+		return Hash(in.unknown(level))
+	default:
+		return in.unknown(level)
+	}
+}
+
+// symbolType returns the type of the variable sym. Perl's special
+// variables, and $a and $b in a sort block, hold a different value at
+// each use, so each use gets a type of its own.
+func (in *inferer) symbolType(sym *resolve.Symbol) Type {
+	if sym == nil {
+		return in.fresh()
+	}
+	if sym.Kind == resolve.Global {
+		name := sym.Name[1:]
+		if resolve.IsSpecial(name) || name == "a" || name == "b" {
+			return in.aggregate(sym.Name[0], in.level)
+		}
+	}
+	if t, ok := in.vars[sym]; ok {
+		return t
+	}
+	level := in.level
+	if sym.Scope == nil {
+		level = 0 // a package variable, visible everywhere
+	}
+	t := in.aggregate(sym.Name[0], level)
+	in.vars[sym] = t
+	return t
+}
+
+func (in *inferer) variable(v *ast.Variable) Type {
+	t := in.symbolType(in.names.SymbolOf(v))
+	if v.Sigil == ast.LastIndexSigil {
+		return Int
+	}
+	return t
+}
+
+// deref returns the type of dereferencing a value of type ref, given at
+// n, with sigil. Like an operator, a dereference takes what it is given:
+// a string is a symbolic reference, which is for strict refs to report.
+func (in *inferer) deref(sigil ast.Sigil, ref Type, n ast.Node) Type {
+	elem := in.fresh()
+	switch sigil {
+	case ast.ArraySigil:
+		in.coerce(ArrayRef(elem), ref, n)
+		return Array(elem)
+	case ast.HashSigil:
+		in.coerce(HashRef(elem), ref, n)
+		return Hash(elem)
+	case ast.LastIndexSigil:
+		in.coerce(ArrayRef(elem), ref, n)
+		return Int
+	}
+	return elem
+}
+
+// index infers an element or slice of an array or hash, directly, as in
+// $x[0] and @h{...}, or through a reference.
+func (in *inferer) index(n *ast.Index) Type {
+	in.expr(n.Index)
+	elem := in.fresh()
+	ref, agg := ArrayRef(elem), Array(elem)
+	if n.IsHash() {
+		ref, agg = HashRef(elem), Hash(elem)
+	}
+
+	if d, ok := n.Left.(*ast.Dereference); ok && !n.Arrow {
+		// $$r[0], ${$r}[0] and @{$r}[0, 1]
+		in.types[d] = agg
+		in.coerce(ref, in.expr(d.Value), d.Value)
+		if d.Sigil != ast.ScalarSigil {
+			return Array(elem) // a slice
+		}
+		return elem
+	}
+	v, ok := n.Left.(*ast.Variable)
+	if !ok || n.Arrow {
+		in.unify(ref, in.expr(n.Left), n.Left)
+		return elem
+	}
+
+	t := in.symbolType(in.names.SymbolOf(v))
+	in.types[v] = t
+	in.unify(agg, t, v)
+	if v.Sigil != ast.ScalarSigil {
+		return Array(elem) // a slice
+	}
+	return elem
+}
+
+// flatten returns the type of the items a value of type t contributes
+// to a list: the elements of an array or the values of a hash, or t
+// itself.
+func (in *inferer) flatten(t Type) (Type, bool) {
+	if c, ok := in.solve.resolve(t).(*Con); ok && (c.Name == "Array" || c.Name == "Hash") {
+		return c.Args[0], true
+	}
+	return t, false
+}
+
+// elements returns the type of every item of a list.
+func (in *inferer) elements(list []ast.Expression) Type {
+	return in.elementsOf(in.unknown(in.level), list)
+}
+
+// elementsOf unifies every item of a list with elem, returning it.
+func (in *inferer) elementsOf(elem Type, list []ast.Expression) Type {
+	types := make([]Type, len(list))
+	for i, e := range list {
+		types[i], _ = in.flatten(in.expr(e))
+	}
+	in.widen(elem, types)
+	for i, e := range list {
+		in.unify(elem, types[i], e)
+	}
+	return elem
+}
+
+// values returns the type of the values of a list of key/value pairs.
+func (in *inferer) values(list []ast.Expression) Type {
+	return in.valuesOf(in.unknown(in.level), list)
+}
+
+// valuesOf unifies the values of a list of key/value pairs with value,
+// returning it.
+func (in *inferer) valuesOf(value Type, list []ast.Expression) Type {
+	var types []Type
+	var at []ast.Expression
+	i := 0
+	for _, e := range list {
+		t := in.expr(e)
+		if c, ok := in.solve.resolve(t).(*Con); ok && (c.Name == "Array" || c.Name == "Hash") {
+			if c.Name == "Hash" {
+				types, at = append(types, c.Args[0]), append(at, e)
+			}
+			continue
+		}
+		if i%2 == 1 {
+			types, at = append(types, t), append(at, e)
+		}
+		i++
+	}
+	in.widen(value, types)
+	for i, e := range at {
+		in.unify(value, types[i], e)
+	}
+	return value
+}
+
+// widen binds elem, the type of the items of a list that isn't known
+// yet, to the widest of their types if they are all numbers, so that a
+// list of Int and Num is of Num.
+func (in *inferer) widen(elem Type, types []Type) {
+	if _, ok := in.solve.resolve(elem).(*Var); !ok {
+		return
+	}
+	if w := in.widest(types...); w != nil {
+		unify(in.solve, elem, w)
+	}
+}
+
+// widest returns the widest of types if they are all numeric, or nil.
+func (in *inferer) widest(types ...Type) Type {
+	var widest *Con
+	for _, t := range types {
+		c, ok := in.solve.resolve(t).(*Con)
+		if !ok || numeric[c.Name] == 0 {
+			return nil
+		}
+		if widest == nil || numeric[c.Name] > numeric[widest.Name] {
+			widest = c
+		}
+	}
+	if widest == nil {
+		return nil
+	}
+	return widest
+}
+
+// listOf returns the type of the items of e in list context.
+func (in *inferer) listOf(e ast.Expression) Type {
+	if list, ok := e.(*ast.ListLiteral); ok {
+		t := in.elements(list.Elements)
+		in.types[e] = Array(t)
+		return t
+	}
+	t, _ := in.flatten(in.expr(e))
+	return t
+}
+
+func (in *inferer) prefix(e *ast.PrefixExpression) Type {
+	t := in.expr(e.Right)
+	switch e.Operator {
+	case "-", "+":
+		if _, ok := e.Right.(*ast.Identifier); ok && e.Operator == "-" {
+			return Str // -bareword
+		}
+		in.coerce(Num, t, e.Right)
+		return in.arithmetic(t)
+	case "++", "--":
+		in.coerce(Num, t, e.Right)
+		return t
+	case "!", "not":
+		return Bool
+	case "~":
+		return Int
+	}
+	return in.fresh()
+}
+
+// arithmetic returns the type of arithmetic on operands: Int if all are
+// whole numbers and Num otherwise. Under gradual checking an operand
+// that isn't known to be a number, which perl converts as it can, makes
+// the result Any unless another is a Num.
+func (in *inferer) arithmetic(operands ...Type) Type {
+	t := Int
+	for _, o := range operands {
+		switch o := in.solve.resolve(o); {
+		case o == Int || o == Bool:
+		case o == Num:
+			return Num
+		case in.gradual:
+			t = Any
+		default:
+			return Num
+		}
+	}
+	return t
+}
+
+func (in *inferer) infix(e *ast.InfixExpression) Type {
+	switch e.Operator {
+	case "=":
+		return in.assign(e)
+	case "x":
+		if list, ok := e.Left.(*ast.ListLiteral); ok {
+			t := Array(in.elements(list.Elements))
+			in.types[list] = t
+			in.expr(e.Right)
+			return t
+		}
+	}
+
+	l, r := in.expr(e.Left), in.expr(e.Right)
+	switch e.Operator {
+	case "+", "-", "*", "**", "+=", "-=", "*=", "**=":
+		in.coerce(Num, l, e.Left)
+		in.coerce(Num, r, e.Right)
+		if strings.HasSuffix(e.Operator, "=") {
+			return l
+		}
+		return in.arithmetic(l, r)
+	case "/", "/=":
+		in.coerce(Num, l, e.Left)
+		in.coerce(Num, r, e.Right)
+		return Num
+	case "%", "%=":
+		in.coerce(Num, l, e.Left)
+		in.coerce(Num, r, e.Right)
+		return Int
+	case "==", "!=", "<", ">", "<=", ">=":
+		in.coerce(Num, l, e.Left)
+		in.coerce(Num, r, e.Right)
+		return Bool
+	case "<=>":
+		in.coerce(Num, l, e.Left)
+		in.coerce(Num, r, e.Right)
+		return Int
+	case "eq", "ne", "lt", "gt", "le", "ge", "=~", "!~", "xor":
+		return Bool
+	case "cmp", "&", "|", "^", "<<", ">>", "&=", "|=", "^=", "<<=", ">>=":
+		return Int
+	case ".", "x":
+		return Str
+	case ".=", "x=":
+		in.unify(l, Str, e.Left)
+		return l
+	case "&&", "and":
+		return r
+	case "||", "//", "or", "||=", "//=", "&&=":
+		if !in.coerce(l, r, e.Right) {
+			return Any
+		}
+		return l
+	case "..":
+		in.coerce(l, r, e.Right)
+		return Array(l)
+	}
+	return in.fresh()
+}
+
+// assign infers an assignment. A list assignment gives each target the
+// type of its value in turn, with an array or hash taking the rest; in
+// scalar context it is the number of values.
+func (in *inferer) assign(e *ast.InfixExpression) Type {
+	var targets []ast.Expression
+	switch left := e.Left.(type) {
+	case *ast.ListLiteral:
+		targets = left.Elements
+	case *ast.Declaration:
+		if left.Parens {
+			for _, v := range left.Variables {
+				targets = append(targets, v)
+			}
+		}
+	}
+	if targets == nil {
+		t := in.expr(e.Left)
+		in.assignTo(t, e.Right)
+		return t
+	}
+	in.expr(e.Left)
+
+	// the types of the values in order, until an array or hash, whose
+	// items are all rest
+	var values []Type
+	var rest func() Type
+	spread := func(value ast.Expression, t Type) {
+		elem, ok := in.flatten(t)
+		switch {
+		case !ok:
+			values = append(values, t)
+		case isSpecial(in.names, value):
+			// nothing is known about what @_ holds, so its items may
+			// each be different
+			rest = in.fresh
+		default:
+			rest = func() Type { return elem }
+		}
+	}
+	if list, ok := e.Right.(*ast.ListLiteral); ok {
+		for _, value := range list.Elements {
+			if rest == nil {
+				spread(value, in.expr(value))
+			} else {
+				in.expr(value)
+			}
+		}
+		in.types[list] = in.fresh()
+	} else {
+		spread(e.Right, in.expr(e.Right))
+	}
+
+	for i, target := range targets {
+		t := in.types[target]
+		if elem, ok := in.flatten(t); ok {
+			for _, v := range values[min(i, len(values)):] {
+				in.unify(elem, v, e.Right)
+			}
+			if rest != nil {
+				in.unify(elem, rest(), e.Right)
+			}
+			break
+		}
+		switch {
+		case i < len(values):
+			in.unify(t, values[i], target)
+		case rest != nil:
+			in.unify(t, rest(), target)
+		}
+	}
+	return Int
+}
+
+// isSpecial reports whether e is one of perl's special arrays or
+// hashes, such as @_ or %ENV.
+func isSpecial(names *resolve.Info, e ast.Expression) bool {
+	v, ok := e.(*ast.Variable)
+	if !ok {
+		return false
+	}
+	sym := names.SymbolOf(v)
+	return sym != nil && sym.Kind == resolve.Global && resolve.IsSpecial(sym.Name[1:])
+}
+
+// assignTo infers assigning value to a target of type t. An array or
+// hash takes the value's items; a scalar given an array or hash gets the
+// number of items, and given a list, the last item. The items of a list
+// or anonymous array or hash are each checked against the target's, as
+// are both branches of a conditional.
+func (in *inferer) assignTo(t Type, value ast.Expression) {
+	if c, ok := value.(*ast.ConditionalExpression); ok {
+		// either branch may be the value
+		in.expr(c.Condition)
+		in.assignTo(t, c.Consequence)
+		in.assignTo(t, c.Alternative)
+		in.types[c] = t
+		return
+	}
+	target := in.solve.resolve(t)
+	if c, ok := target.(*Con); ok && (c.Name == "Array" || c.Name == "Hash") {
+		list, isList := value.(*ast.ListLiteral)
+		switch {
+		// each item must suit the target, which may be annotated
+		case isList && c.Name == "Hash":
+			in.types[list] = Array(in.fresh())
+			in.valuesOf(c.Args[0], list.Elements)
+		case isList:
+			in.elementsOf(c.Args[0], list.Elements)
+			in.types[list] = t
+		default:
+			vt := in.expr(value)
+			if elem, ok := in.flatten(vt); ok {
+				if c.Name == "Array" || apply(in.solve, vt).(*Con).Name == "Hash" {
+					in.unify(c.Args[0], elem, value)
+				}
+			} else {
+				in.unify(c.Args[0], vt, value)
+			}
+		}
+		return
+	}
+
+	if c, ok := target.(*Con); ok && len(c.Args) == 1 {
+		switch lit := value.(type) {
+		case *ast.ArrayLiteral:
+			if c.Name == "ArrayRef" {
+				in.types[lit] = ArrayRef(in.elementsOf(c.Args[0], lit.Elements))
+				return
+			}
+		case *ast.HashLiteral:
+			if c.Name == "HashRef" {
+				in.types[lit] = HashRef(in.valuesOf(c.Args[0], lit.Elements))
+				return
+			}
+		}
+	}
+
+	vt := in.expr(value)
+	if list, ok := value.(*ast.ListLiteral); ok && len(list.Elements) > 0 {
+		last := list.Elements[len(list.Elements)-1]
+		in.unify(t, in.types[last], last)
+		return
+	}
+	if _, ok := in.flatten(vt); ok {
+		vt = Int
+	}
+	in.unify(t, vt, value)
+}
+
+func (in *inferer) callExpression(e *ast.CallExpression) Type {
+	if e.Arrow {
+		f := in.expr(e.Function)
+		args, spread := in.arguments(e.Arguments)
+		ret := in.fresh()
+		in.unify(f, &Func{Params: args, Variadic: spread, Return: ret}, e.Function)
+		return ret
+	}
+
+	name, ok := e.Function.(*ast.Identifier)
+	if !ok {
+		in.expr(e.Function)
+		in.arguments(e.Arguments)
+		return in.fresh()
+	}
+	qualified := in.names.Qualify(name, name.Value)
+	if s := in.subs[qualified]; s != nil && e.Block == nil {
+		f := in.instantiate(s)
+		in.types[name] = f
+		return in.call(f, qualified, e.Arguments, e)
+	}
+	if t, ok := in.builtin(name.Value, e.Block, e.Arguments); ok {
+		return t
+	}
+	if e.Block != nil {
+		in.statements(e.Block.Statements)
+	}
+	in.arguments(e.Arguments)
+	return in.fresh()
+}
+
+// arguments infers the arguments of a call, returning their types up to
+// the first array or hash, and whether there was one, since its items
+// fill the rest of the parameters.
+func (in *inferer) arguments(args []ast.Expression) ([]Type, bool) {
+	var types []Type
+	spread := false
+	for _, a := range args {
+		t := in.expr(a)
+		if _, ok := in.flatten(t); ok {
+			spread = true
+		}
+		if !spread {
+			types = append(types, t)
+		}
+	}
+	return types, spread
+}
+
+// call infers calling the sub with the qualified name name, of type f,
+// with args at n.
+func (in *inferer) call(f Type, name string, args []ast.Expression, n ast.Node) Type {
+	fn, ok := in.solve.resolve(f).(*Func)
+	if !ok {
+		in.arguments(args)
+		return in.fresh()
+	}
+	types, spread := in.arguments(args)
+	for i, t := range types {
+		if i >= len(fn.Params) {
+			if !fn.Variadic {
+				in.arity("Too many", name, len(types), fmt.Sprint(len(fn.Params)), n)
+			}
+			break
+		}
+		in.unify(fn.Params[i], t, args[i])
+	}
+	if required := len(fn.Params) - fn.Optional; !spread && len(types) < required {
+		expected := fmt.Sprint(required)
+		if fn.Optional > 0 || fn.Variadic {
+			expected = "at least " + expected
+		}
+		in.arity("Too few", name, len(types), expected, n)
+	}
+	return fn.Return
+}
+
+func (in *inferer) arity(which, name string, got int, expected string, n ast.Node) {
+	d := diagnostics.Errorf(diagnostics.ArgumentCount, ast.SpanOf(n),
+		"%s arguments for subroutine '%s' (got %d; expected %s)", which, name, got, expected)
+	in.diagnostics = append(in.diagnostics, d)
+}
+
+// methodCall infers a method call. Class->new returns an instance of
+// the class, and the methods of classes in the program are checked
+// like subs.
+func (in *inferer) methodCall(e *ast.MethodCall) Type {
+	var class string
+	if id, ok := e.Invocant.(*ast.Identifier); ok {
+		in.types[id] = Str // a class name
+		if e.Method.Value == "new" {
+			in.arguments(e.Arguments)
+			return Object(id.Value)
+		}
+		class = id.Value
+	} else if c, ok := in.solve.resolve(in.expr(e.Invocant)).(*Con); ok && in.classes[c.Name] {
+		class = c.Name
+	}
+
+	if s := in.subs[class+"::"+e.Method.Value]; s != nil && class != "" {
+		return in.call(in.instantiate(s), class+"::"+e.Method.Value, e.Arguments, e)
+	}
+	in.arguments(e.Arguments)
+	return in.fresh()
+}
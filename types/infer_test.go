@@ -0,0 +1,342 @@
+package types_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+	"github.com/perigrin/simian/types"
+)
+
+func infer(t *testing.T, input string) (*ast.Program, *resolve.Info, *types.Info) {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	names := resolve.Resolve(program)
+	w := types.Infer(program, names)
+	if diff := disagreement(program, w, types.InferWith(program, names, types.J)); diff != "" {
+		t.Errorf("%s: algorithms W and J disagree: %s", input, diff)
+	}
+	return program, names, w
+}
+
+// disagreement describes the first difference between what two
+// inferences found in program, if any.
+func disagreement(program *ast.Program, w, j *types.Info) string {
+	var diff string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if e, ok := n.(ast.Expression); ok && diff == "" {
+			if tw, tj := fmt.Sprint(w.TypeOf(e)), fmt.Sprint(j.TypeOf(e)); tw != tj {
+				diff = fmt.Sprintf("%s is %s and %s", e, tw, tj)
+			}
+		}
+		return diff == ""
+	})
+	for name, s := range w.Subs {
+		if diff == "" && fmt.Sprint(s) != fmt.Sprint(j.Subs[name]) {
+			diff = fmt.Sprintf("%s is %s and %s", name, s, j.Subs[name])
+		}
+	}
+	if diff == "" && fmt.Sprint(w.Diagnostics) != fmt.Sprint(j.Diagnostics) {
+		diff = fmt.Sprintf("diagnostics %v and %v", w.Diagnostics, j.Diagnostics)
+	}
+	return diff
+}
+
+// declared describes the type of each variable declared in input, in
+// source order.
+func declared(t *testing.T, input string) []string {
+	t.Helper()
+	program, names, info := infer(t, input)
+	var out []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if v, ok := n.(*ast.Variable); ok && names.Defs[v] != nil {
+			out = append(out, fmt.Sprintf("%s: %s", v, info.TypeOf(v)))
+		}
+		return true
+	})
+	return out
+}
+
+// found describes diagnostics as code@offset.
+func found(diags []diagnostics.Diagnostic) string {
+	var out []string
+	for _, d := range diags {
+		out = append(out, fmt.Sprintf("%s@%d", d.Code, d.Span.Start))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestInfer(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			`my $i = 1; my $n = $i * 2.5; my $s = "n=" . $n; my $b = $i < $n;`,
+			[]string{"$i: Int", "$n: Num", "$s: Str", "$b: Bool"},
+		},
+		{
+			`my @a = (1, 2); my $count = @a; my ($first) = @a; my $last = $a[-1]; my $top = $#a;`,
+			[]string{"@a: Array[Int]", "$count: Int", "$first: Int", "$last: Int", "$top: Int"},
+		},
+		{
+			`my %h = (a => 1.5); my $v = $h{a}; my @k = keys %h; my @vs = values %h;`,
+			[]string{"%h: Hash[Num]", "$v: Num", "@k: Array[Str]", "@vs: Array[Num]"},
+		},
+		{
+			`my $r = { list => [1, 2] }; my $x = $r->{list}[0]; my @all = @{ $r->{list} };`,
+			[]string{"$r: HashRef[ArrayRef[Int]]", "$x: Int", "@all: Array[Int]"},
+		},
+		{
+			`my $r = [1]; my $x = ${$r}[0]; my @s = @{$r}[0, 1]; my $h = {a => "x"}; my $v = ${$h}{a};`,
+			[]string{"$r: ArrayRef[Int]", "$x: Int", "@s: Array[Int]", "$h: HashRef[Str]", "$v: Str"},
+		},
+		{
+			`my ($name, $n) = ("x", 1); my ($p, $q) = @_; $p + 1; $q->[0] + 1;`,
+			[]string{"$name: Str", "$n: Int", "$p: Num", "$q: ArrayRef[Num]"},
+		},
+		{
+			`my @w = map { $_ * 2 } 1, 2; my @s = sort { $a <=> $b } @w; for my $x (@w) { }`,
+			[]string{"@w: Array[Num]", "@s: Array[Num]", "$x: Num"},
+		},
+		{
+			`class P { field $x :param = 0; method moved($dx) { $x + $dx } method me { $self } }
+			 my $p = P->new(x => 1); my $m = $p->me->moved(2);`,
+			[]string{"$x: Int", "$dx: Num", "$p: P", "$m: Num"},
+		},
+		{
+			`use constant PI => 3.14159; my $area = PI * 2;`,
+			[]string{"$area: Num"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := declared(t, tt.input)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s:\nexpected\n\t%s\ngot\n\t%s", tt.input,
+				strings.Join(tt.expected, "\n\t"), strings.Join(got, "\n\t"))
+		}
+	}
+}
+
+func TestExpressionTypes(t *testing.T) {
+	program, _, info := infer(t, `my $r = [1]; $r->[0] + 1.5; "a" x 3; (1, 2) x 3; -bare; [$r];`)
+	expected := []string{"Num", "Str", "Array[Int]", "Str", "ArrayRef[ArrayRef[Int]]"}
+	for i, s := range program.Statements[1:] {
+		e := s.(*ast.ExpressionStatement).Expression
+		if got := info.TypeOf(e); got == nil || got.String() != expected[i] {
+			t.Errorf("%s: expected %s, got %v", e, expected[i], got)
+		}
+	}
+
+	// every expression has a type
+	ast.Inspect(program, func(n ast.Node) bool {
+		if e, ok := n.(ast.Expression); ok && info.TypeOf(e) == nil {
+			t.Errorf("%s has no type", e)
+		}
+		return true
+	})
+}
+
+func TestPolymorphism(t *testing.T) {
+	_, _, info := infer(t, `
+sub id($x) { $x }
+sub first($list) { $list->[0] }
+sub pair($k, $v = 0) { return { $k => $v } }
+sub count { my ($list) = @_; scalar @$list }
+sub fact($n) { $n <= 1 ? 1 : $n * fact($n - 1) }
+sub counter { $count }
+my $i = id(1);
+my $s = id("s");
+my $r = id([first([1.5])]);
+$count = "many";
+`)
+	tests := map[string]string{
+		"main::id":    "forall a. CodeRef[(a) -> a]",
+		"main::first": "forall a. CodeRef[(ArrayRef[a]) -> a]",
+		"main::pair":  "forall a. CodeRef[(a, Int?) -> HashRef[Int]]",
+		"main::count": "CodeRef[(...) -> Int]",
+		"main::fact":  "CodeRef[(Num) -> Num]",
+
+		// $count is a package variable, so counter isn't polymorphic
+		"main::counter": "CodeRef[(...) -> Str]",
+	}
+	for name, expected := range tests {
+		if s := info.Subs[name]; s == nil || s.String() != expected {
+			t.Errorf("%s: expected %s, got %v", name, expected, s)
+		}
+	}
+	if len(info.Diagnostics) > 0 {
+		t.Errorf("expected no diagnostics, got %v", info.Diagnostics)
+	}
+
+	expected := []string{"$i: Int", "$s: Str", "$r: ArrayRef[Num]"}
+	got := declared(t, `sub id($x) { $x } sub first($l) { $l->[0] } my $i = id(1); my $s = id("s"); my $r = id([first([1.5])]);`)
+	if strings.Join(got[2:], " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, got[2:])
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`my $x = 1; $x = "one";`, "E0400@16"},
+		{`my $n = "ten" + 1;`, "E0400@8"},
+		{`my $r = [1]; $r->{k};`, "E0400@13"},
+		{`my @a = (1, "a");`, "E0400@12"},
+		{`my $x; $x = [$x];`, "E0401@12"},
+		{`sub add($a, $b) { $a + $b } add(1); add(1, 2, 3); add(1, 2);`, "E0402@28 E0402@36"},
+		{`sub opt($a, $b = 1) { } opt(); opt(1); my @l; opt(@l);`, "E0402@24"},
+		{`sub f($n) { $n + 1 } f("x");`, "E0400@23"},
+		{`class C { method m($n) { $n * 2 } } C->new->m("x");`, "E0400@46"},
+		{`my $f; $f->(1); $f->(1, 2);`, "E0400@16"},
+		{`g(1); sub g($x) { }`, ""},
+		{`my $s = "a"; $s .= 1; my $t = $s x 2; my $i = 0; $i //= 1;`, ""},
+	}
+
+	for _, tt := range tests {
+		_, _, info := infer(t, tt.input)
+		if got := found(info.Diagnostics); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q (%v)", tt.input, tt.expected, got, info.Diagnostics)
+		}
+	}
+
+	_, _, info := infer(t, `sub add($a, $b) { $a + $b } add(1);`)
+	expected := "Too few arguments for subroutine 'main::add' (got 1; expected 2)"
+	if len(info.Diagnostics) != 1 || info.Diagnostics[0].Message != expected {
+		t.Errorf("expected %q, got %v", expected, info.Diagnostics)
+	}
+
+	_, _, info = infer(t, `my $x = 1; $x = "one";`)
+	d := info.Diagnostics[0]
+	if d.Message != "type mismatch: expected Int, found Str" || d.Label != "this is Str" ||
+		d.Span != (diagnostics.Span{Start: 16, End: 21}) {
+		t.Errorf("unexpected diagnostic %v at %v labelled %q", d, d.Span, d.Label)
+	}
+}
+
+// largeProgram generates n subs, each calling the one before, with
+// file-level variables holding their results.
+func largeProgram(n int) string {
+	var src strings.Builder
+	src.WriteString("sub f0($x, $y) { $x }\n")
+	for i := 1; i < n; i++ {
+		fmt.Fprintf(&src, `sub id%d($v) { $v }
+sub f%d($x, $y) {
+    my $a = $x + %d;
+    my @l = ($a, $y);
+    my $r = { k => [@l] };
+    return f%d($r->{k}[0], id%d($y));
+}
+my $v%d = f%d(%d, 1.5);
+my @p%d = (id%d("a"), id%d("b"));
+`, i, i, i, i-1, i, i, i, i, i, i, i)
+	}
+	return src.String()
+}
+
+func benchmarkInfer(b *testing.B, algorithm types.Algorithm) {
+	for _, n := range []int{100, 1000} {
+		program := parser.New(lexer.New([]byte(largeProgram(n)))).ParseProgram()
+		names := resolve.Resolve(program)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				types.InferWith(program, names, algorithm)
+			}
+		})
+	}
+}
+
+func BenchmarkInferW(b *testing.B) { benchmarkInfer(b, types.W) }
+
+func BenchmarkInferJ(b *testing.B) { benchmarkInfer(b, types.J) }
+
+func TestLargeProgram(t *testing.T) {
+	_, _, info := infer(t, largeProgram(50))
+	if len(info.Diagnostics) > 0 {
+		t.Errorf("expected no diagnostics, got %v", info.Diagnostics)
+	}
+	if s := info.Subs["main::f49"].String(); s != "CodeRef[(Num, Num) -> Num]" {
+		t.Errorf("unexpected type %s", s)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	got := declared(t, `my Int $x; my Str @names; my HashRef[ArrayRef[Num]] $h; my Point $p; my $y = $x;`)
+	expected := []string{"$x: Int", "@names: Array[Str]", "$h: HashRef[ArrayRef[Num]]", "$p: Point", "$y: Int"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	_, _, info := infer(t, `sub f(Str $s, $n) :returns(Num) { $n } sub g(Any $x) { $x }`)
+	if s := info.Subs["main::f"].String(); s != "CodeRef[(Str, Num) -> Num]" {
+		t.Errorf("unexpected type %s", s)
+	}
+	if s := info.Subs["main::g"].String(); s != "CodeRef[(Any) -> Any]" {
+		t.Errorf("unexpected type %s", s)
+	}
+}
+
+// check describes the diagnostics of gradually checking input.
+func check(t *testing.T, input string) string {
+	t.Helper()
+	p := parser.New(lexer.New([]byte(input)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser has %d errors: %v", len(errors), errors)
+	}
+	return found(types.Check(program, resolve.Resolve(program)))
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// without annotations only the number of arguments is checked
+		{`my $x = 1; $x = "one"; my @a = (1, "a"); my $r = [1]; $r->{k};`, ""},
+		{`sub f($n) { $n + 1 } f("x"); f(1, 2);`, "E0402@29"},
+		{`my $n = "ten" + 1; my $s = $n ? "yes" : 0; my $t = $s || 1; -"x"; abs("y");`, ""},
+		{`my Int $x = $c ? 1 : "one"; my Str $s = $c ? "a" : "b";`, "E0400@21"},
+		{`my Int $x = "10" + 1; my Str $s = 1 + 2;`, "E0400@34"},
+		{`print @{"y"}; my $n = %{"h"}; print ${"z"}[0];`, ""},
+
+		{`my Int $x = 1.5;`, "E0400@12"},
+		{`my Int $i = 1; my Num $n = $i; my Int $j = $n;`, "E0400@43"},
+		{`my Num @a = (1, 1.5); my Int $x = $c ? 1 : 1.5; my Bool $b = 1;`, "E0400@43 E0400@61"},
+
+		{`my Int $x = 5; $x = "five";`, "E0400@20"},
+		{`my Str $s = 1.5;`, "E0400@12"},
+		{`my Int $x = undef; my Any $y = "y"; $y = [];`, ""},
+		{`my ArrayRef[Int] $r = [1, "two"];`, "E0400@26"},
+		{`my HashRef[Str] $h = { a => 1 };`, "E0400@28"},
+		{`my ArrayRef[Int] $r = [1]; my Str $s = ${$r}[0];`, "E0400@39"},
+		{`my ArrayRef[Int] $r = [1]; my Str $s = $$r[0];`, "E0400@39"},
+		{`my ArrayRef[Int] $r = [1]; my Str $s = $r->[0];`, "E0400@39"},
+		{`my Int @a = (1, 2, "c"); push @a, "d";`, "E0400@19 E0400@34"},
+		{`my Int ($a, $b) = (1, "b");`, "E0400@12"},
+		{`for my Str $s (1, 2) { }`, "E0400@15 E0400@18"},
+		{`sub add(Int $a, Int $b) :returns(Int) { $a + $b } my Str $s = add(1, 2); add("x", 2);`, "E0400@62 E0400@77"},
+		{`sub name($who) :returns(Str) { return 42 }`, "E0400@38"},
+		{`class P { field Int $x :param = "a"; method x :returns(Int) { $x } } my Str $s = P->new->x;`, "E0400@32 E0400@81"},
+		{`my Point $p = Point->new; my Line $l = Point->new;`, "E0400@39"},
+		{`my Foo[Int] $x; my ArrayRef[Int, Str] $y; sub f :returns(Int[Str]) { }`, "E0403@3 E0403@19 E0403@48"},
+	}
+
+	for _, tt := range tests {
+		if got := check(t, tt.input); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package types infers static types for perl programs with
+// Hindley-Milner type inference.
+//
+// Perl is dynamically typed, so the types are a model of how values are
+// used rather than something perl enforces. Scalars have the subtypes
+// Int, Num, Str, Bool and Undef; references are ArrayRef[T], HashRef[T]
+// and CodeRef signatures; and @x and %x hold an Array[T] or Hash[T].
+// Every element of an array or value of a hash has the same type. Perl
+// converts between the numeric subtypes freely, so a Bool may be used
+// where an Int or Num is expected and an Int where a Num is, though a
+// Num is not an Int; and undef unifies with anything, as every variable
+// may be undefined. A string is not a number.
+//
+// Variables, fields and signature parameters may be annotated with the
+// type they hold, as in my Int $x, and a sub with the type it returns,
+// as in :returns(Str). Infer takes annotations as given and infers the
+// rest; Check treats what has no annotation as Any, so that only
+// annotated code is checked.
+//
+// Infer uses Algorithm W, which keeps what it learns in a substitution;
+// InferWith can use Algorithm J instead, which updates type variables in
+// place and scales better to large programs.
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is a type: a variable, a constructor such as Int or
+// ArrayRef[Str], or the signature of a sub.
+type Type interface {
+	String() string
+	typeNode()
+}
+
+// Var is a type variable, which stands for a type not known yet.
+type Var struct {
+	ID int
+
+	// Algorithm J binds a variable in place, and generalises it by the
+	// depth of the sub it belongs to
+	instance Type
+	level    int
+}
+
+func (v *Var) typeNode() {}
+
+func (v *Var) String() string { return fmt.Sprintf("t%d", v.ID) }
+
+// Con is a type constructor applied to its arguments: Int has none,
+// ArrayRef[Str] has one. An object's type is a Con named for its class.
+type Con struct {
+	Name string
+	Args []Type
+}
+
+func (c *Con) typeNode() {}
+
+func (c *Con) String() string { return rename(c, (*Var).String) }
+
+// Func is the type of a sub: a CodeRef taking Params and returning
+// Return. The last Optional parameters have defaults. A Variadic sub,
+// one with a slurpy parameter or no signature, takes any number of
+// arguments after Params.
+type Func struct {
+	Params   []Type
+	Optional int
+	Variadic bool
+	Return   Type
+}
+
+func (f *Func) typeNode() {}
+
+func (f *Func) String() string { return rename(f, (*Var).String) }
+
+// The scalar types.
+var (
+	Int   Type = &Con{Name: "Int"}
+	Num   Type = &Con{Name: "Num"}
+	Str   Type = &Con{Name: "Str"}
+	Bool  Type = &Con{Name: "Bool"}
+	Undef Type = &Con{Name: "Undef"}
+
+	// Any is a value nothing is known about, which may be used as any
+	// type. Under gradual typing, what has no annotation is Any.
+	Any Type = &Con{Name: "Any"}
+)
+
+// ArrayRef returns the type of a reference to an array of elem.
+func ArrayRef(elem Type) Type { return &Con{Name: "ArrayRef", Args: []Type{elem}} }
+
+// HashRef returns the type of a reference to a hash of elem.
+func HashRef(elem Type) Type { return &Con{Name: "HashRef", Args: []Type{elem}} }
+
+// Array returns the type of an array or list of elem.
+func Array(elem Type) Type { return &Con{Name: "Array", Args: []Type{elem}} }
+
+// Hash returns the type of a hash of elem.
+func Hash(elem Type) Type { return &Con{Name: "Hash", Args: []Type{elem}} }
+
+// Object returns the type of an instance of class.
+func Object(class string) Type { return &Con{Name: class} }
+
+// numeric ranks the scalar types perl converts between without fuss: a
+// value of one may be used where a wider one is expected, as an Int
+// where a Num is, but not the other way round.
+var numeric = map[string]int{"Bool": 1, "Int": 2, "Num": 3}
+
+// Scheme is a polymorphic type: Type for any types substituted for its
+// Vars. A sub's type is a scheme, so a sub that works on any type can be
+// called with each.
+type Scheme struct {
+	Vars []*Var
+	Type Type
+}
+
+// String names the bound variables a, b, c, ... in the order they
+// appear in the type.
+func (s *Scheme) String() string {
+	if len(s.Vars) == 0 {
+		return s.Type.String()
+	}
+	names := make(map[int]string)
+	for _, v := range s.Vars {
+		names[v.ID] = ""
+	}
+	var order []string
+	t := rename(s.Type, func(v *Var) string {
+		name, ok := names[v.ID]
+		if !ok {
+			return v.String()
+		}
+		if name == "" {
+			name = varName(len(order))
+			names[v.ID] = name
+			order = append(order, name)
+		}
+		return name
+	})
+	return "forall " + strings.Join(order, " ") + ". " + t
+}
+
+func varName(i int) string {
+	name := string(rune('a' + i%26))
+	if i >= 26 {
+		name += fmt.Sprint(i / 26)
+	}
+	return name
+}
+
+// rename renders t with each variable named by name.
+func rename(t Type, name func(*Var) string) string {
+	switch t := t.(type) {
+	case *Var:
+		return name(t)
+	case *Con:
+		if len(t.Args) == 0 {
+			return t.Name
+		}
+		args := make([]string, len(t.Args))
+		for i, a := range t.Args {
+			args[i] = rename(a, name)
+		}
+		return t.Name + "[" + strings.Join(args, ", ") + "]"
+	case *Func:
+		params := make([]string, len(t.Params), len(t.Params)+1)
+		for i, p := range t.Params {
+			params[i] = rename(p, name)
+			if i >= len(t.Params)-t.Optional {
+				params[i] += "?"
+			}
+		}
+		if t.Variadic {
+			params = append(params, "...")
+		}
+		return "CodeRef[(" + strings.Join(params, ", ") + ") -> " + rename(t.Return, name) + "]"
+	}
+	return "?"
+}
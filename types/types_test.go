@@ -0,0 +1,76 @@
+package types_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/perigrin/simian/types"
+)
+
+func TestString(t *testing.T) {
+	a, b := &types.Var{ID: 1}, &types.Var{ID: 2}
+	tests := []struct {
+		typ      fmt.Stringer
+		expected string
+	}{
+		{types.Int, "Int"},
+		{types.HashRef(types.ArrayRef(types.Str)), "HashRef[ArrayRef[Str]]"},
+		{&types.Func{Params: []types.Type{types.Int, types.Str}, Optional: 1, Return: a}, "CodeRef[(Int, Str?) -> t1]"},
+		{&types.Func{Params: []types.Type{a}, Variadic: true, Return: types.Bool}, "CodeRef[(t1, ...) -> Bool]"},
+		{&types.Scheme{Vars: []*types.Var{a, b}, Type: &types.Func{Params: []types.Type{b, types.Array(a)}, Return: a}},
+			"forall a b. CodeRef[(a, Array[b]) -> b]"},
+		{&types.Scheme{Type: types.Object("Point")}, "Point"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.typ.String(); got != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestUnify(t *testing.T) {
+	a, b := &types.Var{ID: 1}, &types.Var{ID: 2}
+	tests := []struct {
+		expected, found types.Type
+		err             string
+	}{
+		{types.Int, types.Int, ""},
+		{types.Num, types.Int, ""},
+		{types.Num, types.Bool, ""},
+		{types.Int, types.Num, "expected Int, found Num"},
+		{types.Str, types.Undef, ""},
+		{types.ArrayRef(types.Int), types.Undef, ""},
+		{types.Int, types.Str, "expected Int, found Str"},
+		{types.ArrayRef(a), types.ArrayRef(types.Str), ""},
+		{types.ArrayRef(a), types.HashRef(a), "expected ArrayRef[t1], found HashRef[t1]"},
+		{a, types.ArrayRef(a), "t1 occurs in ArrayRef[t1], which would make it infinite"},
+		{&types.Func{Params: []types.Type{a}, Return: a}, &types.Func{Params: []types.Type{types.Int}, Return: b}, ""},
+		{&types.Func{Params: []types.Type{a}, Return: a}, &types.Func{Params: []types.Type{a, b}, Return: a},
+			"expected CodeRef[(t1) -> t1], found CodeRef[(t1, t2) -> t1]"},
+		{&types.Func{Variadic: true, Return: a}, &types.Func{Params: []types.Type{a, b}, Return: a}, ""},
+	}
+
+	for _, tt := range tests {
+		err := make(types.Subst).Unify(tt.expected, tt.found)
+		if got := errString(err); got != tt.err {
+			t.Errorf("unify %s with %s: expected %q, got %q", tt.expected, tt.found, tt.err, got)
+		}
+	}
+
+	s := make(types.Subst)
+	f := &types.Func{Params: []types.Type{a}, Return: b}
+	if err := s.Unify(f, &types.Func{Params: []types.Type{types.Int}, Return: types.ArrayRef(a)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Apply(f).String(); got != "CodeRef[(Int) -> ArrayRef[Int]]" {
+		t.Errorf("expected the substitution to bind both variables, got %s", got)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
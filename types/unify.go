@@ -0,0 +1,229 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MismatchError is a failure to unify two types: where a value of
+// Expected was needed, one of Found was given.
+type MismatchError struct {
+	Expected, Found Type
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("expected %s, found %s", e.Expected, e.Found)
+}
+
+// InfiniteError is a failure to unify a variable with a type that
+// contains it, which would make the type infinite.
+type InfiniteError struct {
+	Var  *Var
+	Type Type
+}
+
+func (e *InfiniteError) Error() string {
+	return fmt.Sprintf("%s occurs in %s, which would make it infinite", e.Var, e.Type)
+}
+
+// solver is how inference binds type variables. Algorithm W keeps the
+// bindings in a Subst; Algorithm J keeps each in its variable.
+type solver interface {
+	// resolve follows the bindings of t until it is not a bound
+	// variable.
+	resolve(t Type) Type
+
+	// bind binds v to t, which is not v itself. It reports an
+	// InfiniteError if v occurs in t.
+	bind(v *Var, t Type) error
+
+	// generalize returns the scheme for t, polymorphic in the variables
+	// created deeper than level that env, which adds the variables the
+	// enclosing scopes use to a set, doesn't hold.
+	generalize(t Type, level int, env func(map[int]*Var)) *Scheme
+}
+
+// unify binds variables with s so that expected and found are the same
+// type, or returns a MismatchError or InfiniteError saying why they
+// can't be. A numeric type unifies with a wider one expected, and Undef
+// and Any unify with anything.
+func unify(s solver, expected, found Type) error {
+	expected, found = s.resolve(expected), s.resolve(found)
+
+	if v, ok := expected.(*Var); ok {
+		return bindVar(s, v, found)
+	}
+	if v, ok := found.(*Var); ok {
+		return bindVar(s, v, expected)
+	}
+	if expected == Undef || found == Undef || expected == Any || found == Any {
+		return nil
+	}
+
+	switch e := expected.(type) {
+	case *Con:
+		if f, ok := found.(*Con); ok {
+			if numeric[f.Name] > 0 && numeric[f.Name] <= numeric[e.Name] {
+				return nil
+			}
+			if e.Name != f.Name || len(e.Args) != len(f.Args) {
+				return &MismatchError{Expected: apply(s, expected), Found: apply(s, found)}
+			}
+			for i := range e.Args {
+				if err := unify(s, e.Args[i], f.Args[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+	case *Func:
+		if f, ok := found.(*Func); ok {
+			if !e.Variadic && !f.Variadic && len(e.Params) != len(f.Params) {
+				return &MismatchError{Expected: apply(s, expected), Found: apply(s, found)}
+			}
+			for i := 0; i < len(e.Params) && i < len(f.Params); i++ {
+				if err := unify(s, e.Params[i], f.Params[i]); err != nil {
+					return err
+				}
+			}
+			return unify(s, e.Return, f.Return)
+		}
+	}
+	return &MismatchError{Expected: apply(s, expected), Found: apply(s, found)}
+}
+
+// bindVar binds v to t unless t is v or Undef, which says nothing more
+// about the type since any variable may hold undef.
+func bindVar(s solver, v *Var, t Type) error {
+	if w, ok := t.(*Var); ok && w == v {
+		return nil
+	}
+	if t == Undef {
+		return nil
+	}
+	return s.bind(v, t)
+}
+
+// apply returns t with every bound variable replaced by its binding.
+func apply(s solver, t Type) Type {
+	switch t := s.resolve(t).(type) {
+	case *Con:
+		if len(t.Args) == 0 {
+			return t
+		}
+		args := make([]Type, len(t.Args))
+		for i, a := range t.Args {
+			args[i] = apply(s, a)
+		}
+		return &Con{Name: t.Name, Args: args}
+	case *Func:
+		params := make([]Type, len(t.Params))
+		for i, p := range t.Params {
+			params[i] = apply(s, p)
+		}
+		return &Func{Params: params, Optional: t.Optional, Variadic: t.Variadic, Return: apply(s, t.Return)}
+	default:
+		return t
+	}
+}
+
+// freeVars adds the unbound variables in t to free.
+func freeVars(s solver, t Type, free map[int]*Var) {
+	switch t := s.resolve(t).(type) {
+	case *Var:
+		free[t.ID] = t
+	case *Con:
+		for _, a := range t.Args {
+			freeVars(s, a, free)
+		}
+	case *Func:
+		for _, p := range t.Params {
+			freeVars(s, p, free)
+		}
+		freeVars(s, t.Return, free)
+	}
+}
+
+// newScheme returns the scheme for t bound over vars, in the order they
+// were created so that instances are numbered the same way each time.
+func newScheme(t Type, vars []*Var) *Scheme {
+	sort.Slice(vars, func(i, j int) bool { return vars[i].ID < vars[j].ID })
+	return &Scheme{Vars: vars, Type: t}
+}
+
+// Subst is a substitution: the type bound to each type variable, by
+// ID. It is how Algorithm W solves types: unification extends it, and
+// applying it to a type replaces the variables it binds.
+type Subst map[int]Type
+
+// Unify extends s so that expected and found are the same type, or
+// returns a MismatchError or InfiniteError saying why they can't be.
+func (s Subst) Unify(expected, found Type) error {
+	return unify(s, expected, found)
+}
+
+// Apply returns t with every variable s binds replaced by its binding.
+func (s Subst) Apply(t Type) Type {
+	return apply(s, t)
+}
+
+func (s Subst) resolve(t Type) Type {
+	for {
+		v, ok := t.(*Var)
+		if !ok {
+			return t
+		}
+		bound, ok := s[v.ID]
+		if !ok {
+			return t
+		}
+		t = bound
+	}
+}
+
+func (s Subst) bind(v *Var, t Type) error {
+	if s.occurs(v, t) {
+		return &InfiniteError{Var: v, Type: s.Apply(t)}
+	}
+	s[v.ID] = t
+	return nil
+}
+
+func (s Subst) occurs(v *Var, t Type) bool {
+	switch t := s.resolve(t).(type) {
+	case *Var:
+		return t == v
+	case *Con:
+		for _, a := range t.Args {
+			if s.occurs(v, a) {
+				return true
+			}
+		}
+	case *Func:
+		for _, p := range t.Params {
+			if s.occurs(v, p) {
+				return true
+			}
+		}
+		return s.occurs(v, t.Return)
+	}
+	return false
+}
+
+// generalize binds the variables free in t but not in env, applying s
+// to the types in env, as W does at each sub.
+func (s Subst) generalize(t Type, _ int, env func(map[int]*Var)) *Scheme {
+	used := make(map[int]*Var)
+	env(used)
+	t = s.Apply(t)
+	free := make(map[int]*Var)
+	freeVars(s, t, free)
+	var vars []*Var
+	for id, v := range free {
+		if used[id] == nil {
+			vars = append(vars, v)
+		}
+	}
+	return newScheme(t, vars)
+}
@@ -0,0 +1,66 @@
+package types
+
+// unionFind is how Algorithm J solves types: a variable is bound by
+// pointing it at its type, so finding a binding needs no lookup and
+// nothing has to be applied to the environment. Each variable records
+// the depth of the sub it was created in, lowered to the depth of any
+// variable it is bound into, so the variables to generalise at a sub are
+// those still deeper than it.
+type unionFind struct{}
+
+func (u unionFind) resolve(t Type) Type {
+	v, ok := t.(*Var)
+	if !ok || v.instance == nil {
+		return t
+	}
+	// path compression: point v straight at the end of the chain
+	v.instance = u.resolve(v.instance)
+	return v.instance
+}
+
+func (u unionFind) bind(v *Var, t Type) error {
+	if u.occurs(v, t) {
+		return &InfiniteError{Var: v, Type: apply(u, t)}
+	}
+	v.instance = t
+	return nil
+}
+
+// occurs reports whether v appears in t, and lowers the level of every
+// variable in t to v's, since binding v makes them as visible as it.
+func (u unionFind) occurs(v *Var, t Type) bool {
+	switch t := u.resolve(t).(type) {
+	case *Var:
+		if t == v {
+			return true
+		}
+		t.level = min(t.level, v.level)
+	case *Con:
+		for _, a := range t.Args {
+			if u.occurs(v, a) {
+				return true
+			}
+		}
+	case *Func:
+		for _, p := range t.Params {
+			if u.occurs(v, p) {
+				return true
+			}
+		}
+		return u.occurs(v, t.Return)
+	}
+	return false
+}
+
+func (u unionFind) generalize(t Type, level int, _ func(map[int]*Var)) *Scheme {
+	t = apply(u, t)
+	free := make(map[int]*Var)
+	freeVars(u, t, free)
+	var vars []*Var
+	for _, v := range free {
+		if v.level > level {
+			vars = append(vars, v)
+		}
+	}
+	return newScheme(t, vars)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/perigrin/simian/ast"
+	"github.com/perigrin/simian/callgraph"
+	"github.com/perigrin/simian/diagnostics"
+	"github.com/perigrin/simian/lexer"
+	"github.com/perigrin/simian/parser"
+	"github.com/perigrin/simian/resolve"
+)
+
+// xrefCommand implements `simian xref [--dot] [--name=NAME] [file]`. It
+// parses file, or standard input when no file is given, and writes to
+// stdout where each sub, method and variable is defined and used, or
+// only those called NAME. With --dot it writes the call graph as
+// Graphviz DOT instead. Parse errors go to stderr; the exit status is 1
+// if there are any, and 2 for a usage problem.
+func xrefCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("xref", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dot := flags.Bool("dot", false, "write the call graph as Graphviz DOT")
+	name := flags.String("name", "", "only list the subs, methods and variables with this name")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: simian xref [--dot] [--name=NAME] [file]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	filename, src, err := readSource(flags, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "simian xref: %v\n", err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	diags := p.Errors()
+	graph := callgraph.Build(program, resolve.Resolve(program))
+
+	if *dot {
+		err = graph.WriteDOT(stdout)
+	} else {
+		entries := graph.Index.Entries
+		if *name != "" {
+			entries = graph.Index.Lookup(*name)
+		}
+		err = writeXref(stdout, filename, src, entries)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "simian xref: %v\n", err)
+		return 1
+	}
+
+	diagnostics.Render(stderr, filename, src, diags...)
+	if diagnostics.HasErrors(diags) {
+		return 1
+	}
+	return 0
+}
+
+// writeXref lists each entry with the places it is defined and used:
+//
+//	sub main::greet
+//	  defined at greet.pl:1:5
+//	  used at greet.pl:4:1
+func writeXref(w io.Writer, filename string, src []byte, entries []*callgraph.Entry) error {
+	b := bufio.NewWriter(w)
+	for _, e := range entries {
+		fmt.Fprintf(b, "%s %s\n", e.Kind, e.Name)
+		for _, list := range []struct {
+			what  string
+			nodes []ast.Node
+		}{{"defined", e.Defs}, {"used", e.Uses}} {
+			for _, n := range list.nodes {
+				line, column := diagnostics.Position(src, ast.SpanOf(n).Start)
+				fmt.Fprintf(b, "  %s at %s:%d:%d\n", list.what, filename, line, column)
+			}
+		}
+	}
+	return b.Flush()
+}